@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GetAccountDeletion handles the GET /users/{id}/deletion request
+func GetAccountDeletion(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	deletion, err := models.GetAccountDeletion(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "No deletion requested for this user")
+	}
+
+	return deletion, nil
+}
+
+// CancelAccountDeletion handles the POST /users/{id}/deletion/cancel request.
+// The user confirms with their password and the account is reactivated.
+func CancelAccountDeletion(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := confirmPassword(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if err := models.CancelAccountDeletion(ctx.DB(), id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, gofr.NewError(http.StatusNotFound, "No pending deletion for this user")
+		}
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to cancel deletion: "+err.Error())
+	}
+
+	user, err := models.GetUser(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Deletion cancelled but failed to retrieve user")
+	}
+
+	return user, nil
+}
+
+// confirmPassword checks the password in the request body against the
+// user's, including a deactivated user's
+func confirmPassword(ctx *gofr.Context, userID int) error {
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	if req.Password == "" {
+		return gofr.NewError(http.StatusBadRequest, "Password is required")
+	}
+
+	hash, err := models.GetUserPassword(ctx.DB(), userID)
+	if err != nil {
+		return gofr.NewError(http.StatusNotFound, "User not found")
+	}
+	if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		return gofr.NewError(http.StatusForbidden, "Incorrect password")
+	}
+	return nil
+}
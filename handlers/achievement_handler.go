@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetAchievements handles the GET /achievements request, listing every
+// achievement users can earn
+func GetAchievements(ctx *gofr.Context) (interface{}, error) {
+	achievements, err := models.GetAchievements(ctx.DB())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch achievements: "+err.Error())
+	}
+	return achievements, nil
+}
+
+// CreateAchievement handles the POST /achievements request. Tonnage
+// thresholds are in kilograms unless a unit is given. Users whose past
+// training already earns the new achievement are awarded it in the
+// background.
+func CreateAchievement(ctx *gofr.Context) (interface{}, error) {
+	var req struct {
+		models.Achievement
+		Unit string `json:"unit"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	achievement := req.Achievement
+	if err := achievement.Validate(); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+	if req.Unit != "" {
+		if achievement.Metric != models.MetricTonnage || !models.IsValidWeightUnit(req.Unit) {
+			return nil, gofr.NewError(http.StatusBadRequest, "A unit can only be given for tonnage, as kg or lb")
+		}
+		achievement.Threshold = models.Units{Weight: req.Unit}.WeightToKg(achievement.Threshold)
+	}
+
+	if _, err := models.GetAchievementByCode(ctx.DB(), achievement.Code); err == nil {
+		return nil, gofr.NewError(http.StatusConflict, "An achievement with this code already exists")
+	}
+
+	id, err := models.CreateAchievement(ctx.DB(), achievement)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create achievement: "+err.Error())
+	}
+
+	created, err := models.GetAchievement(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Achievement created but failed to retrieve")
+	}
+	return created, nil
+}
+
+// GetUserAchievements handles the GET /users/{userId}/achievements request,
+// giving the user's weekly streak, the achievements they have earned with
+// the dates they earned them, and how close they are to the others
+func GetUserAchievements(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := models.GetAchievementSummary(ctx.DB(), userID, prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch achievements: "+err.Error())
+	}
+	return summary.InUnits(units), nil
+}
+
+// awardAchievements awards the user anything their training has newly
+// earned, returned in units for a response
+func awardAchievements(ctx *gofr.Context, userID int, units models.Units, prefs models.Preferences) ([]models.EarnedAchievement, error) {
+	awarded, err := models.AwardAchievements(ctx.DB(), userID, prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to check achievements: "+err.Error())
+	}
+
+	newAchievements := make([]models.EarnedAchievement, 0, len(awarded))
+	for _, a := range awarded {
+		a.Achievement = a.Achievement.InUnits(units)
+		newAchievements = append(newAchievements, a)
+	}
+	return newAchievements, nil
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// UploadActivity handles the POST /users/{userId}/activities request. The
+// FIT, GPX or TCX file is uploaded as multipart form data under file, and
+// is logged as a session of its own with a progress entry for the
+// activity. exercise_id and workout_id choose what it is logged against;
+// by default that is the cardio exercise for the recorded sport, under a
+// workout of the same name. name overrides the activity's name.
+func UploadActivity(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave room for the form fields around the file
+	req := ctx.Request()
+	req.Body = http.MaxBytesReader(ctx.ResponseWriter(), req.Body, models.MaxActivitySize+1<<20)
+	if err := req.ParseMultipartForm(8 << 20); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid upload; send the file as multipart form data under 16 MB")
+	}
+
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "An activity file is required")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxActivitySize+1))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read the activity file")
+	}
+	if len(data) > models.MaxActivitySize {
+		return nil, gofr.NewError(http.StatusRequestEntityTooLarge, "Activity files are limited to 16 MB")
+	}
+
+	activity, samples, err := models.ParseActivityFile(data, header.Filename)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read activity: "+err.Error())
+	}
+
+	if err := checkDuplicateActivity(ctx, userID, activity); err != nil {
+		return nil, err
+	}
+
+	// Pick the exercise and workout the activity is logged against
+	var exercise models.Exercise
+	if idStr := req.FormValue("exercise_id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
+		}
+		exercise, err = models.GetExercise(ctx.DB(), id)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
+		}
+		if exercise.TrackingType != models.TrackingDistanceDuration && exercise.TrackingType != models.TrackingDuration {
+			return nil, gofr.NewError(http.StatusBadRequest, "Activities can only be logged against distance or duration exercises")
+		}
+	} else {
+		exercise, err = models.CardioExercise(ctx.DB(), activity.Sport)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to find a cardio exercise: "+err.Error())
+		}
+	}
+
+	var workoutID int
+	if idStr := req.FormValue("workout_id"); idStr != "" {
+		workoutID, err = strconv.Atoi(idStr)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+		}
+		workout, err := models.GetWorkout(ctx.DB(), workoutID)
+		if err != nil || workout.UserID != userID {
+			return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
+		}
+	} else {
+		workoutID, err = models.ActivityWorkout(ctx.DB(), userID, exercise)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create workout: "+err.Error())
+		}
+	}
+
+	if name := req.FormValue("name"); name != "" {
+		activity.Name = name
+	}
+	if activity.Name == "" {
+		activity.Name = exercise.Name
+	}
+
+	// The activity is logged on the day it started in the user's time zone
+	local := activity.StartedAt.In(prefs.Location())
+	progress := models.Progress{
+		UserID:     userID,
+		WorkoutID:  workoutID,
+		ExerciseID: exercise.ID,
+		Sets:       1,
+		Duration:   activity.Duration,
+		Distance:   activity.Distance,
+		Notes:      activity.Name,
+		Date:       time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC),
+	}
+	measurements, err := models.NormalizeMeasurements(exercise.TrackingType, progress.Measurements())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "The activity can't be logged: "+err.Error())
+	}
+	progress.SetMeasurements(measurements)
+
+	activity, err = models.SaveActivity(ctx.DB(), activity, samples, progress)
+	if err != nil {
+		// A concurrent upload of the same file loses on the unique key
+		if err := checkDuplicateActivity(ctx, userID, activity); err != nil {
+			return nil, err
+		}
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to save activity: "+err.Error())
+	}
+
+	// Mark the program day this workout was planned for as done
+	if err := models.CompleteProgramSessions(ctx.DB(), userID, progress.WorkoutID, progress.Date, activity.SessionID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Activity saved but failed to update program: "+err.Error())
+	}
+
+	// Check the entry against the user's personal records and keep the
+	// analytics rollups from its day on up to date
+	progress.ID = activity.ProgressID
+	progress.SessionID = activity.SessionID
+	progress.TrackingType = exercise.TrackingType
+	records, err := models.DetectRecords(ctx.DB(), progress, prefs.E1RMFormula)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Activity saved but failed to check records: "+err.Error())
+	}
+	if err := models.RefreshExerciseRollups(ctx.DB(), userID, progress.ExerciseID, progress.Date, prefs.E1RMFormula); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Activity saved but failed to update analytics: "+err.Error())
+	}
+
+	newRecords := make([]models.PersonalRecord, 0, len(records))
+	for _, record := range records {
+		newRecords = append(newRecords, record.InUnits(units))
+	}
+
+	newAchievements, err := awardAchievements(ctx, userID, units, prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"activity":         activity.InUnits(units),
+		"message":          "Activity uploaded successfully",
+		"new_records":      newRecords,
+		"new_achievements": newAchievements,
+	}, nil
+}
+
+// checkDuplicateActivity fails with a conflict if the user already uploaded
+// the activity
+func checkDuplicateActivity(ctx *gofr.Context, userID int, activity models.Activity) error {
+	existing, err := models.FindDuplicateActivity(ctx.DB(), userID, activity)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return gofr.NewError(http.StatusInternalServerError, "Failed to check for duplicates: "+err.Error())
+	}
+	return gofr.NewError(http.StatusConflict, "This activity was already uploaded as activity "+strconv.Itoa(existing.ID))
+}
+
+// GetUserActivities handles the GET /users/{userId}/activities request,
+// optionally limited to activities started between from and to
+func GetUserActivities(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	units, _, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	activities, err := models.GetUserActivities(ctx.DB(), userID, from, to)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch activities: "+err.Error())
+	}
+
+	response := make([]models.Activity, 0, len(activities))
+	for _, activity := range activities {
+		response = append(response, activity.InUnits(units))
+	}
+	return response, nil
+}
+
+// GetActivity handles the GET /users/{userId}/activities/{id} request
+func GetActivity(ctx *gofr.Context) (interface{}, error) {
+	activity, units, err := userActivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return activity.InUnits(units), nil
+}
+
+// GetActivitySamples handles the GET /users/{userId}/activities/{id}/samples
+// request, returning the recorded time series for charting. points limits
+// the response to that many evenly spaced samples.
+func GetActivitySamples(ctx *gofr.Context) (interface{}, error) {
+	activity, units, err := userActivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := intQueryParam(ctx, "points")
+	if err != nil {
+		return nil, err
+	}
+	if points < 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "points cannot be negative")
+	}
+
+	samples, err := models.GetActivitySamples(ctx.DB(), activity.ID, activity.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch samples: "+err.Error())
+	}
+
+	return models.NewActivitySeries(samples, units, points), nil
+}
+
+// DeleteActivity handles the DELETE /users/{userId}/activities/{id} request.
+// The activity and its samples are removed and its progress entry is moved
+// to the trash, after which the file can be uploaded again.
+func DeleteActivity(ctx *gofr.Context) (interface{}, error) {
+	activity, _, err := userActivity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActiveUser(ctx, activity.UserID); err != nil {
+		return nil, err
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), activity.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	if err := models.DeleteActivity(ctx.DB(), activity.ID, activity.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete activity: "+err.Error())
+	}
+
+	if activity.ProgressID != 0 {
+		progress, err := models.GetProgress(ctx.DB(), activity.ProgressID, activity.UserID)
+		if err == nil {
+			if err := models.DeleteProgress(ctx.DB(), progress.ID, progress.UserID); err != nil {
+				return nil, gofr.NewError(http.StatusInternalServerError, "Activity deleted but failed to delete its progress: "+err.Error())
+			}
+			if err := refreshDerivedProgress(ctx, prefs, progress); err != nil {
+				return nil, err
+			}
+		} else if err != sql.ErrNoRows {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Activity deleted but failed to fetch its progress: "+err.Error())
+		}
+	}
+
+	return map[string]string{"message": "Activity deleted successfully"}, nil
+}
+
+// userActivity resolves the {id} activity of the {userId} user, with the
+// units of the request
+func userActivity(ctx *gofr.Context) (models.Activity, models.Units, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return models.Activity{}, models.Units{}, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Activity{}, models.Units{}, gofr.NewError(http.StatusBadRequest, "Invalid activity ID")
+	}
+
+	units, _, err := requestUnits(ctx, userID)
+	if err != nil {
+		return models.Activity{}, models.Units{}, err
+	}
+
+	activity, err := models.GetActivity(ctx.DB(), id, userID)
+	if err != nil {
+		return activity, units, gofr.NewError(http.StatusNotFound, "Activity not found")
+	}
+	return activity, units, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// defaultBuckets is how many buckets are returned when no from date is given
+const defaultBuckets = 12
+
+// GetUserAnalytics handles the GET /users/{userId}/analytics request
+func GetUserAnalytics(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := ctx.QueryParam("bucket")
+	if bucket == "" {
+		bucket = models.BucketWeek
+	}
+	if !models.IsValidBucket(bucket) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Bucket must be day, week or month")
+	}
+
+	var filter models.AnalyticsFilter
+	if filter.From, err = dateQueryParam(ctx, "from"); err != nil {
+		return nil, err
+	}
+	if filter.To, err = dateQueryParam(ctx, "to"); err != nil {
+		return nil, err
+	}
+	if filter.ExerciseID, err = intQueryParam(ctx, "exercise_id"); err != nil {
+		return nil, err
+	}
+	if filter.WorkoutID, err = intQueryParam(ctx, "workout_id"); err != nil {
+		return nil, err
+	}
+	filter.MuscleGroup = ctx.QueryParam("muscle_group")
+
+	// Default to the last few buckets up to today in the user's time zone
+	if filter.To.IsZero() {
+		filter.To = prefs.Today()
+	}
+	if filter.From.IsZero() {
+		filter.From = models.BucketStart(bucket, filter.To, prefs.WeekStart())
+		switch bucket {
+		case models.BucketDay:
+			filter.From = filter.From.AddDate(0, 0, -(defaultBuckets - 1))
+		case models.BucketWeek:
+			filter.From = filter.From.AddDate(0, 0, -7*(defaultBuckets-1))
+		case models.BucketMonth:
+			filter.From = filter.From.AddDate(0, -(defaultBuckets - 1), 0)
+		}
+	}
+
+	// Read whole buckets so the first one isn't cut short
+	rollupFilter := filter
+	rollupFilter.From = models.BucketStart(bucket, filter.From, prefs.WeekStart())
+
+	rollups, err := models.GetDailyRollups(ctx.DB(), userID, rollupFilter)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch analytics: "+err.Error())
+	}
+
+	series, err := models.BuildSeries(rollups, bucket, filter.From, filter.To, prefs.WeekStart())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	for i := range series {
+		series[i] = series[i].InUnits(units)
+	}
+
+	return map[string]interface{}{
+		"bucket":        bucket,
+		"from":          filter.From.Format(dateLayout),
+		"to":            filter.To.Format(dateLayout),
+		"time_zone":     prefs.TimeZone,
+		"units":         units,
+		"muscle_groups": models.MuscleGroups(series),
+		"series":        series,
+	}, nil
+}
+
+// RebuildUserAnalytics handles the POST /users/{userId}/analytics/rebuild request
+func RebuildUserAnalytics(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	if err := models.RebuildRollups(ctx.DB(), userID, prefs.E1RMFormula); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to rebuild analytics: "+err.Error())
+	}
+
+	return map[string]string{"message": "Analytics rebuilt successfully"}, nil
+}
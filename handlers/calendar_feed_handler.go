@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// The feed covers recent history and the months ahead
+const (
+	feedPastDays   = 30
+	feedFutureDays = 180
+)
+
+// GetCalendarFeed handles the GET /users/{userId}/calendar/feed request. It
+// returns the user's secret feed URL, creating it on first use.
+func GetCalendarFeed(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	feed, err := models.GetOrCreateCalendarFeed(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch calendar feed: "+err.Error())
+	}
+
+	return feedResponse(feed), nil
+}
+
+// RotateCalendarFeed handles the POST /users/{userId}/calendar/feed/rotate
+// request. Subscriptions using the old URL stop working.
+func RotateCalendarFeed(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	feed, err := models.RotateCalendarFeed(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to rotate calendar feed: "+err.Error())
+	}
+
+	return feedResponse(feed), nil
+}
+
+// feedResponse describes a feed with its subscription path
+func feedResponse(feed models.CalendarFeed) map[string]interface{} {
+	return map[string]interface{}{
+		"token": feed.Token,
+		"path":  "/calendar/" + feed.Token + ".ics",
+	}
+}
+
+// GetCalendarFeedICS handles the GET /calendar/{token}.ics request. The token
+// is the only credential, so calendar apps can poll it directly.
+func GetCalendarFeedICS(ctx *gofr.Context) (interface{}, error) {
+	feed, err := models.GetCalendarFeedByToken(ctx.DB(), ctx.PathParam("token"))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Calendar feed not found")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), feed.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	today := prefs.Today()
+	entries, err := models.GetCalendar(ctx.DB(), feed.UserID, today.AddDate(0, 0, -feedPastDays), today.AddDate(0, 0, feedFutureDays), prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to build calendar: "+err.Error())
+	}
+
+	events, err := feedEvents(ctx, entries, prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to build calendar: "+err.Error())
+	}
+
+	return writeRaw(ctx, "text/calendar; charset=utf-8", "", func(w io.Writer) error {
+		return models.WriteICal(w, "Workouts", events)
+	})
+}
+
+// feedEvents turns planned calendar entries into events. UIDs are derived
+// from the schedule occurrence or program session so they stay stable when
+// an occurrence moves or the feed is refreshed.
+func feedEvents(ctx *gofr.Context, entries []models.CalendarEntry, prefs models.Preferences) ([]models.ICalEvent, error) {
+	descriptions := make(map[int]string)
+	var events []models.ICalEvent
+	for _, entry := range entries {
+		var uid string
+		switch entry.Source {
+		case models.CalendarSourceSchedule:
+			original := entry.Date
+			if entry.OriginalDate != nil {
+				original = *entry.OriginalDate
+			}
+			uid = fmt.Sprintf("schedule-%d-%s@workout-app", entry.ScheduleID, original.Format("20060102"))
+		case models.CalendarSourceProgram:
+			uid = fmt.Sprintf("program-session-%d@workout-app", entry.ProgramSessionID)
+		default:
+			continue
+		}
+
+		if _, ok := descriptions[entry.WorkoutID]; !ok {
+			description, err := workoutDescription(ctx, entry.WorkoutID, prefs)
+			if err != nil {
+				return nil, err
+			}
+			descriptions[entry.WorkoutID] = description
+		}
+
+		event := models.ICalEvent{
+			UID:         uid,
+			Summary:     entry.WorkoutName,
+			Description: descriptions[entry.WorkoutID],
+			Date:        entry.Date,
+		}
+		if entry.StartTime != "" {
+			// Start times are local to the user's time zone
+			clock, err := time.Parse("15:04", entry.StartTime)
+			if err != nil {
+				return nil, fmt.Errorf("schedule %d has an invalid start time %q", entry.ScheduleID, entry.StartTime)
+			}
+			event.Start = time.Date(entry.Date.Year(), entry.Date.Month(), entry.Date.Day(),
+				clock.Hour(), clock.Minute(), 0, 0, prefs.Location())
+			event.Duration = time.Duration(entry.DurationMinutes) * time.Minute
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// workoutDescription lists a workout's exercises in the user's units
+func workoutDescription(ctx *gofr.Context, workoutID int, prefs models.Preferences) (string, error) {
+	// Workouts the feed's user can no longer read are not described
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
+	if err != nil {
+		return "", nil
+	}
+	allowed, err := models.CanViewWorkout(ctx.DB(), workout, prefs.UserID)
+	if err != nil || !allowed {
+		return "", err
+	}
+
+	workoutExercises, err := models.GetWorkoutExercises(ctx.DB(), workoutID)
+	if err != nil {
+		return "", err
+	}
+
+	units := prefs.Units()
+	var lines []string
+	for i, we := range workoutExercises {
+		exercise, err := models.GetExercise(ctx.DB(), we.ExerciseID)
+		if err != nil {
+			return "", err
+		}
+		we = we.InUnits(units, prefs.IncrementFor(units))
+		lines = append(lines, fmt.Sprintf("%d. %s: %s", i+1, exercise.Name, formatPrescription(we, exercise.TrackingType)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatPrescription describes a converted prescription, such as
+// "5 x 5 @ 100 kg" or "5 km in 25m0s"
+func formatPrescription(we models.WorkoutExercise, trackingType string) string {
+	weight := fmt.Sprintf(" @ %g %s", we.Weight, we.Units.Weight)
+	if we.Weight == 0 {
+		weight = ""
+	}
+	duration := (time.Duration(we.Duration) * time.Second).String()
+	distance := fmt.Sprintf("%g %s", we.Distance, we.Units.Distance)
+
+	switch trackingType {
+	case models.TrackingReps:
+		return fmt.Sprintf("%d x %d", we.Sets, we.Reps)
+	case models.TrackingDuration:
+		return fmt.Sprintf("%d x %s", we.Sets, duration)
+	case models.TrackingDistanceDuration:
+		if we.Duration == 0 {
+			return distance
+		}
+		return distance + " in " + duration
+	case models.TrackingDistanceLoad:
+		return distance + weight
+	default:
+		return fmt.Sprintf("%d x %d", we.Sets, we.Reps) + weight
+	}
+}
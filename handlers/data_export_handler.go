@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// dataExportResponse is an export with its download path once it's ready
+type dataExportResponse struct {
+	models.DataExport
+	DownloadPath string `json:"download_path,omitempty"`
+}
+
+// newDataExportResponse adds the download path to completed exports
+func newDataExportResponse(export models.DataExport) dataExportResponse {
+	response := dataExportResponse{DataExport: export}
+	if export.Status == models.ExportCompleted && export.Token != "" {
+		response.DownloadPath = "/exports/" + export.Token + ".zip"
+	}
+	return response
+}
+
+// RequestDataExport handles the POST /users/{userId}/exports request. The
+// export is built in the background; poll it until it is completed.
+func RequestDataExport(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	id, err := models.CreateDataExport(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to request export: "+err.Error())
+	}
+
+	export, err := models.GetDataExport(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Export requested but failed to retrieve")
+	}
+
+	return newDataExportResponse(export), nil
+}
+
+// GetUserDataExports handles the GET /users/{userId}/exports request
+func GetUserDataExports(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	exports, err := models.GetUserDataExports(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch exports: "+err.Error())
+	}
+
+	responses := make([]dataExportResponse, 0, len(exports))
+	for _, export := range exports {
+		responses = append(responses, newDataExportResponse(export))
+	}
+	return responses, nil
+}
+
+// GetDataExport handles the GET /users/{userId}/exports/{id} request
+func GetDataExport(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid export ID")
+	}
+
+	export, err := models.GetDataExport(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Export not found")
+	}
+
+	return newDataExportResponse(export), nil
+}
+
+// DownloadDataExport handles the GET /exports/{token}.zip request. The token
+// is the only credential and stops working when the export expires.
+func DownloadDataExport(ctx *gofr.Context) (interface{}, error) {
+	export, err := models.GetDataExportByToken(ctx.DB(), ctx.PathParam("token"))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Export not found or expired")
+	}
+
+	filename := "workout-export-" + strconv.Itoa(export.UserID) + ".zip"
+	return writeRaw(ctx, "application/zip", filename, func(w io.Writer) error {
+		return models.CopyDataExport(ctx.DB(), export.ID, w)
+	})
+}
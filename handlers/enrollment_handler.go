@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetUserEnrollments handles the GET /users/{userId}/enrollments request
+func GetUserEnrollments(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollments, err := models.GetUserEnrollments(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch enrollments: "+err.Error())
+	}
+
+	converted := make([]models.Enrollment, 0, len(enrollments))
+	for _, enrollment := range enrollments {
+		converted = append(converted, enrollment.InUnits(units, prefs.IncrementFor(units)))
+	}
+
+	return converted, nil
+}
+
+// GetEnrollment handles the GET /enrollments/{id} request
+func GetEnrollment(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid enrollment ID")
+	}
+
+	enrollment, err := models.GetEnrollment(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Enrollment not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, enrollment.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return enrollment.InUnits(units, prefs.IncrementFor(units)), nil
+}
+
+// ResyncEnrollment handles the POST /enrollments/{id}/resync request. It
+// applies the program's current definition to the sessions still ahead.
+func ResyncEnrollment(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid enrollment ID")
+	}
+
+	enrollment, err := models.GetEnrollment(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Enrollment not found")
+	}
+	if enrollment.Status != models.EnrollmentActive {
+		return nil, gofr.NewError(http.StatusConflict, "Enrollment is not active")
+	}
+
+	program, err := models.GetProgram(ctx.DB(), enrollment.ProgramID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Program no longer exists")
+	}
+
+	units, prefs, err := requestUnits(ctx, enrollment.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	rounding := models.LoadRounding{Units: units, Increment: prefs.IncrementFor(units)}
+	if err := models.ResyncEnrollment(ctx.DB(), enrollment, program, rounding, prefs.Today()); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to resync enrollment: "+err.Error())
+	}
+
+	updatedEnrollment, err := models.GetEnrollment(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Enrollment resynced but failed to retrieve")
+	}
+
+	return updatedEnrollment.InUnits(units, prefs.IncrementFor(units)), nil
+}
+
+// CancelEnrollment handles the DELETE /enrollments/{id} request
+func CancelEnrollment(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid enrollment ID")
+	}
+
+	enrollment, err := models.GetEnrollment(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Enrollment not found")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), enrollment.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	// Sessions already done stay in the user's history
+	if err := models.CancelEnrollment(ctx.DB(), id, prefs.Today()); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to cancel enrollment: "+err.Error())
+	}
+
+	return map[string]string{"message": "Enrollment cancelled successfully"}, nil
+}
@@ -25,7 +25,8 @@ func GetExercises(ctx *gofr.Context) (interface{}, error) {
 	return exercises, nil
 }
 
-// GetExercise handles the GET /exercises/{id} request
+// GetExercise handles the GET /exercises/{id} request, including the
+// exercise's instructions and media
 func GetExercise(ctx *gofr.Context) (interface{}, error) {
 	idStr := ctx.PathParam("id")
 	id, err := strconv.Atoi(idStr)
@@ -37,7 +38,15 @@ func GetExercise(ctx *gofr.Context) (interface{}, error) {
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
 	}
-	return exercise, nil
+
+	detail := models.ExerciseDetail{Exercise: exercise}
+	if detail.Instructions, err = models.GetExerciseInstructions(ctx.DB(), id); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch instructions: "+err.Error())
+	}
+	if detail.Media, err = models.GetExerciseMediaList(ctx.DB(), id); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch media: "+err.Error())
+	}
+	return detail, nil
 }
 
 // CreateExercise handles the POST /exercises request
@@ -52,6 +61,14 @@ func CreateExercise(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusBadRequest, "Exercise name and category are required")
 	}
 
+	// Exercises are tracked by sets, reps and load unless told otherwise
+	if exercise.TrackingType == "" {
+		exercise.TrackingType = models.TrackingRepsLoad
+	}
+	if !models.IsValidTrackingType(exercise.TrackingType) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid tracking type")
+	}
+
 	// Create the exercise
 	id, err := models.CreateExercise(ctx.DB(), exercise)
 	if err != nil {
@@ -76,7 +93,7 @@ func UpdateExercise(ctx *gofr.Context) (interface{}, error) {
 	}
 
 	// Check if exercise exists
-	_, err = models.GetExercise(ctx.DB(), id)
+	existingExercise, err := models.GetExercise(ctx.DB(), id)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
 	}
@@ -88,6 +105,20 @@ func UpdateExercise(ctx *gofr.Context) (interface{}, error) {
 
 	exercise.ID = id
 
+	// Keep the current tracking type, muscle group and equipment if none are provided
+	if exercise.TrackingType == "" {
+		exercise.TrackingType = existingExercise.TrackingType
+	}
+	if exercise.MuscleGroup == "" {
+		exercise.MuscleGroup = existingExercise.MuscleGroup
+	}
+	if exercise.Equipment == "" {
+		exercise.Equipment = existingExercise.Equipment
+	}
+	if !models.IsValidTrackingType(exercise.TrackingType) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid tracking type")
+	}
+
 	// Update the exercise
 	if err := models.UpdateExercise(ctx.DB(), exercise); err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update exercise: "+err.Error())
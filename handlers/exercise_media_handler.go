@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// UploadExerciseMedia handles the POST /exercises/{id}/media request. The
+// file is uploaded as multipart form data under file, with an optional
+// caption, and is added after the exercise's other media.
+func UploadExerciseMedia(ctx *gofr.Context) (interface{}, error) {
+	exercise, err := pathExercise(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave room for the form fields around the file
+	req := ctx.Request()
+	req.Body = http.MaxBytesReader(ctx.ResponseWriter(), req.Body, models.MaxMediaSize+1<<20)
+	if err := req.ParseMultipartForm(8 << 20); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid upload; send the file as multipart form data under 30 MB")
+	}
+
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "A media file is required")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxMediaSize+1))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read the media file")
+	}
+	if len(data) > models.MaxMediaSize {
+		return nil, gofr.NewError(http.StatusRequestEntityTooLarge, "Media files are limited to 30 MB")
+	}
+
+	caption := req.FormValue("caption")
+	if len(caption) > 255 {
+		return nil, gofr.NewError(http.StatusBadRequest, "Captions are limited to 255 characters")
+	}
+
+	kind, processed, err := models.ProcessMedia(data)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read media: "+err.Error())
+	}
+
+	media := models.ExerciseMedia{ExerciseID: exercise.ID, Kind: kind, Caption: caption}
+	id, err := models.SaveExerciseMedia(ctx.DB(), fileStore, media, processed)
+	if err == models.ErrMediaLimit {
+		return nil, gofr.NewError(http.StatusConflict, "Exercises can have up to 10 images and one GIF or video; delete one first")
+	}
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to save media: "+err.Error())
+	}
+
+	created, err := models.GetExerciseMedia(ctx.DB(), id, exercise.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Media saved but failed to retrieve")
+	}
+	return created, nil
+}
+
+// GetExerciseMedia handles the GET /exercises/{id}/media request, listing an
+// exercise's media in order
+func GetExerciseMedia(ctx *gofr.Context) (interface{}, error) {
+	exercise, err := pathExercise(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	media, err := models.GetExerciseMediaList(ctx.DB(), exercise.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch media: "+err.Error())
+	}
+	return media, nil
+}
+
+// ReorderExerciseMedia handles the PUT /exercises/{id}/media/order request.
+// The body lists every media ID of the exercise in the new order.
+func ReorderExerciseMedia(ctx *gofr.Context) (interface{}, error) {
+	exercise, err := pathExercise(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var req struct {
+		MediaIDs []int `json:"media_ids"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := models.ReorderExerciseMedia(ctx.DB(), exercise.ID, req.MediaIDs); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to reorder media: "+err.Error())
+	}
+
+	media, err := models.GetExerciseMediaList(ctx.DB(), exercise.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Media reordered but failed to retrieve")
+	}
+	return media, nil
+}
+
+// UpdateExerciseMedia handles the PATCH /exercises/{id}/media/{mediaId}
+// request, changing the caption of the media
+func UpdateExerciseMedia(ctx *gofr.Context) (interface{}, error) {
+	media, err := pathExerciseMedia(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var req struct {
+		Caption string `json:"caption"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	if len(req.Caption) > 255 {
+		return nil, gofr.NewError(http.StatusBadRequest, "Captions are limited to 255 characters")
+	}
+
+	if err := models.UpdateExerciseMediaCaption(ctx.DB(), media.ID, media.ExerciseID, req.Caption); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update media: "+err.Error())
+	}
+
+	updated, err := models.GetExerciseMedia(ctx.DB(), media.ID, media.ExerciseID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Media updated but failed to retrieve")
+	}
+	return updated, nil
+}
+
+// DeleteExerciseMedia handles the DELETE /exercises/{id}/media/{mediaId}
+// request. The media and its files are removed for good.
+func DeleteExerciseMedia(ctx *gofr.Context) (interface{}, error) {
+	media, err := pathExerciseMedia(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteExerciseMedia(ctx.DB(), fileStore, media); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete media: "+err.Error())
+	}
+
+	return map[string]string{"message": "Media deleted successfully"}, nil
+}
+
+// DownloadExerciseMedia handles the GET
+// /exercises/{id}/media/{mediaId}/{variant} request, where variant is
+// original or thumbnail. Media never change once uploaded, so they can be
+// cached for good. Range requests are served when the store supports
+// seeking, so videos can be scrubbed.
+func DownloadExerciseMedia(ctx *gofr.Context) (interface{}, error) {
+	media, err := pathExerciseMedia(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := ctx.PathParam("variant")
+	if variant != models.VariantOriginal && variant != models.VariantThumbnail || media.Key(variant) == "" {
+		return nil, gofr.NewError(http.StatusNotFound, "Unknown media variant: "+variant)
+	}
+
+	object, err := fileStore.Open(media.Key(variant))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to read media: "+err.Error())
+	}
+	defer object.Close()
+
+	w := ctx.ResponseWriter()
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if seeker, ok := object.(io.ReadSeeker); ok {
+		w.Header().Set("Content-Type", media.ContentTypeOf(variant))
+		http.ServeContent(w, ctx.Request(), "", media.CreatedAt, seeker)
+		return nil, nil
+	}
+	return writeRaw(ctx, media.ContentTypeOf(variant), "", func(w io.Writer) error {
+		_, err := io.Copy(w, object)
+		return err
+	})
+}
+
+// SetExerciseInstructions handles the PUT /exercises/{id}/instructions
+// request, replacing the exercise's steps, cues and common mistakes
+func SetExerciseInstructions(ctx *gofr.Context) (interface{}, error) {
+	exercise, err := pathExercise(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var instructions models.ExerciseInstructions
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&instructions); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	if err := instructions.Validate(); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := models.SetExerciseInstructions(ctx.DB(), exercise.ID, instructions); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to save instructions: "+err.Error())
+	}
+
+	saved, err := models.GetExerciseInstructions(ctx.DB(), exercise.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Instructions saved but failed to retrieve")
+	}
+	return saved, nil
+}
+
+// pathExercise resolves the {id} exercise
+func pathExercise(ctx *gofr.Context) (models.Exercise, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Exercise{}, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
+	}
+
+	exercise, err := models.GetExercise(ctx.DB(), id)
+	if err != nil {
+		return exercise, gofr.NewError(http.StatusNotFound, "Exercise not found")
+	}
+	return exercise, nil
+}
+
+// pathExerciseMedia resolves the {mediaId} media of the {id} exercise
+func pathExerciseMedia(ctx *gofr.Context) (models.ExerciseMedia, error) {
+	exercise, err := pathExercise(ctx)
+	if err != nil {
+		return models.ExerciseMedia{}, err
+	}
+
+	mediaIDStr := ctx.PathParam("mediaId")
+	mediaID, err := strconv.Atoi(mediaIDStr)
+	if err != nil {
+		return models.ExerciseMedia{}, gofr.NewError(http.StatusBadRequest, "Invalid media ID")
+	}
+
+	media, err := models.GetExerciseMedia(ctx.DB(), mediaID, exercise.ID)
+	if err != nil {
+		return media, gofr.NewError(http.StatusNotFound, "Media not found")
+	}
+	return media, nil
+}
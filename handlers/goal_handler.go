@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// goalRequest is the body of goal requests. Unit defaults to the unit the
+// goal is shown in for the request, and an empty deadline means none.
+type goalRequest struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	ExerciseID int     `json:"exercise_id"`
+	Metric     string  `json:"metric"`
+	Target     float64 `json:"target"`
+	Unit       string  `json:"unit"`
+	Weeks      int     `json:"weeks"`
+	Deadline   string  `json:"deadline"`
+}
+
+// goal validates the request and converts it into a goal in canonical
+// units. The exercise and metric of existing goals are fixed, so they are
+// only checked when creating one.
+func (r goalRequest) goal(db *sql.DB, units models.Units, today time.Time, creating bool) (models.Goal, error) {
+	g := models.Goal{Type: r.Type, Name: r.Name, ExerciseID: r.ExerciseID, Metric: r.Metric, Weeks: r.Weeks}
+	if len(g.Name) > 100 {
+		return g, gofr.NewError(http.StatusBadRequest, "Goal names are limited to 100 characters")
+	}
+	if r.Target <= 0 {
+		return g, gofr.NewError(http.StatusBadRequest, "Target must be positive")
+	}
+
+	if creating {
+		if err := checkGoalSubject(db, &g); err != nil {
+			return g, err
+		}
+	}
+
+	if g.Type == models.GoalFrequency {
+		if g.Weeks == 0 {
+			g.Weeks = models.DefaultGoalWeeks
+		}
+		if g.Weeks < 1 || g.Weeks > 52 {
+			return g, gofr.NewError(http.StatusBadRequest, "Weeks must be between 1 and 52")
+		}
+		if r.Target != float64(int(r.Target)) || r.Target > 14 {
+			return g, gofr.NewError(http.StatusBadRequest, "Frequency targets must be whole sessions per week, up to 14")
+		}
+	} else {
+		g.Weeks = 0
+	}
+
+	if r.Unit == "" {
+		r.Unit = models.GoalUnit(g, units)
+	}
+	target, err := models.GoalToCanonical(g, r.Target, r.Unit)
+	if err != nil {
+		return g, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+	g.Target = target
+
+	if r.Deadline != "" {
+		deadline, err := parseDate(r.Deadline)
+		if err != nil {
+			return g, gofr.NewError(http.StatusBadRequest, "Invalid deadline, expected YYYY-MM-DD")
+		}
+		if deadline.Before(today) {
+			return g, gofr.NewError(http.StatusBadRequest, "Deadline must not be in the past")
+		}
+		g.Deadline = &deadline
+	}
+
+	return g, nil
+}
+
+// checkGoalSubject checks the type of a new goal and the exercise or metric
+// it tracks
+func checkGoalSubject(db *sql.DB, g *models.Goal) error {
+	if !models.IsValidGoalType(g.Type) {
+		return gofr.NewError(http.StatusBadRequest, "Type must be load, e1rm, frequency, volume or measurement")
+	}
+
+	if g.Type != models.GoalMeasurement {
+		g.Metric = ""
+	} else if !models.IsValidMetric(g.Metric) {
+		return gofr.NewError(http.StatusBadRequest, "Unknown metric: "+g.Metric)
+	}
+
+	switch g.Type {
+	case models.GoalFrequency, models.GoalMeasurement:
+		g.ExerciseID = 0
+		return nil
+	case models.GoalVolume:
+		if g.ExerciseID == 0 {
+			return nil
+		}
+	}
+
+	if g.ExerciseID == 0 {
+		return gofr.NewError(http.StatusBadRequest, "An exercise_id is required for "+g.Type+" goals")
+	}
+	exercise, err := models.GetExercise(db, g.ExerciseID)
+	if err != nil {
+		return gofr.NewError(http.StatusBadRequest, "Exercise not found")
+	}
+	switch {
+	case g.Type == models.GoalVolume && exercise.TrackingType != models.TrackingRepsLoad && exercise.TrackingType != models.TrackingReps:
+		return gofr.NewError(http.StatusBadRequest, "Volume goals need an exercise tracked by reps")
+	case g.Type != models.GoalVolume && exercise.TrackingType != models.TrackingRepsLoad:
+		return gofr.NewError(http.StatusBadRequest, "Load and e1RM goals need an exercise tracked by reps and load")
+	}
+	return nil
+}
+
+// CreateGoal handles the POST /users/{userId}/goals request. Load, e1RM and
+// measurement goals start from the user's current best or latest value.
+func CreateGoal(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var req goalRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	goal, err := req.goal(ctx.DB(), units, prefs.Today(), true)
+	if err != nil {
+		return nil, err
+	}
+	goal.UserID = userID
+	goal.StartDate = prefs.Today()
+
+	start, ok, err := models.GoalStartValue(ctx.DB(), goal, prefs.E1RMFormula)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch current progress: "+err.Error())
+	}
+	switch {
+	case !ok:
+		return nil, gofr.NewError(http.StatusBadRequest, "Record a "+goal.Metric+" measurement before setting a goal for it")
+	case goal.Type == models.GoalMeasurement && start == goal.Target:
+		return nil, gofr.NewError(http.StatusBadRequest, "The latest measurement already matches the target")
+	case (goal.Type == models.GoalLoad || goal.Type == models.GoalE1RM) && start >= goal.Target:
+		return nil, gofr.NewError(http.StatusBadRequest, "The target has already been reached")
+	}
+	goal.StartValue = start
+
+	id, err := models.CreateGoal(ctx.DB(), goal)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create goal: "+err.Error())
+	}
+
+	return evaluatedGoal(ctx, id, userID, units, prefs)
+}
+
+// GetUserGoals handles the GET /users/{userId}/goals request, optionally
+// filtered by status. Progress is brought up to date first, so goals that
+// were achieved or missed since the last read show their new status.
+func GetUserGoals(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	status := ctx.QueryParam("status")
+	if status != "" && status != models.GoalActive && status != models.GoalAchieved && status != models.GoalMissed {
+		return nil, gofr.NewError(http.StatusBadRequest, "Status must be active, achieved or missed")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	goals, err := models.GetUserGoals(ctx.DB(), userID, "")
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch goals: "+err.Error())
+	}
+
+	filtered := []models.Goal{}
+	for _, goal := range goals {
+		goal, err := models.EvaluateGoal(ctx.DB(), goal, prefs)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to evaluate goal: "+err.Error())
+		}
+		if status == "" || goal.Status == status {
+			filtered = append(filtered, goal.InUnits(units))
+		}
+	}
+	return filtered, nil
+}
+
+// GetGoal handles the GET /users/{userId}/goals/{id} request
+func GetGoal(ctx *gofr.Context) (interface{}, error) {
+	goal, err := userGoal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	units, prefs, err := requestUnits(ctx, goal.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluatedGoal(ctx, goal.ID, goal.UserID, units, prefs)
+}
+
+// UpdateGoal handles the PATCH /users/{userId}/goals/{id} request, changing
+// the name, target, weeks or deadline. The type, exercise and metric are
+// fixed; set a new goal to track something else.
+func UpdateGoal(ctx *gofr.Context) (interface{}, error) {
+	existing, err := userGoal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActiveUser(ctx, existing.UserID); err != nil {
+		return nil, err
+	}
+
+	units, prefs, err := requestUnits(ctx, existing.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields missing from the body keep their current values, in the
+	// caller's units
+	current := existing.InUnits(units)
+	req := goalRequest{Name: current.Name, Target: current.Target, Unit: current.Unit, Weeks: current.Weeks}
+	if current.Deadline != nil {
+		req.Deadline = current.Deadline.Format(dateLayout)
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	req.Type, req.ExerciseID, req.Metric = existing.Type, existing.ExerciseID, existing.Metric
+
+	// A deadline already passed may be kept as it is, but not moved into
+	// the past
+	today := prefs.Today()
+	if existing.Deadline != nil && req.Deadline == existing.Deadline.Format(dateLayout) {
+		today = minTime(today, *existing.Deadline)
+	}
+
+	goal, err := req.goal(ctx.DB(), units, today, false)
+	if err != nil {
+		return nil, err
+	}
+	goal.ID = existing.ID
+	goal.UserID = existing.UserID
+
+	if err := models.UpdateGoal(ctx.DB(), goal); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update goal: "+err.Error())
+	}
+
+	return evaluatedGoal(ctx, goal.ID, goal.UserID, units, prefs)
+}
+
+// DeleteGoal handles the DELETE /users/{userId}/goals/{id} request
+func DeleteGoal(ctx *gofr.Context) (interface{}, error) {
+	goal, err := userGoal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActiveUser(ctx, goal.UserID); err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteGoal(ctx.DB(), goal.ID, goal.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete goal: "+err.Error())
+	}
+
+	return map[string]string{"message": "Goal deleted successfully"}, nil
+}
+
+// evaluatedGoal retrieves a goal with its progress brought up to date
+func evaluatedGoal(ctx *gofr.Context, id, userID int, units models.Units, prefs models.Preferences) (interface{}, error) {
+	goal, err := models.GetGoal(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to retrieve goal: "+err.Error())
+	}
+
+	goal, err = models.EvaluateGoal(ctx.DB(), goal, prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to evaluate goal: "+err.Error())
+	}
+	return goal.InUnits(units), nil
+}
+
+// userGoal resolves the {id} goal of the {userId} user
+func userGoal(ctx *gofr.Context) (models.Goal, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return models.Goal{}, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Goal{}, gofr.NewError(http.StatusBadRequest, "Invalid goal ID")
+	}
+
+	goal, err := models.GetGoal(ctx.DB(), id, userID)
+	if err != nil {
+		return goal, gofr.NewError(http.StatusNotFound, "Goal not found")
+	}
+	return goal, nil
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// CreateImport handles the POST /users/{userId}/imports request. The file is
+// uploaded as multipart form data with the fields format (strong, hevy or
+// generic), and optionally weight_unit, distance_unit, date_format, workout
+// and, for generic files, columns as a JSON object of field to header.
+func CreateImport(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	// Leave room for the form fields around the file
+	req := ctx.Request()
+	req.Body = http.MaxBytesReader(ctx.ResponseWriter(), req.Body, models.MaxImportSize+1<<20)
+	if err := req.ParseMultipartForm(8 << 20); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid upload; send the file as multipart form data under 32 MB")
+	}
+
+	format := req.FormValue("format")
+	options := models.ImportOptions{
+		WeightUnit:   prefs.WeightUnit,
+		DistanceUnit: prefs.DistanceUnit,
+		DateFormat:   req.FormValue("date_format"),
+		Workout:      req.FormValue("workout"),
+	}
+	if unit := req.FormValue("weight_unit"); unit != "" {
+		options.WeightUnit = unit
+	}
+	if unit := req.FormValue("distance_unit"); unit != "" {
+		options.DistanceUnit = unit
+	}
+	if columns := req.FormValue("columns"); columns != "" {
+		if err := json.Unmarshal([]byte(columns), &options.Columns); err != nil {
+			return nil, gofr.NewError(http.StatusBadRequest, "columns must be a JSON object of field to header")
+		}
+	}
+	if err := models.ValidateImportOptions(format, options); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "An import file is required")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxImportSize+1))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read the import file")
+	}
+	if len(data) > models.MaxImportSize {
+		return nil, gofr.NewError(http.StatusRequestEntityTooLarge, "Import files are limited to 32 MB")
+	}
+
+	id, err := models.CreateImport(ctx.DB(), userID, format, header.Filename, options, data)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create import: "+err.Error())
+	}
+
+	imp, err := models.GetImport(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Import created but failed to retrieve")
+	}
+
+	return imp, nil
+}
+
+// GetUserImports handles the GET /users/{userId}/imports request
+func GetUserImports(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	imports, err := models.GetUserImports(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch imports: "+err.Error())
+	}
+
+	return imports, nil
+}
+
+// GetImport handles the GET /users/{userId}/imports/{id} request
+func GetImport(ctx *gofr.Context) (interface{}, error) {
+	return userImport(ctx)
+}
+
+// GetImportExercises handles the GET /users/{userId}/imports/{id}/exercises
+// request. It lists the exercise names in the file, how each is resolved and
+// the suggested catalog exercise for names that need review.
+func GetImportExercises(ctx *gofr.Context) (interface{}, error) {
+	imp, err := userImport(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exercises, err := models.GetImportExercises(ctx.DB(), imp.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch import exercises: "+err.Error())
+	}
+
+	return exercises, nil
+}
+
+// ResolveImportExercises handles the PUT /users/{userId}/imports/{id}/exercises
+// request. Each entry resolves a name by matching it to exercise_id,
+// creating a new exercise (with an optional tracking_type) or skipping its
+// rows.
+func ResolveImportExercises(ctx *gofr.Context) (interface{}, error) {
+	imp, err := userImport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActiveUser(ctx, imp.UserID); err != nil {
+		return nil, err
+	}
+	if imp.Status != models.ImportReview {
+		return nil, gofr.NewError(http.StatusConflict, "Exercises can only be resolved while the import is in review")
+	}
+
+	var req []struct {
+		Name         string `json:"name"`
+		Action       string `json:"action"`
+		ExerciseID   int    `json:"exercise_id"`
+		TrackingType string `json:"tracking_type"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	for _, mapping := range req {
+		// An exercise ID on its own means a match
+		if mapping.Action == "" && mapping.ExerciseID != 0 {
+			mapping.Action = models.MappingMatch
+		}
+
+		switch mapping.Action {
+		case models.MappingMatch:
+			if _, err := models.GetExercise(ctx.DB(), mapping.ExerciseID); err != nil {
+				return nil, gofr.NewError(http.StatusBadRequest, "Exercise not found for "+mapping.Name)
+			}
+			mapping.TrackingType = ""
+		case models.MappingCreate:
+			if mapping.TrackingType != "" && !models.IsValidTrackingType(mapping.TrackingType) {
+				return nil, gofr.NewError(http.StatusBadRequest, "Invalid tracking type for "+mapping.Name)
+			}
+			mapping.ExerciseID = 0
+		case models.MappingSkip:
+			mapping.ExerciseID, mapping.TrackingType = 0, ""
+		default:
+			return nil, gofr.NewError(http.StatusBadRequest, "Action must be match, create or skip")
+		}
+
+		err := models.ResolveImportExercise(ctx.DB(), imp.ID, mapping.Name, mapping.Action, mapping.ExerciseID, mapping.TrackingType)
+		if err == sql.ErrNoRows {
+			return nil, gofr.NewError(http.StatusBadRequest, "The import has no exercise named "+mapping.Name)
+		}
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to resolve exercise: "+err.Error())
+		}
+	}
+
+	exercises, err := models.GetImportExercises(ctx.DB(), imp.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Exercises resolved but failed to retrieve")
+	}
+
+	return exercises, nil
+}
+
+// StartImport handles the POST /users/{userId}/imports/{id}/start request,
+// queueing a reviewed import once every exercise name is resolved
+func StartImport(ctx *gofr.Context) (interface{}, error) {
+	imp, err := userImport(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActiveUser(ctx, imp.UserID); err != nil {
+		return nil, err
+	}
+	if imp.Status != models.ImportReview {
+		return nil, gofr.NewError(http.StatusConflict, "Only imports in review can be started")
+	}
+
+	exercises, err := models.GetImportExercises(ctx.DB(), imp.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch import exercises: "+err.Error())
+	}
+	unresolved := 0
+	for _, exercise := range exercises {
+		if exercise.Action == "" {
+			unresolved++
+		}
+	}
+	if unresolved > 0 {
+		return nil, gofr.NewError(http.StatusConflict, strconv.Itoa(unresolved)+" exercise names still need to be resolved")
+	}
+
+	if err := models.QueueImport(ctx.DB(), imp.ID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to start import: "+err.Error())
+	}
+
+	return models.GetImport(ctx.DB(), imp.ID, imp.UserID)
+}
+
+// GetImportRows handles the GET /users/{userId}/imports/{id}/rows request,
+// returning the outcome of each row, optionally filtered by status
+func GetImportRows(ctx *gofr.Context) (interface{}, error) {
+	imp, err := userImport(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := models.GetImportRows(ctx.DB(), imp.ID, ctx.QueryParam("status"))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch import report: "+err.Error())
+	}
+
+	return rows, nil
+}
+
+// userImport resolves the {id} import of the {userId} user
+func userImport(ctx *gofr.Context) (models.Import, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return models.Import{}, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Import{}, gofr.NewError(http.StatusBadRequest, "Invalid import ID")
+	}
+
+	imp, err := models.GetImport(ctx.DB(), id, userID)
+	if err != nil {
+		return imp, gofr.NewError(http.StatusNotFound, "Import not found")
+	}
+	return imp, nil
+}
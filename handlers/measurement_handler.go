@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// defaultTrendWindow is the moving average window in days when none is given
+const defaultTrendWindow = 7
+
+// measurementRequest is the body of measurement requests. Unit defaults to
+// the unit the metric is shown in for the request.
+type measurementRequest struct {
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+	Date   string  `json:"date"`
+	Notes  string  `json:"notes"`
+}
+
+// measurement validates the request and converts it into a measurement in
+// canonical units
+func (r measurementRequest) measurement(units models.Units, today time.Time) (models.Measurement, error) {
+	if !models.IsValidMetric(r.Metric) {
+		return models.Measurement{}, gofr.NewError(http.StatusBadRequest, "Unknown metric: "+r.Metric)
+	}
+	if r.Value <= 0 {
+		return models.Measurement{}, gofr.NewError(http.StatusBadRequest, "Value must be positive")
+	}
+
+	if r.Unit == "" {
+		r.Unit = models.MetricUnit(r.Metric, units)
+	}
+	value, err := models.MeasurementToCanonical(r.Metric, r.Value, r.Unit)
+	if err != nil {
+		return models.Measurement{}, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	// If date is not provided, use the current date in the user's time zone
+	date := today
+	if r.Date != "" {
+		if date, err = parseDate(r.Date); err != nil {
+			return models.Measurement{}, gofr.NewError(http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		}
+	}
+
+	return models.Measurement{Metric: r.Metric, Value: value, Date: date, Notes: r.Notes}, nil
+}
+
+// CreateMeasurement handles the POST /users/{userId}/measurements request
+func CreateMeasurement(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var req measurementRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	measurement, err := req.measurement(units, prefs.Today())
+	if err != nil {
+		return nil, err
+	}
+	measurement.UserID = userID
+
+	id, err := models.CreateMeasurement(ctx.DB(), measurement)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to record measurement: "+err.Error())
+	}
+
+	if err := refreshBodyweightMetrics(ctx, prefs, measurement); err != nil {
+		return nil, err
+	}
+
+	created, err := models.GetMeasurement(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Measurement recorded but failed to retrieve")
+	}
+
+	return created.InUnits(units), nil
+}
+
+// GetUserMeasurements handles the GET /users/{userId}/measurements request,
+// optionally filtered by metric and by date with from and to
+func GetUserMeasurements(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	metric := ctx.QueryParam("metric")
+	if metric != "" && !models.IsValidMetric(metric) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Unknown metric: "+metric)
+	}
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	units, _, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	measurements, err := models.GetUserMeasurements(ctx.DB(), userID, metric, from, to)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch measurements: "+err.Error())
+	}
+
+	for i := range measurements {
+		measurements[i] = measurements[i].InUnits(units)
+	}
+	return measurements, nil
+}
+
+// GetMeasurementTrend handles the GET /users/{userId}/measurements/trend
+// request. metric defaults to bodyweight and window, the moving average
+// window in days, to 7.
+func GetMeasurementTrend(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	metric := ctx.QueryParam("metric")
+	if metric == "" {
+		metric = models.MetricBodyweight
+	}
+	if !models.IsValidMetric(metric) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Unknown metric: "+metric)
+	}
+
+	window, err := intQueryParam(ctx, "window")
+	if err != nil {
+		return nil, err
+	}
+	if window == 0 {
+		window = defaultTrendWindow
+	}
+	if window < 1 || window > 365 {
+		return nil, gofr.NewError(http.StatusBadRequest, "window must be between 1 and 365 days")
+	}
+
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	units, _, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	trend, err := models.GetMeasurementTrend(ctx.DB(), userID, metric, from, to, window, units)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to compute trend: "+err.Error())
+	}
+
+	return trend, nil
+}
+
+// UpdateMeasurement handles the PATCH /users/{userId}/measurements/{id}
+// request. The metric of a measurement can't be changed.
+func UpdateMeasurement(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid measurement ID")
+	}
+
+	existing, err := models.GetMeasurement(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Measurement not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields missing from the body keep their current values, in the
+	// caller's units
+	current := existing.InUnits(units)
+	req := measurementRequest{Value: current.Value, Unit: current.Unit, Date: current.Date.Format(dateLayout), Notes: current.Notes}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	req.Metric = existing.Metric
+
+	measurement, err := req.measurement(units, prefs.Today())
+	if err != nil {
+		return nil, err
+	}
+	measurement.ID = id
+	measurement.UserID = userID
+
+	if err := models.UpdateMeasurement(ctx.DB(), measurement); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update measurement: "+err.Error())
+	}
+
+	if err := refreshBodyweightMetrics(ctx, prefs, measurement); err != nil {
+		return nil, err
+	}
+
+	updated, err := models.GetMeasurement(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Measurement updated but failed to retrieve")
+	}
+
+	return updated.InUnits(units), nil
+}
+
+// DeleteMeasurement handles the DELETE /users/{userId}/measurements/{id} request
+func DeleteMeasurement(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid measurement ID")
+	}
+
+	measurement, err := models.GetMeasurement(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Measurement not found")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	if err := models.DeleteMeasurement(ctx.DB(), id, userID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete measurement: "+err.Error())
+	}
+
+	if err := refreshBodyweightMetrics(ctx, prefs, measurement); err != nil {
+		return nil, err
+	}
+
+	return map[string]string{"message": "Measurement deleted successfully"}, nil
+}
+
+// refreshBodyweightMetrics rebuilds the user's analytics after a bodyweight
+// changes, since bodyweight exercise volume depends on it
+func refreshBodyweightMetrics(ctx *gofr.Context, prefs models.Preferences, measurement models.Measurement) error {
+	if measurement.Metric != models.MetricBodyweight {
+		return nil
+	}
+	if err := models.RebuildRollups(ctx.DB(), measurement.UserID, prefs.E1RMFormula); err != nil {
+		return gofr.NewError(http.StatusInternalServerError, "Failed to update analytics: "+err.Error())
+	}
+	return nil
+}
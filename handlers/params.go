@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofr-dev/gofr"
+)
+
+// dateLayout is the format of date query parameters
+const dateLayout = "2006-01-02"
+
+// dateQueryParam parses an optional YYYY-MM-DD query parameter
+func dateQueryParam(ctx *gofr.Context, name string) (time.Time, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	date, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, gofr.NewError(http.StatusBadRequest, "Invalid "+name+" date, expected YYYY-MM-DD")
+	}
+	return date, nil
+}
+
+// intQueryParam parses an optional integer ID query parameter
+func intQueryParam(ctx *gofr.Context, name string) (int, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, gofr.NewError(http.StatusBadRequest, "Invalid "+name)
+	}
+	return id, nil
+}
+
+// parseDate parses a YYYY-MM-DD date from a request body
+func parseDate(value string) (time.Time, error) {
+	return time.Parse(dateLayout, value)
+}
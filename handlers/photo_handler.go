@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/cxocodehub/go-backend-workout/storage"
+	"github.com/gofr-dev/gofr"
+)
+
+// fileStore keeps uploaded photos; it is set at startup with SetStore
+var fileStore storage.Store
+
+// SetStore sets the file store photo handlers save to and read from
+func SetStore(store storage.Store) {
+	fileStore = store
+}
+
+// UploadPhoto handles the POST /users/{userId}/photos request. The image is
+// uploaded as multipart form data under file, with optional date (default
+// today), pose (default front), notes and visibility (default private).
+func UploadPhoto(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+	if err := checkPhotoOwner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	// Leave room for the form fields around the file
+	req := ctx.Request()
+	req.Body = http.MaxBytesReader(ctx.ResponseWriter(), req.Body, models.MaxImageSize+1<<20)
+	if err := req.ParseMultipartForm(8 << 20); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid upload; send the photo as multipart form data under 15 MB")
+	}
+
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "A photo file is required")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxImageSize+1))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read the photo")
+	}
+	if len(data) > models.MaxImageSize {
+		return nil, gofr.NewError(http.StatusRequestEntityTooLarge, "Photos are limited to 15 MB")
+	}
+
+	photo := models.Photo{
+		UserID:     userID,
+		Date:       prefs.Today(),
+		Pose:       models.PoseFront,
+		Notes:      req.FormValue("notes"),
+		Visibility: models.VisibilityPrivate,
+	}
+	if err := applyPhotoFields(&photo, req.FormValue("date"), req.FormValue("pose"), req.FormValue("visibility")); err != nil {
+		return nil, err
+	}
+
+	image, err := models.ProcessImage(data)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Failed to read photo: "+err.Error())
+	}
+
+	id, err := models.SavePhoto(ctx.DB(), fileStore, photo, image)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to save photo: "+err.Error())
+	}
+
+	created, err := models.GetPhoto(ctx.DB(), id, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Photo saved but failed to retrieve")
+	}
+
+	return created.WithURLs(photoURLExpiry()), nil
+}
+
+// GetUserPhotos handles the GET /users/{userId}/photos request, optionally
+// filtered by pose and by date with from and to. Users other than the owner
+// only see public photos.
+func GetUserPhotos(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	pose := ctx.QueryParam("pose")
+	if pose != "" && !models.IsValidPose(pose) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Unknown pose: "+pose)
+	}
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := isPhotoOwner(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	photos, err := models.GetUserPhotos(ctx.DB(), userID, pose, from, to)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch photos: "+err.Error())
+	}
+
+	expires := photoURLExpiry()
+	visible := make([]models.Photo, 0, len(photos))
+	for _, photo := range photos {
+		if owner || photo.Visibility == models.VisibilityPublic {
+			visible = append(visible, photo.WithURLs(expires))
+		}
+	}
+	return visible, nil
+}
+
+// ComparePhotos handles the GET /users/{userId}/photos/compare request,
+// pairing the first photo of a pose on or after from with the last one on or
+// before to. pose defaults to front. Only the owner can compare photos.
+func ComparePhotos(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	if err := checkPhotoOwner(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	pose := ctx.QueryParam("pose")
+	if pose == "" {
+		pose = models.PoseFront
+	}
+	if !models.IsValidPose(pose) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Unknown pose: "+pose)
+	}
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	units, _, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison, err := models.ComparePhotos(ctx.DB(), userID, pose, from, to, units)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to compare photos: "+err.Error())
+	}
+
+	expires := photoURLExpiry()
+	if comparison.Before != nil {
+		before, after := comparison.Before.WithURLs(expires), comparison.After.WithURLs(expires)
+		comparison.Before, comparison.After = &before, &after
+	}
+	return comparison, nil
+}
+
+// GetPhoto handles the GET /users/{userId}/photos/{id} request. Private
+// photos are only found for their owner.
+func GetPhoto(ctx *gofr.Context) (interface{}, error) {
+	photo, err := userPhoto(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, err := isPhotoOwner(ctx, photo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !owner && photo.Visibility != models.VisibilityPublic {
+		return nil, gofr.NewError(http.StatusNotFound, "Photo not found")
+	}
+	return photo.WithURLs(photoURLExpiry()), nil
+}
+
+// UpdatePhoto handles the PATCH /users/{userId}/photos/{id} request, changing
+// the date, pose, notes or visibility of a photo. Making a photo private
+// stops its unexpiring links from working.
+func UpdatePhoto(ctx *gofr.Context) (interface{}, error) {
+	photo, err := userPhoto(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPhotoOwner(ctx, photo.UserID); err != nil {
+		return nil, err
+	}
+
+	var req struct {
+		Date       string  `json:"date"`
+		Pose       string  `json:"pose"`
+		Notes      *string `json:"notes"`
+		Visibility string  `json:"visibility"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&req); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := applyPhotoFields(&photo, req.Date, req.Pose, req.Visibility); err != nil {
+		return nil, err
+	}
+	if req.Notes != nil {
+		photo.Notes = *req.Notes
+	}
+
+	if err := models.UpdatePhoto(ctx.DB(), photo); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update photo: "+err.Error())
+	}
+
+	updated, err := models.GetPhoto(ctx.DB(), photo.ID, photo.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Photo updated but failed to retrieve")
+	}
+	return updated.WithURLs(photoURLExpiry()), nil
+}
+
+// DeletePhoto handles the DELETE /users/{userId}/photos/{id} request. The
+// photo and its files are removed for good.
+func DeletePhoto(ctx *gofr.Context) (interface{}, error) {
+	photo, err := userPhoto(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPhotoOwner(ctx, photo.UserID); err != nil {
+		return nil, err
+	}
+
+	if err := models.DeletePhoto(ctx.DB(), fileStore, photo); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete photo: "+err.Error())
+	}
+
+	return map[string]string{"message": "Photo deleted successfully"}, nil
+}
+
+// DownloadPhoto handles the GET /photos/{id}/{variant} request, where variant
+// is original or thumbnail. The expires and signature query parameters of a
+// URL handed out with the photo are the only credential.
+func DownloadPhoto(ctx *gofr.Context) (interface{}, error) {
+	forbidden := gofr.NewError(http.StatusForbidden, "This photo link is invalid or has expired")
+
+	id, err := strconv.Atoi(ctx.PathParam("id"))
+	if err != nil {
+		return nil, forbidden
+	}
+	variant := ctx.PathParam("variant")
+	if variant != models.VariantOriginal && variant != models.VariantThumbnail {
+		return nil, gofr.NewError(http.StatusNotFound, "Unknown photo variant: "+variant)
+	}
+	expires, err := strconv.ParseInt(ctx.QueryParam("expires"), 10, 64)
+	if err != nil {
+		return nil, forbidden
+	}
+
+	photo, err := models.GetPhotoByID(ctx.DB(), id)
+	if err != nil || !photo.VerifyDownload(variant, expires, ctx.QueryParam("signature"), time.Now()) {
+		return nil, forbidden
+	}
+
+	object, err := fileStore.Open(photo.Key(variant))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to read photo: "+err.Error())
+	}
+	defer object.Close()
+
+	// Caches may keep the image for as long as the link works, but only
+	// for this client unless the photo is public
+	cacheControl := "public, max-age=86400"
+	if expires != 0 {
+		cacheControl = "private, max-age=" + strconv.FormatInt(max(0, expires-time.Now().Unix()), 10)
+	}
+	ctx.ResponseWriter().Header().Set("Cache-Control", cacheControl)
+	ctx.ResponseWriter().Header().Set("X-Content-Type-Options", "nosniff")
+
+	return writeRaw(ctx, photo.ContentType, "", func(w io.Writer) error {
+		_, err := io.Copy(w, object)
+		return err
+	})
+}
+
+// applyPhotoFields sets the date, pose and visibility of a photo from
+// request values, leaving those that are empty unchanged
+func applyPhotoFields(photo *models.Photo, date, pose, visibility string) error {
+	if date != "" {
+		parsed, err := parseDate(date)
+		if err != nil {
+			return gofr.NewError(http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		}
+		photo.Date = parsed
+	}
+	if pose != "" {
+		if !models.IsValidPose(pose) {
+			return gofr.NewError(http.StatusBadRequest, "Unknown pose: "+pose)
+		}
+		photo.Pose = pose
+	}
+	if visibility != "" {
+		if visibility != models.VisibilityPrivate && visibility != models.VisibilityPublic {
+			return gofr.NewError(http.StatusBadRequest, "Visibility must be private or public")
+		}
+		photo.Visibility = visibility
+	}
+	return nil
+}
+
+// photoURLExpiry returns when photo URLs handed out now expire
+func photoURLExpiry() time.Time {
+	return time.Now().Add(models.PhotoURLLifetime()).Truncate(time.Second)
+}
+
+// isPhotoOwner reports whether the acting user, given by the optional user_id
+// query parameter, owns photos of ownerID
+func isPhotoOwner(ctx *gofr.Context, ownerID int) (bool, error) {
+	userID, err := intQueryParam(ctx, "user_id")
+	if err != nil {
+		return false, err
+	}
+	return userID == ownerID, nil
+}
+
+// checkPhotoOwner checks that the acting user, given by the user_id query
+// parameter, owns photos of ownerID
+func checkPhotoOwner(ctx *gofr.Context, ownerID int) error {
+	userID, err := actingUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if userID != ownerID {
+		return gofr.NewError(http.StatusForbidden, "Only the owner can do this with their photos")
+	}
+	return nil
+}
+
+// userPhoto resolves the {id} photo of the {userId} user
+func userPhoto(ctx *gofr.Context) (models.Photo, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return models.Photo{}, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Photo{}, gofr.NewError(http.StatusBadRequest, "Invalid photo ID")
+	}
+
+	photo, err := models.GetPhoto(ctx.DB(), id, userID)
+	if err != nil {
+		return photo, gofr.NewError(http.StatusNotFound, "Photo not found")
+	}
+	return photo, nil
+}
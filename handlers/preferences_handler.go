@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetUserPreferences handles the GET /users/{userId}/preferences request
+func GetUserPreferences(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+	return prefs, nil
+}
+
+// UpdateUserPreferences handles the PUT /users/{userId}/preferences request
+func UpdateUserPreferences(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	existingPrefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	// Fields missing from the body keep their current values
+	prefs := existingPrefs
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&prefs); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	prefs.UserID = userID
+	prefs.FirstDayOfWeek = strings.ToLower(prefs.FirstDayOfWeek)
+
+	// Validate the preferences
+	if !models.IsValidWeightUnit(prefs.WeightUnit) || !models.IsValidDistanceUnit(prefs.DistanceUnit) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Weight unit must be kg or lb and distance unit km or mi")
+	}
+	if !models.IsValidWeekday(prefs.FirstDayOfWeek) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid first day of week")
+	}
+	if _, err := time.LoadLocation(prefs.TimeZone); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid time zone")
+	}
+	if !models.IsValidFormula(prefs.E1RMFormula) {
+		return nil, gofr.NewError(http.StatusBadRequest, "e1RM formula must be epley, brzycki or wathan")
+	}
+	if prefs.PlateIncrement < 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "Plate increment cannot be negative")
+	}
+
+	// The plate increment is expressed in the weight unit, so switching units
+	// without a new increment falls back to that unit's default
+	if prefs.WeightUnit != existingPrefs.WeightUnit && prefs.PlateIncrement == existingPrefs.PlateIncrement {
+		prefs.PlateIncrement = models.DefaultPlateIncrement(prefs.WeightUnit)
+	}
+	if prefs.PlateIncrement == 0 {
+		prefs.PlateIncrement = models.DefaultPlateIncrement(prefs.WeightUnit)
+	}
+
+	if err := models.SavePreferences(ctx.DB(), prefs); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to save preferences: "+err.Error())
+	}
+
+	// Records and analytics intensity depend on the e1RM formula
+	if prefs.E1RMFormula != existingPrefs.E1RMFormula {
+		if err := models.RebuildForFormula(ctx.DB(), userID, prefs.E1RMFormula); err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update records and analytics: "+err.Error())
+		}
+	}
+
+	// Return the saved preferences
+	savedPrefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Preferences saved but failed to retrieve")
+	}
+
+	return savedPrefs, nil
+}
+
+// requestUnits returns the units a request is expressed in: the units= query
+// override if present, otherwise the preferences of the given user
+func requestUnits(ctx *gofr.Context, userID int) (models.Units, models.Preferences, error) {
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return models.Units{}, prefs, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	override := ctx.QueryParam("units")
+	if override == "" {
+		return prefs.Units(), prefs, nil
+	}
+
+	units, err := models.ParseUnits(override)
+	if err != nil {
+		return models.Units{}, prefs, gofr.NewError(http.StatusBadRequest, "Invalid units: "+err.Error())
+	}
+	return units, prefs, nil
+}
+
+// requestFormula returns the e1RM formula for a request: the formula= query
+// override if present, otherwise the user's preferred formula
+func requestFormula(ctx *gofr.Context, prefs models.Preferences) (string, error) {
+	formula := ctx.QueryParam("formula")
+	if formula == "" {
+		return prefs.E1RMFormula, nil
+	}
+	if !models.IsValidFormula(formula) {
+		return "", gofr.NewError(http.StatusBadRequest, "Formula must be epley, brzycki or wathan")
+	}
+	return formula, nil
+}
+
+// viewerID returns the user a workout response is rendered for: the user_id
+// query parameter if present, otherwise the workout's owner. It picks units
+// only; access checks use actingUserID.
+func viewerID(ctx *gofr.Context, ownerID int) (int, error) {
+	userIDStr := ctx.QueryParam("user_id")
+	if userIDStr == "" {
+		return ownerID, nil
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return 0, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	return userID, nil
+}
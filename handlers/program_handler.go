@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetPrograms handles the GET /programs request
+func GetPrograms(ctx *gofr.Context) (interface{}, error) {
+	// Check if user_id query parameter is provided
+	userID, err := intQueryParam(ctx, "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	programs, err := models.GetPrograms(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch programs: "+err.Error())
+	}
+
+	// If no programs are found, return an empty array instead of null
+	if programs == nil {
+		programs = []models.Program{}
+	}
+
+	return programs, nil
+}
+
+// GetProgram handles the GET /programs/{id} request
+func GetProgram(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid program ID")
+	}
+
+	program, err := models.GetProgram(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Program not found")
+	}
+
+	units, _, err := requestUnits(ctx, program.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.InUnits(units), nil
+}
+
+// CreateProgram handles the POST /programs request
+func CreateProgram(ctx *gofr.Context) (interface{}, error) {
+	var program models.Program
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&program); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if program.ProgressionType == "" {
+		program.ProgressionType = models.ProgressionNone
+	}
+
+	// Validate the program and the workouts it uses
+	if err := validateProgram(ctx, program); err != nil {
+		return nil, err
+	}
+
+	// Convert the load increment from the author's units
+	units, _, err := requestUnits(ctx, program.UserID)
+	if err != nil {
+		return nil, err
+	}
+	program = program.FromUnits(units)
+
+	// Create the program
+	id, err := models.CreateProgram(ctx.DB(), program)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create program: "+err.Error())
+	}
+
+	// Return the created program
+	createdProgram, err := models.GetProgram(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Program created but failed to retrieve")
+	}
+
+	return createdProgram.InUnits(units), nil
+}
+
+// UpdateProgram handles the PUT /programs/{id} request
+func UpdateProgram(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid program ID")
+	}
+
+	// Check if program exists
+	existingProgram, err := models.GetProgram(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Program not found")
+	}
+
+	var program models.Program
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&program); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	program.ID = id
+	program.UserID = existingProgram.UserID // Preserve the original author
+	if program.ProgressionType == "" {
+		program.ProgressionType = models.ProgressionNone
+	}
+
+	if err := validateProgram(ctx, program); err != nil {
+		return nil, err
+	}
+
+	units, _, err := requestUnits(ctx, program.UserID)
+	if err != nil {
+		return nil, err
+	}
+	program = program.FromUnits(units)
+
+	// Update the program; schedules of enrolled users keep their snapshot
+	if err := models.UpdateProgram(ctx.DB(), program); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update program: "+err.Error())
+	}
+
+	// Return the updated program
+	updatedProgram, err := models.GetProgram(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Program updated but failed to retrieve")
+	}
+
+	return updatedProgram.InUnits(units), nil
+}
+
+// DeleteProgram handles the DELETE /programs/{id} request
+func DeleteProgram(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid program ID")
+	}
+
+	// Check if program exists
+	program, err := models.GetProgram(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Program not found")
+	}
+
+	// Delete the program; enrollments keep their materialized schedule
+	if err := models.DeleteProgram(ctx.DB(), id, program.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete program: "+err.Error())
+	}
+
+	return map[string]string{"message": "Program deleted successfully"}, nil
+}
+
+// EnrollInProgram handles the POST /programs/{id}/enroll request
+func EnrollInProgram(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid program ID")
+	}
+
+	program, err := models.GetProgram(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Program not found")
+	}
+
+	var requestBody struct {
+		UserID        int             `json:"user_id"`
+		StartDate     string          `json:"start_date"`
+		TrainingMaxes map[int]float64 `json:"training_maxes"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if requestBody.UserID == 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), requestBody.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, requestBody.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment := models.Enrollment{
+		UserID:        requestBody.UserID,
+		StartDate:     prefs.Today(),
+		TrainingMaxes: map[int]float64{},
+	}
+	if requestBody.StartDate != "" {
+		enrollment.StartDate, err = parseDate(requestBody.StartDate)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD")
+		}
+	}
+
+	// Training maxes are given in the user's units
+	for exerciseID, tm := range requestBody.TrainingMaxes {
+		if tm <= 0 {
+			return nil, gofr.NewError(http.StatusBadRequest, "Training maxes must be positive")
+		}
+		enrollment.TrainingMaxes[exerciseID] = units.WeightToKg(tm)
+	}
+
+	rounding := models.LoadRounding{Units: units, Increment: prefs.IncrementFor(units)}
+	enrollmentID, err := models.Enroll(ctx.DB(), enrollment, program, rounding)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to enroll in program: "+err.Error())
+	}
+
+	// Return the enrollment with its schedule
+	createdEnrollment, err := models.GetEnrollment(ctx.DB(), enrollmentID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Enrolled but failed to retrieve enrollment")
+	}
+
+	return createdEnrollment.InUnits(units, prefs.IncrementFor(units)), nil
+}
+
+// validateProgram checks a program and that the workouts it uses exist
+func validateProgram(ctx *gofr.Context, program models.Program) error {
+	if err := program.Validate(); err != nil {
+		return gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	checked := make(map[int]bool)
+	for _, day := range program.Days {
+		if checked[day.WorkoutID] {
+			continue
+		}
+		checked[day.WorkoutID] = true
+
+		if _, err := models.GetWorkout(ctx.DB(), day.WorkoutID); err != nil {
+			return gofr.NewError(http.StatusNotFound, "Workout "+strconv.Itoa(day.WorkoutID)+" not found")
+		}
+	}
+
+	return nil
+}
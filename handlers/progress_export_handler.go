@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// progressExportFlushRows is how many rows are written between flushes, so
+// the client receives the export as it is read
+const progressExportFlushRows = 500
+
+// ExportUserProgress handles the GET /users/{userId}/progress/export request.
+// It streams the user's progress, oldest first, as CSV (format=csv, the
+// default) or newline-delimited JSON (format=ndjson), with workout and
+// exercise names and loads and distances in the user's units. It takes the
+// same filters as GET /users/{userId}/progress.
+func ExportUserProgress(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	formula, err := requestFormula(ctx, prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := progressFilter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	format := ctx.QueryParam("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		return nil, gofr.NewError(http.StatusBadRequest, "format must be csv or ndjson")
+	}
+
+	bodyweights, err := models.GetBodyweights(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch bodyweight: "+err.Error())
+	}
+
+	// Query before writing anything, so a failure can still be reported
+	cursor, err := models.QueryProgressExport(ctx.DB(), userID, filter)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to export progress: "+err.Error())
+	}
+	defer cursor.Close()
+
+	filename := "progress-" + userIDStr + "." + format
+	if format == "ndjson" {
+		return writeRaw(ctx, "application/x-ndjson", filename, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			return streamProgressExport(cursor, units, formula, bodyweights, func(row models.ProgressExport) error {
+				return encoder.Encode(row)
+			}, func() {
+				flushResponse(w)
+			})
+		})
+	}
+
+	return writeRaw(ctx, "text/csv; charset=utf-8", filename, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.Write(models.ProgressCSVHeader(units)); err != nil {
+			return err
+		}
+		err := streamProgressExport(cursor, units, formula, bodyweights, func(row models.ProgressExport) error {
+			return writer.Write(row.CSVRecord())
+		}, func() {
+			writer.Flush()
+			flushResponse(w)
+		})
+		writer.Flush()
+		if err != nil {
+			return err
+		}
+		return writer.Error()
+	})
+}
+
+// streamProgressExport converts each row of the cursor into units and writes
+// it, flushing every progressExportFlushRows rows
+func streamProgressExport(cursor *models.ProgressCursor, units models.Units, formula string, bodyweights models.Bodyweights, write func(models.ProgressExport) error, flush func()) error {
+	count := 0
+	for cursor.Next() {
+		row, err := cursor.Row()
+		if err != nil {
+			return err
+		}
+		row.Progress = row.Progress.WithFormula(formula).WithBodyweight(bodyweights.On(row.Date)).InUnits(units)
+		if err := write(row); err != nil {
+			return err
+		}
+
+		count++
+		if count%progressExportFlushRows == 0 {
+			flush()
+		}
+	}
+	return cursor.Err()
+}
+
+// flushResponse pushes what has been written so far to the client when the
+// response writer supports it
+func flushResponse(w io.Writer) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -18,34 +18,78 @@ func GetUserProgress(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
 	}
 
-	// Check if exercise_id query parameter is provided
-	exerciseIDStr := ctx.QueryParam("exercise_id")
-	if exerciseIDStr != "" {
-		exerciseID, err := strconv.Atoi(exerciseIDStr)
-		if err != nil {
-			return nil, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
-		}
-		
-		// Get progress for specific exercise
-		progress, err := models.GetExerciseProgress(ctx.DB(), userID, exerciseID)
-		if err != nil {
-			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch progress: "+err.Error())
-		}
-		return progress, nil
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	formula, err := requestFormula(ctx, prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := progressFilter(ctx)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Get all progress for user
-	progress, err := models.GetUserProgress(ctx.DB(), userID)
+
+	progress, err := models.QueryProgress(ctx.DB(), userID, filter)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch progress: "+err.Error())
 	}
-	
-	// If no progress is found, return an empty array instead of null
-	if progress == nil {
-		progress = []models.Progress{}
+
+	bodyweights, err := models.GetBodyweights(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch bodyweight: "+err.Error())
+	}
+
+	converted := progressForResponse(progress, units, formula, bodyweights)
+
+	// Optionally group the records by date
+	switch ctx.QueryParam("group_by") {
+	case "":
+		return converted, nil
+	case "date":
+		return models.GroupProgressByDate(converted), nil
+	default:
+		return nil, gofr.NewError(http.StatusBadRequest, "group_by must be date")
 	}
-	
-	return progress, nil
+}
+
+// progressFilter builds a progress filter from the query parameters; all of
+// them combine
+func progressFilter(ctx *gofr.Context) (models.ProgressFilter, error) {
+	var filter models.ProgressFilter
+	var err error
+	if filter.ExerciseID, err = intQueryParam(ctx, "exercise_id"); err != nil {
+		return filter, err
+	}
+	if filter.WorkoutID, err = intQueryParam(ctx, "workout_id"); err != nil {
+		return filter, err
+	}
+	if filter.SessionID, err = intQueryParam(ctx, "session_id"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = dateQueryParam(ctx, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = dateQueryParam(ctx, "to"); err != nil {
+		return filter, err
+	}
+	filter.Notes = ctx.QueryParam("notes")
+	return filter, nil
+}
+
+// progressForResponse estimates e1RMs with formula, adds the metrics that
+// depend on the bodyweight of each record's day and converts progress
+// records into units. It never returns nil, so an empty history is encoded as
+// an empty array.
+func progressForResponse(progress []models.Progress, units models.Units, formula string, bodyweights models.Bodyweights) []models.Progress {
+	converted := make([]models.Progress, 0, len(progress))
+	for _, p := range progress {
+		converted = append(converted, p.WithFormula(formula).WithBodyweight(bodyweights.On(p.Date)).InUnits(units))
+	}
+	return converted
 }
 
 // RecordUserProgress handles the POST /users/{userId}/progress request
@@ -55,6 +99,9 @@ func RecordUserProgress(ctx *gofr.Context) (interface{}, error) {
 	if err != nil {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
 	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
 
 	var progress models.Progress
 	if err := json.NewDecoder(ctx.Request().Body).Decode(&progress); err != nil {
@@ -64,14 +111,62 @@ func RecordUserProgress(ctx *gofr.Context) (interface{}, error) {
 	// Set user ID from path parameter
 	progress.UserID = userID
 
+	// Convert loads and distances from the caller's units
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	progress = progress.FromUnits(units)
+
 	// Validate required fields
-	if progress.WorkoutID == 0 || progress.ExerciseID == 0 || progress.Sets == 0 || progress.Reps == 0 {
-		return nil, gofr.NewError(http.StatusBadRequest, "Workout ID, exercise ID, sets, and reps are required")
+	if (progress.WorkoutID == 0 && progress.SessionID == 0) || progress.ExerciseID == 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "Exercise ID and a workout or session ID are required")
 	}
 
-	// If date is not provided, use current date
+	// Validate the logged fields against the exercise's tracking type
+	exercise, err := models.GetExercise(ctx.DB(), progress.ExerciseID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
+	}
+
+	measurements, err := models.NormalizeMeasurements(exercise.TrackingType, progress.Measurements())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+	progress.SetMeasurements(measurements)
+
+	if progress.RPE < 0 || progress.RPE > 10 {
+		return nil, gofr.NewError(http.StatusBadRequest, "RPE must be between 0 and 10")
+	}
+
+	// If date is not provided, use the current date in the user's time zone
 	if progress.Date.IsZero() {
-		progress.Date = time.Now()
+		progress.Date = prefs.Today()
+	}
+
+	// Attach the entry to the given session, or to the session of this
+	// workout on this day
+	if progress.SessionID != 0 {
+		session, err := models.GetSession(ctx.DB(), progress.SessionID)
+		if err != nil || session.UserID != userID {
+			return nil, gofr.NewError(http.StatusNotFound, "Session not found")
+		}
+		progress.WorkoutID = session.WorkoutID
+		progress.Date = session.Date
+	} else {
+		// The workout must be one the user can train with
+		workout, err := models.GetWorkout(ctx.DB(), progress.WorkoutID)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
+		}
+		if err := checkWorkoutAccessFor(ctx, workout, userID); err != nil {
+			return nil, err
+		}
+
+		progress.SessionID, err = models.GetOrCreateSession(ctx.DB(), userID, progress.WorkoutID, progress.Date)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create session: "+err.Error())
+		}
 	}
 
 	// Record progress
@@ -80,12 +175,202 @@ func RecordUserProgress(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to record progress: "+err.Error())
 	}
 
+	// Mark the program day this workout was planned for as done
+	if err := models.CompleteProgramSessions(ctx.DB(), userID, progress.WorkoutID, progress.Date, progress.SessionID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Progress recorded but failed to update program: "+err.Error())
+	}
+
+	// Check the new entry against the user's personal records. e1RM records
+	// are kept with the user's preferred formula.
+	progress.ID = id
+	progress.TrackingType = exercise.TrackingType
+	records, err := models.DetectRecords(ctx.DB(), progress, prefs.E1RMFormula)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Progress recorded but failed to check records: "+err.Error())
+	}
+
+	// Keep the analytics rollups from the entry's day on up to date
+	if err := models.RefreshExerciseRollups(ctx.DB(), userID, progress.ExerciseID, progress.Date, prefs.E1RMFormula); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Progress recorded but failed to update analytics: "+err.Error())
+	}
+
+	newRecords := make([]models.PersonalRecord, 0, len(records))
+	for _, record := range records {
+		newRecords = append(newRecords, record.InUnits(units))
+	}
+
+	newAchievements, err := awardAchievements(ctx, userID, units, prefs)
+	if err != nil {
+		return nil, err
+	}
+
 	return map[string]interface{}{
-		"id": id,
-		"message": "Progress recorded successfully",
+		"id":               id,
+		"session_id":       progress.SessionID,
+		"message":          "Progress recorded successfully",
+		"new_records":      newRecords,
+		"new_achievements": newAchievements,
 	}, nil
 }
 
+// progressPatch holds the fields of a progress update; nil fields were not
+// sent and are left as they are
+type progressPatch struct {
+	WorkoutID  *int       `json:"workout_id"`
+	ExerciseID *int       `json:"exercise_id"`
+	SessionID  *int       `json:"session_id"`
+	Sets       *int       `json:"sets"`
+	Reps       *int       `json:"reps"`
+	Weight     *float64   `json:"weight"`
+	Duration   *int       `json:"duration"`
+	Distance   *float64   `json:"distance"`
+	RPE        *float64   `json:"rpe"`
+	Notes      *string    `json:"notes"`
+	Date       *time.Time `json:"date"`
+}
+
+// apply returns a copy of the stored record with the sent fields set. Loads
+// and distances are converted from u; stored values are never round-tripped
+// through display units.
+func (patch progressPatch) apply(p models.Progress, u models.Units) models.Progress {
+	if patch.WorkoutID != nil {
+		p.WorkoutID = *patch.WorkoutID
+	}
+	if patch.ExerciseID != nil {
+		p.ExerciseID = *patch.ExerciseID
+	}
+	if patch.SessionID != nil {
+		p.SessionID = *patch.SessionID
+	}
+	if patch.Sets != nil {
+		p.Sets = *patch.Sets
+	}
+	if patch.Reps != nil {
+		p.Reps = *patch.Reps
+	}
+	if patch.Weight != nil {
+		p.Weight = models.StoredWeightKg(u, *patch.Weight)
+	}
+	if patch.Duration != nil {
+		p.Duration = *patch.Duration
+	}
+	if patch.Distance != nil {
+		p.Distance = models.StoredDistanceMeters(u, *patch.Distance)
+	}
+	if patch.RPE != nil {
+		p.RPE = *patch.RPE
+	}
+	if patch.Notes != nil {
+		p.Notes = *patch.Notes
+	}
+	if patch.Date != nil {
+		p.Date = *patch.Date
+	}
+	return p
+}
+
+// UpdateUserProgress handles the PATCH /users/{userId}/progress/{progressId} request
+func UpdateUserProgress(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	progressIDStr := ctx.PathParam("progressId")
+	progressID, err := strconv.Atoi(progressIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid progress ID")
+	}
+
+	// Check if the progress record exists and belongs to the user
+	existingProgress, err := models.GetProgress(ctx.DB(), progressID, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Progress record not found")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields missing from the body keep their stored values untouched
+	var patch progressPatch
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&patch); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	progress := patch.apply(existingProgress, units)
+
+	// Validate the logged fields against the exercise's tracking type. The
+	// exercise may have been deleted since; its progress is kept and can
+	// still be corrected, but not moved to another deleted exercise.
+	getExercise := models.GetExercise
+	if progress.ExerciseID == existingProgress.ExerciseID {
+		getExercise = models.GetExerciseIncludingTrashed
+	}
+	exercise, err := getExercise(ctx.DB(), progress.ExerciseID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
+	}
+
+	measurements, err := models.NormalizeMeasurements(exercise.TrackingType, progress.Measurements())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+	progress.SetMeasurements(measurements)
+
+	if progress.RPE < 0 || progress.RPE > 10 {
+		return nil, gofr.NewError(http.StatusBadRequest, "RPE must be between 0 and 10")
+	}
+
+	// Moving the entry to another workout or day moves it to that session,
+	// unless a session was given explicitly
+	if progress.SessionID != existingProgress.SessionID {
+		session, err := models.GetSession(ctx.DB(), progress.SessionID)
+		if err != nil || session.UserID != userID {
+			return nil, gofr.NewError(http.StatusNotFound, "Session not found")
+		}
+		progress.WorkoutID = session.WorkoutID
+		progress.Date = session.Date
+	} else if progress.WorkoutID != existingProgress.WorkoutID || !progress.Date.Equal(existingProgress.Date) {
+		// A new workout must be one the user can train with
+		if progress.WorkoutID != existingProgress.WorkoutID {
+			workout, err := models.GetWorkout(ctx.DB(), progress.WorkoutID)
+			if err != nil {
+				return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
+			}
+			if err := checkWorkoutAccessFor(ctx, workout, userID); err != nil {
+				return nil, err
+			}
+		}
+
+		progress.SessionID, err = models.GetOrCreateSession(ctx.DB(), userID, progress.WorkoutID, progress.Date)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create session: "+err.Error())
+		}
+	}
+
+	// Update progress, keeping the previous version
+	if err := models.UpdateProgress(ctx.DB(), existingProgress, progress); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update progress: "+err.Error())
+	}
+
+	if err := refreshDerivedProgress(ctx, prefs, existingProgress, progress); err != nil {
+		return nil, err
+	}
+
+	// Return the updated progress record
+	updatedProgress, err := models.GetProgress(ctx.DB(), progressID, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Progress updated but failed to retrieve")
+	}
+
+	return updatedProgress.WithFormula(prefs.E1RMFormula).InUnits(units), nil
+}
+
 // DeleteUserProgress handles the DELETE /users/{userId}/progress/{progressId} request
 func DeleteUserProgress(ctx *gofr.Context) (interface{}, error) {
 	userIDStr := ctx.PathParam("userId")
@@ -93,6 +378,9 @@ func DeleteUserProgress(ctx *gofr.Context) (interface{}, error) {
 	if err != nil {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
 	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
 
 	progressIDStr := ctx.PathParam("progressId")
 	progressID, err := strconv.Atoi(progressIDStr)
@@ -100,10 +388,109 @@ func DeleteUserProgress(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid progress ID")
 	}
 
-	// Delete progress
+	// Check if the progress record exists and belongs to the user
+	existingProgress, err := models.GetProgress(ctx.DB(), progressID, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Progress record not found")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	// Delete progress, keeping the deleted version
 	if err := models.DeleteProgress(ctx.DB(), progressID, userID); err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete progress: "+err.Error())
 	}
 
+	if err := refreshDerivedProgress(ctx, prefs, existingProgress); err != nil {
+		return nil, err
+	}
+
 	return map[string]string{"message": "Progress deleted successfully"}, nil
-}
\ No newline at end of file
+}
+
+// GetUserProgressHistory handles the GET /users/{userId}/progress/{progressId}/history request
+func GetUserProgressHistory(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	progressIDStr := ctx.PathParam("progressId")
+	progressID, err := strconv.Atoi(progressIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid progress ID")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := models.GetProgressRevisions(ctx.DB(), progressID, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch progress history: "+err.Error())
+	}
+
+	// The current version is missing once the record has been deleted
+	current, err := models.GetProgress(ctx.DB(), progressID, userID)
+	if err != nil && len(revisions) == 0 {
+		return nil, gofr.NewError(http.StatusNotFound, "Progress record not found")
+	}
+
+	for i := range revisions {
+		revisions[i].Previous = revisions[i].Previous.WithFormula(prefs.E1RMFormula).InUnits(units)
+	}
+	if revisions == nil {
+		revisions = []models.ProgressRevision{}
+	}
+
+	response := map[string]interface{}{
+		"revisions": revisions,
+	}
+	if err == nil {
+		response["current"] = current.WithFormula(prefs.E1RMFormula).InUnits(units)
+	}
+	return response, nil
+}
+
+// refreshDerivedProgress rebuilds the personal records and analytics rollups
+// affected by editing or deleting progress records, and awards any
+// achievements the changes earn
+func refreshDerivedProgress(ctx *gofr.Context, prefs models.Preferences, changed ...models.Progress) error {
+	// Each exercise's rollups are refreshed from its earliest changed day
+	earliest := make(map[int]time.Time)
+	var exerciseIDs []int
+
+	for _, progress := range changed {
+		from, seen := earliest[progress.ExerciseID]
+		if !seen {
+			exerciseIDs = append(exerciseIDs, progress.ExerciseID)
+			if err := models.RebuildRecords(ctx.DB(), progress.UserID, progress.ExerciseID, prefs.E1RMFormula); err != nil {
+				return gofr.NewError(http.StatusInternalServerError, "Failed to rebuild records: "+err.Error())
+			}
+		}
+		if !seen || progress.Date.Before(from) {
+			earliest[progress.ExerciseID] = progress.Date
+		}
+	}
+
+	for _, exerciseID := range exerciseIDs {
+		if err := models.RefreshExerciseRollups(ctx.DB(), changed[0].UserID, exerciseID, earliest[exerciseID], prefs.E1RMFormula); err != nil {
+			return gofr.NewError(http.StatusInternalServerError, "Failed to update analytics: "+err.Error())
+		}
+	}
+
+	// Achievements are never taken back, but restored or corrected
+	// records can earn new ones
+	if len(changed) > 0 {
+		if _, err := models.AwardAchievements(ctx.DB(), changed[0].UserID, prefs); err != nil {
+			return gofr.NewError(http.StatusInternalServerError, "Failed to check achievements: "+err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/cxocodehub/go-backend-workout/progression"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetNextPrescription handles the GET /workouts/{workoutId}/exercises/{exerciseId}/next request
+func GetNextPrescription(ctx *gofr.Context) (interface{}, error) {
+	next, err := computeNextPrescription(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return next.response(), nil
+}
+
+// ApplyNextPrescription handles the POST /workouts/{workoutId}/exercises/{exerciseId}/next
+// request. It stores the computed target as the entry's new prescription.
+func ApplyNextPrescription(ctx *gofr.Context) (interface{}, error) {
+	next, err := computeNextPrescription(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWorkoutOwner(ctx, next.workout); err != nil {
+		return nil, err
+	}
+
+	// The target goes through the same checks as a submitted prescription
+	we := next.entry
+	measurements, err := models.NormalizeMeasurements(next.trackingType, models.Measurements{
+		Sets:   next.result.Prescription.Sets,
+		Reps:   next.result.Prescription.Reps,
+		Weight: next.units.WeightToKg(next.result.Prescription.Weight),
+	})
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "The next target can't be saved: "+err.Error())
+	}
+	we.SetMeasurements(measurements)
+	if next.result.Prescription.RPE > 0 {
+		we.TargetRPE = next.result.Prescription.RPE
+	}
+	if err := validateProgression(&we, next.trackingType); err != nil {
+		return nil, err
+	}
+
+	if err := models.UpdateWorkoutExercise(ctx.DB(), we); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update workout exercise: "+err.Error())
+	}
+
+	return next.response(), nil
+}
+
+// nextPrescription holds a computed target and what it was computed from
+type nextPrescription struct {
+	userID       int
+	workout      models.Workout
+	entry        models.WorkoutExercise
+	trackingType string
+	units        models.Units
+	result       progression.Result
+}
+
+func (n nextPrescription) response() map[string]interface{} {
+	return map[string]interface{}{
+		"workout_id":  n.entry.WorkoutID,
+		"exercise_id": n.entry.ExerciseID,
+		"user_id":     n.userID,
+		"units":       n.units,
+		"next":        n.result,
+	}
+}
+
+// computeNextPrescription runs the entry's progression strategy over the
+// user's history for the exercise, in the user's units
+func computeNextPrescription(ctx *gofr.Context) (nextPrescription, error) {
+	var next nextPrescription
+
+	workoutIDStr := ctx.PathParam("workoutId")
+	workoutID, err := strconv.Atoi(workoutIDStr)
+	if err != nil {
+		return next, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+	}
+
+	exerciseIDStr := ctx.PathParam("exerciseId")
+	exerciseID, err := strconv.Atoi(exerciseIDStr)
+	if err != nil {
+		return next, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
+	}
+
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
+	if err != nil {
+		return next, gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+	if err := checkWorkoutAccess(ctx, workout); err != nil {
+		return next, err
+	}
+	next.workout = workout
+
+	next.entry, err = models.GetWorkoutExercise(ctx.DB(), workoutID, exerciseID)
+	if err != nil {
+		return next, gofr.NewError(http.StatusNotFound, "Exercise is not part of this workout")
+	}
+
+	exercise, err := models.GetExercise(ctx.DB(), exerciseID)
+	if err != nil {
+		return next, gofr.NewError(http.StatusNotFound, "Exercise not found")
+	}
+	next.trackingType = exercise.TrackingType
+	if !models.SupportsProgression(exercise.TrackingType) {
+		return next, gofr.NewError(http.StatusBadRequest, "Progression targets are only computed for reps and load or reps-only exercises")
+	}
+
+	strategy, ok := progression.Get(next.entry.Progression)
+	if !ok {
+		return next, gofr.NewError(http.StatusBadRequest, "Unknown progression strategy: "+next.entry.Progression)
+	}
+	if err := checkStrategyFits(next.entry.Progression, exercise.TrackingType); err != nil {
+		return next, err
+	}
+
+	// The lifter is the user_id query parameter, already checked for access
+	next.userID, err = actingUserID(ctx)
+	if err != nil {
+		return next, err
+	}
+
+	units, prefs, err := requestUnits(ctx, next.userID)
+	if err != nil {
+		return next, err
+	}
+	next.units = units
+	increment := prefs.IncrementFor(units)
+
+	history, err := models.QueryProgress(ctx.DB(), next.userID, models.ProgressFilter{ExerciseID: exerciseID})
+	if err != nil {
+		return next, gofr.NewError(http.StatusInternalServerError, "Failed to fetch progress: "+err.Error())
+	}
+
+	entries := make([]progression.Entry, 0, len(history))
+	for _, p := range history {
+		p = p.InUnits(units)
+		entries = append(entries, progression.Entry{Date: p.Date, Sets: p.Sets, Reps: p.Reps, Weight: p.Weight, RPE: p.RPE})
+	}
+
+	// Reps-only exercises carry no load to add
+	if exercise.TrackingType == models.TrackingReps {
+		increment = 0
+	}
+
+	current := next.entry.InUnits(units, increment)
+	params := progression.Params{
+		Increment:   increment,
+		RepsMin:     current.RepsMin,
+		RepsMax:     current.RepsMax,
+		TargetRPE:   current.TargetRPE,
+		TrainingMax: current.TrainingMax,
+	}
+	if current.CycleStart != nil {
+		params.CycleStart = *current.CycleStart
+	}
+
+	next.result = strategy.Next(progression.Prescription{
+		Sets:   current.Sets,
+		Reps:   current.Reps,
+		Weight: current.Weight,
+		RPE:    current.TargetRPE,
+	}, entries, params)
+
+	return next, nil
+}
+
+// validateProgression checks an entry's progression settings for the
+// exercise's tracking type, defaulting to linear progression, or double for
+// reps-only exercises. Exercises not tracked by sets and reps have no
+// progression.
+func validateProgression(we *models.WorkoutExercise, trackingType string) error {
+	if !models.SupportsProgression(trackingType) {
+		if we.Progression != "" {
+			return gofr.NewError(http.StatusBadRequest, "Progression strategies only apply to reps and load or reps-only exercises")
+		}
+		return nil
+	}
+
+	if we.Progression == "" {
+		we.Progression = "linear"
+		if trackingType == models.TrackingReps {
+			we.Progression = "double"
+		}
+	}
+	if _, ok := progression.Get(we.Progression); !ok {
+		return gofr.NewError(http.StatusBadRequest, "Unknown progression strategy: "+we.Progression)
+	}
+	if err := checkStrategyFits(we.Progression, trackingType); err != nil {
+		return err
+	}
+	if we.RepsMin < 0 || we.RepsMax < 0 || (we.RepsMax > 0 && we.RepsMax < we.RepsMin) {
+		return gofr.NewError(http.StatusBadRequest, "Invalid rep range")
+	}
+	if we.TargetRPE < 0 || we.TargetRPE > 10 {
+		return gofr.NewError(http.StatusBadRequest, "Target RPE must be between 0 and 10")
+	}
+	if we.TrainingMax < 0 {
+		return gofr.NewError(http.StatusBadRequest, "Training max cannot be negative")
+	}
+	return nil
+}
+
+// checkStrategyFits checks that a strategy suits the exercise's tracking
+// type. Reps-only exercises carry no load, so they can only progress reps.
+func checkStrategyFits(strategy, trackingType string) error {
+	if trackingType == models.TrackingReps && strategy != "double" {
+		return gofr.NewError(http.StatusBadRequest, "Reps-only exercises can only use double progression")
+	}
+	return nil
+}
+
+// restartCycle starts a new cycle for an entry on the owner's today when the
+// entry is new or its strategy or training max changed. Otherwise the cycle
+// carries on.
+func restartCycle(ctx *gofr.Context, workout models.Workout, we *models.WorkoutExercise) error {
+	existing, err := models.GetWorkoutExercise(ctx.DB(), we.WorkoutID, we.ExerciseID)
+	if err == nil && existing.Progression == we.Progression &&
+		math.Round(existing.TrainingMax*100) == math.Round(we.TrainingMax*100) {
+		return nil
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), workout.UserID)
+	if err != nil {
+		return gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+	today := prefs.Today()
+	we.CycleStart = &today
+	return nil
+}
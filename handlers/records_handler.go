@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetUserRecords handles the GET /users/{userId}/records request
+func GetUserRecords(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if exercise_id query parameter is provided
+	exerciseID := 0
+	exerciseIDStr := ctx.QueryParam("exercise_id")
+	if exerciseIDStr != "" {
+		exerciseID, err = strconv.Atoi(exerciseIDStr)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
+		}
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// e1RM records are kept per formula; only show the requested one, or
+	// the user's own formula by default
+	formula, err := requestFormula(ctx, prefs)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := models.GetUserRecords(ctx.DB(), userID, exerciseID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch records: "+err.Error())
+	}
+
+	filtered := make([]models.PersonalRecord, 0, len(history))
+	for _, record := range history {
+		if record.RecordType == models.RecordBestE1RM && record.Formula != formula {
+			continue
+		}
+		filtered = append(filtered, record.InUnits(units))
+	}
+
+	return map[string]interface{}{
+		"current": models.CurrentRecords(filtered),
+		"history": filtered,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetUserReport handles the GET /users/{userId}/reports/{period} request,
+// where period is week or month. It builds the report for the period
+// containing start, or for the last period to have ended, as JSON or, with
+// format=html or format=text, as the body of the report email.
+func GetUserReport(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	user, err := models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	period := ctx.PathParam("period")
+	if !models.IsValidReportPeriod(period) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Period must be week or month")
+	}
+	format := ctx.QueryParam("format")
+	if format != "" && format != "json" && format != "html" && format != "text" {
+		return nil, gofr.NewError(http.StatusBadRequest, "Format must be json, html or text")
+	}
+	start, err := dateQueryParam(ctx, "start")
+	if err != nil {
+		return nil, err
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if start.IsZero() {
+		start = models.LastReportPeriod(period, prefs.Today(), prefs.WeekStart())
+	} else {
+		start = models.BucketStart(period, start, prefs.WeekStart())
+	}
+
+	report, err := models.BuildReport(ctx.DB(), userID, period, start, prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to build report: "+err.Error())
+	}
+	report = report.InUnits(units)
+
+	if format == "" || format == "json" {
+		return report, nil
+	}
+
+	email, err := models.RenderReport(report, user.Username)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to render report: "+err.Error())
+	}
+	if format == "html" {
+		return writeRaw(ctx, "text/html; charset=utf-8", "", func(w io.Writer) error {
+			_, err := io.WriteString(w, email.HTML)
+			return err
+		})
+	}
+	return writeRaw(ctx, "text/plain; charset=utf-8", "", func(w io.Writer) error {
+		_, err := io.WriteString(w, email.Text)
+		return err
+	})
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gofr-dev/gofr"
+)
+
+// writeRaw writes a non-JSON response such as a file or feed straight to the
+// response writer. The handler returns nothing for the framework to encode.
+func writeRaw(ctx *gofr.Context, contentType, filename string, write func(io.Writer) error) (interface{}, error) {
+	w := ctx.ResponseWriter()
+	w.Header().Set("Content-Type", contentType)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	return nil, write(w)
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// defaultCalendarDays is how far ahead the calendar looks without a to date
+const defaultCalendarDays = 28
+
+// scheduleRequest is the request body for creating or updating a schedule
+type scheduleRequest struct {
+	WorkoutID       int    `json:"workout_id"`
+	StartDate       string `json:"start_date"`
+	RRule           string `json:"rrule"`
+	StartTime       string `json:"start_time"`
+	DurationMinutes *int   `json:"duration_minutes"`
+}
+
+// apply validates the request and copies it onto a schedule
+func (r scheduleRequest) apply(ctx *gofr.Context, schedule *models.Schedule) error {
+	if r.WorkoutID == 0 {
+		return gofr.NewError(http.StatusBadRequest, "Workout ID is required")
+	}
+
+	// The schedule's user must be able to read the workout, since its name
+	// and exercises show up in their calendar
+	workout, err := models.GetWorkout(ctx.DB(), r.WorkoutID)
+	if err != nil {
+		return gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+	if err := checkWorkoutAccessFor(ctx, workout, schedule.UserID); err != nil {
+		return err
+	}
+
+	if r.StartDate == "" {
+		return gofr.NewError(http.StatusBadRequest, "Start date is required")
+	}
+	startDate, err := parseDate(r.StartDate)
+	if err != nil {
+		return gofr.NewError(http.StatusBadRequest, "Invalid start date, expected YYYY-MM-DD")
+	}
+
+	if r.RRule != "" {
+		if _, err := models.ParseRRule(r.RRule); err != nil {
+			return gofr.NewError(http.StatusBadRequest, "Invalid recurrence rule: "+err.Error())
+		}
+	}
+
+	if r.StartTime != "" {
+		if _, err := time.Parse("15:04", r.StartTime); err != nil {
+			return gofr.NewError(http.StatusBadRequest, "Invalid start time, expected HH:MM")
+		}
+	}
+
+	schedule.WorkoutID = r.WorkoutID
+	schedule.StartDate = startDate
+	schedule.RRule = r.RRule
+	schedule.StartTime = r.StartTime
+	if schedule.DurationMinutes == 0 {
+		schedule.DurationMinutes = 60
+	}
+	if r.DurationMinutes != nil {
+		if *r.DurationMinutes <= 0 {
+			return gofr.NewError(http.StatusBadRequest, "Duration must be positive")
+		}
+		schedule.DurationMinutes = *r.DurationMinutes
+	}
+	return nil
+}
+
+// GetUserSchedules handles the GET /users/{userId}/schedules request
+func GetUserSchedules(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	schedules, err := models.GetUserSchedules(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch schedules: "+err.Error())
+	}
+
+	// If no schedules are found, return an empty array instead of null
+	if schedules == nil {
+		schedules = []models.Schedule{}
+	}
+
+	return schedules, nil
+}
+
+// GetSchedule handles the GET /schedules/{id} request
+func GetSchedule(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	schedule, err := models.GetSchedule(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Schedule not found")
+	}
+
+	return schedule, nil
+}
+
+// CreateSchedule handles the POST /users/{userId}/schedules request
+func CreateSchedule(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Check if user exists
+	_, err = models.GetUser(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	var requestBody scheduleRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	schedule := models.Schedule{UserID: userID}
+	if err := requestBody.apply(ctx, &schedule); err != nil {
+		return nil, err
+	}
+
+	id, err := models.CreateSchedule(ctx.DB(), schedule)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to create schedule: "+err.Error())
+	}
+
+	return map[string]interface{}{
+		"id":      id,
+		"message": "Schedule created successfully",
+	}, nil
+}
+
+// UpdateSchedule handles the PUT /schedules/{id} request
+func UpdateSchedule(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	// Check if schedule exists
+	schedule, err := models.GetSchedule(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Schedule not found")
+	}
+	if err := checkActiveUser(ctx, schedule.UserID); err != nil {
+		return nil, err
+	}
+
+	var requestBody scheduleRequest
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := requestBody.apply(ctx, &schedule); err != nil {
+		return nil, err
+	}
+
+	if err := models.UpdateSchedule(ctx.DB(), schedule); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update schedule: "+err.Error())
+	}
+
+	return map[string]string{"message": "Schedule updated successfully"}, nil
+}
+
+// DeleteSchedule handles the DELETE /schedules/{id} request
+func DeleteSchedule(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	// Check if schedule exists
+	schedule, err := models.GetSchedule(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Schedule not found")
+	}
+	if err := checkActiveUser(ctx, schedule.UserID); err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteSchedule(ctx.DB(), id, schedule.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete schedule: "+err.Error())
+	}
+
+	return map[string]string{"message": "Schedule deleted successfully"}, nil
+}
+
+// scheduleOccurrence resolves the schedule and occurrence date of an
+// occurrence request, checking that the date is one of its occurrences
+func scheduleOccurrence(ctx *gofr.Context) (models.Schedule, time.Time, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Schedule{}, time.Time{}, gofr.NewError(http.StatusBadRequest, "Invalid schedule ID")
+	}
+
+	schedule, err := models.GetSchedule(ctx.DB(), id)
+	if err != nil {
+		return schedule, time.Time{}, gofr.NewError(http.StatusNotFound, "Schedule not found")
+	}
+	if err := checkActiveUser(ctx, schedule.UserID); err != nil {
+		return schedule, time.Time{}, err
+	}
+
+	date, err := parseDate(ctx.PathParam("date"))
+	if err != nil {
+		return schedule, date, gofr.NewError(http.StatusBadRequest, "Invalid occurrence date, expected YYYY-MM-DD")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), schedule.UserID)
+	if err != nil {
+		return schedule, date, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+	if !schedule.IsOccurrence(date, prefs.WeekStart()) {
+		return schedule, date, gofr.NewError(http.StatusNotFound, "Schedule has no occurrence on that date")
+	}
+
+	return schedule, date, nil
+}
+
+// SkipScheduleOccurrence handles the POST /schedules/{id}/occurrences/{date}/skip request
+func SkipScheduleOccurrence(ctx *gofr.Context) (interface{}, error) {
+	schedule, date, err := scheduleOccurrence(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	exception := models.ScheduleException{OccurrenceDate: date, Action: models.ExceptionSkip}
+	if err := models.SaveScheduleException(ctx.DB(), schedule.ID, exception); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to skip occurrence: "+err.Error())
+	}
+
+	return map[string]string{"message": "Occurrence skipped successfully"}, nil
+}
+
+// MoveScheduleOccurrence handles the POST /schedules/{id}/occurrences/{date}/move
+// request. The body gives the new date.
+func MoveScheduleOccurrence(ctx *gofr.Context) (interface{}, error) {
+	schedule, date, err := scheduleOccurrence(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var requestBody struct {
+		Date string `json:"date"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	newDate, err := parseDate(requestBody.Date)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+	}
+
+	exception := models.ScheduleException{OccurrenceDate: date, Action: models.ExceptionMove, NewDate: &newDate}
+	if err := models.SaveScheduleException(ctx.DB(), schedule.ID, exception); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to move occurrence: "+err.Error())
+	}
+
+	return map[string]string{"message": "Occurrence moved successfully"}, nil
+}
+
+// RestoreScheduleOccurrence handles the DELETE /schedules/{id}/occurrences/{date}
+// request, undoing a skip or move
+func RestoreScheduleOccurrence(ctx *gofr.Context) (interface{}, error) {
+	schedule, date, err := scheduleOccurrence(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.DeleteScheduleException(ctx.DB(), schedule.ID, date); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to restore occurrence: "+err.Error())
+	}
+
+	return map[string]string{"message": "Occurrence restored successfully"}, nil
+}
+
+// GetUserCalendar handles the GET /users/{userId}/calendar request. It
+// defaults to the next four weeks from today in the user's time zone.
+func GetUserCalendar(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	prefs, err := models.GetPreferences(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch preferences: "+err.Error())
+	}
+
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+	if from.IsZero() {
+		from = prefs.Today()
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, defaultCalendarDays-1)
+	}
+	if to.Before(from) {
+		return nil, gofr.NewError(http.StatusBadRequest, "The to date must not be before the from date")
+	}
+	if to.After(from.AddDate(0, 0, models.MaxCalendarDays-1)) {
+		return nil, gofr.NewError(http.StatusBadRequest, fmt.Sprintf("The calendar can cover at most %d days", models.MaxCalendarDays))
+	}
+
+	entries, err := models.GetCalendar(ctx.DB(), userID, from, to, prefs)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to build calendar: "+err.Error())
+	}
+
+	// If nothing is planned, return an empty array instead of null
+	if entries == nil {
+		entries = []models.CalendarEntry{}
+	}
+
+	return entries, nil
+}
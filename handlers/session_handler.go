@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetUserSessions handles the GET /users/{userId}/sessions request
+func GetUserSessions(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	from, err := dateQueryParam(ctx, "from")
+	if err != nil {
+		return nil, err
+	}
+	to, err := dateQueryParam(ctx, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := models.GetUserSessions(ctx.DB(), userID, from, to)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch sessions: "+err.Error())
+	}
+
+	// If no sessions are found, return an empty array instead of null
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// actingUserID returns the user making a workout request, given by the
+// user_id query parameter. Routes that check access require it, and it must
+// be an active user.
+func actingUserID(ctx *gofr.Context) (int, error) {
+	userID, err := intQueryParam(ctx, "user_id")
+	if err != nil {
+		return 0, err
+	}
+	if userID == 0 {
+		return 0, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// checkActiveUser rejects users who are deactivated or waiting for their
+// account to be erased, the same way their calendar feeds are. They can't
+// change anything until the deletion is cancelled.
+func checkActiveUser(ctx *gofr.Context, userID int) error {
+	if _, err := models.GetUser(ctx.DB(), userID); err != nil {
+		if err == sql.ErrNoRows {
+			return gofr.NewError(http.StatusNotFound, "User not found")
+		}
+		return gofr.NewError(http.StatusInternalServerError, "Failed to fetch user: "+err.Error())
+	}
+	return nil
+}
+
+// checkWorkoutAccess checks that the requesting user, given by the user_id
+// query parameter, may read a workout
+func checkWorkoutAccess(ctx *gofr.Context, workout models.Workout) error {
+	userID, err := actingUserID(ctx)
+	if err != nil {
+		return err
+	}
+	return checkWorkoutAccessFor(ctx, workout, userID)
+}
+
+// checkWorkoutAccessFor checks that a given user may read a workout, such as
+// the owner of a schedule or progress record that points at it
+func checkWorkoutAccessFor(ctx *gofr.Context, workout models.Workout, userID int) error {
+	allowed, err := models.CanViewWorkout(ctx.DB(), workout, userID)
+	if err != nil {
+		return gofr.NewError(http.StatusInternalServerError, "Failed to check workout access: "+err.Error())
+	}
+	if !allowed {
+		return gofr.NewError(http.StatusForbidden, "You don't have access to this workout")
+	}
+	return nil
+}
+
+// checkWorkoutOwner checks that the requesting user owns a workout. Users a
+// workout is shared with can read it but not change it.
+func checkWorkoutOwner(ctx *gofr.Context, workout models.Workout) error {
+	userID, err := actingUserID(ctx)
+	if err != nil {
+		return err
+	}
+	if userID == workout.UserID {
+		return nil
+	}
+
+	if err := checkWorkoutAccess(ctx, workout); err != nil {
+		return err
+	}
+	return gofr.NewError(http.StatusForbidden, "Shared workouts are read-only")
+}
+
+// CloneWorkout handles the POST /workouts/{id}/clone request. It copies the
+// workout with all its exercises into the account of the user in the body.
+func CloneWorkout(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+	}
+
+	// Check if workout exists
+	workout, err := models.GetWorkout(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+
+	userID, err := cloneRecipient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := models.CanViewWorkout(ctx.DB(), workout, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to check workout access: "+err.Error())
+	}
+	if !allowed {
+		return nil, gofr.NewError(http.StatusForbidden, "You don't have access to this workout")
+	}
+
+	return cloneWorkout(ctx, workout.ID, userID)
+}
+
+// CloneSharedWorkout handles the POST /shared/workouts/{token}/clone request
+func CloneSharedWorkout(ctx *gofr.Context) (interface{}, error) {
+	workout, err := models.GetWorkoutByShareToken(ctx.DB(), ctx.PathParam("token"))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Shared workout not found")
+	}
+
+	userID, err := cloneRecipient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloneWorkout(ctx, workout.ID, userID)
+}
+
+// cloneRecipient reads and checks the user a workout is copied for
+func cloneRecipient(ctx *gofr.Context) (int, error) {
+	var requestBody struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return 0, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if requestBody.UserID == 0 {
+		return 0, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+
+	// Check if user exists
+	if _, err := models.GetUser(ctx.DB(), requestBody.UserID); err != nil {
+		return 0, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+	return requestBody.UserID, nil
+}
+
+// cloneWorkout copies a workout for a user and returns the copy
+func cloneWorkout(ctx *gofr.Context, workoutID, userID int) (interface{}, error) {
+	id, err := models.CloneWorkout(ctx.DB(), workoutID, userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to clone workout: "+err.Error())
+	}
+
+	clonedWorkout, err := models.GetWorkout(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Workout cloned but failed to retrieve")
+	}
+
+	return clonedWorkout, nil
+}
+
+// PublishWorkout handles the POST /workouts/{id}/publish request. It makes
+// the workout public and returns its share link.
+func PublishWorkout(ctx *gofr.Context) (interface{}, error) {
+	workout, err := ownedWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := models.PublishWorkout(ctx.DB(), workout.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to publish workout: "+err.Error())
+	}
+
+	return map[string]interface{}{
+		"share_token": token,
+		"path":        "/shared/workouts/" + token,
+	}, nil
+}
+
+// UnpublishWorkout handles the DELETE /workouts/{id}/publish request. The old
+// share link stops working.
+func UnpublishWorkout(ctx *gofr.Context) (interface{}, error) {
+	workout, err := ownedWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.UnpublishWorkout(ctx.DB(), workout.ID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to unpublish workout: "+err.Error())
+	}
+
+	return map[string]string{"message": "Workout unpublished successfully"}, nil
+}
+
+// GetSharedWorkout handles the GET /shared/workouts/{token} request
+func GetSharedWorkout(ctx *gofr.Context) (interface{}, error) {
+	workout, err := models.GetWorkoutByShareToken(ctx.DB(), ctx.PathParam("token"))
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Shared workout not found")
+	}
+
+	// Get exercises for this workout
+	exercises, err := models.GetWorkoutExercises(ctx.DB(), workout.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workout exercises: "+err.Error())
+	}
+
+	exercises, err = prescriptionsForViewer(ctx, workout, exercises)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"workout":   workout,
+		"exercises": exercises,
+	}, nil
+}
+
+// GetWorkoutShares handles the GET /workouts/{id}/shares request
+func GetWorkoutShares(ctx *gofr.Context) (interface{}, error) {
+	workout, err := ownedWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := models.GetWorkoutShares(ctx.DB(), workout.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch shares: "+err.Error())
+	}
+
+	return shares, nil
+}
+
+// ShareWorkout handles the POST /workouts/{id}/shares request
+func ShareWorkout(ctx *gofr.Context) (interface{}, error) {
+	workout, err := ownedWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var requestBody struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if requestBody.UserID == 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+	if requestBody.UserID == workout.UserID {
+		return nil, gofr.NewError(http.StatusBadRequest, "Workouts can't be shared with their owner")
+	}
+
+	// Check if user exists
+	if _, err := models.GetUser(ctx.DB(), requestBody.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	if err := models.ShareWorkout(ctx.DB(), workout.ID, requestBody.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to share workout: "+err.Error())
+	}
+
+	return map[string]string{"message": "Workout shared successfully"}, nil
+}
+
+// UnshareWorkout handles the DELETE /workouts/{id}/shares/{userId} request
+func UnshareWorkout(ctx *gofr.Context) (interface{}, error) {
+	workout, err := ownedWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := models.UnshareWorkout(ctx.DB(), workout.ID, userID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to unshare workout: "+err.Error())
+	}
+
+	return map[string]string{"message": "Workout unshared successfully"}, nil
+}
+
+// GetWorkoutsSharedWithUser handles the GET /users/{userId}/shared-workouts request
+func GetWorkoutsSharedWithUser(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	workouts, err := models.GetWorkoutsSharedWith(ctx.DB(), userID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch shared workouts: "+err.Error())
+	}
+
+	return workouts, nil
+}
+
+// ownedWorkout resolves the {id} workout and checks the requester owns it
+func ownedWorkout(ctx *gofr.Context) (models.Workout, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Workout{}, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+	}
+
+	// Check if workout exists
+	workout, err := models.GetWorkout(ctx.DB(), id)
+	if err != nil {
+		return workout, gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+
+	return workout, checkWorkoutOwner(ctx, workout)
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetTemplates handles the GET /templates request. It filters by kind, goal,
+// level, equipment (what the user has, comma separated), max_duration and
+// days_per_week, and sorts by sort=popular, rating or newest.
+func GetTemplates(ctx *gofr.Context) (interface{}, error) {
+	filter := models.TemplateFilter{
+		Kind:  ctx.QueryParam("kind"),
+		Goal:  ctx.QueryParam("goal"),
+		Level: ctx.QueryParam("level"),
+		Sort:  ctx.QueryParam("sort"),
+	}
+
+	if filter.Kind != "" && filter.Kind != models.TemplateKindWorkout && filter.Kind != models.TemplateKindProgram {
+		return nil, gofr.NewError(http.StatusBadRequest, "Kind must be workout or program")
+	}
+	if filter.Goal != "" && !models.IsValidGoal(filter.Goal) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid goal")
+	}
+	if filter.Level != "" && !models.IsValidLevel(filter.Level) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid level")
+	}
+	if filter.Sort != "" && filter.Sort != "popular" && filter.Sort != "rating" && filter.Sort != "newest" {
+		return nil, gofr.NewError(http.StatusBadRequest, "Sort must be popular, rating or newest")
+	}
+
+	// An empty equipment parameter means bodyweight-only templates
+	if equipment, ok := ctx.Request().URL.Query()["equipment"]; ok {
+		filter.Equipment = []string{}
+		for _, name := range strings.Split(strings.Join(equipment, ","), ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				filter.Equipment = append(filter.Equipment, name)
+			}
+		}
+	}
+
+	var err error
+	if filter.MaxDuration, err = intQueryParam(ctx, "max_duration"); err != nil {
+		return nil, err
+	}
+	if filter.DaysPerWeek, err = intQueryParam(ctx, "days_per_week"); err != nil {
+		return nil, err
+	}
+
+	templates, err := models.BrowseTemplates(ctx.DB(), filter)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch templates: "+err.Error())
+	}
+
+	return templates, nil
+}
+
+// GetTemplate handles the GET /templates/{id} request
+func GetTemplate(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	template, err := models.GetTemplate(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Template not found")
+	}
+
+	return template, nil
+}
+
+// PublishTemplate handles the POST /templates request. It snapshots one of
+// the author's workouts or programs into the template library.
+func PublishTemplate(ctx *gofr.Context) (interface{}, error) {
+	var requestBody struct {
+		UserID          int    `json:"user_id"`
+		Kind            string `json:"kind"`
+		SourceID        int    `json:"source_id"`
+		Title           string `json:"title"`
+		Description     string `json:"description"`
+		Goal            string `json:"goal"`
+		Level           string `json:"level"`
+		DurationMinutes int    `json:"duration_minutes"`
+		DaysPerWeek     int    `json:"days_per_week"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	// Validate required fields
+	if requestBody.UserID == 0 || requestBody.SourceID == 0 || requestBody.Title == "" {
+		return nil, gofr.NewError(http.StatusBadRequest, "User ID, source ID and title are required")
+	}
+	if !models.IsValidGoal(requestBody.Goal) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Goal must be strength, hypertrophy, endurance, weight_loss or general")
+	}
+	if !models.IsValidLevel(requestBody.Level) {
+		return nil, gofr.NewError(http.StatusBadRequest, "Level must be beginner, intermediate or advanced")
+	}
+	if requestBody.DurationMinutes < 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "Duration must not be negative")
+	}
+
+	authorID := requestBody.UserID
+	template := models.Template{
+		AuthorID:        &authorID,
+		Kind:            requestBody.Kind,
+		SourceID:        requestBody.SourceID,
+		Title:           requestBody.Title,
+		Description:     requestBody.Description,
+		Goal:            requestBody.Goal,
+		Level:           requestBody.Level,
+		DurationMinutes: requestBody.DurationMinutes,
+		DaysPerWeek:     requestBody.DaysPerWeek,
+	}
+
+	switch requestBody.Kind {
+	case models.TemplateKindWorkout:
+		workout, err := models.GetWorkout(ctx.DB(), requestBody.SourceID)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
+		}
+		if workout.UserID != requestBody.UserID {
+			return nil, gofr.NewError(http.StatusForbidden, "Only the owner can publish a workout")
+		}
+
+		snapshot, err := models.BuildWorkoutSnapshot(ctx.DB(), workout.ID)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to snapshot workout: "+err.Error())
+		}
+		template.Snapshot = &models.TemplateSnapshot{Workouts: []models.TemplateWorkout{snapshot}}
+
+		if template.DaysPerWeek == 0 {
+			template.DaysPerWeek = 1
+		}
+		if template.DaysPerWeek < 1 || template.DaysPerWeek > 7 {
+			return nil, gofr.NewError(http.StatusBadRequest, "Days per week must be between 1 and 7")
+		}
+	case models.TemplateKindProgram:
+		program, err := models.GetProgram(ctx.DB(), requestBody.SourceID)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusNotFound, "Program not found")
+		}
+		if program.UserID != requestBody.UserID {
+			return nil, gofr.NewError(http.StatusForbidden, "Only the owner can publish a program")
+		}
+
+		snapshot, err := models.BuildProgramSnapshot(ctx.DB(), program)
+		if err != nil {
+			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to snapshot program: "+err.Error())
+		}
+		template.Snapshot = &snapshot
+
+		// Days per week is the busiest week of the program
+		template.DaysPerWeek = 0
+		for _, week := range program.Weeks {
+			days := make(map[int]bool)
+			for _, day := range program.DaysOfWeek(week.Week) {
+				days[day.Day] = true
+			}
+			template.DaysPerWeek = max(template.DaysPerWeek, len(days))
+		}
+	default:
+		return nil, gofr.NewError(http.StatusBadRequest, "Kind must be workout or program")
+	}
+
+	id, err := models.PublishTemplate(ctx.DB(), template)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to publish template: "+err.Error())
+	}
+
+	publishedTemplate, err := models.GetTemplate(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Template published but failed to retrieve")
+	}
+
+	return publishedTemplate, nil
+}
+
+// DeleteTemplate handles the DELETE /templates/{id}?user_id= request. Only
+// the author can remove a template; imported copies are kept.
+func DeleteTemplate(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	// Check if template exists
+	template, err := models.GetTemplate(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Template not found")
+	}
+
+	userID, err := intQueryParam(ctx, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	if template.AuthorID == nil || userID != *template.AuthorID {
+		return nil, gofr.NewError(http.StatusForbidden, "Only the author can delete a template")
+	}
+
+	if err := models.DeleteTemplate(ctx.DB(), id, userID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete template: "+err.Error())
+	}
+
+	return map[string]string{"message": "Template deleted successfully"}, nil
+}
+
+// ImportTemplate handles the POST /templates/{id}/import request. It copies
+// the template's workouts, and its program if any, into the user's account.
+func ImportTemplate(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	template, err := models.GetTemplate(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Template not found")
+	}
+
+	var requestBody struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&requestBody); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if requestBody.UserID == 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+
+	// Check if user exists
+	if _, err := models.GetUser(ctx.DB(), requestBody.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	imported, err := models.ImportTemplate(ctx.DB(), template, requestBody.UserID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to import template: "+err.Error())
+	}
+
+	return imported, nil
+}
+
+// GetTemplateReviews handles the GET /templates/{id}/reviews request
+func GetTemplateReviews(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	reviews, err := models.GetTemplateReviews(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch reviews: "+err.Error())
+	}
+
+	return reviews, nil
+}
+
+// ReviewTemplate handles the POST /templates/{id}/reviews request. Each user
+// has one review per template, replaced when they review again.
+func ReviewTemplate(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	// Check if template exists
+	template, err := models.GetTemplate(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Template not found")
+	}
+
+	var review models.TemplateReview
+	if err := json.NewDecoder(ctx.Request().Body).Decode(&review); err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
+	}
+	review.TemplateID = id
+
+	if review.UserID == 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+	if template.AuthorID != nil && review.UserID == *template.AuthorID {
+		return nil, gofr.NewError(http.StatusForbidden, "Authors can't review their own templates")
+	}
+	if review.Rating < 1 || review.Rating > 5 {
+		return nil, gofr.NewError(http.StatusBadRequest, "Rating must be between 1 and 5")
+	}
+
+	// Check if user exists
+	if _, err := models.GetUser(ctx.DB(), review.UserID); err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "User not found")
+	}
+
+	if err := models.SaveTemplateReview(ctx.DB(), review); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to save review: "+err.Error())
+	}
+
+	return map[string]string{"message": "Review saved successfully"}, nil
+}
+
+// DeleteTemplateReview handles the DELETE /templates/{id}/reviews/{userId} request
+func DeleteTemplateReview(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid template ID")
+	}
+
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if err := models.DeleteTemplateReview(ctx.DB(), id, userID); err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete review: "+err.Error())
+	}
+
+	return map[string]string{"message": "Review deleted successfully"}, nil
+}
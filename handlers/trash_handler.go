@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetUserTrash handles the GET /users/{userId}/trash request. It lists the
+// user's deleted workouts and progress with the time each will be purged.
+func GetUserTrash(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+
+	items, err := models.GetUserTrash(ctx.DB(), userID, models.TrashRetention())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch trash: "+err.Error())
+	}
+
+	return items, nil
+}
+
+// GetExerciseTrash handles the GET /exercises/trash request
+func GetExerciseTrash(ctx *gofr.Context) (interface{}, error) {
+	items, err := models.GetExerciseTrash(ctx.DB(), models.TrashRetention())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch trash: "+err.Error())
+	}
+
+	return items, nil
+}
+
+// RestoreWorkout handles the POST /workouts/{id}/restore?user_id= request.
+// Only the owner can restore a deleted workout.
+func RestoreWorkout(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+	}
+
+	userID, err := intQueryParam(ctx, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	if userID == 0 {
+		return nil, gofr.NewError(http.StatusBadRequest, "User ID is required")
+	}
+
+	if err := models.RestoreWorkout(ctx.DB(), id, userID); err != nil {
+		return nil, restoreError("Workout", err)
+	}
+
+	workout, err := models.GetWorkout(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Workout restored but failed to retrieve")
+	}
+
+	return workout, nil
+}
+
+// RestoreExercise handles the POST /exercises/{id}/restore request
+func RestoreExercise(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
+	}
+
+	if err := models.RestoreExercise(ctx.DB(), id); err != nil {
+		return nil, restoreError("Exercise", err)
+	}
+
+	exercise, err := models.GetExercise(ctx.DB(), id)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Exercise restored but failed to retrieve")
+	}
+
+	return exercise, nil
+}
+
+// RestoreUserProgress handles the POST /users/{userId}/progress/{progressId}/restore request
+func RestoreUserProgress(ctx *gofr.Context) (interface{}, error) {
+	userIDStr := ctx.PathParam("userId")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
+	}
+	if err := checkActiveUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	progressIDStr := ctx.PathParam("progressId")
+	progressID, err := strconv.Atoi(progressIDStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid progress ID")
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress, err := models.RestoreProgress(ctx.DB(), progressID, userID)
+	if err != nil {
+		return nil, restoreError("Progress record", err)
+	}
+
+	// Records and analytics count the restored entry again
+	if err := refreshDerivedProgress(ctx, prefs, progress); err != nil {
+		return nil, err
+	}
+
+	return progress.WithFormula(prefs.E1RMFormula).InUnits(units), nil
+}
+
+// restoreError maps a failed restore to a response, treating a missing row as
+// nothing in the trash to restore
+func restoreError(what string, err error) error {
+	if err == sql.ErrNoRows {
+		return gofr.NewError(http.StatusNotFound, what+" not found in trash")
+	}
+	return gofr.NewError(http.StatusInternalServerError, "Failed to restore: "+err.Error())
+}
@@ -112,7 +112,9 @@ func UpdateUser(ctx *gofr.Context) (interface{}, error) {
 	return updatedUser, nil
 }
 
-// DeleteUser handles the DELETE /users/{id} request
+// DeleteUser handles the DELETE /users/{id} request. The user confirms with
+// their password; the account is deactivated at once and erased after the
+// grace period unless the deletion is cancelled.
 func DeleteUser(ctx *gofr.Context) (interface{}, error) {
 	idStr := ctx.PathParam("id")
 	id, err := strconv.Atoi(idStr)
@@ -126,10 +128,15 @@ func DeleteUser(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusNotFound, "User not found")
 	}
 
-	// Delete the user
-	if err := models.DeleteUser(ctx.DB(), id); err != nil {
+	if err := confirmPassword(ctx, id); err != nil {
+		return nil, err
+	}
+
+	// Deactivate the user and schedule the erasure
+	deletion, err := models.RequestAccountDeletion(ctx.DB(), id, models.AccountDeletionGrace())
+	if err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to delete user: "+err.Error())
 	}
 
-	return map[string]string{"message": "User deleted successfully"}, nil
-}
\ No newline at end of file
+	return deletion, nil
+}
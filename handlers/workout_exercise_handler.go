@@ -18,10 +18,13 @@ func GetWorkoutExercises(ctx *gofr.Context) (interface{}, error) {
 	}
 
 	// Check if workout exists
-	_, err = models.GetWorkout(ctx.DB(), workoutID)
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
 	}
+	if err := checkWorkoutAccess(ctx, workout); err != nil {
+		return nil, err
+	}
 
 	// Get exercises for this workout
 	workoutExercises, err := models.GetWorkoutExercises(ctx.DB(), workoutID)
@@ -29,12 +32,52 @@ func GetWorkoutExercises(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workout exercises: "+err.Error())
 	}
 
-	// If no exercises are found, return an empty array instead of null
-	if workoutExercises == nil {
-		workoutExercises = []models.WorkoutExercise{}
+	return prescriptionsForViewer(ctx, workout, workoutExercises)
+}
+
+// prescriptionsForViewer converts workout entries into the units of the user
+// viewing the workout. It never returns nil, so a workout without exercises
+// is encoded as an empty array.
+func prescriptionsForViewer(ctx *gofr.Context, workout models.Workout, workoutExercises []models.WorkoutExercise) ([]models.WorkoutExercise, error) {
+	userID, err := viewerID(ctx, workout.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	units, prefs, err := requestUnits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := make([]models.WorkoutExercise, 0, len(workoutExercises))
+	for _, we := range workoutExercises {
+		converted = append(converted, we.InUnits(units, prefs.IncrementFor(units)))
+	}
+	return converted, nil
+}
+
+// workoutOwnerByID checks that a workout exists and the requester owns it
+func workoutOwnerByID(ctx *gofr.Context, workoutID int) error {
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
+	if err != nil {
+		return gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+	return checkWorkoutOwner(ctx, workout)
+}
+
+// prescriptionFromRequest converts a submitted prescription into canonical
+// units, using the units of the workout's owner unless overridden
+func prescriptionFromRequest(ctx *gofr.Context, workoutID int, we models.WorkoutExercise) (models.WorkoutExercise, error) {
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
+	if err != nil {
+		return we, gofr.NewError(http.StatusNotFound, "Workout not found")
 	}
 
-	return workoutExercises, nil
+	units, _, err := requestUnits(ctx, workout.UserID)
+	if err != nil {
+		return we, err
+	}
+	return we.FromUnits(units), nil
 }
 
 // AddExerciseToWorkout handles the POST /workouts/{workoutId}/exercises/{exerciseId} request
@@ -52,31 +95,53 @@ func AddExerciseToWorkout(ctx *gofr.Context) (interface{}, error) {
 	}
 
 	// Check if workout exists
-	_, err = models.GetWorkout(ctx.DB(), workoutID)
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
 	}
+	if err := checkWorkoutOwner(ctx, workout); err != nil {
+		return nil, err
+	}
 
 	// Check if exercise exists
-	_, err = models.GetExercise(ctx.DB(), exerciseID)
+	exercise, err := models.GetExercise(ctx.DB(), exerciseID)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
 	}
 
 	// Parse request body for sets, reps, and weight
 	var workoutExercise models.WorkoutExercise
-	if err := json.NewDecoder(ctx.Request().Body).Decode(&workoutExercise); err != nil {
-		// If no body is provided, use default values
-		workoutExercise = models.WorkoutExercise{
-			Sets:  3,
-			Reps:  10,
-			Weight: 0,
-		}
-	}
+	hasBody := json.NewDecoder(ctx.Request().Body).Decode(&workoutExercise) == nil
 
 	workoutExercise.WorkoutID = workoutID
 	workoutExercise.ExerciseID = exerciseID
 
+	// Convert loads and distances from the caller's units
+	workoutExercise, err = prescriptionFromRequest(ctx, workoutID, workoutExercise)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no body is provided, use the defaults of the tracking type, which
+	// are already in canonical units
+	if !hasBody {
+		workoutExercise.SetMeasurements(models.DefaultPrescription(exercise.TrackingType))
+	}
+
+	// Validate the prescription against the exercise's tracking type
+	measurements, err := models.NormalizeMeasurements(exercise.TrackingType, workoutExercise.Measurements())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+	workoutExercise.SetMeasurements(measurements)
+
+	if err := validateProgression(&workoutExercise, exercise.TrackingType); err != nil {
+		return nil, err
+	}
+	if err := restartCycle(ctx, workout, &workoutExercise); err != nil {
+		return nil, err
+	}
+
 	// Add exercise to workout
 	if err := models.AddExerciseToWorkout(ctx.DB(), workoutExercise); err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to add exercise to workout: "+err.Error())
@@ -99,6 +164,18 @@ func UpdateWorkoutExercise(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
 	}
 
+	// Only the owner may change a workout
+	workout, err := models.GetWorkout(ctx.DB(), workoutID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+	if err := checkWorkoutOwner(ctx, workout); err != nil {
+		return nil, err
+	}
+	if _, err := models.GetWorkoutExercise(ctx.DB(), workoutID, exerciseID); err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Exercise is not part of this workout")
+	}
+
 	var workoutExercise models.WorkoutExercise
 	if err := json.NewDecoder(ctx.Request().Body).Decode(&workoutExercise); err != nil {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid request body")
@@ -107,6 +184,31 @@ func UpdateWorkoutExercise(ctx *gofr.Context) (interface{}, error) {
 	workoutExercise.WorkoutID = workoutID
 	workoutExercise.ExerciseID = exerciseID
 
+	// Convert loads and distances from the caller's units
+	workoutExercise, err = prescriptionFromRequest(ctx, workoutID, workoutExercise)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the prescription against the exercise's tracking type
+	exercise, err := models.GetExercise(ctx.DB(), exerciseID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusNotFound, "Exercise not found")
+	}
+
+	measurements, err := models.NormalizeMeasurements(exercise.TrackingType, workoutExercise.Measurements())
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, err.Error())
+	}
+	workoutExercise.SetMeasurements(measurements)
+
+	if err := validateProgression(&workoutExercise, exercise.TrackingType); err != nil {
+		return nil, err
+	}
+	if err := restartCycle(ctx, workout, &workoutExercise); err != nil {
+		return nil, err
+	}
+
 	// Update workout exercise
 	if err := models.UpdateWorkoutExercise(ctx.DB(), workoutExercise); err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to update workout exercise: "+err.Error())
@@ -129,6 +231,11 @@ func RemoveExerciseFromWorkout(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid exercise ID")
 	}
 
+	// Only the owner may change a workout
+	if err := workoutOwnerByID(ctx, workoutID); err != nil {
+		return nil, err
+	}
+
 	// Remove exercise from workout
 	if err := models.RemoveExerciseFromWorkout(ctx.DB(), workoutID, exerciseID); err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to remove exercise from workout: "+err.Error())
@@ -145,6 +252,11 @@ func ReorderWorkoutExercises(ctx *gofr.Context) (interface{}, error) {
 		return nil, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
 	}
 
+	// Only the owner may change a workout
+	if err := workoutOwnerByID(ctx, workoutID); err != nil {
+		return nil, err
+	}
+
 	// Parse request body for exercise IDs in new order
 	var requestBody struct {
 		ExerciseIDs []int `json:"exercise_ids"`
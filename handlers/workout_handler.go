@@ -9,26 +9,16 @@ import (
 	"github.com/gofr-dev/gofr"
 )
 
-// GetWorkouts handles the GET /workouts request
+// GetWorkouts handles the GET /workouts request. It lists the workouts the
+// user_id query parameter may read: their own, those shared with them and
+// public ones. Without a user only public workouts are listed.
 func GetWorkouts(ctx *gofr.Context) (interface{}, error) {
-	// Check if user_id query parameter is provided
-	userIDStr := ctx.QueryParam("user_id")
-	if userIDStr != "" {
-		userID, err := strconv.Atoi(userIDStr)
-		if err != nil {
-			return nil, gofr.NewError(http.StatusBadRequest, "Invalid user ID")
-		}
-		
-		// Get workouts for specific user
-		workouts, err := models.GetUserWorkouts(ctx.DB(), userID)
-		if err != nil {
-			return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workouts: "+err.Error())
-		}
-		return workouts, nil
+	userID, err := intQueryParam(ctx, "user_id")
+	if err != nil {
+		return nil, err
 	}
-	
-	// Get all workouts
-	workouts, err := models.GetWorkouts(ctx.DB())
+
+	workouts, err := models.GetWorkouts(ctx.DB(), userID)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workouts: "+err.Error())
 	}
@@ -47,12 +37,22 @@ func GetWorkout(ctx *gofr.Context) (interface{}, error) {
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
 	}
+
+	// Shared workouts are readable by their recipients
+	if err := checkWorkoutAccess(ctx, workout); err != nil {
+		return nil, err
+	}
 	
 	// Get exercises for this workout
 	exercises, err := models.GetWorkoutExercises(ctx.DB(), id)
 	if err != nil {
 		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workout exercises: "+err.Error())
 	}
+
+	exercises, err = prescriptionsForViewer(ctx, workout, exercises)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Return workout with exercises
 	return map[string]interface{}{
@@ -101,6 +101,9 @@ func UpdateWorkout(ctx *gofr.Context) (interface{}, error) {
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
 	}
+	if err := checkWorkoutOwner(ctx, existingWorkout); err != nil {
+		return nil, err
+	}
 
 	var workout models.Workout
 	if err := json.NewDecoder(ctx.Request().Body).Decode(&workout); err != nil {
@@ -137,6 +140,9 @@ func DeleteWorkout(ctx *gofr.Context) (interface{}, error) {
 	if err != nil {
 		return nil, gofr.NewError(http.StatusNotFound, "Workout not found")
 	}
+	if err := checkWorkoutOwner(ctx, workout); err != nil {
+		return nil, err
+	}
 
 	// Delete the workout
 	if err := models.DeleteWorkout(ctx.DB(), id, workout.UserID); err != nil {
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/gofr-dev/gofr"
+)
+
+// GetWorkoutVersions handles the GET /workouts/{id}/versions request
+func GetWorkoutVersions(ctx *gofr.Context) (interface{}, error) {
+	workout, err := readableWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := models.GetWorkoutVersions(ctx.DB(), workout.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workout versions: "+err.Error())
+	}
+
+	for i := range versions {
+		if versions[i].Entries, err = prescriptionsForViewer(ctx, workout, versions[i].Entries); err != nil {
+			return nil, err
+		}
+	}
+
+	return versions, nil
+}
+
+// GetWorkoutVersion handles the GET /workouts/{id}/versions/{version} request
+func GetWorkoutVersion(ctx *gofr.Context) (interface{}, error) {
+	workout, err := readableWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := workoutVersionParam(ctx, workout.ID, ctx.PathParam("version"))
+	if err != nil {
+		return nil, err
+	}
+
+	version.Entries, err = prescriptionsForViewer(ctx, workout, version.Entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// DiffWorkoutVersions handles the GET /workouts/{id}/versions/diff?from=&to=
+// request. to defaults to the latest version and from to the one before it.
+func DiffWorkoutVersions(ctx *gofr.Context) (interface{}, error) {
+	workout, err := readableWorkout(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := models.CurrentWorkoutVersion(ctx.DB(), workout.ID)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to fetch workout versions: "+err.Error())
+	}
+
+	toParam := ctx.QueryParam("to")
+	if toParam == "" {
+		toParam = strconv.Itoa(latest)
+	}
+	to, err := workoutVersionParam(ctx, workout.ID, toParam)
+	if err != nil {
+		return nil, err
+	}
+
+	fromParam := ctx.QueryParam("from")
+	if fromParam == "" {
+		fromParam = strconv.Itoa(max(to.Version-1, 1))
+	}
+	from, err := workoutVersionParam(ctx, workout.ID, fromParam)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare loads in the viewer's units
+	if from.Entries, err = prescriptionsForViewer(ctx, workout, from.Entries); err != nil {
+		return nil, err
+	}
+	if to.Entries, err = prescriptionsForViewer(ctx, workout, to.Entries); err != nil {
+		return nil, err
+	}
+
+	return models.DiffWorkoutVersions(from, to), nil
+}
+
+// RestoreWorkoutVersion handles the POST /workouts/{id}/versions/{version}/restore
+// request. The restored structure becomes the newest version.
+func RestoreWorkoutVersion(ctx *gofr.Context) (interface{}, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+	}
+
+	// Only the owner may change a workout
+	if err := workoutOwnerByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	version, err := workoutVersionParam(ctx, id, ctx.PathParam("version"))
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := models.RestoreWorkoutVersion(ctx.DB(), version)
+	if err != nil {
+		return nil, gofr.NewError(http.StatusInternalServerError, "Failed to restore workout version: "+err.Error())
+	}
+
+	return map[string]interface{}{
+		"version": current,
+		"message": "Workout version restored successfully",
+	}, nil
+}
+
+// readableWorkout resolves the {id} workout and checks the requester may read it
+func readableWorkout(ctx *gofr.Context) (models.Workout, error) {
+	idStr := ctx.PathParam("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return models.Workout{}, gofr.NewError(http.StatusBadRequest, "Invalid workout ID")
+	}
+
+	// Check if workout exists
+	workout, err := models.GetWorkout(ctx.DB(), id)
+	if err != nil {
+		return workout, gofr.NewError(http.StatusNotFound, "Workout not found")
+	}
+
+	return workout, checkWorkoutAccess(ctx, workout)
+}
+
+// workoutVersionParam parses a version number and loads that version
+func workoutVersionParam(ctx *gofr.Context, workoutID int, value string) (models.WorkoutVersion, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return models.WorkoutVersion{}, gofr.NewError(http.StatusBadRequest, "Invalid version")
+	}
+
+	version, err := models.GetWorkoutVersion(ctx.DB(), workoutID, number)
+	if err != nil {
+		return version, gofr.NewError(http.StatusNotFound, "Workout version not found")
+	}
+	return version, nil
+}
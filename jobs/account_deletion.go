@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/cxocodehub/go-backend-workout/storage"
+)
+
+// accountDeletionInterval is how often deletion requests past their grace
+// period are looked for
+const accountDeletionInterval = time.Hour
+
+// EraseDeletedAccounts anonymizes the accounts whose deletion grace period
+// has passed, removing their photos from the store first. It never returns.
+func EraseDeletedAccounts(db *sql.DB, store storage.Store) {
+	ticker := time.NewTicker(accountDeletionInterval)
+	defer ticker.Stop()
+
+	for {
+		userIDs, err := models.GetDueAccountDeletions(db, time.Now())
+		if err != nil {
+			log.Printf("account deletion lookup failed: %v", err)
+		}
+		for _, userID := range userIDs {
+			if err := models.DeleteUserPhotoFiles(db, store, userID); err != nil {
+				log.Printf("account deletion of user %d failed to remove photos: %v", userID, err)
+				continue
+			}
+			if err := models.AnonymizeUser(db, userID); err != nil {
+				log.Printf("account deletion of user %d failed: %v", userID, err)
+				continue
+			}
+			log.Printf("account of user %d erased", userID)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+)
+
+// achievementBackfillInterval is how often new achievement definitions are
+// looked for
+const achievementBackfillInterval = time.Minute
+
+// BackfillAchievements awards new achievement definitions to the users whose
+// past training has already earned them, checking every
+// achievementBackfillInterval. It never returns.
+func BackfillAchievements(db *sql.DB) {
+	ticker := time.NewTicker(achievementBackfillInterval)
+	defer ticker.Stop()
+
+	for {
+		awarded, err := models.BackfillAchievements(db)
+		if err != nil {
+			log.Printf("achievement backfill failed: %v", err)
+		} else if awarded > 0 {
+			log.Printf("achievement backfill awarded %d achievements", awarded)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+)
+
+// exportPollInterval is how often queued data exports are looked for
+const exportPollInterval = 5 * time.Second
+
+// RunDataExports builds queued data exports one at a time and removes the
+// archives of expired ones. It never returns.
+func RunDataExports(db *sql.DB) {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			export, err := models.ClaimDataExport(db)
+			if err == sql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				log.Printf("data export claim failed: %v", err)
+				break
+			}
+
+			if err := models.BuildDataExport(db, export); err != nil {
+				log.Printf("data export %d failed: %v", export.ID, err)
+				if err := models.FailDataExport(db, export.ID, err); err != nil {
+					log.Printf("data export %d could not be marked failed: %v", export.ID, err)
+				}
+			}
+		}
+
+		if _, err := models.ExpireDataExports(db); err != nil {
+			log.Printf("data export expiry failed: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+)
+
+// importPollInterval is how often imports with work to do are looked for
+const importPollInterval = 5 * time.Second
+
+// RunImports reads uploaded import files and imports their rows once their
+// exercise names are resolved, one import at a time. It never returns.
+func RunImports(db *sql.DB) {
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			imp, err := models.ClaimImport(db)
+			if err == sql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				log.Printf("import claim failed: %v", err)
+				break
+			}
+
+			if imp.Status == models.ImportReading {
+				err = models.ReadImport(db, imp)
+			} else {
+				err = models.RunImport(db, imp)
+			}
+			if err != nil {
+				log.Printf("import %d failed: %v", imp.ID, err)
+				if err := models.FailImport(db, imp.ID, err); err != nil {
+					log.Printf("import %d could not be marked failed: %v", imp.ID, err)
+				}
+			}
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/mailer"
+	"github.com/cxocodehub/go-backend-workout/models"
+)
+
+// reportInterval is how often users are checked for reports that are due
+const reportInterval = 15 * time.Minute
+
+// SendReports emails users their weekly and monthly reports once each
+// period has ended in their time zone, checking every reportInterval. It
+// never returns.
+func SendReports(db *sql.DB, m mailer.Mailer) {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := sendDueReports(db, m, time.Now())
+		if err != nil {
+			log.Printf("reports failed: %v", err)
+		} else if sent > 0 {
+			log.Printf("reports sent %d emails", sent)
+		}
+		<-ticker.C
+	}
+}
+
+// sendDueReports sends every report due at now that hasn't been sent,
+// returning how many were sent. Reports with nothing to tell are skipped.
+func sendDueReports(db *sql.DB, m mailer.Mailer, now time.Time) (int, error) {
+	recipients, err := models.GetReportRecipients(db)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, recipient := range recipients {
+		for period, start := range models.DueReportPeriods(recipient.Prefs, now) {
+			claimed, err := models.ClaimReportDelivery(db, recipient.User.ID, period, start)
+			if err != nil {
+				return sent, err
+			}
+			if !claimed {
+				continue
+			}
+
+			status, err := sendReport(db, m, recipient, period, start)
+			if err != nil {
+				log.Printf("%s report for user %d failed: %v", period, recipient.User.ID, err)
+			} else if status == models.DeliverySent {
+				sent++
+			}
+			if err := models.FinishReportDelivery(db, recipient.User.ID, period, start, status, err); err != nil {
+				return sent, err
+			}
+		}
+	}
+	return sent, nil
+}
+
+// sendReport builds, renders and sends one report, returning the delivery
+// status
+func sendReport(db *sql.DB, m mailer.Mailer, recipient models.ReportRecipient, period string, start time.Time) (string, error) {
+	report, err := models.BuildReport(db, recipient.User.ID, period, start, recipient.Prefs)
+	if err != nil {
+		return models.DeliveryFailed, err
+	}
+	if report.IsEmpty() {
+		return models.DeliverySkipped, nil
+	}
+
+	email, err := models.RenderReport(report.InUnits(recipient.Prefs.Units()), recipient.User.Username)
+	if err != nil {
+		return models.DeliveryFailed, err
+	}
+
+	msg := mailer.Message{To: recipient.User.Email, Subject: email.Subject, Text: email.Text, HTML: email.HTML}
+	if err := m.Send(msg); err != nil {
+		return models.DeliveryFailed, err
+	}
+	return models.DeliverySent, nil
+}
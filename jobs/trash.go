@@ -0,0 +1,39 @@
+// Package jobs holds the background work started alongside the server
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/cxocodehub/go-backend-workout/storage"
+)
+
+// trashPurgeInterval is how often the trash is checked for expired rows
+const trashPurgeInterval = time.Hour
+
+// PurgeTrash permanently deletes rows that have been in the trash for longer
+// than the retention period, checking every trashPurgeInterval, along with
+// the media files of purged exercises. It never returns.
+func PurgeTrash(db *sql.DB, store storage.Store) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := models.PurgeTrash(db, time.Now().Add(-models.TrashRetention()))
+		if err != nil {
+			log.Printf("trash purge failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("trash purge removed %d rows", purged)
+		}
+
+		media, err := models.PurgeExerciseMedia(db, store)
+		if err != nil {
+			log.Printf("exercise media purge failed: %v", err)
+		} else if media > 0 {
+			log.Printf("exercise media purge removed %d media", media)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,18 @@
+package mailer
+
+import "log"
+
+// Log writes messages to the log instead of sending them, with their plain
+// text body
+type Log struct{}
+
+// NewLog returns a mailer that logs messages
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Send logs the message
+func (l *Log) Send(msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
@@ -0,0 +1,51 @@
+// Package mailer sends email, through an SMTP server or, by default, to the
+// log for development
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Message is an email with a plain-text body and an optional HTML
+// alternative
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages
+type Mailer interface {
+	// Send delivers a message, returning once the server has accepted it
+	Send(msg Message) error
+}
+
+// FromEnv opens the mailer chosen by MAILER_BACKEND: log (the default),
+// which writes messages to the log, or smtp, configured by the SMTP_*
+// variables and sending from MAIL_FROM
+func FromEnv() (Mailer, error) {
+	switch backend := os.Getenv("MAILER_BACKEND"); backend {
+	case "", "log":
+		return NewLog(), nil
+	case "smtp":
+		port := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			var err error
+			if port, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid SMTP_PORT %q", value)
+			}
+		}
+		return NewSMTP(SMTPConfig{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q", backend)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"log"
+
 	"github.com/cxocodehub/go-backend-workout/handlers"
+	"github.com/cxocodehub/go-backend-workout/jobs"
+	"github.com/cxocodehub/go-backend-workout/mailer"
 	"github.com/cxocodehub/go-backend-workout/models"
+	"github.com/cxocodehub/go-backend-workout/storage"
 	"github.com/gofr-dev/gofr"
 )
 
@@ -16,6 +21,27 @@ func main() {
 	// Create tables if they don't exist
 	models.InitTables(db)
 
+	// Open the file store for uploaded photos and exercise media
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to open file storage: %v", err)
+	}
+	handlers.SetStore(store)
+
+	// Open the mailer for report emails
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to open mailer: %v", err)
+	}
+
+	// Start background jobs
+	go jobs.PurgeTrash(db, store)
+	go jobs.RunDataExports(db)
+	go jobs.EraseDeletedAccounts(db, store)
+	go jobs.RunImports(db)
+	go jobs.BackfillAchievements(db)
+	go jobs.SendReports(db, mail)
+
 	// Register routes
 	registerRoutes(app)
 
@@ -30,6 +56,8 @@ func registerRoutes(app *gofr.Gofr) {
 	app.POST("/users", handlers.CreateUser)
 	app.PUT("/users/{id}", handlers.UpdateUser)
 	app.DELETE("/users/{id}", handlers.DeleteUser)
+	app.GET("/users/{id}/deletion", handlers.GetAccountDeletion)
+	app.POST("/users/{id}/deletion/cancel", handlers.CancelAccountDeletion)
 
 	// Workout routes
 	app.GET("/workouts", handlers.GetWorkouts)
@@ -37,20 +65,164 @@ func registerRoutes(app *gofr.Gofr) {
 	app.POST("/workouts", handlers.CreateWorkout)
 	app.PUT("/workouts/{id}", handlers.UpdateWorkout)
 	app.DELETE("/workouts/{id}", handlers.DeleteWorkout)
+	app.POST("/workouts/{id}/restore", handlers.RestoreWorkout)
+
+	// Workout version routes
+	app.GET("/workouts/{id}/versions", handlers.GetWorkoutVersions)
+	app.GET("/workouts/{id}/versions/diff", handlers.DiffWorkoutVersions)
+	app.GET("/workouts/{id}/versions/{version}", handlers.GetWorkoutVersion)
+	app.POST("/workouts/{id}/versions/{version}/restore", handlers.RestoreWorkoutVersion)
+
+	// Workout sharing routes
+	app.POST("/workouts/{id}/clone", handlers.CloneWorkout)
+	app.POST("/workouts/{id}/publish", handlers.PublishWorkout)
+	app.DELETE("/workouts/{id}/publish", handlers.UnpublishWorkout)
+	app.GET("/workouts/{id}/shares", handlers.GetWorkoutShares)
+	app.POST("/workouts/{id}/shares", handlers.ShareWorkout)
+	app.DELETE("/workouts/{id}/shares/{userId}", handlers.UnshareWorkout)
+	app.GET("/shared/workouts/{token}", handlers.GetSharedWorkout)
+	app.POST("/shared/workouts/{token}/clone", handlers.CloneSharedWorkout)
+	app.GET("/users/{userId}/shared-workouts", handlers.GetWorkoutsSharedWithUser)
 
 	// Exercise routes
 	app.GET("/exercises", handlers.GetExercises)
+	app.GET("/exercises/trash", handlers.GetExerciseTrash)
 	app.GET("/exercises/{id}", handlers.GetExercise)
 	app.POST("/exercises", handlers.CreateExercise)
 	app.PUT("/exercises/{id}", handlers.UpdateExercise)
 	app.DELETE("/exercises/{id}", handlers.DeleteExercise)
+	app.POST("/exercises/{id}/restore", handlers.RestoreExercise)
+
+	// Exercise media and instruction routes
+	app.PUT("/exercises/{id}/instructions", handlers.SetExerciseInstructions)
+	app.GET("/exercises/{id}/media", handlers.GetExerciseMedia)
+	app.POST("/exercises/{id}/media", handlers.UploadExerciseMedia)
+	app.PUT("/exercises/{id}/media/order", handlers.ReorderExerciseMedia)
+	app.PATCH("/exercises/{id}/media/{mediaId}", handlers.UpdateExerciseMedia)
+	app.DELETE("/exercises/{id}/media/{mediaId}", handlers.DeleteExerciseMedia)
+	app.GET("/exercises/{id}/media/{mediaId}/{variant}", handlers.DownloadExerciseMedia)
 
 	// Workout-Exercise association routes
 	app.GET("/workouts/{workoutId}/exercises", handlers.GetWorkoutExercises)
+	app.PUT("/workouts/{workoutId}/exercises/reorder", handlers.ReorderWorkoutExercises)
 	app.POST("/workouts/{workoutId}/exercises/{exerciseId}", handlers.AddExerciseToWorkout)
+	app.PUT("/workouts/{workoutId}/exercises/{exerciseId}", handlers.UpdateWorkoutExercise)
 	app.DELETE("/workouts/{workoutId}/exercises/{exerciseId}", handlers.RemoveExerciseFromWorkout)
+	app.GET("/workouts/{workoutId}/exercises/{exerciseId}/next", handlers.GetNextPrescription)
+	app.POST("/workouts/{workoutId}/exercises/{exerciseId}/next", handlers.ApplyNextPrescription)
+
+	// Template library routes
+	app.GET("/templates", handlers.GetTemplates)
+	app.GET("/templates/{id}", handlers.GetTemplate)
+	app.POST("/templates", handlers.PublishTemplate)
+	app.DELETE("/templates/{id}", handlers.DeleteTemplate)
+	app.POST("/templates/{id}/import", handlers.ImportTemplate)
+	app.GET("/templates/{id}/reviews", handlers.GetTemplateReviews)
+	app.POST("/templates/{id}/reviews", handlers.ReviewTemplate)
+	app.DELETE("/templates/{id}/reviews/{userId}", handlers.DeleteTemplateReview)
+
+	// Program routes
+	app.GET("/programs", handlers.GetPrograms)
+	app.GET("/programs/{id}", handlers.GetProgram)
+	app.POST("/programs", handlers.CreateProgram)
+	app.PUT("/programs/{id}", handlers.UpdateProgram)
+	app.DELETE("/programs/{id}", handlers.DeleteProgram)
+	app.POST("/programs/{id}/enroll", handlers.EnrollInProgram)
+
+	// Program enrollment routes
+	app.GET("/users/{userId}/enrollments", handlers.GetUserEnrollments)
+	app.GET("/enrollments/{id}", handlers.GetEnrollment)
+	app.POST("/enrollments/{id}/resync", handlers.ResyncEnrollment)
+	app.DELETE("/enrollments/{id}", handlers.CancelEnrollment)
+
+	// Schedule and calendar routes
+	app.GET("/users/{userId}/schedules", handlers.GetUserSchedules)
+	app.POST("/users/{userId}/schedules", handlers.CreateSchedule)
+	app.GET("/schedules/{id}", handlers.GetSchedule)
+	app.PUT("/schedules/{id}", handlers.UpdateSchedule)
+	app.DELETE("/schedules/{id}", handlers.DeleteSchedule)
+	app.POST("/schedules/{id}/occurrences/{date}/skip", handlers.SkipScheduleOccurrence)
+	app.POST("/schedules/{id}/occurrences/{date}/move", handlers.MoveScheduleOccurrence)
+	app.DELETE("/schedules/{id}/occurrences/{date}", handlers.RestoreScheduleOccurrence)
+	app.GET("/users/{userId}/calendar", handlers.GetUserCalendar)
+	app.GET("/users/{userId}/calendar/feed", handlers.GetCalendarFeed)
+	app.POST("/users/{userId}/calendar/feed/rotate", handlers.RotateCalendarFeed)
+	app.GET("/calendar/{token}.ics", handlers.GetCalendarFeedICS)
 
 	// User progress routes
 	app.GET("/users/{userId}/progress", handlers.GetUserProgress)
+	app.GET("/users/{userId}/progress/export", handlers.ExportUserProgress)
 	app.POST("/users/{userId}/progress", handlers.RecordUserProgress)
+	app.PATCH("/users/{userId}/progress/{progressId}", handlers.UpdateUserProgress)
+	app.DELETE("/users/{userId}/progress/{progressId}", handlers.DeleteUserProgress)
+	app.GET("/users/{userId}/progress/{progressId}/history", handlers.GetUserProgressHistory)
+	app.POST("/users/{userId}/progress/{progressId}/restore", handlers.RestoreUserProgress)
+	app.GET("/users/{userId}/sessions", handlers.GetUserSessions)
+
+	// Body measurement routes
+	app.GET("/users/{userId}/measurements", handlers.GetUserMeasurements)
+	app.POST("/users/{userId}/measurements", handlers.CreateMeasurement)
+	app.GET("/users/{userId}/measurements/trend", handlers.GetMeasurementTrend)
+	app.PATCH("/users/{userId}/measurements/{id}", handlers.UpdateMeasurement)
+	app.DELETE("/users/{userId}/measurements/{id}", handlers.DeleteMeasurement)
+
+	// Goal routes
+	app.GET("/users/{userId}/goals", handlers.GetUserGoals)
+	app.POST("/users/{userId}/goals", handlers.CreateGoal)
+	app.GET("/users/{userId}/goals/{id}", handlers.GetGoal)
+	app.PATCH("/users/{userId}/goals/{id}", handlers.UpdateGoal)
+	app.DELETE("/users/{userId}/goals/{id}", handlers.DeleteGoal)
+
+	// Achievement routes
+	app.GET("/achievements", handlers.GetAchievements)
+	app.POST("/achievements", handlers.CreateAchievement)
+	app.GET("/users/{userId}/achievements", handlers.GetUserAchievements)
+
+	// Report routes
+	app.GET("/users/{userId}/reports/{period}", handlers.GetUserReport)
+
+	// Progress photo routes
+	app.GET("/users/{userId}/photos", handlers.GetUserPhotos)
+	app.POST("/users/{userId}/photos", handlers.UploadPhoto)
+	app.GET("/users/{userId}/photos/compare", handlers.ComparePhotos)
+	app.GET("/users/{userId}/photos/{id}", handlers.GetPhoto)
+	app.PATCH("/users/{userId}/photos/{id}", handlers.UpdatePhoto)
+	app.DELETE("/users/{userId}/photos/{id}", handlers.DeletePhoto)
+	app.GET("/photos/{id}/{variant}", handlers.DownloadPhoto)
+
+	// Activity routes
+	app.GET("/users/{userId}/activities", handlers.GetUserActivities)
+	app.POST("/users/{userId}/activities", handlers.UploadActivity)
+	app.GET("/users/{userId}/activities/{id}", handlers.GetActivity)
+	app.DELETE("/users/{userId}/activities/{id}", handlers.DeleteActivity)
+	app.GET("/users/{userId}/activities/{id}/samples", handlers.GetActivitySamples)
+
+	// Personal record routes
+	app.GET("/users/{userId}/records", handlers.GetUserRecords)
+
+	// Analytics routes
+	app.GET("/users/{userId}/analytics", handlers.GetUserAnalytics)
+	app.POST("/users/{userId}/analytics/rebuild", handlers.RebuildUserAnalytics)
+
+	// Trash routes
+	app.GET("/users/{userId}/trash", handlers.GetUserTrash)
+
+	// Import routes
+	app.GET("/users/{userId}/imports", handlers.GetUserImports)
+	app.POST("/users/{userId}/imports", handlers.CreateImport)
+	app.GET("/users/{userId}/imports/{id}", handlers.GetImport)
+	app.GET("/users/{userId}/imports/{id}/exercises", handlers.GetImportExercises)
+	app.PUT("/users/{userId}/imports/{id}/exercises", handlers.ResolveImportExercises)
+	app.POST("/users/{userId}/imports/{id}/start", handlers.StartImport)
+	app.GET("/users/{userId}/imports/{id}/rows", handlers.GetImportRows)
+
+	// Data export routes
+	app.GET("/users/{userId}/exports", handlers.GetUserDataExports)
+	app.POST("/users/{userId}/exports", handlers.RequestDataExport)
+	app.GET("/users/{userId}/exports/{id}", handlers.GetDataExport)
+	app.GET("/exports/{token}.zip", handlers.DownloadDataExport)
+
+	// User preference routes
+	app.GET("/users/{userId}/preferences", handlers.GetUserPreferences)
+	app.PUT("/users/{userId}/preferences", handlers.UpdateUserPreferences)
 }
\ No newline at end of file
@@ -0,0 +1,218 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultDeletionGraceDays is how long a deletion request can be cancelled
+// when ACCOUNT_DELETION_GRACE_DAYS isn't set
+const defaultDeletionGraceDays = 14
+
+// AccountDeletion is a user's request to delete their account. The account
+// is deactivated at once and its personal data erased after EraseAfter
+// unless the request is cancelled first.
+type AccountDeletion struct {
+	UserID      int        `json:"user_id"`
+	RequestedAt time.Time  `json:"requested_at"`
+	EraseAfter  time.Time  `json:"erase_after"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// CreateAccountDeletionTable creates the account_deletions table if it
+// doesn't exist
+func CreateAccountDeletionTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS account_deletions (
+		user_id INT PRIMARY KEY,
+		requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		erase_after TIMESTAMP NOT NULL,
+		completed_at TIMESTAMP NULL,
+		INDEX idx_account_deletions_erase_after (erase_after),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// Users deactivated before deletion requests existed are queued as if
+	// they had asked on the day they were deactivated
+	graceDays := int(AccountDeletionGrace() / (24 * time.Hour))
+	query = `
+	INSERT INTO account_deletions (user_id, requested_at, erase_after)
+	SELECT u.id, u.deleted_at, DATE_ADD(u.deleted_at, INTERVAL ? DAY)
+	FROM users u
+	LEFT JOIN account_deletions d ON d.user_id = u.id
+	WHERE u.deleted_at IS NOT NULL AND d.user_id IS NULL`
+	_, err := db.Exec(query, graceDays)
+	return err
+}
+
+// AccountDeletionGrace returns how long a deletion request can be cancelled,
+// read from ACCOUNT_DELETION_GRACE_DAYS
+func AccountDeletionGrace() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		days = defaultDeletionGraceDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetAccountDeletion retrieves a user's deletion request
+func GetAccountDeletion(db *sql.DB, userID int) (AccountDeletion, error) {
+	query := "SELECT user_id, requested_at, erase_after, completed_at FROM account_deletions WHERE user_id = ?"
+	var deletion AccountDeletion
+	var completedAt sql.NullTime
+	err := db.QueryRow(query, userID).Scan(&deletion.UserID, &deletion.RequestedAt, &deletion.EraseAfter, &completedAt)
+	if completedAt.Valid {
+		deletion.CompletedAt = &completedAt.Time
+	}
+	return deletion, err
+}
+
+// RequestAccountDeletion deactivates a user and schedules their personal
+// data to be erased once the grace period has passed
+func RequestAccountDeletion(db *sql.DB, userID int, grace time.Duration) (AccountDeletion, error) {
+	now := time.Now()
+	deletion := AccountDeletion{UserID: userID, RequestedAt: now, EraseAfter: now.Add(grace)}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return deletion, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", now, userID); err != nil {
+		tx.Rollback()
+		return deletion, err
+	}
+
+	query := "INSERT INTO account_deletions (user_id, requested_at, erase_after) VALUES (?, ?, ?)"
+	if _, err := tx.Exec(query, userID, now, deletion.EraseAfter); err != nil {
+		tx.Rollback()
+		return deletion, err
+	}
+
+	return deletion, tx.Commit()
+}
+
+// CancelAccountDeletion withdraws a pending deletion request and reactivates
+// the user, returning sql.ErrNoRows if there is nothing left to cancel
+func CancelAccountDeletion(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("DELETE FROM account_deletions WHERE user_id = ? AND completed_at IS NULL", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		tx.Rollback()
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET deleted_at = NULL WHERE id = ?", userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetDueAccountDeletions returns the users whose grace period has passed
+func GetDueAccountDeletions(db *sql.DB, now time.Time) ([]int, error) {
+	rows, err := db.Query("SELECT user_id FROM account_deletions WHERE completed_at IS NULL AND erase_after <= ? ORDER BY erase_after", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// anonymizeQueries erase a user's personal data, each taking the user ID.
+// The users row stays behind as a tombstone so that
+// daily rollups, template ratings, and programs and workouts other users
+// train with stay intact without pointing at anyone.
+var anonymizeQueries = []string{
+	// Training history
+	"DELETE FROM activities WHERE user_id = ?",
+	"DELETE FROM progress_revisions WHERE user_id = ?",
+	"DELETE FROM personal_records WHERE user_id = ?",
+	"DELETE FROM progress WHERE user_id = ?",
+	"DELETE FROM program_enrollments WHERE user_id = ?",
+	"DELETE FROM workout_schedules WHERE user_id = ?",
+	"DELETE FROM sessions WHERE user_id = ?",
+
+	// Account data
+	"DELETE FROM user_preferences WHERE user_id = ?",
+	"DELETE FROM body_measurements WHERE user_id = ?",
+	"DELETE FROM progress_photos WHERE user_id = ?",
+	"DELETE FROM goals WHERE user_id = ?",
+	"DELETE FROM user_achievements WHERE user_id = ?",
+	"DELETE FROM report_deliveries WHERE user_id = ?",
+	"DELETE FROM calendar_feeds WHERE user_id = ?",
+	"DELETE FROM data_exports WHERE user_id = ?",
+	"DELETE FROM imports WHERE user_id = ?",
+	"DELETE FROM workout_shares WHERE user_id = ?",
+
+	// Workouts nobody else depends on are erased; the rest are made
+	// private and unshared
+	`DELETE FROM workouts
+	WHERE user_id = ?
+		AND NOT EXISTS (SELECT 1 FROM program_days d WHERE d.workout_id = workouts.id)
+		AND NOT EXISTS (SELECT 1 FROM program_sessions s WHERE s.workout_id = workouts.id)
+		AND NOT EXISTS (SELECT 1 FROM sessions s WHERE s.workout_id = workouts.id)
+		AND NOT EXISTS (SELECT 1 FROM progress p WHERE p.workout_id = workouts.id)`,
+	"DELETE FROM workout_shares WHERE workout_id IN (SELECT id FROM workouts WHERE user_id = ?)",
+	"UPDATE workouts SET visibility = 'private', share_token = NULL WHERE user_id = ?",
+
+	// Published content stays, without its author or review text
+	"UPDATE templates SET author_id = NULL WHERE author_id = ?",
+	"UPDATE template_reviews SET review = '' WHERE user_id = ?",
+
+	// The tombstone keeps nothing that identifies the user
+	`UPDATE users
+	SET username = CONCAT('deleted-user-', id), email = CONCAT('deleted-user-', id, '@deleted.invalid'), password = ''
+	WHERE id = ?`,
+}
+
+// AnonymizeUser permanently erases a deactivated user's personal data and
+// completes their deletion request
+func AnonymizeUser(db *sql.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, query := range anonymizeQueries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE account_deletions SET completed_at = ? WHERE user_id = ?", time.Now(), userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,626 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Achievement metrics. Each is a running total over the user's history that
+// only ever grows, so an achievement is earned on the first day its metric
+// reaches the threshold.
+const (
+	// MetricSessions counts sessions with at least one progress record
+	MetricSessions = "sessions"
+
+	// MetricWeeklyStreak is the longest run of weeks in a row with a session
+	MetricWeeklyStreak = "weekly_streak"
+
+	// MetricTonnage is the total volume lifted, in kilograms
+	MetricTonnage = "tonnage"
+
+	// MetricPersonalRecords counts personal records that beat an earlier
+	// record, so first entries don't count
+	MetricPersonalRecords = "personal_records"
+)
+
+// AchievementMetrics lists every supported achievement metric
+var AchievementMetrics = []string{MetricSessions, MetricWeeklyStreak, MetricTonnage, MetricPersonalRecords}
+
+// IsValidAchievementMetric reports whether m is a supported achievement metric
+func IsValidAchievementMetric(m string) bool {
+	for _, metric := range AchievementMetrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// Achievement is a definition of something users can earn: reaching
+// Threshold in Metric. Definitions are data, so new ones are added without
+// touching the rules that evaluate them, and users' past training is
+// backfilled against them in the background.
+type Achievement struct {
+	ID          int       `json:"id"`
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Metric      string    `json:"metric"`
+	Threshold   float64   `json:"threshold"`
+	Unit        string    `json:"unit,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// defaultAchievements are the definitions every installation starts with.
+// They are added by code, so existing definitions are never changed; new
+// defaults are added and backfilled like any other definition.
+var defaultAchievements = []Achievement{
+	{Code: "first_workout", Name: "First Workout", Description: "Log your first session", Metric: MetricSessions, Threshold: 1},
+	{Code: "sessions_10", Name: "Getting Started", Description: "Log 10 sessions", Metric: MetricSessions, Threshold: 10},
+	{Code: "sessions_50", Name: "Regular", Description: "Log 50 sessions", Metric: MetricSessions, Threshold: 50},
+	{Code: "sessions_100", Name: "Centurion", Description: "Log 100 sessions", Metric: MetricSessions, Threshold: 100},
+	{Code: "streak_4_weeks", Name: "Habit Forming", Description: "Train every week for 4 weeks in a row", Metric: MetricWeeklyStreak, Threshold: 4},
+	{Code: "streak_12_weeks", Name: "Consistent", Description: "Train every week for 12 weeks in a row", Metric: MetricWeeklyStreak, Threshold: 12},
+	{Code: "streak_26_weeks", Name: "Half a Year Strong", Description: "Train every week for 26 weeks in a row", Metric: MetricWeeklyStreak, Threshold: 26},
+	{Code: "streak_52_weeks", Name: "Year Round", Description: "Train every week for 52 weeks in a row", Metric: MetricWeeklyStreak, Threshold: 52},
+	{Code: "tonnage_10t", Name: "10 Tonnes", Description: "Lift 10,000 kg in total", Metric: MetricTonnage, Threshold: 10000},
+	{Code: "tonnage_100t", Name: "100 Tonnes", Description: "Lift 100,000 kg in total", Metric: MetricTonnage, Threshold: 100000},
+	{Code: "tonnage_1000t", Name: "1,000 Tonnes", Description: "Lift 1,000,000 kg in total", Metric: MetricTonnage, Threshold: 1000000},
+	{Code: "records_1", Name: "New Best", Description: "Beat a personal record", Metric: MetricPersonalRecords, Threshold: 1},
+	{Code: "records_10", Name: "Record Breaker", Description: "Beat 10 personal records", Metric: MetricPersonalRecords, Threshold: 10},
+	{Code: "records_50", Name: "Unstoppable", Description: "Beat 50 personal records", Metric: MetricPersonalRecords, Threshold: 50},
+}
+
+// EarnedAchievement is an achievement a user has earned, on AwardedOn
+type EarnedAchievement struct {
+	Achievement
+	AwardedOn time.Time `json:"awarded_on"`
+}
+
+// LockedAchievement is an achievement a user has yet to earn, with how far
+// they have come
+type LockedAchievement struct {
+	Achievement
+	Current float64 `json:"current"`
+	Percent float64 `json:"percent"`
+}
+
+// Streak is a user's run of weeks in a row with a session. The week in
+// progress extends the current streak once trained in, and breaks it only
+// once it is over.
+type Streak struct {
+	CurrentWeeks     int        `json:"current_weeks"`
+	LongestWeeks     int        `json:"longest_weeks"`
+	TrainedThisWeek  bool       `json:"trained_this_week"`
+	LastSessionOn    *time.Time `json:"last_session_on,omitempty"`
+	CurrentStartedOn *time.Time `json:"current_started_on,omitempty"`
+}
+
+// AchievementSummary is a user's streak and achievements, earned ones
+// newest first and locked ones closest to being earned first
+type AchievementSummary struct {
+	Streak Streak              `json:"streak"`
+	Earned []EarnedAchievement `json:"earned"`
+	Locked []LockedAchievement `json:"locked"`
+}
+
+// CreateAchievementTables creates the achievements and user_achievements
+// tables if they don't exist, and adds missing default definitions
+func CreateAchievementTables(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS achievements (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		code VARCHAR(50) NOT NULL UNIQUE,
+		name VARCHAR(100) NOT NULL,
+		description VARCHAR(255) NOT NULL DEFAULT '',
+		metric VARCHAR(20) NOT NULL,
+		threshold DECIMAL(14,2) NOT NULL,
+		backfilled_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	query = `
+	CREATE TABLE IF NOT EXISTS user_achievements (
+		user_id INT NOT NULL,
+		achievement_id INT NOT NULL,
+		awarded_on DATE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, achievement_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (achievement_id) REFERENCES achievements(id) ON DELETE CASCADE
+	);`
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	for _, a := range defaultAchievements {
+		query := "INSERT IGNORE INTO achievements (code, name, description, metric, threshold) VALUES (?, ?, ?, ?, ?)"
+		if _, err := db.Exec(query, a.Code, a.Name, a.Description, a.Metric, a.Threshold); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks a new achievement definition
+func (a Achievement) Validate() error {
+	if a.Code == "" || len(a.Code) > 50 || strings.Trim(a.Code, "abcdefghijklmnopqrstuvwxyz0123456789_") != "" {
+		return errors.New("code must be 1 to 50 lowercase letters, digits and underscores")
+	}
+	if strings.TrimSpace(a.Name) == "" || len(a.Name) > 100 {
+		return errors.New("name is required and limited to 100 characters")
+	}
+	if len(a.Description) > 255 {
+		return errors.New("description is limited to 255 characters")
+	}
+	if !IsValidAchievementMetric(a.Metric) {
+		return errors.New("metric must be one of " + strings.Join(AchievementMetrics, ", "))
+	}
+	if a.Threshold <= 0 {
+		return errors.New("threshold must be positive")
+	}
+	return nil
+}
+
+// InUnits returns a copy of the achievement expressed in u
+func (a Achievement) InUnits(u Units) Achievement {
+	if a.Metric == MetricTonnage {
+		a.Threshold = RoundWeight(u.WeightFromKg(a.Threshold))
+		a.Unit = u.Weight
+	}
+	return a
+}
+
+// achievementSelect selects the columns scanned by scanAchievement
+const achievementSelect = `
+	SELECT a.id, a.code, a.name, a.description, a.metric, a.threshold, a.created_at
+	FROM achievements a`
+
+// scanAchievement scans an achievement selected with achievementSelect
+func scanAchievement(row interface{ Scan(...interface{}) error }) (Achievement, error) {
+	var a Achievement
+	err := row.Scan(&a.ID, &a.Code, &a.Name, &a.Description, &a.Metric, &a.Threshold, &a.CreatedAt)
+	return a, err
+}
+
+// queryAchievements retrieves the achievements matched by a query built on
+// achievementSelect
+func queryAchievements(db *sql.DB, query string, args ...interface{}) ([]Achievement, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	achievements := []Achievement{}
+	for rows.Next() {
+		a, err := scanAchievement(rows)
+		if err != nil {
+			return nil, err
+		}
+		achievements = append(achievements, a)
+	}
+
+	return achievements, rows.Err()
+}
+
+// GetAchievements retrieves every achievement definition, grouped by metric
+// and ordered by threshold
+func GetAchievements(db *sql.DB) ([]Achievement, error) {
+	return queryAchievements(db, achievementSelect+" ORDER BY a.metric, a.threshold, a.id")
+}
+
+// GetAchievement retrieves an achievement definition by ID
+func GetAchievement(db *sql.DB, id int) (Achievement, error) {
+	return scanAchievement(db.QueryRow(achievementSelect+" WHERE a.id = ?", id))
+}
+
+// GetAchievementByCode retrieves an achievement definition by its code
+func GetAchievementByCode(db *sql.DB, code string) (Achievement, error) {
+	return scanAchievement(db.QueryRow(achievementSelect+" WHERE a.code = ?", code))
+}
+
+// CreateAchievement adds an achievement definition, returning its ID. Users
+// who already qualify are awarded it by BackfillAchievements.
+func CreateAchievement(db *sql.DB, a Achievement) (int, error) {
+	query := "INSERT INTO achievements (code, name, description, metric, threshold) VALUES (?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, a.Code, a.Name, a.Description, a.Metric, a.Threshold)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// AwardAchievements awards a user every achievement their history has
+// earned and they don't have yet, returning the new ones. Awards are never
+// taken back, and awarding twice has no effect.
+func AwardAchievements(db *sql.DB, userID int, prefs Preferences) ([]EarnedAchievement, error) {
+	achievements, err := GetAchievements(db)
+	if err != nil {
+		return nil, err
+	}
+	return awardAchievements(db, userID, prefs, achievements)
+}
+
+// awardAchievements awards a user those of the achievements they have
+// earned and don't have yet
+func awardAchievements(db *sql.DB, userID int, prefs Preferences, achievements []Achievement) ([]EarnedAchievement, error) {
+	earned, err := earnedAchievementIDs(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Achievement
+	metrics := make(map[string]bool)
+	for _, a := range achievements {
+		if !earned[a.ID] {
+			pending = append(pending, a)
+			metrics[a.Metric] = true
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	timelines, _, err := achievementTimelines(db, userID, prefs, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	var awarded []EarnedAchievement
+	for _, a := range pending {
+		on := reachedOn(timelines[a.Metric], a.Threshold)
+		if on == nil {
+			continue
+		}
+
+		query := "INSERT IGNORE INTO user_achievements (user_id, achievement_id, awarded_on) VALUES (?, ?, ?)"
+		result, err := db.Exec(query, userID, a.ID, *on)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			awarded = append(awarded, EarnedAchievement{Achievement: a, AwardedOn: *on})
+		}
+	}
+	return awarded, nil
+}
+
+// earnedAchievementIDs returns the IDs of the achievements a user has earned
+func earnedAchievementIDs(db *sql.DB, userID int) (map[int]bool, error) {
+	rows, err := db.Query("SELECT achievement_id FROM user_achievements WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	earned := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		earned[id] = true
+	}
+	return earned, rows.Err()
+}
+
+// GetAchievementSummary awards a user anything they have earned but not yet
+// received, then returns their streak with their earned and locked
+// achievements
+func GetAchievementSummary(db *sql.DB, userID int, prefs Preferences) (AchievementSummary, error) {
+	summary := AchievementSummary{Earned: []EarnedAchievement{}, Locked: []LockedAchievement{}}
+
+	if _, err := AwardAchievements(db, userID, prefs); err != nil {
+		return summary, err
+	}
+
+	query := `
+	SELECT a.id, a.code, a.name, a.description, a.metric, a.threshold, a.created_at, ua.awarded_on
+	FROM user_achievements ua
+	JOIN achievements a ON a.id = ua.achievement_id
+	WHERE ua.user_id = ?
+	ORDER BY ua.awarded_on DESC, a.metric, a.threshold DESC`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+
+	earned := make(map[int]bool)
+	for rows.Next() {
+		var e EarnedAchievement
+		if err := rows.Scan(&e.ID, &e.Code, &e.Name, &e.Description, &e.Metric, &e.Threshold, &e.CreatedAt, &e.AwardedOn); err != nil {
+			return summary, err
+		}
+		earned[e.ID] = true
+		summary.Earned = append(summary.Earned, e)
+	}
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	all := make(map[string]bool)
+	for _, metric := range AchievementMetrics {
+		all[metric] = true
+	}
+	timelines, streak, err := achievementTimelines(db, userID, prefs, all)
+	if err != nil {
+		return summary, err
+	}
+	summary.Streak = streak
+
+	achievements, err := GetAchievements(db)
+	if err != nil {
+		return summary, err
+	}
+	for _, a := range achievements {
+		if earned[a.ID] {
+			continue
+		}
+		current := 0.0
+		if points := timelines[a.Metric]; len(points) > 0 {
+			current = points[len(points)-1].Value
+		}
+		percent := math.Round(math.Min(current/a.Threshold, 1)*1000) / 10
+		summary.Locked = append(summary.Locked, LockedAchievement{Achievement: a, Current: current, Percent: percent})
+	}
+
+	// Closest to being earned first
+	sort.SliceStable(summary.Locked, func(i, j int) bool {
+		return summary.Locked[i].Percent > summary.Locked[j].Percent
+	})
+	return summary, nil
+}
+
+// InUnits returns a copy of the summary expressed in u
+func (s AchievementSummary) InUnits(u Units) AchievementSummary {
+	earned := make([]EarnedAchievement, len(s.Earned))
+	for i, e := range s.Earned {
+		e.Achievement = e.Achievement.InUnits(u)
+		earned[i] = e
+	}
+	locked := make([]LockedAchievement, len(s.Locked))
+	for i, l := range s.Locked {
+		if l.Metric == MetricTonnage {
+			l.Current = RoundWeight(u.WeightFromKg(l.Current))
+		}
+		l.Achievement = l.Achievement.InUnits(u)
+		locked[i] = l
+	}
+	s.Earned, s.Locked = earned, locked
+	return s
+}
+
+// BackfillAchievements awards achievement definitions that haven't been
+// backfilled yet to every user whose past training has earned them, then
+// marks them backfilled. It returns the number of awards made.
+func BackfillAchievements(db *sql.DB) (int, error) {
+	achievements, err := queryAchievements(db, achievementSelect+" WHERE a.backfilled_at IS NULL ORDER BY a.id")
+	if err != nil || len(achievements) == 0 {
+		return 0, err
+	}
+
+	rows, err := db.Query("SELECT DISTINCT user_id FROM sessions ORDER BY user_id")
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	awards := 0
+	for _, userID := range userIDs {
+		prefs, err := GetPreferences(db, userID)
+		if err != nil {
+			return awards, err
+		}
+		awarded, err := awardAchievements(db, userID, prefs, achievements)
+		if err != nil {
+			return awards, err
+		}
+		awards += len(awarded)
+	}
+
+	for _, a := range achievements {
+		if _, err := db.Exec("UPDATE achievements SET backfilled_at = ? WHERE id = ?", time.Now(), a.ID); err != nil {
+			return awards, err
+		}
+	}
+	return awards, nil
+}
+
+// achievementTimelines computes the running value of each of the metrics
+// over a user's history, oldest first, along with their streak
+func achievementTimelines(db *sql.DB, userID int, prefs Preferences, metrics map[string]bool) (map[string][]TrendPoint, Streak, error) {
+	timelines := make(map[string][]TrendPoint)
+	var streak Streak
+
+	if metrics[MetricSessions] || metrics[MetricWeeklyStreak] {
+		dates, err := sessionDates(db, userID, time.Time{}, time.Time{})
+		if err != nil {
+			return nil, streak, err
+		}
+		for i, date := range dates {
+			timelines[MetricSessions] = appendRunning(timelines[MetricSessions], date, float64(i+1))
+		}
+		timelines[MetricWeeklyStreak], streak = streakTimeline(dates, prefs.WeekStart(), prefs.Today())
+	}
+
+	if metrics[MetricTonnage] {
+		query := "SELECT date, SUM(volume) FROM progress_daily_rollups WHERE user_id = ? GROUP BY date ORDER BY date"
+		points, err := runningTotal(db, query, userID)
+		if err != nil {
+			return nil, streak, err
+		}
+		timelines[MetricTonnage] = points
+	}
+
+	if metrics[MetricPersonalRecords] {
+		// Only records that beat an earlier record of the same kind count.
+		// e1RM records count with the user's formula only.
+		query := `
+		SELECT r.achieved_on, COUNT(*)
+		FROM personal_records r
+		WHERE r.user_id = ? AND r.formula IN ('', ?)
+			AND EXISTS (SELECT 1 FROM personal_records o WHERE ` + earlierRecordSQL + `)
+		GROUP BY r.achieved_on
+		ORDER BY r.achieved_on`
+		points, err := runningTotal(db, query, userID, prefs.E1RMFormula)
+		if err != nil {
+			return nil, streak, err
+		}
+		timelines[MetricPersonalRecords] = points
+	}
+
+	return timelines, streak, nil
+}
+
+// runningTotal sums the (date, amount) rows of a query into a running total
+// per date
+func runningTotal(db *sql.DB, query string, args ...interface{}) ([]TrendPoint, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []TrendPoint
+	total := 0.0
+	for rows.Next() {
+		var date time.Time
+		var amount float64
+		if err := rows.Scan(&date, &amount); err != nil {
+			return nil, err
+		}
+		total += amount
+		points = appendRunning(points, date, total)
+	}
+	return points, rows.Err()
+}
+
+// streakTimeline walks the weeks from the first session to today, returning
+// the longest streak as it grew, dated by the session that extended it, and
+// the streak as of today
+func streakTimeline(dates []time.Time, weekStart time.Weekday, today time.Time) ([]TrendPoint, Streak) {
+	var points []TrendPoint
+	var streak Streak
+	if len(dates) == 0 {
+		return points, streak
+	}
+
+	firstOfWeek := make(map[time.Time]time.Time)
+	for _, date := range dates {
+		week := BucketStart(BucketWeek, date, weekStart)
+		if _, ok := firstOfWeek[week]; !ok {
+			firstOfWeek[week] = date
+		}
+	}
+
+	thisWeek := BucketStart(BucketWeek, today, weekStart)
+	current := 0
+	var startedOn time.Time
+	for week := BucketStart(BucketWeek, dates[0], weekStart); !week.After(thisWeek); week = week.AddDate(0, 0, 7) {
+		date, trained := firstOfWeek[week]
+		switch {
+		case trained:
+			if current == 0 {
+				startedOn = date
+			}
+			current++
+			if current > streak.LongestWeeks {
+				streak.LongestWeeks = current
+				points = appendRunning(points, date, float64(current))
+			}
+		case week.Before(thisWeek):
+			current = 0
+		}
+	}
+
+	last := dates[len(dates)-1]
+	streak.CurrentWeeks = current
+	_, streak.TrainedThisWeek = firstOfWeek[thisWeek]
+	streak.LastSessionOn = &last
+	if current > 0 {
+		streak.CurrentStartedOn = &startedOn
+	}
+	return points, streak
+}
+
+// appendRunning appends a running value, replacing the last point when it
+// is for the same date
+func appendRunning(points []TrendPoint, date time.Time, value float64) []TrendPoint {
+	if n := len(points); n > 0 && points[n-1].Date.Equal(date) {
+		points[n-1].Value = value
+		return points
+	}
+	return append(points, TrendPoint{Date: date, Value: value})
+}
+
+// reachedOn returns the first date a running value reached threshold, or
+// nil if it hasn't
+func reachedOn(points []TrendPoint, threshold float64) *time.Time {
+	for _, p := range points {
+		if p.Value >= threshold {
+			date := p.Date
+			return &date
+		}
+	}
+	return nil
+}
+
+// sessionDates returns the dates of a user's sessions with at least one
+// progress record not in the trash, oldest first, optionally limited to
+// from..to
+func sessionDates(db *sql.DB, userID int, from, to time.Time) ([]time.Time, error) {
+	query := `
+	SELECT s.date
+	FROM sessions s
+	WHERE s.user_id = ?
+		AND EXISTS (SELECT 1 FROM progress p WHERE p.session_id = s.id AND p.deleted_at IS NULL)`
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		query += " AND s.date >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND s.date <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY s.date, s.id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+	}
+	return dates, rows.Err()
+}
@@ -0,0 +1,352 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Activity file formats
+const (
+	ActivityFIT = "fit"
+	ActivityGPX = "gpx"
+	ActivityTCX = "tcx"
+)
+
+// Cardio sports an activity can be recorded as
+const (
+	SportRunning  = "running"
+	SportCycling  = "cycling"
+	SportWalking  = "walking"
+	SportHiking   = "hiking"
+	SportSwimming = "swimming"
+	SportRowing   = "rowing"
+	SportOther    = "other"
+)
+
+// sportExercises names the catalog exercise each sport is logged against
+var sportExercises = map[string]string{
+	SportRunning:  "Running",
+	SportCycling:  "Cycling",
+	SportWalking:  "Walking",
+	SportHiking:   "Hiking",
+	SportSwimming: "Swimming",
+	SportRowing:   "Rowing",
+	SportOther:    "Cardio",
+}
+
+// MaxActivitySize is the largest activity file accepted, compressed or not.
+// Decompressed files may be up to four times larger.
+const MaxActivitySize = 16 << 20
+
+// Activity is a recorded cardio activity uploaded from a device file. Its
+// session and progress entry are created with it. Distance is in meters,
+// elevation in meters and durations in seconds; Duration excludes pauses.
+type Activity struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"user_id"`
+	SessionID     int       `json:"session_id"`
+	ProgressID    int       `json:"progress_id"`
+	ExerciseID    int       `json:"exercise_id"`
+	Name          string    `json:"name"`
+	Sport         string    `json:"sport"`
+	Format        string    `json:"format"`
+	Filename      string    `json:"filename"`
+	StartedAt     time.Time `json:"started_at"`
+	ElapsedTime   int       `json:"elapsed_time"`
+	Duration      int       `json:"duration"`
+	Distance      float64   `json:"distance"`
+	Pace          float64   `json:"pace,omitempty"`
+	ElevationGain float64   `json:"elevation_gain"`
+	ElevationLoss float64   `json:"elevation_loss"`
+	AvgHeartRate  int       `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate  int       `json:"max_heart_rate,omitempty"`
+	SampleCount   int       `json:"sample_count"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// FileHash identifies the uploaded file, so uploading it again is caught
+	FileHash string `json:"-"`
+
+	// Units is set once the activity has been converted for a response
+	Units *Units `json:"units,omitempty"`
+}
+
+// InUnits returns a copy of the activity with its distance and pace in u's
+// distance unit. Pace is in seconds per distance unit.
+func (a Activity) InUnits(u Units) Activity {
+	if a.Distance > 0 && a.Duration > 0 {
+		a.Pace = math.Round(float64(a.Duration) / u.DistanceFromMeters(a.Distance))
+	}
+	a.Distance = RoundDistance(u.DistanceFromMeters(a.Distance))
+	a.Units = &u
+	return a
+}
+
+// CreateActivityTable creates the activities table if it doesn't exist
+func CreateActivityTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS activities (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		session_id INT NULL,
+		progress_id INT NULL,
+		exercise_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL DEFAULT '',
+		sport VARCHAR(20) NOT NULL,
+		format VARCHAR(4) NOT NULL,
+		filename VARCHAR(255) NOT NULL DEFAULT '',
+		file_hash CHAR(64) NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		elapsed_seconds INT NOT NULL DEFAULT 0,
+		duration_seconds INT NOT NULL DEFAULT 0,
+		distance_meters DECIMAL(10,2) NOT NULL DEFAULT 0,
+		elevation_gain DECIMAL(7,1) NOT NULL DEFAULT 0,
+		elevation_loss DECIMAL(7,1) NOT NULL DEFAULT 0,
+		avg_heart_rate SMALLINT NOT NULL DEFAULT 0,
+		max_heart_rate SMALLINT NOT NULL DEFAULT 0,
+		sample_count INT NOT NULL DEFAULT 0,
+		samples MEDIUMBLOB,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_activities_file (user_id, file_hash),
+		INDEX idx_activities_user_start (user_id, started_at),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL,
+		FOREIGN KEY (progress_id) REFERENCES progress(id) ON DELETE SET NULL,
+		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// Activities go with their exercise when it is purged from the trash
+	return setForeignKeyOnDelete(db, "activities", "exercise_id", "exercises", "CASCADE")
+}
+
+// activitySelect selects the columns scanned by scanActivity
+const activitySelect = `
+	SELECT id, user_id, COALESCE(session_id, 0), COALESCE(progress_id, 0), exercise_id, name, sport, format, filename, file_hash,
+		started_at, elapsed_seconds, duration_seconds, distance_meters, elevation_gain, elevation_loss, avg_heart_rate, max_heart_rate,
+		sample_count, created_at
+	FROM activities`
+
+// scanActivity scans an activity selected with activitySelect
+func scanActivity(row interface{ Scan(...interface{}) error }) (Activity, error) {
+	var a Activity
+	err := row.Scan(&a.ID, &a.UserID, &a.SessionID, &a.ProgressID, &a.ExerciseID, &a.Name, &a.Sport, &a.Format, &a.Filename, &a.FileHash,
+		&a.StartedAt, &a.ElapsedTime, &a.Duration, &a.Distance, &a.ElevationGain, &a.ElevationLoss, &a.AvgHeartRate, &a.MaxHeartRate,
+		&a.SampleCount, &a.CreatedAt)
+	return a, err
+}
+
+// ParseActivityFile reads a FIT, GPX or TCX file, optionally gzipped, into an
+// activity with its totals and the samples to store. The format is detected
+// from the content. The file hash is taken after decompression, so the same
+// recording is recognized either way.
+func ParseActivityFile(data []byte, filename string) (Activity, []ActivitySample, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return Activity{}, nil, errors.New("invalid gzip file")
+		}
+		data, err = io.ReadAll(io.LimitReader(reader, 4*MaxActivitySize+1))
+		if err != nil {
+			return Activity{}, nil, errors.New("invalid gzip file")
+		}
+		if len(data) > 4*MaxActivitySize {
+			return Activity{}, nil, errors.New("the decompressed file is too large")
+		}
+	}
+
+	var parsed ParsedActivity
+	var err error
+	switch {
+	case isFIT(data):
+		parsed, err = parseFIT(data)
+	case xmlRoot(data) == "gpx":
+		parsed, err = parseGPX(data)
+	case xmlRoot(data) == "TrainingCenterDatabase":
+		parsed, err = parseTCX(data)
+	default:
+		return Activity{}, nil, errors.New("unrecognized file; upload a FIT, GPX or TCX activity")
+	}
+	if err != nil {
+		return Activity{}, nil, err
+	}
+
+	parsed.Samples = prepareSamples(parsed.Samples)
+	activity := parsed.summarize()
+	if activity.StartedAt.IsZero() {
+		return Activity{}, nil, errors.New("the activity has no start time")
+	}
+	activity.StartedAt = activity.StartedAt.UTC().Truncate(time.Second)
+	activity.Filename = truncate(filename, 255)
+	activity.Name = truncate(strings.TrimSpace(activity.Name), 255)
+
+	sum := sha256.Sum256(data)
+	activity.FileHash = hex.EncodeToString(sum[:])
+	return activity, parsed.Samples, nil
+}
+
+// FindDuplicateActivity returns a user's activity uploaded from the same
+// file, or started at the same second, which catches the same recording
+// exported in another format
+func FindDuplicateActivity(db *sql.DB, userID int, activity Activity) (Activity, error) {
+	query := activitySelect + " WHERE user_id = ? AND (file_hash = ? OR started_at = ?) ORDER BY id LIMIT 1"
+	return scanActivity(db.QueryRow(query, userID, activity.FileHash, activity.StartedAt))
+}
+
+// CardioExercise returns the distance and duration exercise a sport is
+// logged against, creating it if the catalog has none
+func CardioExercise(db *sql.DB, sport string) (Exercise, error) {
+	name, ok := sportExercises[sport]
+	if !ok {
+		name = sportExercises[SportOther]
+	}
+
+	query := `
+	SELECT id, name, description, category, muscle_group, tracking_type, equipment, created_at, updated_at
+	FROM exercises
+	WHERE LOWER(name) = LOWER(?) AND tracking_type = ? AND deleted_at IS NULL
+	ORDER BY id LIMIT 1`
+	var exercise Exercise
+	err := db.QueryRow(query, name, TrackingDistanceDuration).Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category,
+		&exercise.MuscleGroup, &exercise.TrackingType, &exercise.Equipment, &exercise.CreatedAt, &exercise.UpdatedAt)
+	if err != sql.ErrNoRows {
+		return exercise, err
+	}
+
+	exercise = Exercise{Name: name, Category: "cardio", TrackingType: TrackingDistanceDuration}
+	if exercise.ID, err = CreateExercise(db, exercise); err != nil {
+		return Exercise{}, err
+	}
+	return GetExercise(db, exercise.ID)
+}
+
+// ActivityWorkout returns the user's workout activities of an exercise are
+// logged under, named after the exercise, creating it if needed
+func ActivityWorkout(db *sql.DB, userID int, exercise Exercise) (int, error) {
+	var id int
+	query := "SELECT id FROM workouts WHERE user_id = ? AND LOWER(name) = LOWER(?) AND deleted_at IS NULL ORDER BY id LIMIT 1"
+	err := db.QueryRow(query, userID, exercise.Name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return CreateWorkout(db, Workout{Name: exercise.Name, Description: "Recorded activities", UserID: userID})
+	}
+	return id, err
+}
+
+// SaveActivity stores an activity together with the progress entry it is
+// logged as, in the session of its workout on that day. The progress entry's
+// date is the day of the session.
+func SaveActivity(db *sql.DB, activity Activity, samples []ActivitySample, progress Progress) (Activity, error) {
+	version, err := CurrentWorkoutVersion(db, progress.WorkoutID)
+	if err != nil {
+		return activity, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return activity, err
+	}
+
+	sessionID, err := upsertSession(tx, progress.UserID, progress.WorkoutID, progress.Date, activity.Name, version)
+	if err != nil {
+		tx.Rollback()
+		return activity, err
+	}
+	progress.SessionID = sessionID
+
+	progressID, err := recordProgress(tx, progress)
+	if err != nil {
+		tx.Rollback()
+		return activity, err
+	}
+
+	query := `
+	INSERT INTO activities (user_id, session_id, progress_id, exercise_id, name, sport, format, filename, file_hash, started_at,
+		elapsed_seconds, duration_seconds, distance_meters, elevation_gain, elevation_loss, avg_heart_rate, max_heart_rate, sample_count, samples)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, progress.UserID, sessionID, progressID, progress.ExerciseID, activity.Name, activity.Sport, activity.Format,
+		activity.Filename, activity.FileHash, activity.StartedAt, activity.ElapsedTime, activity.Duration, activity.Distance,
+		activity.ElevationGain, activity.ElevationLoss, activity.AvgHeartRate, activity.MaxHeartRate, len(samples), encodeSamples(samples))
+	if err != nil {
+		tx.Rollback()
+		return activity, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return activity, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return activity, err
+	}
+	return GetActivity(db, int(id), progress.UserID)
+}
+
+// GetActivity retrieves a user's activity by ID
+func GetActivity(db *sql.DB, id, userID int) (Activity, error) {
+	query := activitySelect + " WHERE id = ? AND user_id = ?"
+	return scanActivity(db.QueryRow(query, id, userID))
+}
+
+// GetUserActivities retrieves a user's activities started between from and
+// to, newest first. Zero dates mean no bound.
+func GetUserActivities(db *sql.DB, userID int, from, to time.Time) ([]Activity, error) {
+	query := activitySelect + " WHERE user_id = ?"
+	args := []interface{}{userID}
+	if !from.IsZero() {
+		query += " AND started_at >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND started_at < ?"
+		args = append(args, to.AddDate(0, 0, 1))
+	}
+	query += " ORDER BY started_at DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []Activity
+	for rows.Next() {
+		activity, err := scanActivity(rows)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, activity)
+	}
+
+	return activities, rows.Err()
+}
+
+// GetActivitySamples retrieves and decodes an activity's stored samples
+func GetActivitySamples(db *sql.DB, id, userID int) ([]ActivitySample, error) {
+	var data []byte
+	query := "SELECT samples FROM activities WHERE id = ? AND user_id = ?"
+	if err := db.QueryRow(query, id, userID).Scan(&data); err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return []ActivitySample{}, nil
+	}
+	return decodeSamples(data)
+}
+
+// DeleteActivity removes a user's activity and its samples. Its progress
+// entry is moved to the trash separately by the caller.
+func DeleteActivity(db *sql.DB, id, userID int) error {
+	_, err := db.Exec("DELETE FROM activities WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
@@ -0,0 +1,341 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// fitEpoch is the zero time of FIT timestamps
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// fitDegreesPerSemicircle converts FIT positions into degrees
+const fitDegreesPerSemicircle = 180.0 / (1 << 31)
+
+// FIT global message numbers and the fields read from them
+const (
+	fitMessageSession = 18
+	fitMessageRecord  = 20
+
+	fitFieldTimestamp = 253
+)
+
+// fitSports names the FIT sport enum values that have a cardio exercise
+var fitSports = map[int64]string{
+	1:  SportRunning,
+	2:  SportCycling,
+	5:  SportSwimming,
+	11: SportWalking,
+	15: SportRowing,
+	17: SportHiking,
+}
+
+// fitField is one field of a definition message
+type fitField struct {
+	num      byte
+	size     int
+	baseType byte
+}
+
+// fitDefinition describes the layout of the data messages of a local
+// message type
+type fitDefinition struct {
+	global    uint16
+	bigEndian bool
+	fields    []fitField
+	devSize   int
+}
+
+// fitCRCTable is the nibble table of the FIT CRC-16
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C00, 0x8800, 0x4401,
+}
+
+// fitCRC computes the FIT CRC-16 of data
+func fitCRC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
+
+// isFIT reports whether data starts with a FIT file header
+func isFIT(data []byte) bool {
+	return len(data) >= 12 && string(data[8:12]) == ".FIT"
+}
+
+// parseFIT reads the records and sessions of a FIT activity file. Files
+// chained one after another are read in turn.
+func parseFIT(data []byte) (ParsedActivity, error) {
+	activity := ParsedActivity{Format: ActivityFIT, Sport: SportOther}
+	sessions := 0
+
+	for len(data) > 0 {
+		if !isFIT(data) {
+			return activity, errors.New("invalid FIT header")
+		}
+		headerSize := int(data[0])
+		dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+		end := headerSize + dataSize
+		if headerSize < 12 || end+2 > len(data) {
+			return activity, errors.New("the FIT file is truncated")
+		}
+		if fitCRC(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+			return activity, errors.New("the FIT file is corrupt")
+		}
+
+		if err := parseFITRecords(data[headerSize:end], &activity, &sessions); err != nil {
+			return activity, err
+		}
+		data = data[end+2:]
+	}
+
+	if len(activity.Samples) == 0 && sessions == 0 {
+		return activity, errors.New("the FIT file has no activity data")
+	}
+	return activity, nil
+}
+
+// parseFITRecords reads the messages of one FIT file, adding records as
+// samples and session totals to activity
+func parseFITRecords(data []byte, activity *ParsedActivity, sessions *int) error {
+	definitions := make(map[byte]fitDefinition)
+	var lastTimestamp uint32
+
+	for pos := 0; pos < len(data); {
+		header := data[pos]
+		pos++
+
+		// Compressed timestamp headers carry a 5 bit offset from the last
+		// full timestamp
+		local := header & 0x0F
+		compressed := header&0x80 != 0
+		var timestamp uint32
+		if compressed {
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp = lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+		}
+
+		if !compressed && header&0x40 != 0 {
+			definition, size, err := parseFITDefinition(data[pos:], header&0x20 != 0)
+			if err != nil {
+				return err
+			}
+			definitions[local] = definition
+			pos += size
+			continue
+		}
+
+		definition, ok := definitions[local]
+		if !ok {
+			return errors.New("the FIT file uses an undefined message")
+		}
+
+		values := make(map[byte]float64, len(definition.fields))
+		for _, field := range definition.fields {
+			if pos+field.size > len(data) {
+				return errors.New("the FIT file is truncated")
+			}
+			if value, ok := fitValue(data[pos:pos+field.size], field.baseType, definition.bigEndian); ok {
+				values[field.num] = value
+			}
+			pos += field.size
+		}
+		if pos+definition.devSize > len(data) {
+			return errors.New("the FIT file is truncated")
+		}
+		pos += definition.devSize
+
+		if value, ok := values[fitFieldTimestamp]; ok {
+			lastTimestamp = uint32(value)
+		} else if compressed {
+			values[fitFieldTimestamp] = float64(timestamp)
+		}
+
+		switch definition.global {
+		case fitMessageRecord:
+			if sample, ok := fitRecordSample(values); ok {
+				activity.Samples = append(activity.Samples, sample)
+			}
+		case fitMessageSession:
+			addFITSession(activity, values, *sessions)
+			*sessions++
+		}
+	}
+
+	return nil
+}
+
+// parseFITDefinition reads a definition message, returning it with its size
+func parseFITDefinition(data []byte, developer bool) (fitDefinition, int, error) {
+	if len(data) < 5 {
+		return fitDefinition{}, 0, errors.New("the FIT file is truncated")
+	}
+
+	definition := fitDefinition{bigEndian: data[1] == 1}
+	if definition.bigEndian {
+		definition.global = binary.BigEndian.Uint16(data[2:4])
+	} else {
+		definition.global = binary.LittleEndian.Uint16(data[2:4])
+	}
+
+	count := int(data[4])
+	size := 5 + count*3
+	if len(data) < size {
+		return fitDefinition{}, 0, errors.New("the FIT file is truncated")
+	}
+	for i := 0; i < count; i++ {
+		field := data[5+i*3 : 8+i*3]
+		definition.fields = append(definition.fields, fitField{num: field[0], size: int(field[1]), baseType: field[2]})
+	}
+
+	// Developer fields are skipped over
+	if developer {
+		if len(data) < size+1 {
+			return fitDefinition{}, 0, errors.New("the FIT file is truncated")
+		}
+		devCount := int(data[size])
+		size++
+		if len(data) < size+devCount*3 {
+			return fitDefinition{}, 0, errors.New("the FIT file is truncated")
+		}
+		for i := 0; i < devCount; i++ {
+			definition.devSize += int(data[size+i*3+1])
+		}
+		size += devCount * 3
+	}
+
+	return definition, size, nil
+}
+
+// fitValue decodes the first value of a field, reporting false for the
+// invalid value FIT uses to mark a field as unset
+func fitValue(raw []byte, baseType byte, bigEndian bool) (float64, bool) {
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+
+	switch baseType & 0x1F {
+	case 0x00, 0x02, 0x0A, 0x0D: // enum, uint8, uint8z, byte
+		if len(raw) < 1 {
+			return 0, false
+		}
+		v := raw[0]
+		return float64(v), v != 0xFF && !(baseType&0x1F == 0x0A && v == 0)
+	case 0x01: // sint8
+		if len(raw) < 1 {
+			return 0, false
+		}
+		return float64(int8(raw[0])), raw[0] != 0x7F
+	case 0x03: // sint16
+		if len(raw) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(raw)
+		return float64(int16(v)), v != 0x7FFF
+	case 0x04, 0x0B: // uint16, uint16z
+		if len(raw) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(raw)
+		return float64(v), v != 0xFFFF && !(baseType&0x1F == 0x0B && v == 0)
+	case 0x05: // sint32
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(int32(v)), v != 0x7FFFFFFF
+	case 0x06, 0x0C: // uint32, uint32z
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(v), v != 0xFFFFFFFF && !(baseType&0x1F == 0x0C && v == 0)
+	case 0x08: // float32
+		if len(raw) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(raw)
+		return float64(math.Float32frombits(v)), v != 0xFFFFFFFF
+	case 0x09: // float64
+		if len(raw) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(raw)
+		return math.Float64frombits(v), v != 0xFFFFFFFFFFFFFFFF
+	}
+	return 0, false
+}
+
+// fitTime converts a FIT timestamp into a time
+func fitTime(seconds float64) time.Time {
+	return fitEpoch.Add(time.Duration(seconds) * time.Second)
+}
+
+// fitRecordSample reads a record message. Positions are in semicircles and
+// altitudes are scaled by 5 with an offset of 500 m.
+func fitRecordSample(values map[byte]float64) (ActivitySample, bool) {
+	timestamp, ok := values[fitFieldTimestamp]
+	if !ok {
+		return ActivitySample{}, false
+	}
+
+	sample := newActivitySample(fitTime(timestamp))
+	lat, hasLat := values[0]
+	lon, hasLon := values[1]
+	if hasLat && hasLon {
+		sample.Latitude = lat * fitDegreesPerSemicircle
+		sample.Longitude = lon * fitDegreesPerSemicircle
+	}
+	if altitude, ok := values[78]; ok {
+		sample.Altitude = altitude/5 - 500
+	} else if altitude, ok := values[2]; ok {
+		sample.Altitude = altitude/5 - 500
+	}
+	if distance, ok := values[5]; ok {
+		sample.Distance = distance / 100
+	}
+	if heartRate, ok := values[3]; ok {
+		sample.HeartRate = int(heartRate)
+	}
+	return sample, true
+}
+
+// addFITSession adds the totals of a session message. Multisport files have
+// a session per leg; the first leg names the sport.
+func addFITSession(activity *ParsedActivity, values map[byte]float64, index int) {
+	if index == 0 {
+		if sport, ok := fitSports[int64(values[5])]; ok {
+			activity.Sport = sport
+		}
+		if start, ok := values[2]; ok {
+			activity.Start = fitTime(start)
+		}
+	}
+
+	activity.ElapsedTime += values[7] / 1000
+	activity.TimerTime += values[8] / 1000
+	activity.Distance += values[9] / 100
+	activity.Ascent += values[22]
+	activity.Descent += values[23]
+	if heartRate := int(values[17]); heartRate > activity.MaxHeartRate {
+		activity.MaxHeartRate = heartRate
+	}
+	if heartRate := int(values[16]); heartRate > 0 && activity.AvgHeartRate == 0 {
+		activity.AvgHeartRate = heartRate
+	}
+}
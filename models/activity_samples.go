@@ -0,0 +1,450 @@
+package models
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// ActivitySample is one point of a recorded activity. Distance is
+// cumulative in meters and altitude in meters; fields the device didn't
+// record are NaN, or 0 for heart rate.
+type ActivitySample struct {
+	Time      time.Time
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+	Distance  float64
+	HeartRate int
+}
+
+// newActivitySample returns a sample at t with nothing recorded
+func newActivitySample(t time.Time) ActivitySample {
+	nan := math.NaN()
+	return ActivitySample{Time: t, Latitude: nan, Longitude: nan, Altitude: nan, Distance: nan}
+}
+
+// hasPosition reports whether the sample has a GPS position
+func (s ActivitySample) hasPosition() bool {
+	return !math.IsNaN(s.Latitude) && !math.IsNaN(s.Longitude)
+}
+
+// ParsedActivity is an activity read from a FIT, GPX or TCX file. Totals are
+// those recorded by the device, or zero when the file has none, in which
+// case they are derived from the samples.
+type ParsedActivity struct {
+	Format  string
+	Sport   string
+	Name    string
+	Start   time.Time
+	Samples []ActivitySample
+
+	ElapsedTime  float64
+	TimerTime    float64
+	Distance     float64
+	Ascent       float64
+	Descent      float64
+	AvgHeartRate int
+	MaxHeartRate int
+}
+
+// Thresholds for deriving totals from samples. Intervals slower than
+// activityStoppedSpeed or longer than activityMaxGap count as paused, and
+// climbs shorter than activityClimbThreshold are treated as GPS noise.
+const (
+	activityStoppedSpeed   = 0.5 // m/s
+	activityMaxGap         = 60 * time.Second
+	activityClimbThreshold = 3.0 // m
+)
+
+// prepareSamples sorts samples by time, drops repeated timestamps and fills
+// in cumulative distance from GPS positions when the device recorded none
+func prepareSamples(samples []ActivitySample) []ActivitySample {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+
+	prepared := samples[:0]
+	for _, sample := range samples {
+		if n := len(prepared); n > 0 && sample.Time.Unix() == prepared[n-1].Time.Unix() {
+			continue
+		}
+		prepared = append(prepared, sample)
+	}
+
+	hasDistance := false
+	for _, sample := range prepared {
+		if !math.IsNaN(sample.Distance) {
+			hasDistance = true
+			break
+		}
+	}
+	if !hasDistance {
+		total := 0.0
+		var last *ActivitySample
+		for i := range prepared {
+			if !prepared[i].hasPosition() {
+				continue
+			}
+			if last != nil {
+				total += haversine(last.Latitude, last.Longitude, prepared[i].Latitude, prepared[i].Longitude)
+			}
+			prepared[i].Distance = total
+			last = &prepared[i]
+		}
+	}
+
+	return prepared
+}
+
+// haversine returns the distance in meters between two positions
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371008.8
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(min(1, a)))
+}
+
+// summarize fills in an activity's totals, preferring those the device
+// recorded over those derived from the samples
+func (p ParsedActivity) summarize() Activity {
+	activity := Activity{
+		Name:          p.Name,
+		Sport:         p.Sport,
+		Format:        p.Format,
+		StartedAt:     p.Start,
+		ElapsedTime:   int(math.Round(p.ElapsedTime)),
+		Duration:      int(math.Round(p.TimerTime)),
+		Distance:      p.Distance,
+		ElevationGain: p.Ascent,
+		ElevationLoss: p.Descent,
+		AvgHeartRate:  p.AvgHeartRate,
+		MaxHeartRate:  p.MaxHeartRate,
+		SampleCount:   len(p.Samples),
+	}
+
+	samples := p.Samples
+	if len(samples) == 0 {
+		if activity.ElapsedTime == 0 {
+			activity.ElapsedTime = activity.Duration
+		}
+		return activity
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	if activity.StartedAt.IsZero() || first.Time.Before(activity.StartedAt) {
+		activity.StartedAt = first.Time
+	}
+	if activity.ElapsedTime == 0 {
+		activity.ElapsedTime = int(last.Time.Sub(activity.StartedAt).Seconds())
+	}
+
+	moving := 0.0
+	heartRateSum, heartRateCount, maxHeartRate := 0, 0, 0
+	gain, loss := 0.0, 0.0
+	climbFrom := math.NaN()
+	lastDistance := math.NaN()
+	for i, sample := range samples {
+		if sample.HeartRate > 0 {
+			heartRateSum += sample.HeartRate
+			heartRateCount++
+			maxHeartRate = max(maxHeartRate, sample.HeartRate)
+		}
+
+		// Altitude changes count once they exceed the climb threshold
+		if !math.IsNaN(sample.Altitude) {
+			if math.IsNaN(climbFrom) {
+				climbFrom = sample.Altitude
+			} else if change := sample.Altitude - climbFrom; math.Abs(change) >= activityClimbThreshold {
+				if change > 0 {
+					gain += change
+				} else {
+					loss -= change
+				}
+				climbFrom = sample.Altitude
+			}
+		}
+
+		if !math.IsNaN(sample.Distance) {
+			lastDistance = sample.Distance
+		}
+
+		if i == 0 {
+			continue
+		}
+		gap := sample.Time.Sub(samples[i-1].Time)
+		if gap > activityMaxGap {
+			continue
+		}
+		if previous := samples[i-1].Distance; !math.IsNaN(previous) && !math.IsNaN(sample.Distance) &&
+			(sample.Distance-previous)/gap.Seconds() < activityStoppedSpeed {
+			continue
+		}
+		moving += gap.Seconds()
+	}
+
+	if activity.Duration == 0 {
+		activity.Duration = int(math.Round(moving))
+	}
+	if activity.Distance == 0 && !math.IsNaN(lastDistance) {
+		activity.Distance = lastDistance
+	}
+	if p.Ascent == 0 && p.Descent == 0 {
+		activity.ElevationGain, activity.ElevationLoss = gain, loss
+	}
+	if activity.AvgHeartRate == 0 && heartRateCount > 0 {
+		activity.AvgHeartRate = int(math.Round(float64(heartRateSum) / float64(heartRateCount)))
+	}
+	if activity.MaxHeartRate == 0 {
+		activity.MaxHeartRate = maxHeartRate
+	}
+	return activity
+}
+
+// Channels of an encoded sample stream. Time is always present.
+const (
+	sampleDistance byte = 1 << iota
+	sampleAltitude
+	sampleHeartRate
+	samplePosition
+)
+
+// sampleEncodingVersion is the first byte of an encoded sample stream
+const sampleEncodingVersion = 1
+
+// Encoded samples are quantized to 0.1 m for distance and altitude and to
+// 1e-6 degrees (about 11 cm) for positions
+const (
+	sampleMetersScale  = 10
+	sampleDegreesScale = 1e6
+)
+
+// encodeSamples packs samples for storage. After a header of the version,
+// the channels present, the sample count and the start time, each channel
+// is written as zigzag varint deltas between consecutive quantized values,
+// so a one hour recording at one sample per second takes tens of
+// kilobytes. Gaps in a channel repeat its last known value.
+func encodeSamples(samples []ActivitySample) []byte {
+	var channels byte
+	for _, sample := range samples {
+		if !math.IsNaN(sample.Distance) {
+			channels |= sampleDistance
+		}
+		if !math.IsNaN(sample.Altitude) {
+			channels |= sampleAltitude
+		}
+		if sample.HeartRate > 0 {
+			channels |= sampleHeartRate
+		}
+		if sample.hasPosition() {
+			channels |= samplePosition
+		}
+	}
+
+	buf := []byte{sampleEncodingVersion, channels}
+	buf = binary.AppendUvarint(buf, uint64(len(samples)))
+	if len(samples) == 0 {
+		return buf
+	}
+	start := samples[0].Time.Unix()
+	buf = binary.AppendVarint(buf, start)
+
+	previous := start
+	for _, sample := range samples {
+		buf = binary.AppendUvarint(buf, uint64(sample.Time.Unix()-previous))
+		previous = sample.Time.Unix()
+	}
+
+	channel := func(value func(ActivitySample) (float64, bool), scale float64) {
+		values := make([]int64, len(samples))
+		known := false
+		var current int64
+		for i, sample := range samples {
+			if v, ok := value(sample); ok {
+				current = int64(math.Round(v * scale))
+				if !known {
+					// Leading gaps take the first known value
+					for j := range values[:i] {
+						values[j] = current
+					}
+					known = true
+				}
+			}
+			values[i] = current
+		}
+
+		var last int64
+		for _, v := range values {
+			buf = binary.AppendVarint(buf, v-last)
+			last = v
+		}
+	}
+	known := func(v float64) (float64, bool) { return v, !math.IsNaN(v) }
+
+	if channels&sampleDistance != 0 {
+		channel(func(s ActivitySample) (float64, bool) { return known(s.Distance) }, sampleMetersScale)
+	}
+	if channels&sampleAltitude != 0 {
+		channel(func(s ActivitySample) (float64, bool) { return known(s.Altitude) }, sampleMetersScale)
+	}
+	if channels&sampleHeartRate != 0 {
+		channel(func(s ActivitySample) (float64, bool) { return float64(s.HeartRate), s.HeartRate > 0 }, 1)
+	}
+	if channels&samplePosition != 0 {
+		channel(func(s ActivitySample) (float64, bool) { return s.Latitude, s.hasPosition() }, sampleDegreesScale)
+		channel(func(s ActivitySample) (float64, bool) { return s.Longitude, s.hasPosition() }, sampleDegreesScale)
+	}
+
+	return buf
+}
+
+// decodeSamples unpacks samples stored by encodeSamples
+func decodeSamples(data []byte) ([]ActivitySample, error) {
+	errCorrupt := errors.New("stored activity samples are corrupt")
+	if len(data) < 2 || data[0] != sampleEncodingVersion {
+		return nil, errCorrupt
+	}
+	channels := data[1]
+	pos := 2
+
+	uvarint := func() (uint64, bool) {
+		v, n := binary.Uvarint(data[pos:])
+		pos += max(n, 0)
+		return v, n > 0
+	}
+	varint := func() (int64, bool) {
+		v, n := binary.Varint(data[pos:])
+		pos += max(n, 0)
+		return v, n > 0
+	}
+
+	count, ok := uvarint()
+	if !ok || count > uint64(len(data)) {
+		return nil, errCorrupt
+	}
+	samples := make([]ActivitySample, count)
+	if count == 0 {
+		return samples, nil
+	}
+
+	current, ok := varint()
+	if !ok {
+		return nil, errCorrupt
+	}
+	for i := range samples {
+		delta, ok := uvarint()
+		if !ok {
+			return nil, errCorrupt
+		}
+		current += int64(delta)
+		samples[i] = newActivitySample(time.Unix(current, 0).UTC())
+	}
+
+	channel := func(set func(*ActivitySample, float64), scale float64) bool {
+		var value int64
+		for i := range samples {
+			delta, ok := varint()
+			if !ok {
+				return false
+			}
+			value += delta
+			set(&samples[i], float64(value)/scale)
+		}
+		return true
+	}
+
+	if channels&sampleDistance != 0 && !channel(func(s *ActivitySample, v float64) { s.Distance = v }, sampleMetersScale) {
+		return nil, errCorrupt
+	}
+	if channels&sampleAltitude != 0 && !channel(func(s *ActivitySample, v float64) { s.Altitude = v }, sampleMetersScale) {
+		return nil, errCorrupt
+	}
+	if channels&sampleHeartRate != 0 && !channel(func(s *ActivitySample, v float64) { s.HeartRate = int(v) }, 1) {
+		return nil, errCorrupt
+	}
+	if channels&samplePosition != 0 {
+		if !channel(func(s *ActivitySample, v float64) { s.Latitude = v }, sampleDegreesScale) ||
+			!channel(func(s *ActivitySample, v float64) { s.Longitude = v }, sampleDegreesScale) {
+			return nil, errCorrupt
+		}
+	}
+
+	return samples, nil
+}
+
+// ActivitySeries is an activity's samples laid out as parallel arrays for
+// charting. Offsets are seconds from the start; distance is in the
+// response's distance unit, altitude in meters and pace in seconds per
+// distance unit, smoothed over paceWindow. Channels the device didn't
+// record are left out.
+type ActivitySeries struct {
+	Offsets   []int     `json:"offsets"`
+	Distance  []float64 `json:"distance,omitempty"`
+	Pace      []float64 `json:"pace,omitempty"`
+	Altitude  []float64 `json:"altitude,omitempty"`
+	HeartRate []int     `json:"heart_rate,omitempty"`
+	Latitude  []float64 `json:"latitude,omitempty"`
+	Longitude []float64 `json:"longitude,omitempty"`
+	Units     Units     `json:"units"`
+}
+
+// paceWindow is how far back pace is measured from each sample
+const paceWindow = 30 * time.Second
+
+// NewActivitySeries lays samples out in u, keeping at most points evenly
+// spaced samples when points is positive
+func NewActivitySeries(samples []ActivitySample, u Units, points int) ActivitySeries {
+	series := ActivitySeries{Offsets: []int{}, Units: u}
+	if len(samples) == 0 {
+		return series
+	}
+
+	pace := make([]float64, len(samples))
+	from := 0
+	for i, sample := range samples {
+		for samples[from].Time.Before(sample.Time.Add(-paceWindow)) {
+			from++
+		}
+		meters := sample.Distance - samples[from].Distance
+		if i > from && meters >= 1 {
+			pace[i] = math.Round(sample.Time.Sub(samples[from].Time).Seconds() / u.DistanceFromMeters(meters))
+		}
+	}
+
+	indexes := make([]int, 0, len(samples))
+	if points > 0 && points < len(samples) {
+		step := float64(len(samples)-1) / float64(max(points-1, 1))
+		for i := 0; i < points; i++ {
+			indexes = append(indexes, int(math.Round(float64(i)*step)))
+		}
+	} else {
+		for i := range samples {
+			indexes = append(indexes, i)
+		}
+	}
+
+	start := samples[0].Time
+	first := samples[0]
+	for _, i := range indexes {
+		sample := samples[i]
+		series.Offsets = append(series.Offsets, int(sample.Time.Sub(start).Seconds()))
+		if !math.IsNaN(first.Distance) {
+			series.Distance = append(series.Distance, math.Round(u.DistanceFromMeters(sample.Distance)*1000)/1000)
+			series.Pace = append(series.Pace, pace[i])
+		}
+		if !math.IsNaN(first.Altitude) {
+			series.Altitude = append(series.Altitude, math.Round(sample.Altitude*10)/10)
+		}
+		if first.HeartRate > 0 {
+			series.HeartRate = append(series.HeartRate, sample.HeartRate)
+		}
+		if first.hasPosition() {
+			series.Latitude = append(series.Latitude, sample.Latitude)
+			series.Longitude = append(series.Longitude, sample.Longitude)
+		}
+	}
+
+	return series
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmlSports maps the sport names of GPX track types and TCX activities to
+// cardio sports. Strava writes GPX types as numbers.
+var xmlSports = map[string]string{
+	"running":  SportRunning,
+	"run":      SportRunning,
+	"9":        SportRunning,
+	"biking":   SportCycling,
+	"cycling":  SportCycling,
+	"ride":     SportCycling,
+	"1":        SportCycling,
+	"walking":  SportWalking,
+	"walk":     SportWalking,
+	"10":       SportWalking,
+	"hiking":   SportHiking,
+	"hike":     SportHiking,
+	"4":        SportHiking,
+	"swimming": SportSwimming,
+	"swim":     SportSwimming,
+	"rowing":   SportRowing,
+	"row":      SportRowing,
+}
+
+// xmlRoot returns the local name of the root element of an XML document
+func xmlRoot(data []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// xmlActivityHandler receives the elements of a GPX or TCX document as they
+// end, with the local names of the open elements from the root down, and
+// the attributes of elements as they start
+type xmlActivityHandler struct {
+	start func(path []string, attrs []xml.Attr)
+	end   func(path []string, text string)
+}
+
+// walkXML streams a document through a handler, so large tracks aren't
+// decoded into memory all at once
+func walkXML(data []byte, handler xmlActivityHandler) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var path []string
+	var text strings.Builder
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.New("invalid XML: " + err.Error())
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+			text.Reset()
+			if handler.start != nil {
+				handler.start(path, t.Attr)
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			handler.end(path, strings.TrimSpace(text.String()))
+			text.Reset()
+			path = path[:len(path)-1]
+		}
+	}
+}
+
+// within reports whether the element at the end of path is name inside
+// parent
+func within(path []string, parent, name string) bool {
+	return len(path) >= 2 && path[len(path)-1] == name && path[len(path)-2] == parent
+}
+
+// inside reports whether path passes through an element named name
+func inside(path []string, name string) bool {
+	for _, element := range path[:len(path)-1] {
+		if element == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGPX reads the track points of a GPX file. Heart rate comes from the
+// Garmin track point extension, whatever its namespace prefix.
+func parseGPX(data []byte) (ParsedActivity, error) {
+	activity := ParsedActivity{Format: ActivityGPX, Sport: SportOther}
+	var point ActivitySample
+	var metadataName string
+
+	err := walkXML(data, xmlActivityHandler{
+		start: func(path []string, attrs []xml.Attr) {
+			if path[len(path)-1] != "trkpt" {
+				return
+			}
+			point = newActivitySample(time.Time{})
+			var lat, lon float64
+			var hasLat, hasLon bool
+			for _, attr := range attrs {
+				switch attr.Name.Local {
+				case "lat":
+					lat, hasLat = parseXMLFloat(attr.Value)
+				case "lon":
+					lon, hasLon = parseXMLFloat(attr.Value)
+				}
+			}
+			if hasLat && hasLon {
+				point.Latitude, point.Longitude = lat, lon
+			}
+		},
+		end: func(path []string, text string) {
+			name := path[len(path)-1]
+			switch {
+			case name == "trkpt":
+				if !point.Time.IsZero() {
+					activity.Samples = append(activity.Samples, point)
+				}
+			case within(path, "trkpt", "ele"):
+				if v, ok := parseXMLFloat(text); ok {
+					point.Altitude = v
+				}
+			case within(path, "trkpt", "time"):
+				point.Time, _ = time.Parse(time.RFC3339, text)
+			case name == "hr" && inside(path, "trkpt"):
+				if v, ok := parseXMLFloat(text); ok {
+					point.HeartRate = int(v)
+				}
+			case within(path, "trk", "name"):
+				activity.Name = text
+			case within(path, "metadata", "name"):
+				metadataName = text
+			case within(path, "trk", "type"):
+				if sport, ok := xmlSports[strings.ToLower(text)]; ok {
+					activity.Sport = sport
+				}
+			}
+		},
+	})
+	if err != nil {
+		return activity, err
+	}
+
+	if activity.Name == "" {
+		activity.Name = metadataName
+	}
+	if len(activity.Samples) == 0 {
+		return activity, errors.New("the GPX file has no timed track points")
+	}
+	return activity, nil
+}
+
+// parseTCX reads the laps and track points of a TCX file. Only the first
+// activity in the file is read.
+func parseTCX(data []byte) (ParsedActivity, error) {
+	activity := ParsedActivity{Format: ActivityTCX, Sport: SportOther}
+	var point ActivitySample
+	activities := 0
+
+	err := walkXML(data, xmlActivityHandler{
+		start: func(path []string, attrs []xml.Attr) {
+			switch path[len(path)-1] {
+			case "Activity":
+				activities++
+				if activities != 1 {
+					return
+				}
+				for _, attr := range attrs {
+					if attr.Name.Local == "Sport" {
+						if sport, ok := xmlSports[strings.ToLower(attr.Value)]; ok {
+							activity.Sport = sport
+						}
+					}
+				}
+			case "Trackpoint":
+				point = newActivitySample(time.Time{})
+			}
+		},
+		end: func(path []string, text string) {
+			if activities != 1 {
+				return
+			}
+			name := path[len(path)-1]
+			value, isNumber := parseXMLFloat(text)
+			switch {
+			case name == "Trackpoint":
+				if !point.Time.IsZero() {
+					activity.Samples = append(activity.Samples, point)
+				}
+			case within(path, "Trackpoint", "Time"):
+				point.Time, _ = time.Parse(time.RFC3339, text)
+			case within(path, "Trackpoint", "AltitudeMeters") && isNumber:
+				point.Altitude = value
+			case within(path, "Trackpoint", "DistanceMeters") && isNumber:
+				point.Distance = value
+			case within(path, "Position", "LatitudeDegrees") && isNumber:
+				point.Latitude = value
+			case within(path, "Position", "LongitudeDegrees") && isNumber:
+				point.Longitude = value
+			case within(path, "HeartRateBpm", "Value") && inside(path, "Trackpoint") && isNumber:
+				point.HeartRate = int(value)
+			case within(path, "Activity", "Id"):
+				activity.Start, _ = time.Parse(time.RFC3339, text)
+			case within(path, "Lap", "TotalTimeSeconds") && isNumber:
+				activity.TimerTime += value
+			case within(path, "Lap", "DistanceMeters") && isNumber:
+				activity.Distance += value
+			case within(path, "Activity", "Notes"):
+				activity.Name = text
+			}
+		},
+	})
+	if err != nil {
+		return activity, err
+	}
+
+	if activities == 0 {
+		return activity, errors.New("the TCX file has no activities")
+	}
+	if len(activity.Samples) == 0 && activity.TimerTime == 0 {
+		return activity, errors.New("the TCX file has no laps or track points")
+	}
+	return activity, nil
+}
+
+// parseXMLFloat parses a number from an element or attribute
+func parseXMLFloat(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return v, err == nil
+}
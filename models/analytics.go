@@ -0,0 +1,398 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Analytics bucket sizes
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// MaxSeriesBuckets is the most buckets a series can have: a year of days,
+// about seven years of weeks or thirty years of months
+const MaxSeriesBuckets = 366
+
+// DailyRollup is a pre-aggregated day of training for one exercise in one
+// workout. Volume is in kilograms, with bodyweight exercises moving the
+// user's bodyweight, and intensity is the sum over sets of the load as a
+// fraction of the best e1RM known on that day.
+type DailyRollup struct {
+	UserID        int
+	Date          time.Time
+	ExerciseID    int
+	WorkoutID     int
+	MuscleGroup   string
+	Entries       int
+	Sets          int
+	Reps          int
+	Volume        float64
+	IntensitySum  float64
+	IntensitySets int
+	Duration      int
+	Distance      float64
+}
+
+// CreateRollupTable creates the progress_daily_rollups table if it doesn't exist
+func CreateRollupTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS progress_daily_rollups (
+		user_id INT NOT NULL,
+		date DATE NOT NULL,
+		exercise_id INT NOT NULL,
+		workout_id INT NOT NULL,
+		entries INT NOT NULL,
+		sets INT NOT NULL,
+		reps INT NOT NULL,
+		volume DECIMAL(14,2) NOT NULL,
+		intensity_sum DECIMAL(12,4) NOT NULL,
+		intensity_sets INT NOT NULL,
+		duration_seconds INT NOT NULL,
+		distance_meters DECIMAL(12,2) NOT NULL,
+		PRIMARY KEY (user_id, date, exercise_id, workout_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// RefreshExerciseRollups recomputes a user's rollups for one exercise from
+// the given date on. It is called whenever progress on that date changes:
+// each day's intensity is measured against the best e1RM as of that day, so
+// a backdated record or a deleted best changes every later day too.
+func RefreshExerciseRollups(db *sql.DB, userID, exerciseID int, from time.Time, formula string) error {
+	return refreshRollups(db, userID, exerciseID, from, formula)
+}
+
+// RebuildRollups recomputes all of a user's rollups from progress
+func RebuildRollups(db *sql.DB, userID int, formula string) error {
+	return refreshRollups(db, userID, 0, time.Time{}, formula)
+}
+
+// RebuildForFormula recomputes a user's records and rollups for an e1RM
+// formula, after the user switches to it. Intensity is measured against the
+// best e1RM of the formula, which only exists once its records are built.
+func RebuildForFormula(db *sql.DB, userID int, formula string) error {
+	rows, err := db.Query("SELECT DISTINCT exercise_id FROM progress WHERE user_id = ? AND deleted_at IS NULL", userID)
+	if err != nil {
+		return err
+	}
+	var exerciseIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		exerciseIDs = append(exerciseIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, exerciseID := range exerciseIDs {
+		if err := RebuildRecords(db, userID, exerciseID, formula); err != nil {
+			return err
+		}
+	}
+	return RebuildRollups(db, userID, formula)
+}
+
+// refreshRollups recomputes a user's rollups, limited to one exercise and to
+// days from a date on unless they are zero
+func refreshRollups(db *sql.DB, userID, exerciseID int, from time.Time, formula string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := "DELETE FROM progress_daily_rollups WHERE user_id = ?"
+	deleteArgs := []interface{}{userID}
+	if exerciseID != 0 {
+		deleteQuery += " AND exercise_id = ?"
+		deleteArgs = append(deleteArgs, exerciseID)
+	}
+	if !from.IsZero() {
+		deleteQuery += " AND date >= ?"
+		deleteArgs = append(deleteArgs, from)
+	}
+	if _, err := tx.Exec(deleteQuery, deleteArgs...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// The best e1RM per exercise as of each day is looked up with a
+	// correlated subquery, so days before a record use the older best.
+	// Bodyweight exercises count the bodyweight of the day as their load.
+	query := `
+	INSERT INTO progress_daily_rollups (user_id, date, exercise_id, workout_id, entries, sets, reps, volume,
+		intensity_sum, intensity_sets, duration_seconds, distance_meters)
+	SELECT d.user_id, d.date, d.exercise_id, d.workout_id, COUNT(*), SUM(d.sets), SUM(d.sets * d.reps),
+		SUM(d.sets * d.reps * d.volume_load),
+		SUM(CASE WHEN d.best > 0 AND d.weight > 0 THEN d.sets * d.weight / d.best ELSE 0 END),
+		SUM(CASE WHEN d.best > 0 AND d.weight > 0 THEN d.sets ELSE 0 END),
+		SUM(d.sets * d.duration_seconds), SUM(d.distance_meters)
+	FROM (
+		SELECT p.user_id, p.date, p.exercise_id, p.workout_id, p.sets, p.reps, p.weight,
+			p.duration_seconds, p.distance_meters,
+			(SELECT MAX(r.value) FROM personal_records r
+			WHERE r.user_id = p.user_id AND r.exercise_id = p.exercise_id
+				AND r.record_type = 'best_e1rm' AND r.formula = ? AND r.achieved_on <= p.date) AS best,
+			CASE WHEN e.tracking_type = 'reps' THEN ` + bodyweightOnSQL + ` ELSE p.weight END AS volume_load
+		FROM progress p
+		JOIN exercises e ON e.id = p.exercise_id
+		WHERE p.user_id = ? AND p.deleted_at IS NULL`
+	args := []interface{}{formula, userID}
+	if exerciseID != 0 {
+		query += " AND p.exercise_id = ?"
+		args = append(args, exerciseID)
+	}
+	if !from.IsZero() {
+		query += " AND p.date >= ?"
+		args = append(args, from)
+	}
+	query += `
+	) d
+	GROUP BY d.user_id, d.date, d.exercise_id, d.workout_id`
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AnalyticsFilter limits the rollups an analytics query reads. Zero values
+// mean no limit.
+type AnalyticsFilter struct {
+	From        time.Time
+	To          time.Time
+	ExerciseID  int
+	WorkoutID   int
+	MuscleGroup string
+}
+
+// GetDailyRollups retrieves a user's rollups matching the filter, oldest first
+func GetDailyRollups(db *sql.DB, userID int, filter AnalyticsFilter) ([]DailyRollup, error) {
+	query := `
+	SELECT r.user_id, r.date, r.exercise_id, r.workout_id, e.muscle_group, r.entries, r.sets, r.reps, r.volume,
+		r.intensity_sum, r.intensity_sets, r.duration_seconds, r.distance_meters
+	FROM progress_daily_rollups r
+	JOIN exercises e ON e.id = r.exercise_id
+	WHERE r.user_id = ?`
+	args := []interface{}{userID}
+
+	if !filter.From.IsZero() {
+		query += " AND r.date >= ?"
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		query += " AND r.date <= ?"
+		args = append(args, filter.To)
+	}
+	if filter.ExerciseID != 0 {
+		query += " AND r.exercise_id = ?"
+		args = append(args, filter.ExerciseID)
+	}
+	if filter.WorkoutID != 0 {
+		query += " AND r.workout_id = ?"
+		args = append(args, filter.WorkoutID)
+	}
+	if filter.MuscleGroup != "" {
+		query += " AND e.muscle_group = ?"
+		args = append(args, filter.MuscleGroup)
+	}
+	query += " ORDER BY r.date ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []DailyRollup
+	for rows.Next() {
+		var r DailyRollup
+		if err := rows.Scan(&r.UserID, &r.Date, &r.ExerciseID, &r.WorkoutID, &r.MuscleGroup, &r.Entries, &r.Sets,
+			&r.Reps, &r.Volume, &r.IntensitySum, &r.IntensitySets, &r.Duration, &r.Distance); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+
+	return rollups, rows.Err()
+}
+
+// AnalyticsBucket is one period of an analytics series. Volume is in
+// kilograms, distance in meters and duration in seconds until converted.
+// AverageIntensity is a percentage of e1RM.
+type AnalyticsBucket struct {
+	Start              time.Time      `json:"start"`
+	End                time.Time      `json:"end"`
+	Volume             float64        `json:"volume"`
+	Sets               int            `json:"sets"`
+	Reps               int            `json:"reps"`
+	SetsPerMuscleGroup map[string]int `json:"sets_per_muscle_group"`
+	AverageIntensity   float64        `json:"average_intensity"`
+	Sessions           int            `json:"sessions"`
+	TrainingDays       int            `json:"training_days"`
+	Duration           int            `json:"duration"`
+	Distance           float64        `json:"distance"`
+	Pace               float64        `json:"pace,omitempty"`
+	Speed              float64        `json:"speed,omitempty"`
+
+	intensitySum  float64
+	intensitySets int
+}
+
+// IsValidBucket reports whether b is a supported bucket size
+func IsValidBucket(b string) bool {
+	return b == BucketDay || b == BucketWeek || b == BucketMonth
+}
+
+// BucketStart returns the first day of the bucket containing date
+func BucketStart(bucket string, date time.Time, weekStart time.Weekday) time.Time {
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case BucketWeek:
+		offset := (int(date.Weekday()) - int(weekStart) + 7) % 7
+		return date.AddDate(0, 0, -offset)
+	case BucketMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
+
+// nextBucket returns the first day of the bucket after the one starting at start
+func nextBucket(bucket string, start time.Time) time.Time {
+	switch bucket {
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// BuildSeries groups rollups into consecutive buckets covering from..to,
+// including empty buckets so charts have no gaps. Ranges of more than
+// MaxSeriesBuckets buckets are refused.
+func BuildSeries(rollups []DailyRollup, bucket string, from, to time.Time, weekStart time.Weekday) ([]AnalyticsBucket, error) {
+	if !IsValidBucket(bucket) {
+		return nil, errors.New("bucket must be day, week or month")
+	}
+	if to.Before(from) {
+		return nil, errors.New("from must not be after to")
+	}
+
+	var series []AnalyticsBucket
+	index := make(map[time.Time]int)
+	for start := BucketStart(bucket, from, weekStart); !start.After(to); start = nextBucket(bucket, start) {
+		if len(series) == MaxSeriesBuckets {
+			return nil, fmt.Errorf("a series can have at most %d buckets; narrow from and to or use a larger bucket", MaxSeriesBuckets)
+		}
+		index[start] = len(series)
+		series = append(series, AnalyticsBucket{
+			Start:              start,
+			End:                nextBucket(bucket, start).AddDate(0, 0, -1),
+			SetsPerMuscleGroup: map[string]int{},
+		})
+	}
+
+	type session struct {
+		date      time.Time
+		workoutID int
+	}
+	sessions := make(map[int]map[session]bool)
+	days := make(map[int]map[time.Time]bool)
+	cardio := make(map[int][2]float64)
+
+	for _, r := range rollups {
+		i, ok := index[BucketStart(bucket, r.Date, weekStart)]
+		if !ok {
+			continue
+		}
+
+		b := &series[i]
+		b.Volume += r.Volume
+		b.Sets += r.Sets
+		b.Reps += r.Reps
+		b.Duration += r.Duration
+		b.Distance += r.Distance
+		b.intensitySum += r.IntensitySum
+		b.intensitySets += r.IntensitySets
+
+		muscleGroup := r.MuscleGroup
+		if muscleGroup == "" {
+			muscleGroup = "other"
+		}
+		b.SetsPerMuscleGroup[muscleGroup] += r.Sets
+
+		if sessions[i] == nil {
+			sessions[i] = make(map[session]bool)
+			days[i] = make(map[time.Time]bool)
+		}
+		sessions[i][session{r.Date, r.WorkoutID}] = true
+		days[i][r.Date] = true
+
+		// Pace and speed only consider entries that covered a distance
+		if r.Distance > 0 && r.Duration > 0 {
+			c := cardio[i]
+			cardio[i] = [2]float64{c[0] + float64(r.Duration), c[1] + r.Distance}
+		}
+	}
+
+	for i := range series {
+		b := &series[i]
+		b.Sessions = len(sessions[i])
+		b.TrainingDays = len(days[i])
+		if b.intensitySets > 0 {
+			b.AverageIntensity = math.Round(b.intensitySum/float64(b.intensitySets)*1000) / 10
+		}
+		if c, ok := cardio[i]; ok {
+			b.Pace = c[0] / (c[1] / 1000)
+			b.Speed = (c[1] / 1000) / (c[0] / 3600)
+		}
+	}
+
+	return series, nil
+}
+
+// InUnits returns a copy of the bucket expressed in u
+func (b AnalyticsBucket) InUnits(u Units) AnalyticsBucket {
+	metrics := (&ProgressMetrics{Volume: b.Volume, Pace: b.Pace, Speed: b.Speed}).InUnits(u)
+	b.Volume = metrics.Volume
+	b.Pace = metrics.Pace
+	b.Speed = metrics.Speed
+	b.Distance = RoundDistance(u.DistanceFromMeters(b.Distance))
+	return b
+}
+
+// MuscleGroups returns the muscle groups present in a series, sorted
+func MuscleGroups(series []AnalyticsBucket) []string {
+	seen := make(map[string]bool)
+	for _, b := range series {
+		for group := range b.SetsPerMuscleGroup {
+			seen[group] = true
+		}
+	}
+
+	groups := make([]string, 0, len(seen))
+	for group := range seen {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
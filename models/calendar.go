@@ -0,0 +1,173 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// MaxCalendarDays is the longest range a calendar request can cover, since
+// occurrences are expanded one day at a time
+const MaxCalendarDays = 366
+
+// Calendar entry sources
+const (
+	CalendarSourceSchedule = "schedule"
+	CalendarSourceProgram  = "program"
+	CalendarSourceSession  = "session"
+)
+
+// Calendar entry statuses
+const (
+	CalendarPlanned   = "planned"
+	CalendarCompleted = "completed"
+	CalendarMissed    = "missed"
+)
+
+// CalendarEntry is a planned or performed workout on a day. Planned entries
+// come from schedules or program enrollments; sessions that weren't planned
+// appear with source "session".
+type CalendarEntry struct {
+	Date             time.Time  `json:"date"`
+	WorkoutID        int        `json:"workout_id"`
+	WorkoutName      string     `json:"workout_name"`
+	Source           string     `json:"source"`
+	Status           string     `json:"status"`
+	ScheduleID       int        `json:"schedule_id,omitempty"`
+	OriginalDate     *time.Time `json:"original_date,omitempty"`
+	StartTime        string     `json:"start_time,omitempty"`
+	DurationMinutes  int        `json:"duration_minutes,omitempty"`
+	ProgramSessionID int        `json:"program_session_id,omitempty"`
+	SessionID        int        `json:"session_id,omitempty"`
+}
+
+// GetCalendar builds a user's calendar between from and to, matching planned
+// workouts against logged sessions. Occurrences before today without a
+// session are missed.
+func GetCalendar(db *sql.DB, userID int, from, to time.Time, prefs Preferences) ([]CalendarEntry, error) {
+	schedules, err := GetUserSchedules(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	programSessions, err := GetUserProgramSessions(db, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := GetPerformedSessions(db, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CalendarEntry
+	for _, schedule := range schedules {
+		occurrences, err := schedule.Occurrences(from, to, prefs.WeekStart())
+		if err != nil {
+			return nil, err
+		}
+		for _, occurrence := range occurrences {
+			entry := CalendarEntry{
+				Date:            occurrence.Date,
+				WorkoutID:       occurrence.WorkoutID,
+				Source:          CalendarSourceSchedule,
+				ScheduleID:      occurrence.ScheduleID,
+				StartTime:       occurrence.StartTime,
+				DurationMinutes: occurrence.Duration,
+			}
+			if !occurrence.OriginalDate.Equal(occurrence.Date) {
+				original := occurrence.OriginalDate
+				entry.OriginalDate = &original
+			}
+			entries = append(entries, entry)
+		}
+	}
+	for _, ps := range programSessions {
+		entries = append(entries, CalendarEntry{
+			Date:             ps.ScheduledDate,
+			WorkoutID:        ps.WorkoutID,
+			Source:           CalendarSourceProgram,
+			ProgramSessionID: ps.ID,
+			SessionID:        ps.SessionID,
+		})
+	}
+
+	// Each session completes at most one planned entry for its workout and day
+	type key struct {
+		date      string
+		workoutID int
+	}
+	unmatched := make(map[key][]Session)
+	for _, session := range sessions {
+		k := key{session.Date.Format("2006-01-02"), session.WorkoutID}
+		unmatched[k] = append(unmatched[k], session)
+	}
+	claim := func(k key, sessionID int) int {
+		candidates := unmatched[k]
+		for i, session := range candidates {
+			if sessionID == 0 || session.ID == sessionID {
+				unmatched[k] = append(candidates[:i:i], candidates[i+1:]...)
+				return session.ID
+			}
+		}
+		return 0
+	}
+
+	// Program sessions already linked to a session claim it first
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SessionID != 0 && entries[j].SessionID == 0
+	})
+
+	today := prefs.Today()
+	for i := range entries {
+		entry := &entries[i]
+		entry.SessionID = claim(key{entry.Date.Format("2006-01-02"), entry.WorkoutID}, entry.SessionID)
+		switch {
+		case entry.SessionID != 0:
+			entry.Status = CalendarCompleted
+		case entry.Date.Before(today):
+			entry.Status = CalendarMissed
+		default:
+			entry.Status = CalendarPlanned
+		}
+	}
+
+	for _, remaining := range unmatched {
+		for _, session := range remaining {
+			entries = append(entries, CalendarEntry{
+				Date:      session.Date,
+				WorkoutID: session.WorkoutID,
+				Source:    CalendarSourceSession,
+				Status:    CalendarCompleted,
+				SessionID: session.ID,
+			})
+		}
+	}
+
+	if err := nameWorkouts(db, entries); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Date.Equal(entries[j].Date) {
+			return entries[i].Date.Before(entries[j].Date)
+		}
+		return entries[i].StartTime < entries[j].StartTime
+	})
+	return entries, nil
+}
+
+// nameWorkouts fills in the workout names of calendar entries
+func nameWorkouts(db *sql.DB, entries []CalendarEntry) error {
+	names := make(map[int]string)
+	for i := range entries {
+		id := entries[i].WorkoutID
+		if _, ok := names[id]; !ok {
+			workout, err := GetWorkout(db, id)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			names[id] = workout.Name
+		}
+		entries[i].WorkoutName = names[id]
+	}
+	return nil
+}
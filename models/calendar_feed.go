@@ -0,0 +1,70 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// CalendarFeed is a user's secret iCalendar subscription token. Anyone with
+// the token can read the feed, so rotating it revokes old subscriptions.
+type CalendarFeed struct {
+	UserID    int       `json:"user_id"`
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateCalendarFeedTable creates the calendar_feeds table if it doesn't exist
+func CreateCalendarFeedTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS calendar_feeds (
+		user_id INT PRIMARY KEY,
+		token CHAR(64) NOT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// GetOrCreateCalendarFeed returns a user's feed, creating a token on first use
+func GetOrCreateCalendarFeed(db *sql.DB, userID int) (CalendarFeed, error) {
+	query := "SELECT user_id, token, created_at FROM calendar_feeds WHERE user_id = ?"
+	var feed CalendarFeed
+	err := db.QueryRow(query, userID).Scan(&feed.UserID, &feed.Token, &feed.CreatedAt)
+	if err != sql.ErrNoRows {
+		return feed, err
+	}
+
+	return RotateCalendarFeed(db, userID)
+}
+
+// RotateCalendarFeed replaces a user's feed token with a new one
+func RotateCalendarFeed(db *sql.DB, userID int) (CalendarFeed, error) {
+	token, err := newToken()
+	if err != nil {
+		return CalendarFeed{}, err
+	}
+
+	query := `
+	INSERT INTO calendar_feeds (user_id, token) VALUES (?, ?)
+	ON DUPLICATE KEY UPDATE token = VALUES(token)`
+	if _, err := db.Exec(query, userID, token); err != nil {
+		return CalendarFeed{}, err
+	}
+
+	return CalendarFeed{UserID: userID, Token: token, CreatedAt: time.Now()}, nil
+}
+
+// GetCalendarFeedByToken looks up the feed for a token. Feeds of
+// deactivated users are not found.
+func GetCalendarFeedByToken(db *sql.DB, token string) (CalendarFeed, error) {
+	query := `
+	SELECT f.user_id, f.token, f.created_at
+	FROM calendar_feeds f
+	JOIN users u ON u.id = f.user_id AND u.deleted_at IS NULL
+	WHERE f.token = ?`
+	var feed CalendarFeed
+	err := db.QueryRow(query, token).Scan(&feed.UserID, &feed.Token, &feed.CreatedAt)
+	return feed, err
+}
@@ -0,0 +1,297 @@
+package models
+
+import (
+	"database/sql"
+	"io"
+	"time"
+)
+
+// Data export statuses
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+// Export download links stop working after exportLinkLifetime. A running
+// export that hasn't finished after exportStaleAfter is assumed to have died
+// with its server and is picked up again. Archives are stored in the database
+// in chunks of exportChunkSize bytes so any server can build or serve them.
+const (
+	exportLinkLifetime = 7 * 24 * time.Hour
+	exportStaleAfter   = time.Hour
+	exportChunkSize    = 1 << 20
+)
+
+// DataExport is an asynchronous export of everything tied to a user. Once
+// completed, the archive can be downloaded with its token until ExpiresAt.
+type DataExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Token       string     `json:"-"`
+	Size        int64      `json:"size,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateDataExportTable creates the data_exports and data_export_chunks
+// tables if they don't exist
+func CreateDataExportTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS data_exports (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		error TEXT,
+		token CHAR(64) NULL UNIQUE,
+		size BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP NULL,
+		completed_at TIMESTAMP NULL,
+		expires_at TIMESTAMP NULL,
+		INDEX idx_data_exports_status (status),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	query = `
+	CREATE TABLE IF NOT EXISTS data_export_chunks (
+		export_id INT NOT NULL,
+		seq INT NOT NULL,
+		data MEDIUMBLOB NOT NULL,
+		PRIMARY KEY (export_id, seq),
+		FOREIGN KEY (export_id) REFERENCES data_exports(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// dataExportSelect selects the columns scanned by scanDataExport
+const dataExportSelect = `
+	SELECT id, user_id, status, COALESCE(error, ''), COALESCE(token, ''), size, created_at, completed_at, expires_at
+	FROM data_exports`
+
+// scanDataExport scans an export selected with dataExportSelect
+func scanDataExport(row interface{ Scan(...interface{}) error }) (DataExport, error) {
+	var export DataExport
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.Error, &export.Token, &export.Size,
+		&export.CreatedAt, &completedAt, &expiresAt)
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+	return export, err
+}
+
+// GetUserDataExports retrieves a user's exports, newest first
+func GetUserDataExports(db *sql.DB, userID int) ([]DataExport, error) {
+	rows, err := db.Query(dataExportSelect+" WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, rows.Err()
+}
+
+// GetDataExport retrieves one of a user's exports
+func GetDataExport(db *sql.DB, id, userID int) (DataExport, error) {
+	return scanDataExport(db.QueryRow(dataExportSelect+" WHERE id = ? AND user_id = ?", id, userID))
+}
+
+// GetDataExportByToken looks up a completed export by its download token,
+// failing once the link has expired
+func GetDataExportByToken(db *sql.DB, token string) (DataExport, error) {
+	query := dataExportSelect + " WHERE token = ? AND status = ? AND expires_at > ?"
+	return scanDataExport(db.QueryRow(query, token, ExportCompleted, time.Now()))
+}
+
+// CreateDataExport queues an export for a user. A user's pending or running
+// export is returned instead of queueing another.
+func CreateDataExport(db *sql.DB, userID int) (int, error) {
+	var id int
+	query := "SELECT id FROM data_exports WHERE user_id = ? AND status IN (?, ?) ORDER BY id LIMIT 1"
+	err := db.QueryRow(query, userID, ExportPending, ExportRunning).Scan(&id)
+	if err != sql.ErrNoRows {
+		return id, err
+	}
+
+	result, err := db.Exec("INSERT INTO data_exports (user_id, status) VALUES (?, ?)", userID, ExportPending)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := result.LastInsertId()
+	return int(newID), err
+}
+
+// ClaimDataExport marks the oldest queued export as running and returns it,
+// or sql.ErrNoRows when there is nothing to do. Exports left running by a
+// server that stopped are claimed again.
+func ClaimDataExport(db *sql.DB) (DataExport, error) {
+	now := time.Now()
+	query := dataExportSelect + `
+	WHERE status = ? OR (status = ? AND started_at < ?)
+	ORDER BY id
+	LIMIT 1`
+	export, err := scanDataExport(db.QueryRow(query, ExportPending, ExportRunning, now.Add(-exportStaleAfter)))
+	if err != nil {
+		return export, err
+	}
+
+	// Another server may have claimed it first
+	result, err := db.Exec("UPDATE data_exports SET status = ?, started_at = ? WHERE id = ? AND status = ?",
+		ExportRunning, now, export.ID, export.Status)
+	if err != nil {
+		return export, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return export, err
+	}
+
+	export.Status = ExportRunning
+	return export, nil
+}
+
+// BuildDataExport writes the archive of a claimed export and issues its
+// download token. Chunks left by an earlier attempt are replaced.
+func BuildDataExport(db *sql.DB, export DataExport) error {
+	if _, err := db.Exec("DELETE FROM data_export_chunks WHERE export_id = ?", export.ID); err != nil {
+		return err
+	}
+
+	chunks := &exportChunkWriter{db: db, exportID: export.ID}
+	if err := WriteUserExport(db, export.UserID, chunks); err != nil {
+		return err
+	}
+	if err := chunks.flush(); err != nil {
+		return err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := "UPDATE data_exports SET status = ?, token = ?, size = ?, completed_at = ?, expires_at = ? WHERE id = ?"
+	_, err = db.Exec(query, ExportCompleted, token, chunks.size, now, now.Add(exportLinkLifetime), export.ID)
+	return err
+}
+
+// exportChunkWriter stores everything written to it as numbered chunks
+type exportChunkWriter struct {
+	db       *sql.DB
+	exportID int
+	seq      int
+	size     int64
+	buf      []byte
+}
+
+func (w *exportChunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), exportChunkSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(w.buf) == exportChunkSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush stores the buffered bytes as the next chunk
+func (w *exportChunkWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	if _, err := w.db.Exec("INSERT INTO data_export_chunks (export_id, seq, data) VALUES (?, ?, ?)", w.exportID, w.seq, w.buf); err != nil {
+		return err
+	}
+	w.seq++
+	w.size += int64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// CopyDataExport writes an export's archive to w one chunk at a time
+func CopyDataExport(db *sql.DB, exportID int, w io.Writer) error {
+	rows, err := db.Query("SELECT data FROM data_export_chunks WHERE export_id = ? ORDER BY seq", exportID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// FailDataExport records why an export failed, discarding any partial archive
+func FailDataExport(db *sql.DB, id int, cause error) error {
+	if _, err := db.Exec("DELETE FROM data_export_chunks WHERE export_id = ?", id); err != nil {
+		return err
+	}
+
+	query := "UPDATE data_exports SET status = ?, error = ?, completed_at = ? WHERE id = ?"
+	_, err := db.Exec(query, ExportFailed, cause.Error(), time.Now(), id)
+	return err
+}
+
+// ExpireDataExports revokes the download links that have run out and deletes
+// their archives
+func ExpireDataExports(db *sql.DB) (int64, error) {
+	now := time.Now()
+	query := `
+	DELETE c FROM data_export_chunks c
+	JOIN data_exports x ON x.id = c.export_id
+	WHERE x.status = ? AND x.expires_at <= ?`
+	if _, err := db.Exec(query, ExportCompleted, now); err != nil {
+		return 0, err
+	}
+
+	result, err := db.Exec("UPDATE data_exports SET status = ?, token = NULL WHERE status = ? AND expires_at <= ?",
+		ExportExpired, ExportCompleted, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,447 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Enrollment statuses
+const (
+	EnrollmentActive    = "active"
+	EnrollmentCancelled = "cancelled"
+)
+
+// Program session statuses
+const (
+	ProgramSessionPlanned   = "planned"
+	ProgramSessionCompleted = "completed"
+)
+
+// Enrollment represents a user following a program from a start date.
+// TrainingMaxes maps exercise IDs to training maxes in kilograms.
+type Enrollment struct {
+	ID            int              `json:"id"`
+	UserID        int              `json:"user_id"`
+	ProgramID     int              `json:"program_id"`
+	ProgramName   string           `json:"program_name"`
+	StartDate     time.Time        `json:"start_date"`
+	Status        string           `json:"status"`
+	TrainingMaxes map[int]float64  `json:"training_maxes"`
+	Sessions      []ProgramSession `json:"sessions,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Units         *Units           `json:"units,omitempty"`
+}
+
+// ProgramSession is one day of a program materialized for an enrolled user.
+// Its prescriptions are a snapshot taken at enrollment, so later edits to
+// the program or its workouts don't change it.
+type ProgramSession struct {
+	ID            int                   `json:"id"`
+	EnrollmentID  int                   `json:"enrollment_id"`
+	UserID        int                   `json:"user_id"`
+	Week          int                   `json:"week"`
+	Day           int                   `json:"day"`
+	Phase         string                `json:"phase"`
+	WorkoutID     int                   `json:"workout_id"`
+	ScheduledDate time.Time             `json:"scheduled_date"`
+	SessionID     int                   `json:"session_id"`
+	Status        string                `json:"status"`
+	Exercises     []ProgramPrescription `json:"exercises"`
+}
+
+// InUnits returns a copy of the enrollment expressed in u. Prescribed loads
+// are rounded to the given plate increment.
+func (e Enrollment) InUnits(u Units, increment float64) Enrollment {
+	trainingMaxes := make(map[int]float64, len(e.TrainingMaxes))
+	for exerciseID, tm := range e.TrainingMaxes {
+		trainingMaxes[exerciseID] = RoundWeight(u.WeightFromKg(tm))
+	}
+	e.TrainingMaxes = trainingMaxes
+
+	sessions := make([]ProgramSession, len(e.Sessions))
+	for i, session := range e.Sessions {
+		exercises := make([]ProgramPrescription, len(session.Exercises))
+		for j, prescription := range session.Exercises {
+			prescription.WorkoutExercise = prescription.WorkoutExercise.InUnits(u, increment)
+			exercises[j] = prescription
+		}
+		session.Exercises = exercises
+		sessions[i] = session
+	}
+	e.Sessions = sessions
+	e.Units = &u
+	return e
+}
+
+// CreateEnrollmentTables creates the program_enrollments, program_sessions
+// and program_session_exercises tables if they don't exist
+func CreateEnrollmentTables(db *sql.DB) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS program_enrollments (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		program_id INT NULL,
+		program_name VARCHAR(100) NOT NULL,
+		start_date DATE NOT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'active',
+		training_maxes JSON NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (program_id) REFERENCES programs(id) ON DELETE SET NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS program_sessions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		enrollment_id INT NOT NULL,
+		user_id INT NOT NULL,
+		week_number INT NOT NULL,
+		day_number INT NOT NULL,
+		phase VARCHAR(20) NOT NULL,
+		workout_id INT NOT NULL,
+		scheduled_date DATE NOT NULL,
+		session_id INT NULL,
+		status VARCHAR(20) NOT NULL DEFAULT 'planned',
+		INDEX idx_program_sessions_user_date (user_id, scheduled_date),
+		FOREIGN KEY (enrollment_id) REFERENCES program_enrollments(id) ON DELETE CASCADE,
+		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS program_session_exercises (
+		program_session_id INT NOT NULL,
+		exercise_id INT NOT NULL,
+		exercise_order INT NOT NULL,
+		sets INT NOT NULL,
+		reps INT NOT NULL,
+		weight DECIMAL(8,2) NOT NULL,
+		duration_seconds INT NOT NULL,
+		distance_meters DECIMAL(10,2) NOT NULL,
+		rpe_target DECIMAL(3,1) NOT NULL DEFAULT 0,
+		PRIMARY KEY (program_session_id, exercise_id),
+		FOREIGN KEY (program_session_id) REFERENCES program_sessions(id) ON DELETE CASCADE,
+		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE
+	);`}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRounding rounds materialized loads to what the lifter can load
+type LoadRounding struct {
+	Units     Units
+	Increment float64
+}
+
+// Enroll enrolls a user in a program and materializes their schedule
+func Enroll(db *sql.DB, enrollment Enrollment, program Program, rounding LoadRounding) (int, error) {
+	trainingMaxes, err := json.Marshal(enrollment.TrainingMaxes)
+	if err != nil {
+		return 0, err
+	}
+
+	sessions, err := planProgramSessions(db, program, enrollment, rounding, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO program_enrollments (user_id, program_id, program_name, start_date, status, training_maxes)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, enrollment.UserID, program.ID, program.Name, enrollment.StartDate, EnrollmentActive, trainingMaxes)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := insertProgramSessions(tx, int(id), sessions); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// ResyncEnrollment replaces the planned sessions from a date on with the
+// program's current definition. Completed sessions and anything before from
+// are left as they were.
+func ResyncEnrollment(db *sql.DB, enrollment Enrollment, program Program, rounding LoadRounding, from time.Time) error {
+	sessions, err := planProgramSessions(db, program, enrollment, rounding, from)
+	if err != nil {
+		return err
+	}
+
+	// Keep the sessions that have already been done
+	completed := make(map[[3]int]bool)
+	for _, session := range enrollment.Sessions {
+		if session.Status == ProgramSessionCompleted {
+			completed[[3]int{session.Week, session.Day, session.WorkoutID}] = true
+		}
+	}
+
+	var pending []ProgramSession
+	for _, session := range sessions {
+		if !completed[[3]int{session.Week, session.Day, session.WorkoutID}] {
+			pending = append(pending, session)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM program_sessions WHERE enrollment_id = ? AND status = ? AND scheduled_date >= ?"
+	if _, err := tx.Exec(query, enrollment.ID, ProgramSessionPlanned, from); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := insertProgramSessions(tx, enrollment.ID, pending); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// planProgramSessions computes the sessions of an enrollment scheduled on or
+// after from, with their prescriptions
+func planProgramSessions(db *sql.DB, program Program, enrollment Enrollment, rounding LoadRounding, from time.Time) ([]ProgramSession, error) {
+	entries := make(map[int][]WorkoutExercise)
+
+	var sessions []ProgramSession
+	for _, week := range program.Weeks {
+		for _, day := range program.DaysOfWeek(week.Week) {
+			date := enrollment.StartDate.AddDate(0, 0, (week.Week-1)*7+day.Day-1)
+			if date.Before(from) {
+				continue
+			}
+
+			if _, ok := entries[day.WorkoutID]; !ok {
+				workoutExercises, err := GetWorkoutExercises(db, day.WorkoutID)
+				if err != nil {
+					return nil, err
+				}
+				entries[day.WorkoutID] = workoutExercises
+			}
+
+			session := ProgramSession{
+				UserID:        enrollment.UserID,
+				Week:          week.Week,
+				Day:           day.Day,
+				Phase:         week.Phase,
+				WorkoutID:     day.WorkoutID,
+				ScheduledDate: date,
+				Status:        ProgramSessionPlanned,
+			}
+			for _, we := range entries[day.WorkoutID] {
+				prescription := program.Prescribe(week, we, enrollment.TrainingMaxes[we.ExerciseID])
+				if prescription.Weight > 0 {
+					prescription.Weight = RoundLoadKg(prescription.Weight, rounding.Units, rounding.Increment)
+				}
+				session.Exercises = append(session.Exercises, prescription)
+			}
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions, nil
+}
+
+// insertProgramSessions stores materialized sessions and their prescriptions
+func insertProgramSessions(tx *sql.Tx, enrollmentID int, sessions []ProgramSession) error {
+	for _, session := range sessions {
+		query := `
+		INSERT INTO program_sessions (enrollment_id, user_id, week_number, day_number, phase, workout_id, scheduled_date, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		result, err := tx.Exec(query, enrollmentID, session.UserID, session.Week, session.Day, session.Phase,
+			session.WorkoutID, session.ScheduledDate, session.Status)
+		if err != nil {
+			return err
+		}
+
+		sessionID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for _, p := range session.Exercises {
+			query := `
+			INSERT INTO program_session_exercises (program_session_id, exercise_id, exercise_order, sets, reps, weight,
+				duration_seconds, distance_meters, rpe_target)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			if _, err := tx.Exec(query, sessionID, p.ExerciseID, p.Order, p.Sets, p.Reps, p.Weight,
+				p.Duration, p.Distance, p.RPETarget); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetUserEnrollments retrieves a user's enrollments without their sessions
+func GetUserEnrollments(db *sql.DB, userID int) ([]Enrollment, error) {
+	query := `
+	SELECT id, user_id, COALESCE(program_id, 0), program_name, start_date, status, training_maxes, created_at
+	FROM program_enrollments
+	WHERE user_id = ?
+	ORDER BY start_date DESC`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var enrollments []Enrollment
+	for rows.Next() {
+		enrollment, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, enrollment)
+	}
+
+	return enrollments, rows.Err()
+}
+
+// GetEnrollment retrieves an enrollment with its sessions and prescriptions
+func GetEnrollment(db *sql.DB, id int) (Enrollment, error) {
+	query := `
+	SELECT id, user_id, COALESCE(program_id, 0), program_name, start_date, status, training_maxes, created_at
+	FROM program_enrollments
+	WHERE id = ?`
+
+	enrollment, err := scanEnrollment(db.QueryRow(query, id))
+	if err != nil {
+		return enrollment, err
+	}
+
+	enrollment.Sessions, err = getProgramSessions(db, "ps.enrollment_id = ?", id)
+	return enrollment, err
+}
+
+// scanEnrollment scans an enrollment row
+func scanEnrollment(row interface{ Scan(...interface{}) error }) (Enrollment, error) {
+	var enrollment Enrollment
+	var trainingMaxes []byte
+	if err := row.Scan(&enrollment.ID, &enrollment.UserID, &enrollment.ProgramID, &enrollment.ProgramName,
+		&enrollment.StartDate, &enrollment.Status, &trainingMaxes, &enrollment.CreatedAt); err != nil {
+		return enrollment, err
+	}
+
+	err := json.Unmarshal(trainingMaxes, &enrollment.TrainingMaxes)
+	return enrollment, err
+}
+
+// GetUserProgramSessions retrieves a user's program sessions of active
+// enrollments scheduled between from and to
+func GetUserProgramSessions(db *sql.DB, userID int, from, to time.Time) ([]ProgramSession, error) {
+	return getProgramSessions(db, `ps.user_id = ? AND ps.scheduled_date BETWEEN ? AND ?
+		AND ps.enrollment_id IN (SELECT id FROM program_enrollments WHERE status = 'active')`, userID, from, to)
+}
+
+// getProgramSessions retrieves program sessions matching a condition on ps,
+// with their prescriptions, in schedule order
+func getProgramSessions(db *sql.DB, where string, args ...interface{}) ([]ProgramSession, error) {
+	query := `
+	SELECT ps.id, ps.enrollment_id, ps.user_id, ps.week_number, ps.day_number, ps.phase, ps.workout_id,
+		ps.scheduled_date, COALESCE(ps.session_id, 0), ps.status,
+		pse.exercise_id, pse.exercise_order, pse.sets, pse.reps, pse.weight, pse.duration_seconds,
+		pse.distance_meters, pse.rpe_target
+	FROM program_sessions ps
+	LEFT JOIN program_session_exercises pse ON pse.program_session_id = ps.id
+	WHERE ` + where + `
+	ORDER BY ps.scheduled_date, ps.id, pse.exercise_order`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []ProgramSession{}
+	for rows.Next() {
+		var session ProgramSession
+		var exerciseID, order, sets, reps, duration sql.NullInt64
+		var weight, distance, rpe sql.NullFloat64
+		if err := rows.Scan(&session.ID, &session.EnrollmentID, &session.UserID, &session.Week, &session.Day,
+			&session.Phase, &session.WorkoutID, &session.ScheduledDate, &session.SessionID, &session.Status,
+			&exerciseID, &order, &sets, &reps, &weight, &duration, &distance, &rpe); err != nil {
+			return nil, err
+		}
+
+		if len(sessions) == 0 || sessions[len(sessions)-1].ID != session.ID {
+			session.Exercises = []ProgramPrescription{}
+			sessions = append(sessions, session)
+		}
+		if !exerciseID.Valid {
+			continue
+		}
+
+		current := &sessions[len(sessions)-1]
+		current.Exercises = append(current.Exercises, ProgramPrescription{
+			WorkoutExercise: WorkoutExercise{
+				WorkoutID:  session.WorkoutID,
+				ExerciseID: int(exerciseID.Int64),
+				Sets:       int(sets.Int64),
+				Reps:       int(reps.Int64),
+				Weight:     weight.Float64,
+				Duration:   int(duration.Int64),
+				Distance:   distance.Float64,
+				Order:      int(order.Int64),
+			},
+			RPETarget: rpe.Float64,
+		})
+	}
+
+	return sessions, rows.Err()
+}
+
+// CompleteProgramSessions marks the user's planned program sessions for a
+// workout on a day as done by the logged session
+func CompleteProgramSessions(db *sql.DB, userID, workoutID int, date time.Time, sessionID int) error {
+	query := `
+	UPDATE program_sessions
+	SET session_id = ?, status = ?
+	WHERE user_id = ? AND workout_id = ? AND scheduled_date = ? AND status = ?`
+	_, err := db.Exec(query, sessionID, ProgramSessionCompleted, userID, workoutID, date, ProgramSessionPlanned)
+	return err
+}
+
+// CancelEnrollment stops an enrollment and removes its planned sessions from
+// a date on. Completed sessions are kept.
+func CancelEnrollment(db *sql.DB, id int, from time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE program_enrollments SET status = ? WHERE id = ?", EnrollmentCancelled, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := "DELETE FROM program_sessions WHERE enrollment_id = ? AND status = ? AND scheduled_date >= ?"
+	if _, err := tx.Exec(query, id, ProgramSessionPlanned, from); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -7,12 +7,15 @@ import (
 
 // Exercise represents a physical exercise
 type Exercise struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Category    string    `json:"category"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Category     string    `json:"category"`
+	MuscleGroup  string    `json:"muscle_group"`
+	TrackingType string    `json:"tracking_type"`
+	Equipment    string    `json:"equipment"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // CreateExerciseTable creates the exercises table if it doesn't exist
@@ -23,17 +26,36 @@ func CreateExerciseTable(db *sql.DB) error {
 		name VARCHAR(100) NOT NULL,
 		description TEXT,
 		category VARCHAR(50) NOT NULL,
+		muscle_group VARCHAR(50) NOT NULL DEFAULT '',
+		tracking_type VARCHAR(30) NOT NULL DEFAULT 'reps_load',
+		equipment VARCHAR(50) NOT NULL DEFAULT '',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		deleted_at TIMESTAMP NULL
 	);`
 
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "exercises", "tracking_type", "VARCHAR(30) NOT NULL DEFAULT 'reps_load'"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "exercises", "muscle_group", "VARCHAR(50) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "exercises", "equipment", "VARCHAR(50) NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "exercises", "instructions", "JSON NULL"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(db, "exercises", "deleted_at", "TIMESTAMP NULL")
 }
 
 // GetExercises retrieves all exercises from the database
 func GetExercises(db *sql.DB) ([]Exercise, error) {
-	query := "SELECT id, name, description, category, created_at, updated_at FROM exercises"
+	query := "SELECT id, name, description, category, muscle_group, tracking_type, equipment, created_at, updated_at FROM exercises WHERE deleted_at IS NULL"
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
@@ -43,7 +65,7 @@ func GetExercises(db *sql.DB) ([]Exercise, error) {
 	var exercises []Exercise
 	for rows.Next() {
 		var exercise Exercise
-		if err := rows.Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category, &exercise.CreatedAt, &exercise.UpdatedAt); err != nil {
+		if err := rows.Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category, &exercise.MuscleGroup, &exercise.TrackingType, &exercise.Equipment, &exercise.CreatedAt, &exercise.UpdatedAt); err != nil {
 			return nil, err
 		}
 		exercises = append(exercises, exercise)
@@ -54,16 +76,33 @@ func GetExercises(db *sql.DB) ([]Exercise, error) {
 
 // GetExercise retrieves an exercise by ID
 func GetExercise(db *sql.DB, id int) (Exercise, error) {
-	query := "SELECT id, name, description, category, created_at, updated_at FROM exercises WHERE id = ?"
+	query := "SELECT id, name, description, category, muscle_group, tracking_type, equipment, created_at, updated_at FROM exercises WHERE id = ? AND deleted_at IS NULL"
 	var exercise Exercise
-	err := db.QueryRow(query, id).Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category, &exercise.CreatedAt, &exercise.UpdatedAt)
+	err := db.QueryRow(query, id).Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category, &exercise.MuscleGroup, &exercise.TrackingType, &exercise.Equipment, &exercise.CreatedAt, &exercise.UpdatedAt)
+	return exercise, err
+}
+
+// GetExerciseIncludingTrashed retrieves an exercise by ID even if it is in
+// the trash, for progress that was logged against it
+func GetExerciseIncludingTrashed(db *sql.DB, id int) (Exercise, error) {
+	query := "SELECT id, name, description, category, muscle_group, tracking_type, equipment, created_at, updated_at FROM exercises WHERE id = ?"
+	var exercise Exercise
+	err := db.QueryRow(query, id).Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category, &exercise.MuscleGroup, &exercise.TrackingType, &exercise.Equipment, &exercise.CreatedAt, &exercise.UpdatedAt)
+	return exercise, err
+}
+
+// FindExerciseByName retrieves the first exercise with a name, ignoring case
+func FindExerciseByName(db *sql.DB, name string) (Exercise, error) {
+	query := "SELECT id, name, description, category, muscle_group, tracking_type, equipment, created_at, updated_at FROM exercises WHERE LOWER(name) = LOWER(?) AND deleted_at IS NULL ORDER BY id LIMIT 1"
+	var exercise Exercise
+	err := db.QueryRow(query, name).Scan(&exercise.ID, &exercise.Name, &exercise.Description, &exercise.Category, &exercise.MuscleGroup, &exercise.TrackingType, &exercise.Equipment, &exercise.CreatedAt, &exercise.UpdatedAt)
 	return exercise, err
 }
 
 // CreateExercise creates a new exercise in the database
 func CreateExercise(db *sql.DB, exercise Exercise) (int, error) {
-	query := "INSERT INTO exercises (name, description, category) VALUES (?, ?, ?)"
-	result, err := db.Exec(query, exercise.Name, exercise.Description, exercise.Category)
+	query := "INSERT INTO exercises (name, description, category, muscle_group, tracking_type, equipment) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, exercise.Name, exercise.Description, exercise.Category, exercise.MuscleGroup, exercise.TrackingType, exercise.Equipment)
 	if err != nil {
 		return 0, err
 	}
@@ -74,14 +113,20 @@ func CreateExercise(db *sql.DB, exercise Exercise) (int, error) {
 
 // UpdateExercise updates an existing exercise
 func UpdateExercise(db *sql.DB, exercise Exercise) error {
-	query := "UPDATE exercises SET name = ?, description = ?, category = ? WHERE id = ?"
-	_, err := db.Exec(query, exercise.Name, exercise.Description, exercise.Category, exercise.ID)
+	query := "UPDATE exercises SET name = ?, description = ?, category = ?, muscle_group = ?, tracking_type = ?, equipment = ? WHERE id = ? AND deleted_at IS NULL"
+	_, err := db.Exec(query, exercise.Name, exercise.Description, exercise.Category, exercise.MuscleGroup, exercise.TrackingType, exercise.Equipment, exercise.ID)
 	return err
 }
 
-// DeleteExercise deletes an exercise by ID
+// DeleteExercise moves an exercise to the trash. Progress logged for it is
+// kept, and workouts stop listing it.
 func DeleteExercise(db *sql.DB, id int) error {
-	query := "DELETE FROM exercises WHERE id = ?"
+	query := "UPDATE exercises SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL"
 	_, err := db.Exec(query, id)
 	return err
+}
+
+// RestoreExercise takes an exercise out of the trash
+func RestoreExercise(db *sql.DB, id int) error {
+	return restoreRow(db, "UPDATE exercises SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
 }
\ No newline at end of file
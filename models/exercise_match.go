@@ -0,0 +1,162 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Exercise names from other apps are matched to the catalog automatically
+// when the score reaches MatchAutoAccept. Lower scores down to
+// MatchSuggestion are offered for review.
+const (
+	MatchAutoAccept = 0.9
+	MatchSuggestion = 0.5
+)
+
+// exerciseSynonyms expands abbreviations common in other apps' exports
+var exerciseSynonyms = map[string]string{
+	"db":     "dumbbell",
+	"bb":     "barbell",
+	"kb":     "kettlebell",
+	"ez":     "ezbar",
+	"ohp":    "overhead press",
+	"rdl":    "romanian deadlift",
+	"bw":     "bodyweight",
+	"pullup": "pull up",
+	"pushup": "push up",
+	"chinup": "chin up",
+	"situp":  "sit up",
+}
+
+// ExerciseMatch is the catalog exercise that best matches a name, with a
+// score from 0 (nothing in common) to 1 (same name)
+type ExerciseMatch struct {
+	Exercise Exercise
+	Score    float64
+}
+
+// MatchExercise finds the catalog exercise that best matches name. Names
+// such as "Bench Press (Barbell)" carry their equipment in parentheses; it
+// counts towards the match either as part of the name or against the
+// exercise's equipment.
+func MatchExercise(name string, catalog []Exercise) (ExerciseMatch, bool) {
+	base, hint := splitEquipmentHint(name)
+	baseTokens := matchTokens(base)
+	fullTokens := matchTokens(base + " " + hint)
+	hintTokens := matchTokens(hint)
+
+	var best ExerciseMatch
+	found := false
+	for _, exercise := range catalog {
+		candidate := matchTokens(exercise.Name)
+		score := max(tokenSimilarity(baseTokens, candidate), tokenSimilarity(fullTokens, candidate))
+
+		// Equipment given separately has to agree with the exercise's
+		if len(hintTokens) > 0 && exercise.Equipment != "" {
+			if tokenSimilarity(hintTokens, matchTokens(exercise.Equipment)) >= MatchAutoAccept {
+				score = min(1, score+0.1)
+			} else {
+				score -= 0.15
+			}
+		}
+
+		if !found || score > best.Score {
+			best = ExerciseMatch{Exercise: exercise, Score: score}
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// splitEquipmentHint separates a trailing parenthesized part from a name
+func splitEquipmentHint(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	open := strings.LastIndex(name, "(")
+	if open <= 0 || !strings.HasSuffix(name, ")") {
+		return name, ""
+	}
+	return strings.TrimSpace(name[:open]), strings.TrimSpace(name[open+1 : len(name)-1])
+}
+
+// matchTokens lowercases a name into sorted words with punctuation removed,
+// abbreviations expanded and simple plurals made singular
+func matchTokens(name string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var tokens []string
+	for _, word := range words {
+		if synonym, ok := exerciseSynonyms[word]; ok {
+			tokens = append(tokens, strings.Fields(synonym)...)
+			continue
+		}
+		if len(word) > 2 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+			word = strings.TrimSuffix(word, "s")
+		}
+		tokens = append(tokens, word)
+	}
+
+	sort.Strings(tokens)
+	return tokens
+}
+
+// tokenSimilarity scores two token lists by the better of their word overlap
+// and the edit distance between their sorted spellings, which catches typos
+func tokenSimilarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	set := make(map[string]bool, len(a))
+	for _, token := range a {
+		set[token] = true
+	}
+	shared := 0
+	union := len(set)
+	seen := make(map[string]bool, len(b))
+	for _, token := range b {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		if set[token] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	overlap := float64(shared) / float64(union)
+
+	x, y := strings.Join(a, " "), strings.Join(b, " ")
+	longest := max(len([]rune(x)), len([]rune(y)))
+	spelling := 1 - float64(levenshtein(x, y))/float64(longest)
+
+	return max(overlap, spelling)
+}
+
+// levenshtein counts the single-rune edits that turn a into b
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(br)]
+}
@@ -0,0 +1,424 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/storage"
+)
+
+// Kinds of exercise media
+const (
+	MediaImage = "image"
+	MediaGIF   = "gif"
+	MediaVideo = "video"
+)
+
+const (
+	// MaxMediaSize is the largest exercise media upload accepted, in bytes.
+	// Images and GIFs are limited to MaxImageSize.
+	MaxMediaSize = 30 << 20
+
+	// maxExerciseImages is how many still images an exercise can have; it
+	// can have one GIF or video besides
+	maxExerciseImages = 10
+
+	// Limits on structured instructions
+	maxInstructionSteps = 30
+	maxInstructionItems = 20
+	maxInstructionText  = 500
+)
+
+// ErrMediaLimit is returned when an exercise already has as much media of a
+// kind as it can
+var ErrMediaLimit = errors.New("media limit reached")
+
+// ExerciseMedia is an image, animated GIF or short video demonstrating an
+// exercise. Files are kept in the file store and are public like the rest of
+// the catalog.
+type ExerciseMedia struct {
+	ID            int       `json:"id"`
+	ExerciseID    int       `json:"exercise_id"`
+	Kind          string    `json:"kind"`
+	ContentType   string    `json:"content_type"`
+	Position      int       `json:"position"`
+	Caption       string    `json:"caption"`
+	Width         int       `json:"width,omitempty"`
+	Height        int       `json:"height,omitempty"`
+	Size          int       `json:"size"`
+	ObjectKey     string    `json:"-"`
+	ThumbnailKey  string    `json:"-"`
+	ThumbnailType string    `json:"-"`
+	URL           string    `json:"url"`
+	ThumbnailURL  string    `json:"thumbnail_url,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExerciseInstructions are step-by-step instructions for an exercise, with
+// coaching cues and common mistakes to avoid
+type ExerciseInstructions struct {
+	Steps          []string `json:"steps"`
+	Cues           []string `json:"cues"`
+	CommonMistakes []string `json:"common_mistakes"`
+}
+
+// ExerciseDetail is an exercise with its instructions and media, in order
+type ExerciseDetail struct {
+	Exercise
+	Instructions ExerciseInstructions `json:"instructions"`
+	Media        []ExerciseMedia      `json:"media"`
+}
+
+// CreateExerciseMediaTable creates the exercise_media table if it doesn't
+// exist. Media of purged exercises are removed by PurgeExerciseMedia, which
+// also deletes their files, so there is no cascading foreign key.
+func CreateExerciseMediaTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS exercise_media (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		exercise_id INT NOT NULL,
+		kind VARCHAR(10) NOT NULL,
+		content_type VARCHAR(20) NOT NULL,
+		position INT NOT NULL,
+		caption VARCHAR(255) NOT NULL DEFAULT '',
+		width INT NOT NULL DEFAULT 0,
+		height INT NOT NULL DEFAULT 0,
+		size INT NOT NULL,
+		object_key VARCHAR(255) NOT NULL,
+		thumbnail_key VARCHAR(255) NOT NULL DEFAULT '',
+		thumbnail_type VARCHAR(20) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_exercise_media_position (exercise_id, position)
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// ProcessMedia checks an uploaded media file and prepares it for storage,
+// returning its kind. JPEG and PNG images and GIFs are cleaned up like
+// photos; MP4 and WebM videos are stored as they are.
+func ProcessMedia(data []byte) (string, ProcessedImage, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png":
+		if len(data) > MaxImageSize {
+			return "", ProcessedImage{}, errors.New("images are limited to 15 MB")
+		}
+		processed, err := ProcessImage(data)
+		return MediaImage, processed, err
+	case "image/gif":
+		if len(data) > MaxImageSize {
+			return "", ProcessedImage{}, errors.New("GIFs are limited to 15 MB")
+		}
+		processed, err := ProcessAnimation(data)
+		return MediaGIF, processed, err
+	case "video/mp4", "video/webm":
+		return MediaVideo, ProcessedImage{ContentType: contentType, Image: data}, nil
+	}
+	return "", ProcessedImage{}, errors.New("unsupported media type " + contentType + "; upload a JPEG, PNG, GIF, MP4 or WebM file")
+}
+
+// mediaSelect selects the columns scanned by scanMedia
+const mediaSelect = `
+	SELECT id, exercise_id, kind, content_type, position, caption, width, height, size, object_key, thumbnail_key, thumbnail_type,
+		created_at
+	FROM exercise_media`
+
+// scanMedia scans media selected with mediaSelect, with their URLs
+func scanMedia(row interface{ Scan(...interface{}) error }) (ExerciseMedia, error) {
+	var m ExerciseMedia
+	err := row.Scan(&m.ID, &m.ExerciseID, &m.Kind, &m.ContentType, &m.Position, &m.Caption, &m.Width, &m.Height, &m.Size,
+		&m.ObjectKey, &m.ThumbnailKey, &m.ThumbnailType, &m.CreatedAt)
+	m.URL = fmt.Sprintf("/exercises/%d/media/%d/%s", m.ExerciseID, m.ID, VariantOriginal)
+	if m.ThumbnailKey != "" {
+		m.ThumbnailURL = fmt.Sprintf("/exercises/%d/media/%d/%s", m.ExerciseID, m.ID, VariantThumbnail)
+	}
+	return m, err
+}
+
+// SaveExerciseMedia stores processed media under random keys and adds it
+// after the exercise's other media, returning its ID. An exercise takes
+// maxExerciseImages images and one GIF or video; past that ErrMediaLimit is
+// returned.
+func SaveExerciseMedia(db *sql.DB, store storage.Store, m ExerciseMedia, file ProcessedImage) (int, error) {
+	if err := checkMediaLimit(db, m.ExerciseID, m.Kind); err != nil {
+		return 0, err
+	}
+
+	name, err := newToken()
+	if err != nil {
+		return 0, err
+	}
+	m.ObjectKey = fmt.Sprintf("exercises/%d/%s%s", m.ExerciseID, name, mediaExtension(file.ContentType))
+	if err := store.Put(m.ObjectKey, file.Image, file.ContentType); err != nil {
+		return 0, err
+	}
+	if len(file.Thumbnail) > 0 {
+		m.ThumbnailKey = fmt.Sprintf("exercises/%d/%s_thumb%s", m.ExerciseID, name, mediaExtension(file.ThumbnailType))
+		m.ThumbnailType = file.ThumbnailType
+		if err := store.Put(m.ThumbnailKey, file.Thumbnail, file.ThumbnailType); err != nil {
+			store.Delete(m.ObjectKey)
+			return 0, err
+		}
+	}
+
+	query := `
+	INSERT INTO exercise_media (exercise_id, kind, content_type, position, caption, width, height, size, object_key, thumbnail_key, thumbnail_type)
+	SELECT ?, ?, ?, COALESCE(MAX(position), 0) + 1, ?, ?, ?, ?, ?, ?, ?
+	FROM exercise_media
+	WHERE exercise_id = ?`
+	result, err := db.Exec(query, m.ExerciseID, m.Kind, file.ContentType, m.Caption, file.Width, file.Height, len(file.Image),
+		m.ObjectKey, m.ThumbnailKey, m.ThumbnailType, m.ExerciseID)
+	if err != nil {
+		store.Delete(m.ObjectKey)
+		if m.ThumbnailKey != "" {
+			store.Delete(m.ThumbnailKey)
+		}
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// checkMediaLimit fails with ErrMediaLimit if an exercise can't take more
+// media of a kind
+func checkMediaLimit(db *sql.DB, exerciseID int, kind string) error {
+	var images, clips int
+	query := `
+	SELECT COALESCE(SUM(kind = ?), 0), COALESCE(SUM(kind <> ?), 0)
+	FROM exercise_media
+	WHERE exercise_id = ?`
+	if err := db.QueryRow(query, MediaImage, MediaImage, exerciseID).Scan(&images, &clips); err != nil {
+		return err
+	}
+	if kind == MediaImage && images >= maxExerciseImages || kind != MediaImage && clips > 0 {
+		return ErrMediaLimit
+	}
+	return nil
+}
+
+// mediaExtension returns the file extension of a media type
+func mediaExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "video/mp4":
+		return ".mp4"
+	case "video/webm":
+		return ".webm"
+	}
+	return ""
+}
+
+// GetExerciseMedia retrieves media of an exercise by ID
+func GetExerciseMedia(db *sql.DB, id, exerciseID int) (ExerciseMedia, error) {
+	query := mediaSelect + " WHERE id = ? AND exercise_id = ?"
+	return scanMedia(db.QueryRow(query, id, exerciseID))
+}
+
+// GetExerciseMediaList retrieves an exercise's media in order
+func GetExerciseMediaList(db *sql.DB, exerciseID int) ([]ExerciseMedia, error) {
+	rows, err := db.Query(mediaSelect+" WHERE exercise_id = ? ORDER BY position, id", exerciseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	media := []ExerciseMedia{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+
+	return media, rows.Err()
+}
+
+// UpdateExerciseMediaCaption changes the caption of an exercise's media
+func UpdateExerciseMediaCaption(db *sql.DB, id, exerciseID int, caption string) error {
+	_, err := db.Exec("UPDATE exercise_media SET caption = ? WHERE id = ? AND exercise_id = ?", caption, id, exerciseID)
+	return err
+}
+
+// ReorderExerciseMedia puts an exercise's media in the given order, which
+// must list each of its media exactly once
+func ReorderExerciseMedia(db *sql.DB, exerciseID int, mediaIDs []int) error {
+	media, err := GetExerciseMediaList(db, exerciseID)
+	if err != nil {
+		return err
+	}
+	if len(mediaIDs) != len(media) {
+		return errors.New("the order must list each of the exercise's media exactly once")
+	}
+	listed := make(map[int]bool, len(mediaIDs))
+	for _, id := range mediaIDs {
+		listed[id] = true
+	}
+	for _, m := range media {
+		if !listed[m.ID] {
+			return errors.New("the order must list each of the exercise's media exactly once")
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for i, id := range mediaIDs {
+		if _, err := tx.Exec("UPDATE exercise_media SET position = ? WHERE id = ? AND exercise_id = ?", i+1, id, exerciseID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteExerciseMedia deletes media of an exercise and its files
+func DeleteExerciseMedia(db *sql.DB, store storage.Store, m ExerciseMedia) error {
+	if _, err := db.Exec("DELETE FROM exercise_media WHERE id = ? AND exercise_id = ?", m.ID, m.ExerciseID); err != nil {
+		return err
+	}
+	return deleteMediaFiles(store, m)
+}
+
+// deleteMediaFiles removes the files of media from the store
+func deleteMediaFiles(store storage.Store, m ExerciseMedia) error {
+	if err := store.Delete(m.ObjectKey); err != nil {
+		return err
+	}
+	if m.ThumbnailKey != "" {
+		return store.Delete(m.ThumbnailKey)
+	}
+	return nil
+}
+
+// PurgeExerciseMedia deletes the media and files of exercises that have been
+// purged from the trash, returning how many were removed
+func PurgeExerciseMedia(db *sql.DB, store storage.Store) (int, error) {
+	query := mediaSelect + " WHERE NOT EXISTS (SELECT 1 FROM exercises e WHERE e.id = exercise_media.exercise_id)"
+	rows, err := db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	var orphans []ExerciseMedia
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orphans = append(orphans, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, m := range orphans {
+		if err := deleteMediaFiles(store, m); err != nil {
+			return i, err
+		}
+		if _, err := db.Exec("DELETE FROM exercise_media WHERE id = ?", m.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(orphans), nil
+}
+
+// GetExerciseInstructions retrieves the instructions of an exercise, empty
+// if it has none
+func GetExerciseInstructions(db *sql.DB, exerciseID int) (ExerciseInstructions, error) {
+	var raw []byte
+	instructions := ExerciseInstructions{Steps: []string{}, Cues: []string{}, CommonMistakes: []string{}}
+	err := db.QueryRow("SELECT instructions FROM exercises WHERE id = ?", exerciseID).Scan(&raw)
+	if err != nil || raw == nil {
+		return instructions, err
+	}
+	if err := json.Unmarshal(raw, &instructions); err != nil {
+		return instructions, err
+	}
+	return instructions.normalized(), nil
+}
+
+// SetExerciseInstructions replaces the instructions of an exercise
+func SetExerciseInstructions(db *sql.DB, exerciseID int, instructions ExerciseInstructions) error {
+	raw, err := json.Marshal(instructions.normalized())
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE exercises SET instructions = ? WHERE id = ? AND deleted_at IS NULL", raw, exerciseID)
+	return err
+}
+
+// Validate trims the instructions' text and checks it is within limits,
+// with no empty items
+func (i *ExerciseInstructions) Validate() error {
+	lists := []struct {
+		name  string
+		items []string
+		max   int
+	}{
+		{"steps", i.Steps, maxInstructionSteps},
+		{"cues", i.Cues, maxInstructionItems},
+		{"common_mistakes", i.CommonMistakes, maxInstructionItems},
+	}
+	for _, list := range lists {
+		if len(list.items) > list.max {
+			return fmt.Errorf("at most %d %s are allowed", list.max, list.name)
+		}
+		for n, item := range list.items {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				return fmt.Errorf("%s cannot be empty", list.name)
+			}
+			if len(item) > maxInstructionText {
+				return fmt.Errorf("%s are limited to %d characters", list.name, maxInstructionText)
+			}
+			list.items[n] = item
+		}
+	}
+	return nil
+}
+
+// normalized returns the instructions with empty lists instead of nil ones
+func (i ExerciseInstructions) normalized() ExerciseInstructions {
+	if i.Steps == nil {
+		i.Steps = []string{}
+	}
+	if i.Cues == nil {
+		i.Cues = []string{}
+	}
+	if i.CommonMistakes == nil {
+		i.CommonMistakes = []string{}
+	}
+	return i
+}
+
+// Key returns the store key of a variant
+func (m ExerciseMedia) Key(variant string) string {
+	if variant == VariantThumbnail {
+		return m.ThumbnailKey
+	}
+	return m.ObjectKey
+}
+
+// ContentTypeOf returns the content type of a variant
+func (m ExerciseMedia) ContentTypeOf(variant string) string {
+	if variant == VariantThumbnail {
+		return m.ThumbnailType
+	}
+	return m.ContentType
+}
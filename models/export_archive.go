@@ -0,0 +1,327 @@
+package models
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// exportFormatVersion is bumped whenever the archive layout changes
+const exportFormatVersion = 1
+
+// exportDataset is one kind of user data in an export archive, written as
+// <name>.json and <name>.csv. Each query takes the user ID as its only
+// argument.
+type exportDataset struct {
+	name  string
+	query string
+}
+
+// exportDatasets lists everything tied to a user. Trashed rows are included
+// since they are still the user's data. Names are denormalized so the files
+// read on their own.
+var exportDatasets = []exportDataset{
+	{"profile", `
+	SELECT id, username, email, created_at, updated_at, deleted_at
+	FROM users
+	WHERE id = ?`},
+	{"preferences", `
+	SELECT weight_unit, distance_unit, first_day_of_week, time_zone, plate_increment, e1rm_formula, weekly_report,
+		monthly_report, updated_at
+	FROM user_preferences
+	WHERE user_id = ?`},
+	{"workouts", `
+	SELECT id, name, description, forked_from, visibility, created_at, updated_at, deleted_at
+	FROM workouts
+	WHERE user_id = ?
+	ORDER BY id`},
+	{"workout_exercises", `
+	SELECT we.workout_id, w.name AS workout_name, we.exercise_id, e.name AS exercise_name, we.exercise_order,
+		we.sets, we.reps, we.weight AS weight_kg, we.duration_seconds, we.distance_meters, we.progression,
+		we.reps_min, we.reps_max, we.target_rpe, we.training_max AS training_max_kg
+	FROM workout_exercises we
+	JOIN workouts w ON w.id = we.workout_id
+	JOIN exercises e ON e.id = we.exercise_id
+	WHERE w.user_id = ?
+	ORDER BY we.workout_id, we.exercise_order`},
+	{"sessions", `
+	SELECT s.id, s.date, s.workout_id, w.name AS workout_name, s.workout_version, s.notes, s.created_at
+	FROM sessions s
+	JOIN workouts w ON w.id = s.workout_id
+	WHERE s.user_id = ?
+	ORDER BY s.date, s.id`},
+	{"progress", `
+	SELECT p.id, p.date, p.session_id, p.workout_id, w.name AS workout_name, p.exercise_id, e.name AS exercise_name,
+		p.sets, p.reps, p.weight AS weight_kg, p.duration_seconds, p.distance_meters, p.rpe, p.notes, p.created_at, p.deleted_at
+	FROM progress p
+	JOIN workouts w ON w.id = p.workout_id
+	JOIN exercises e ON e.id = p.exercise_id
+	WHERE p.user_id = ?
+	ORDER BY p.date, p.id`},
+	{"measurements", `
+	SELECT id, metric, value, date, notes, created_at, updated_at
+	FROM body_measurements
+	WHERE user_id = ?
+	ORDER BY date, id`},
+	{"goals", `
+	SELECT id, type, name, exercise_id, metric, target, weeks, start_value, start_date, deadline, status, achieved_on,
+		created_at, updated_at
+	FROM goals
+	WHERE user_id = ?
+	ORDER BY created_at, id`},
+	{"achievements", `
+	SELECT a.code, a.name, a.metric, a.threshold, ua.awarded_on
+	FROM user_achievements ua
+	JOIN achievements a ON a.id = ua.achievement_id
+	WHERE ua.user_id = ?
+	ORDER BY ua.awarded_on, a.id`},
+	{"photos", `
+	SELECT id, date, pose, notes, visibility, content_type, width, height, size, created_at, updated_at
+	FROM progress_photos
+	WHERE user_id = ?
+	ORDER BY date, id`},
+	{"activities", `
+	SELECT a.id, a.session_id, a.progress_id, a.exercise_id, e.name AS exercise_name, a.name, a.sport, a.format, a.filename,
+		a.started_at, a.elapsed_seconds, a.duration_seconds, a.distance_meters, a.elevation_gain, a.elevation_loss,
+		a.avg_heart_rate, a.max_heart_rate, a.sample_count, a.created_at
+	FROM activities a
+	JOIN exercises e ON e.id = a.exercise_id
+	WHERE a.user_id = ?
+	ORDER BY a.started_at, a.id`},
+}
+
+// ExportManifest describes the files in an export archive
+type ExportManifest struct {
+	FormatVersion int                  `json:"format_version"`
+	UserID        int                  `json:"user_id"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+	Units         map[string]string    `json:"units"`
+	Files         []ExportManifestFile `json:"files"`
+}
+
+// ExportManifestFile describes one dataset of an export archive
+type ExportManifestFile struct {
+	Name    string   `json:"name"`
+	JSON    string   `json:"json"`
+	CSV     string   `json:"csv"`
+	Rows    int      `json:"rows"`
+	Columns []string `json:"columns"`
+}
+
+// WriteUserExport writes a ZIP archive of everything tied to a user, with a
+// JSON and a CSV file per dataset and a manifest.json. Rows are streamed from
+// the database rather than loaded, and every dataset is read from the same
+// snapshot.
+func WriteUserExport(db *sql.DB, userID int, w io.Writer) error {
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	archive := zip.NewWriter(w)
+	manifest := ExportManifest{
+		FormatVersion: exportFormatVersion,
+		UserID:        userID,
+		GeneratedAt:   time.Now().UTC(),
+		Units:         map[string]string{"weight": "kg", "distance": "m", "duration": "s", "length": "cm"},
+	}
+
+	for _, dataset := range exportDatasets {
+		file := ExportManifestFile{Name: dataset.name, JSON: dataset.name + ".json", CSV: dataset.name + ".csv"}
+
+		// A zip entry must be finished before the next starts, so each
+		// dataset is queried once per format
+		if file.Columns, file.Rows, err = writeExportJSON(tx, archive, file.JSON, dataset.query, userID); err != nil {
+			return err
+		}
+		if err := writeExportCSV(tx, archive, file.CSV, dataset.query, userID); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// writeExportJSON writes a dataset as a JSON array of objects with the
+// columns in query order, returning the columns and row count
+func writeExportJSON(tx *sql.Tx, archive *zip.Writer, name, query string, userID int) ([]string, int, error) {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := bufio.NewWriter(entry)
+
+	count := 0
+	columns, err := streamExportRows(tx, query, userID, func(columns, types []string, values []interface{}) error {
+		if count == 0 {
+			out.WriteString("[\n  {")
+		} else {
+			out.WriteString(",\n  {")
+		}
+		for i, column := range columns {
+			if i > 0 {
+				out.WriteString(", ")
+			}
+			key, _ := json.Marshal(column)
+			out.Write(key)
+			out.WriteString(": ")
+			value, err := exportJSONValue(values[i], types[i])
+			if err != nil {
+				return err
+			}
+			out.Write(value)
+		}
+		out.WriteString("}")
+		count++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if count == 0 {
+		out.WriteString("[]\n")
+	} else {
+		out.WriteString("\n]\n")
+	}
+	return columns, count, out.Flush()
+}
+
+// writeExportCSV writes a dataset as CSV with a header row
+func writeExportCSV(tx *sql.Tx, archive *zip.Writer, name, query string, userID int) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	out := csv.NewWriter(entry)
+
+	header := false
+	columns, err := streamExportRows(tx, query, userID, func(columns, types []string, values []interface{}) error {
+		if !header {
+			if err := out.Write(columns); err != nil {
+				return err
+			}
+			header = true
+		}
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = exportCSVValue(value, types[i])
+		}
+		return out.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Empty datasets still get their header
+	if !header {
+		if err := out.Write(columns); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// streamExportRows calls each with every row of a dataset query in turn
+func streamExportRows(tx *sql.Tx, query string, userID int, each func(columns, types []string, values []interface{}) error) ([]string, error) {
+	rows, err := tx.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, len(columnTypes))
+	for i, columnType := range columnTypes {
+		types[i] = columnType.DatabaseTypeName()
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if err := each(columns, types, values); err != nil {
+			return nil, err
+		}
+	}
+
+	return columns, rows.Err()
+}
+
+// exportJSONValue encodes a scanned column value. Drivers return numeric
+// columns such as DECIMAL as text, so they are written as numbers by type.
+func exportJSONValue(value interface{}, dbType string) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		switch dbType {
+		case "DECIMAL", "INT", "BIGINT", "SMALLINT", "TINYINT", "FLOAT", "DOUBLE":
+			if _, err := strconv.ParseFloat(string(v), 64); err == nil {
+				return v, nil
+			}
+		}
+		return json.Marshal(string(v))
+	case time.Time:
+		return json.Marshal(exportCSVValue(v, dbType))
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// exportCSVValue formats a scanned column value for CSV, leaving NULL empty.
+// Dates are written as YYYY-MM-DD and timestamps as RFC 3339 in UTC.
+func exportCSVValue(value interface{}, dbType string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		if dbType == "DATE" {
+			return v.Format("2006-01-02")
+		}
+		return v.UTC().Format(time.RFC3339)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,597 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+// Goal types
+const (
+	GoalLoad        = "load"
+	GoalE1RM        = "e1rm"
+	GoalFrequency   = "frequency"
+	GoalVolume      = "volume"
+	GoalMeasurement = "measurement"
+)
+
+// Goal statuses. Active goals become achieved when their target is reached
+// by the deadline, or missed when the deadline passes first.
+const (
+	GoalActive   = "active"
+	GoalAchieved = "achieved"
+	GoalMissed   = "missed"
+)
+
+const (
+	// DefaultGoalWeeks is how many weeks in a row a frequency goal must be
+	// met when it doesn't say
+	DefaultGoalWeeks = 4
+
+	// goalTrendDays is how far back the trend used for projections reaches
+	goalTrendDays = 56
+
+	// goalMaxProjectionDays is the furthest out a completion is projected;
+	// trends slower than that don't get a projection
+	goalMaxProjectionDays = 3650
+)
+
+// UnitSessionsPerWeek is the unit of frequency goal targets
+const UnitSessionsPerWeek = "sessions/week"
+
+// IsValidGoalType reports whether t is a supported goal type
+func IsValidGoalType(t string) bool {
+	switch t {
+	case GoalLoad, GoalE1RM, GoalFrequency, GoalVolume, GoalMeasurement:
+		return true
+	}
+	return false
+}
+
+// Goal is a target a user sets for themselves, optionally by a deadline:
+//   - load and e1rm: lifting Target kilograms, or estimating it as a one-rep
+//     max, in an exercise
+//   - frequency: training Target sessions a week for Weeks weeks in a row
+//   - volume: moving Target kilograms in total from the start date, in one
+//     exercise or across all of them
+//   - measurement: bringing a body metric to Target, down or up from
+//     StartValue
+//
+// Progress is computed from the user's training and measurements whenever
+// the goal is read.
+type Goal struct {
+	ID         int          `json:"id"`
+	UserID     int          `json:"user_id"`
+	Type       string       `json:"type"`
+	Name       string       `json:"name"`
+	ExerciseID int          `json:"exercise_id,omitempty"`
+	Metric     string       `json:"metric,omitempty"`
+	Target     float64      `json:"target"`
+	Weeks      int          `json:"weeks,omitempty"`
+	Unit       string       `json:"unit"`
+	StartValue float64      `json:"start_value"`
+	StartDate  time.Time    `json:"start_date"`
+	Deadline   *time.Time   `json:"deadline,omitempty"`
+	Status     string       `json:"status"`
+	AchievedOn *time.Time   `json:"achieved_on,omitempty"`
+	Progress   GoalProgress `json:"progress"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// GoalProgress is how far a goal has come. Current is in the goal's unit,
+// except for frequency goals, where it is the number of weeks in a row the
+// target has been met. ProjectedOn extrapolates the recent trend; OnTrack
+// says whether that is by the deadline.
+type GoalProgress struct {
+	Current          float64    `json:"current"`
+	Percent          float64    `json:"percent"`
+	SessionsThisWeek *int       `json:"sessions_this_week,omitempty"`
+	ProjectedOn      *time.Time `json:"projected_on,omitempty"`
+	OnTrack          *bool      `json:"on_track,omitempty"`
+	DaysLeft         *int       `json:"days_left,omitempty"`
+}
+
+// CreateGoalTable creates the goals table if it doesn't exist
+func CreateGoalTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS goals (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		type VARCHAR(20) NOT NULL,
+		name VARCHAR(100) NOT NULL DEFAULT '',
+		exercise_id INT NULL,
+		metric VARCHAR(20) NOT NULL DEFAULT '',
+		target DECIMAL(14,2) NOT NULL,
+		weeks INT NOT NULL DEFAULT 0,
+		start_value DECIMAL(14,2) NOT NULL DEFAULT 0,
+		start_date DATE NOT NULL,
+		deadline DATE NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'active',
+		achieved_on DATE NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_goals_user_status (user_id, status),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// GoalUnit returns the unit a goal's target is expressed in for u
+func GoalUnit(g Goal, u Units) string {
+	switch g.Type {
+	case GoalFrequency:
+		return UnitSessionsPerWeek
+	case GoalMeasurement:
+		return MetricUnit(g.Metric, u)
+	}
+	return u.Weight
+}
+
+// GoalToCanonical converts a target given in unit into the goal's storage
+// unit
+func GoalToCanonical(g Goal, value float64, unit string) (float64, error) {
+	switch g.Type {
+	case GoalFrequency:
+		return value, nil
+	case GoalMeasurement:
+		return MeasurementToCanonical(g.Metric, value, unit)
+	}
+	if !IsValidWeightUnit(unit) {
+		return 0, errors.New("unknown weight unit: " + unit)
+	}
+	return Units{Weight: unit}.WeightToKg(value), nil
+}
+
+// InUnits returns a copy of the goal expressed in u
+func (g Goal) InUnits(u Units) Goal {
+	g.Unit = GoalUnit(g, u)
+	convert := func(v float64) float64 {
+		switch g.Type {
+		case GoalFrequency:
+			return v
+		case GoalMeasurement:
+			return measurementFromCanonical(g.Metric, v, u)
+		}
+		return RoundWeight(u.WeightFromKg(v))
+	}
+	g.Target = convert(g.Target)
+	g.StartValue = convert(g.StartValue)
+	if g.Type != GoalFrequency {
+		g.Progress.Current = convert(g.Progress.Current)
+	}
+	return g
+}
+
+// goalSelect selects the columns scanned by scanGoal
+const goalSelect = `
+	SELECT id, user_id, type, name, COALESCE(exercise_id, 0), metric, target, weeks, start_value, start_date, deadline,
+		status, achieved_on, created_at, updated_at
+	FROM goals`
+
+// scanGoal scans a goal selected with goalSelect
+func scanGoal(row interface{ Scan(...interface{}) error }) (Goal, error) {
+	var g Goal
+	var deadline, achievedOn sql.NullTime
+	err := row.Scan(&g.ID, &g.UserID, &g.Type, &g.Name, &g.ExerciseID, &g.Metric, &g.Target, &g.Weeks, &g.StartValue, &g.StartDate,
+		&deadline, &g.Status, &achievedOn, &g.CreatedAt, &g.UpdatedAt)
+	if deadline.Valid {
+		g.Deadline = &deadline.Time
+	}
+	if achievedOn.Valid {
+		g.AchievedOn = &achievedOn.Time
+	}
+	return g, err
+}
+
+// CreateGoal creates a goal, returning its ID
+func CreateGoal(db *sql.DB, g Goal) (int, error) {
+	query := `
+	INSERT INTO goals (user_id, type, name, exercise_id, metric, target, weeks, start_value, start_date, deadline, status)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, g.UserID, g.Type, g.Name, nullableID(g.ExerciseID), g.Metric, g.Target, g.Weeks,
+		g.StartValue, g.StartDate, g.Deadline, GoalActive)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetGoal retrieves a user's goal by ID
+func GetGoal(db *sql.DB, id, userID int) (Goal, error) {
+	query := goalSelect + " WHERE id = ? AND user_id = ?"
+	return scanGoal(db.QueryRow(query, id, userID))
+}
+
+// GetUserGoals retrieves a user's goals, optionally only those with a
+// status, newest first
+func GetUserGoals(db *sql.DB, userID int, status string) ([]Goal, error) {
+	query := goalSelect + " WHERE user_id = ?"
+	args := []interface{}{userID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+
+	return goals, rows.Err()
+}
+
+// UpdateGoal updates the name, target, weeks and deadline of a user's goal
+func UpdateGoal(db *sql.DB, g Goal) error {
+	query := "UPDATE goals SET name = ?, target = ?, weeks = ?, deadline = ? WHERE id = ? AND user_id = ?"
+	_, err := db.Exec(query, g.Name, g.Target, g.Weeks, g.Deadline, g.ID, g.UserID)
+	return err
+}
+
+// DeleteGoal deletes a user's goal
+func DeleteGoal(db *sql.DB, id, userID int) error {
+	_, err := db.Exec("DELETE FROM goals WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// GoalStartValue returns where a new goal starts from: the best load or
+// e1RM lifted so far, or the latest measurement. ok is false when a
+// measurement goal has nothing to start from.
+func GoalStartValue(db *sql.DB, g Goal, formula string) (value float64, ok bool, err error) {
+	switch g.Type {
+	case GoalLoad, GoalE1RM:
+		days, err := dailyBests(db, g, formula, time.Time{})
+		if err != nil {
+			return 0, false, err
+		}
+		best := 0.0
+		for _, day := range days {
+			best = math.Max(best, day.Value)
+		}
+		return best, true, nil
+	case GoalMeasurement:
+		days, err := dailyMeasurements(db, g, time.Time{})
+		if err != nil || len(days) == 0 {
+			return 0, false, err
+		}
+		return days[len(days)-1].Value, true, nil
+	}
+	return 0, true, nil
+}
+
+// EvaluateGoal computes a goal's progress as of the user's today and works
+// out its status, saving the status and achievement date when they change.
+// Editing a goal or the history behind it can move it between statuses.
+func EvaluateGoal(db *sql.DB, g Goal, prefs Preferences) (Goal, error) {
+	today := prefs.Today()
+	stored := g.AchievedOn
+	g.AchievedOn = nil
+
+	var err error
+	switch g.Type {
+	case GoalLoad, GoalE1RM:
+		err = evaluateLiftGoal(db, &g, prefs.E1RMFormula, today)
+	case GoalMeasurement:
+		err = evaluateMeasurementGoal(db, &g, today)
+	case GoalVolume:
+		err = evaluateVolumeGoal(db, &g, today)
+	case GoalFrequency:
+		err = evaluateFrequencyGoal(db, &g, today, prefs.WeekStart())
+	}
+	if err != nil {
+		return g, err
+	}
+
+	// Work out the status from the achievement date and the deadline
+	status := GoalActive
+	switch {
+	case g.AchievedOn != nil && (g.Deadline == nil || !g.AchievedOn.After(*g.Deadline)):
+		status = GoalAchieved
+		g.Progress.Percent = 100
+	case g.Deadline != nil && g.Deadline.Before(today):
+		status = GoalMissed
+	}
+	g.Progress.Percent = math.Round(math.Max(0, math.Min(100, g.Progress.Percent))*10) / 10
+
+	if status == GoalActive {
+		if g.Deadline != nil {
+			daysLeft := int(g.Deadline.Sub(today).Hours() / 24)
+			onTrack := g.Progress.ProjectedOn != nil && !g.Progress.ProjectedOn.After(*g.Deadline)
+			g.Progress.DaysLeft, g.Progress.OnTrack = &daysLeft, &onTrack
+		}
+	} else {
+		g.Progress.ProjectedOn = nil
+	}
+
+	var achievedOn interface{}
+	if g.AchievedOn != nil {
+		achievedOn = *g.AchievedOn
+	}
+	if status != g.Status || !sameDate(g.AchievedOn, stored) {
+		if _, err := db.Exec("UPDATE goals SET status = ?, achieved_on = ? WHERE id = ?", status, achievedOn, g.ID); err != nil {
+			return g, err
+		}
+	}
+	g.Status = status
+	return g, nil
+}
+
+// evaluateLiftGoal tracks the best load or e1RM of the goal's exercise
+func evaluateLiftGoal(db *sql.DB, g *Goal, formula string, today time.Time) error {
+	days, err := dailyBests(db, *g, formula, time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		g.Progress.Current = math.Max(g.Progress.Current, day.Value)
+		if g.AchievedOn == nil && !day.Date.Before(g.StartDate) && day.Value >= g.Target {
+			date := day.Date
+			g.AchievedOn = &date
+		}
+	}
+	g.Progress.Percent = towards(g.StartValue, g.Progress.Current, g.Target)
+
+	recent := pointsSince(days, today.AddDate(0, 0, -goalTrendDays))
+	g.Progress.ProjectedOn = projectTrend(recent, g.Progress.Current, g.Target, today)
+	return nil
+}
+
+// evaluateMeasurementGoal tracks the latest measurement of the goal's
+// metric, down or up towards the target
+func evaluateMeasurementGoal(db *sql.DB, g *Goal, today time.Time) error {
+	days, err := dailyMeasurements(db, *g, time.Time{})
+	if err != nil {
+		return err
+	}
+	g.Progress.Current = g.StartValue
+	if len(days) > 0 {
+		g.Progress.Current = days[len(days)-1].Value
+	}
+
+	down := g.Target < g.StartValue
+	for _, day := range days {
+		if day.Date.Before(g.StartDate) {
+			continue
+		}
+		if down && day.Value <= g.Target || !down && day.Value >= g.Target {
+			date := day.Date
+			g.AchievedOn = &date
+			break
+		}
+	}
+	g.Progress.Percent = towards(g.StartValue, g.Progress.Current, g.Target)
+
+	recent := pointsSince(days, today.AddDate(0, 0, -goalTrendDays/2))
+	g.Progress.ProjectedOn = projectTrend(recent, g.Progress.Current, g.Target, today)
+	return nil
+}
+
+// evaluateVolumeGoal tracks the volume moved since the start date, from the
+// analytics rollups
+func evaluateVolumeGoal(db *sql.DB, g *Goal, today time.Time) error {
+	query := "SELECT date, SUM(volume) FROM progress_daily_rollups WHERE user_id = ? AND date >= ?"
+	args := []interface{}{g.UserID, g.StartDate}
+	if g.ExerciseID != 0 {
+		query += " AND exercise_id = ?"
+		args = append(args, g.ExerciseID)
+	}
+	query += " GROUP BY date ORDER BY date"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	recentFrom := today.AddDate(0, 0, -(goalTrendDays/2 - 1))
+	recent := 0.0
+	for rows.Next() {
+		var date time.Time
+		var volume float64
+		if err := rows.Scan(&date, &volume); err != nil {
+			return err
+		}
+		g.Progress.Current += volume
+		if g.AchievedOn == nil && g.Progress.Current >= g.Target {
+			g.AchievedOn = &date
+		}
+		if !date.Before(recentFrom) {
+			recent += volume
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	g.Progress.Percent = towards(0, g.Progress.Current, g.Target)
+
+	// Project at the average daily volume of the recent weeks, or of the
+	// days since the goal started if that is shorter
+	if recentFrom.Before(g.StartDate) {
+		recentFrom = g.StartDate
+	}
+	if days := today.Sub(recentFrom).Hours()/24 + 1; recent > 0 && days > 0 {
+		g.Progress.ProjectedOn = projectRate(g.Target-g.Progress.Current, recent/days, today)
+	}
+	return nil
+}
+
+// evaluateFrequencyGoal counts the weeks in a row, from the start date, in
+// which the user trained at least the target number of sessions. The week
+// in progress breaks the streak only once it is over.
+func evaluateFrequencyGoal(db *sql.DB, g *Goal, today time.Time, weekStart time.Weekday) error {
+	firstWeek := BucketStart(BucketWeek, g.StartDate, weekStart)
+	dates, err := sessionDates(db, g.UserID, firstWeek, today)
+	if err != nil {
+		return err
+	}
+
+	perWeek := map[time.Time][]time.Time{}
+	for _, date := range dates {
+		week := BucketStart(BucketWeek, date, weekStart)
+		perWeek[week] = append(perWeek[week], date)
+	}
+
+	target := int(math.Ceil(g.Target))
+	thisWeek := BucketStart(BucketWeek, today, weekStart)
+	streak := 0
+	for week := firstWeek; !week.After(thisWeek); week = week.AddDate(0, 0, 7) {
+		sessions := perWeek[week]
+		if len(sessions) >= target {
+			streak++
+			if g.AchievedOn == nil && streak == g.Weeks {
+				date := sessions[target-1]
+				g.AchievedOn = &date
+			}
+		} else if week.Before(thisWeek) {
+			streak = 0
+		}
+	}
+
+	done := len(perWeek[thisWeek])
+	g.Progress.Current = float64(streak)
+	g.Progress.SessionsThisWeek = &done
+	g.Progress.Percent = towards(0, float64(streak), float64(g.Weeks))
+
+	// If every week from now on meets the target, the streak completes at
+	// the end of the week that brings it to the required length
+	remaining := g.Weeks - streak
+	if done >= target {
+		remaining++
+	}
+	if remaining > 0 {
+		projected := thisWeek.AddDate(0, 0, 7*remaining-1)
+		g.Progress.ProjectedOn = &projected
+	}
+	return nil
+}
+
+// dailyBests returns the best load, or e1RM, lifted in a goal's exercise on
+// each day since from, oldest first
+func dailyBests(db *sql.DB, g Goal, formula string, from time.Time) ([]TrendPoint, error) {
+	query := `
+	SELECT date, weight, reps
+	FROM progress
+	WHERE user_id = ? AND exercise_id = ? AND deleted_at IS NULL AND weight > 0 AND reps > 0 AND date >= ?
+	ORDER BY date`
+	rows, err := db.Query(query, g.UserID, g.ExerciseID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []TrendPoint
+	for rows.Next() {
+		var date time.Time
+		var weight float64
+		var reps int
+		if err := rows.Scan(&date, &weight, &reps); err != nil {
+			return nil, err
+		}
+		value := weight
+		if g.Type == GoalE1RM {
+			value = E1RM(formula, weight, reps)
+		}
+		if n := len(days); n > 0 && days[n-1].Date.Equal(date) {
+			days[n-1].Value = math.Max(days[n-1].Value, value)
+			continue
+		}
+		days = append(days, TrendPoint{Date: date, Value: value})
+	}
+
+	return days, rows.Err()
+}
+
+// dailyMeasurements returns a goal's metric averaged per day since from,
+// oldest first
+func dailyMeasurements(db *sql.DB, g Goal, from time.Time) ([]TrendPoint, error) {
+	query := `
+	SELECT date, AVG(value)
+	FROM body_measurements
+	WHERE user_id = ? AND metric = ? AND date >= ?
+	GROUP BY date
+	ORDER BY date`
+	rows, err := db.Query(query, g.UserID, g.Metric, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []TrendPoint
+	for rows.Next() {
+		var day TrendPoint
+		if err := rows.Scan(&day.Date, &day.Value); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
+
+// pointsSince returns the points on or after from
+func pointsSince(points []TrendPoint, from time.Time) []TrendPoint {
+	for i, p := range points {
+		if !p.Date.Before(from) {
+			return points[i:]
+		}
+	}
+	return nil
+}
+
+// projectTrend projects when current reaches target at the least-squares
+// trend of the points, or nil when the trend doesn't head there
+func projectTrend(points []TrendPoint, current, target float64, today time.Time) *time.Time {
+	perDay := weeklySlope(points) / 7
+	if perDay == 0 || (target-current)/perDay < 0 {
+		return nil
+	}
+	return projectRate(math.Abs(target-current), math.Abs(perDay), today)
+}
+
+// projectRate projects when remaining is covered at rate per day, or nil
+// when that is too far out to be meaningful
+func projectRate(remaining, rate float64, today time.Time) *time.Time {
+	if remaining <= 0 {
+		return &today
+	}
+	days := math.Ceil(remaining / rate)
+	if days > goalMaxProjectionDays {
+		return nil
+	}
+	projected := today.AddDate(0, 0, int(days))
+	return &projected
+}
+
+// sameDate reports whether two optional dates are the same day
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+// towards returns how far current has come from start to target, as a
+// percentage
+func towards(start, current, target float64) float64 {
+	if target == start {
+		return 100
+	}
+	return (current - start) / (target - start) * 100
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// icalLineLimit is the maximum line length in octets before folding
+const icalLineLimit = 75
+
+// ICalEvent is one VEVENT of an iCalendar feed. Events without a Start time
+// are all-day events on Date.
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Date        time.Time
+	Start       time.Time
+	Duration    time.Duration
+}
+
+// WriteICal writes events as an iCalendar (RFC 5545) document
+func WriteICal(w io.Writer, name string, events []ICalEvent) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) {
+		// Fold long lines, continuing with a leading space
+		for len(s) > icalLineLimit {
+			cut := icalLineLimit
+			for cut > 0 && !isRuneStart(s[cut]) {
+				cut--
+			}
+			bw.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		bw.WriteString(s + "\r\n")
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Workout App//Training Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + icalEscape(name))
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.UID)
+		line("DTSTAMP:" + stamp)
+		if event.Start.IsZero() {
+			line("DTSTART;VALUE=DATE:" + event.Date.Format("20060102"))
+			line("DTEND;VALUE=DATE:" + event.Date.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			line("DTSTART:" + event.Start.UTC().Format("20060102T150405Z"))
+			line("DTEND:" + event.Start.Add(event.Duration).UTC().Format("20060102T150405Z"))
+		}
+		line("SUMMARY:" + icalEscape(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + icalEscape(event.Description))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// icalEscape escapes text property values
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// isRuneStart reports whether b begins a UTF-8 sequence, so folding never
+// splits a character
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,352 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxImageSize is the largest image upload accepted, in bytes
+const MaxImageSize = 15 << 20
+
+const (
+	// maxImagePixels guards against images that are small files but decode
+	// into huge bitmaps
+	maxImagePixels = 50_000_000
+
+	// imageMaxEdge is the longest side images are stored at
+	imageMaxEdge = 4096
+
+	// thumbnailEdge is the longest side of thumbnails
+	thumbnailEdge = 320
+
+	imageJPEGQuality     = 90
+	thumbnailJPEGQuality = 80
+
+	// maxAnimationPixels bounds the frames of an animated GIF together,
+	// and maxAnimationFramePixels each frame
+	maxAnimationPixels      = 100_000_000
+	maxAnimationFramePixels = 4_000_000
+)
+
+// ProcessedImage is an uploaded image cleaned up for storage, with its
+// thumbnail
+type ProcessedImage struct {
+	ContentType   string
+	Image         []byte
+	Width         int
+	Height        int
+	Thumbnail     []byte
+	ThumbnailType string
+}
+
+// ProcessImage checks an uploaded image and prepares it for storage. The type
+// is sniffed from the content rather than trusted from the upload, and only
+// JPEG and PNG are accepted. The image is decoded and encoded again, which
+// drops EXIF and any other metadata such as GPS position, after turning it
+// upright as its EXIF orientation says. Images larger than imageMaxEdge are
+// scaled down.
+func ProcessImage(data []byte) (ProcessedImage, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return ProcessedImage{}, errors.New("unsupported image type " + contentType + "; upload a JPEG or PNG")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ProcessedImage{}, errors.New("the image could not be read")
+	}
+	if config.Width == 0 || config.Height == 0 || config.Width*config.Height > maxImagePixels {
+		return ProcessedImage{}, errors.New("images are limited to 50 megapixels")
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ProcessedImage{}, errors.New("the image could not be read")
+	}
+
+	// Work on a plain RGBA copy, which drawing converts to quickly from
+	// whatever the decoder produced
+	img := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	if contentType == "image/jpeg" {
+		img = orientImage(img, jpegOrientation(data))
+	}
+	img = fitImage(img, imageMaxEdge)
+
+	processed := ProcessedImage{ContentType: contentType, Width: img.Bounds().Dx(), Height: img.Bounds().Dy(), ThumbnailType: contentType}
+	if processed.Image, err = encodeImage(img, contentType, imageJPEGQuality); err != nil {
+		return ProcessedImage{}, err
+	}
+	if processed.Thumbnail, err = encodeImage(fitImage(img, thumbnailEdge), contentType, thumbnailJPEGQuality); err != nil {
+		return ProcessedImage{}, err
+	}
+	return processed, nil
+}
+
+// ProcessAnimation checks an uploaded animated GIF and prepares it for
+// storage like ProcessImage. The frames are decoded and encoded again, which
+// keeps their timing and looping but drops comments and application data;
+// the thumbnail is the first frame, as a PNG.
+func ProcessAnimation(data []byte) (ProcessedImage, error) {
+	if contentType := http.DetectContentType(data); contentType != "image/gif" {
+		return ProcessedImage{}, errors.New("unsupported animation type " + contentType + "; upload a GIF")
+	}
+
+	// Count the frames before decoding, since every frame is kept in memory
+	config, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ProcessedImage{}, errors.New("the animation could not be read")
+	}
+	frames, err := gifFrameCount(data)
+	if err != nil {
+		return ProcessedImage{}, errors.New("the animation could not be read")
+	}
+	pixels := config.Width * config.Height
+	if pixels == 0 || pixels > maxAnimationFramePixels || frames*pixels > maxAnimationPixels {
+		return ProcessedImage{}, errors.New("animations are limited to 4 megapixels and 100 megapixels over all frames")
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(anim.Image) == 0 {
+		return ProcessedImage{}, errors.New("the animation could not be read")
+	}
+
+	processed := ProcessedImage{ContentType: "image/gif", Width: anim.Config.Width, Height: anim.Config.Height, ThumbnailType: "image/png"}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return ProcessedImage{}, err
+	}
+	processed.Image = buf.Bytes()
+
+	// Frames can cover part of the canvas, so draw the first one in place
+	first := image.NewRGBA(image.Rect(0, 0, anim.Config.Width, anim.Config.Height))
+	draw.Draw(first, anim.Image[0].Bounds(), anim.Image[0], anim.Image[0].Bounds().Min, draw.Over)
+	if processed.Thumbnail, err = encodeImage(fitImage(first, thumbnailEdge), "image/png", 0); err != nil {
+		return ProcessedImage{}, err
+	}
+	return processed, nil
+}
+
+// gifFrameCount counts the frames of a GIF by walking its blocks without
+// decoding them
+func gifFrameCount(data []byte) (int, error) {
+	truncated := errors.New("truncated GIF")
+	if len(data) < 13 {
+		return 0, truncated
+	}
+
+	// Skip the header, the logical screen descriptor and the global color
+	// table
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks moves past a chain of data sub-blocks
+	skipSubBlocks := func() error {
+		for {
+			if i >= len(data) {
+				return truncated
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return nil
+			}
+			i += size
+		}
+	}
+
+	frames := 0
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension
+			i += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return 0, truncated
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++ // LZW minimum code size
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errors.New("invalid GIF block")
+		}
+	}
+	return frames, nil
+}
+
+// encodeImage encodes an image in the given type. The encoders write no
+// metadata.
+func encodeImage(img image.Image, contentType string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	return buf.Bytes(), err
+}
+
+// fitImage scales an image down so its longest side is at most edge,
+// averaging the source pixels behind each output pixel. Smaller images are
+// returned as they are.
+func fitImage(src *image.RGBA, edge int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= edge && sh <= edge {
+		return src
+	}
+
+	dw, dh := edge, edge
+	if sw >= sh {
+		dh = max(1, sh*edge/sw)
+	} else {
+		dw = max(1, sw*edge/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, max((dy+1)*sh/dh, dy*sh/dh+1)
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, max((dx+1)*sw/dw, dx*sw/dw+1)
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4 : x*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			o := dst.Pix[dy*dst.Stride+dx*4:]
+			o[0], o[1], o[2], o[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// orientImage applies the transform an EXIF orientation of 1 to 8 calls for
+// to display an image upright. Orientations 5 to 8 swap width and height.
+func orientImage(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror
+				sx, sy = w-1-x, y
+			case 3: // half turn
+				sx, sy = w-1-x, h-1-y
+			case 4: // flip
+				sx, sy = x, h-1-y
+			case 5: // mirror across the main diagonal
+				sx, sy = y, x
+			case 6: // quarter turn clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirror across the other diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // quarter turn counterclockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation of a JPEG, or 1 if it has none
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the segments before the image data looking for the EXIF APP1
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag of the first IFD of a TIFF
+// structure, as found in EXIF
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// Orientation is tag 0x0112, a SHORT stored in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,733 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// Import statuses. An uploaded file waits as pending until it has been read
+// and its exercise names matched. Names that couldn't be matched with
+// confidence hold the import in review until the user resolves them; then it
+// is queued and imported row by row.
+const (
+	ImportPending   = "pending"
+	ImportReading   = "reading"
+	ImportReview    = "review"
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// How an imported exercise name is resolved: logged against a catalog
+// exercise, against a new exercise created with that name, or not at all
+const (
+	MappingMatch  = "match"
+	MappingCreate = "create"
+	MappingSkip   = "skip"
+)
+
+// Outcomes of an import row
+const (
+	RowImported  = "imported"
+	RowDuplicate = "duplicate"
+	RowSkipped   = "skipped"
+	RowError     = "error"
+)
+
+// An import that has been reading or running without a heartbeat for
+// importStaleAfter is assumed to have died with its server and is picked up
+// again where it left off. The heartbeat is written every
+// importHeartbeatRows rows.
+const (
+	importStaleAfter    = 10 * time.Minute
+	importHeartbeatRows = 200
+)
+
+// MaxImportSize is the largest import file accepted
+const MaxImportSize = 32 << 20
+
+// Import is a file of training history from another app being imported into
+// a user's progress
+type Import struct {
+	ID          int            `json:"id"`
+	UserID      int            `json:"user_id"`
+	Format      string         `json:"format"`
+	Filename    string         `json:"filename"`
+	Options     ImportOptions  `json:"options"`
+	Status      string         `json:"status"`
+	Error       string         `json:"error,omitempty"`
+	TotalRows   int            `json:"total_rows"`
+	Summary     map[string]int `json:"summary"`
+	CreatedAt   time.Time      `json:"created_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// ImportExercise is an exercise name found in an import file and how it is
+// resolved. Unresolved names have no action and may carry a suggestion.
+type ImportExercise struct {
+	Name                string  `json:"name"`
+	Rows                int     `json:"rows"`
+	Action              string  `json:"action"`
+	ExerciseID          *int    `json:"exercise_id,omitempty"`
+	SuggestedExerciseID *int    `json:"suggested_exercise_id,omitempty"`
+	SuggestedName       string  `json:"suggested_name,omitempty"`
+	Score               float64 `json:"score"`
+	TrackingType        string  `json:"tracking_type"`
+}
+
+// ImportRowReport is the outcome of one row of an import file
+type ImportRowReport struct {
+	Row        int    `json:"row"`
+	Status     string `json:"status"`
+	Exercise   string `json:"exercise"`
+	Message    string `json:"message,omitempty"`
+	ProgressID *int   `json:"progress_id,omitempty"`
+}
+
+// CreateImportTables creates the imports, import_exercises and import_rows
+// tables if they don't exist
+func CreateImportTables(db *sql.DB) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS imports (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		format VARCHAR(10) NOT NULL,
+		filename VARCHAR(255) NOT NULL DEFAULT '',
+		options JSON NOT NULL,
+		status VARCHAR(10) NOT NULL DEFAULT 'pending',
+		error TEXT,
+		data LONGBLOB,
+		total_rows INT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		heartbeat_at TIMESTAMP NULL,
+		completed_at TIMESTAMP NULL,
+		INDEX idx_imports_status (status),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`, `
+	CREATE TABLE IF NOT EXISTS import_exercises (
+		import_id INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		row_count INT NOT NULL DEFAULT 0,
+		action VARCHAR(10) NOT NULL DEFAULT '',
+		exercise_id INT NULL,
+		suggested_exercise_id INT NULL,
+		score DECIMAL(4,3) NOT NULL DEFAULT 0,
+		tracking_type VARCHAR(30) NOT NULL DEFAULT 'reps_load',
+		PRIMARY KEY (import_id, name),
+		FOREIGN KEY (import_id) REFERENCES imports(id) ON DELETE CASCADE,
+		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE SET NULL,
+		FOREIGN KEY (suggested_exercise_id) REFERENCES exercises(id) ON DELETE SET NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS import_rows (
+		import_id INT NOT NULL,
+		line INT NOT NULL,
+		status VARCHAR(10) NOT NULL,
+		exercise_name VARCHAR(255) NOT NULL DEFAULT '',
+		message VARCHAR(255) NOT NULL DEFAULT '',
+		progress_id INT NULL,
+		PRIMARY KEY (import_id, line),
+		FOREIGN KEY (import_id) REFERENCES imports(id) ON DELETE CASCADE,
+		FOREIGN KEY (progress_id) REFERENCES progress(id) ON DELETE SET NULL
+	);`}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importSelect selects the columns scanned by scanImport
+const importSelect = `
+	SELECT id, user_id, format, filename, options, status, COALESCE(error, ''), total_rows, created_at, completed_at
+	FROM imports`
+
+// scanImport scans an import selected with importSelect
+func scanImport(row interface{ Scan(...interface{}) error }) (Import, error) {
+	var imp Import
+	var options []byte
+	var completedAt sql.NullTime
+	if err := row.Scan(&imp.ID, &imp.UserID, &imp.Format, &imp.Filename, &options, &imp.Status, &imp.Error,
+		&imp.TotalRows, &imp.CreatedAt, &completedAt); err != nil {
+		return imp, err
+	}
+	if completedAt.Valid {
+		imp.CompletedAt = &completedAt.Time
+	}
+	return imp, json.Unmarshal(options, &imp.Options)
+}
+
+// CreateImport stores an uploaded file for the background job to read
+func CreateImport(db *sql.DB, userID int, format, filename string, options ImportOptions, data []byte) (int, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "INSERT INTO imports (user_id, format, filename, options, status, data) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, userID, format, filename, encoded, ImportPending, data)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetImport retrieves one of a user's imports with a count of its rows by
+// outcome
+func GetImport(db *sql.DB, id, userID int) (Import, error) {
+	imp, err := scanImport(db.QueryRow(importSelect+" WHERE id = ? AND user_id = ?", id, userID))
+	if err != nil {
+		return imp, err
+	}
+
+	rows, err := db.Query("SELECT status, COUNT(*) FROM import_rows WHERE import_id = ? GROUP BY status", id)
+	if err != nil {
+		return imp, err
+	}
+	defer rows.Close()
+
+	imp.Summary = map[string]int{RowImported: 0, RowDuplicate: 0, RowSkipped: 0, RowError: 0}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return imp, err
+		}
+		imp.Summary[status] = count
+	}
+
+	return imp, rows.Err()
+}
+
+// GetUserImports retrieves a user's imports, newest first
+func GetUserImports(db *sql.DB, userID int) ([]Import, error) {
+	rows, err := db.Query(importSelect+" WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports := []Import{}
+	for rows.Next() {
+		imp, err := scanImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+
+	return imports, rows.Err()
+}
+
+// GetImportExercises retrieves the exercise names of an import in order of
+// how often they occur
+func GetImportExercises(db *sql.DB, importID int) ([]ImportExercise, error) {
+	query := `
+	SELECT ie.name, ie.row_count, ie.action, ie.exercise_id, ie.suggested_exercise_id, COALESCE(e.name, ''), ie.score, ie.tracking_type
+	FROM import_exercises ie
+	LEFT JOIN exercises e ON e.id = ie.suggested_exercise_id
+	WHERE ie.import_id = ?
+	ORDER BY ie.row_count DESC, ie.name`
+	rows, err := db.Query(query, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []ImportExercise{}
+	for rows.Next() {
+		var exercise ImportExercise
+		var exerciseID, suggestedID sql.NullInt64
+		if err := rows.Scan(&exercise.Name, &exercise.Rows, &exercise.Action, &exerciseID, &suggestedID,
+			&exercise.SuggestedName, &exercise.Score, &exercise.TrackingType); err != nil {
+			return nil, err
+		}
+		if exerciseID.Valid {
+			id := int(exerciseID.Int64)
+			exercise.ExerciseID = &id
+		}
+		if suggestedID.Valid {
+			id := int(suggestedID.Int64)
+			exercise.SuggestedExerciseID = &id
+		}
+		exercises = append(exercises, exercise)
+	}
+
+	return exercises, rows.Err()
+}
+
+// ResolveImportExercise decides how an exercise name of an import is logged.
+// exerciseID is used with MappingMatch and trackingType with MappingCreate.
+func ResolveImportExercise(db *sql.DB, importID int, name, action string, exerciseID int, trackingType string) error {
+	query := "UPDATE import_exercises SET action = ?, exercise_id = ?, tracking_type = COALESCE(NULLIF(?, ''), tracking_type) WHERE import_id = ? AND name = ?"
+	result, err := db.Exec(query, action, nullableID(exerciseID), trackingType, importID, name)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err == nil && affected == 0 {
+		var exists int
+		err = db.QueryRow("SELECT 1 FROM import_exercises WHERE import_id = ? AND name = ?", importID, name).Scan(&exists)
+	}
+	return err
+}
+
+// QueueImport starts importing the rows of an import whose names have all
+// been resolved
+func QueueImport(db *sql.DB, id int) error {
+	_, err := db.Exec("UPDATE imports SET status = ? WHERE id = ? AND status = ?", ImportQueued, id, ImportReview)
+	return err
+}
+
+// GetImportRows retrieves the per-row report of an import, optionally only
+// the rows with one outcome
+func GetImportRows(db *sql.DB, importID int, status string) ([]ImportRowReport, error) {
+	query := "SELECT line, status, exercise_name, message, progress_id FROM import_rows WHERE import_id = ?"
+	args := []interface{}{importID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY line"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []ImportRowReport{}
+	for rows.Next() {
+		var report ImportRowReport
+		var progressID sql.NullInt64
+		if err := rows.Scan(&report.Row, &report.Status, &report.Exercise, &report.Message, &progressID); err != nil {
+			return nil, err
+		}
+		if progressID.Valid {
+			id := int(progressID.Int64)
+			report.ProgressID = &id
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// ClaimImport takes the oldest import with work to do, marking it as being
+// read or run, or returns sql.ErrNoRows when there is none. Imports whose
+// server stopped mid-way are claimed again.
+func ClaimImport(db *sql.DB) (Import, error) {
+	now := time.Now()
+	query := importSelect + `
+	WHERE status IN (?, ?) OR (status IN (?, ?) AND heartbeat_at < ?)
+	ORDER BY id
+	LIMIT 1`
+	imp, err := scanImport(db.QueryRow(query, ImportPending, ImportQueued, ImportReading, ImportRunning, now.Add(-importStaleAfter)))
+	if err != nil {
+		return imp, err
+	}
+
+	claimed := ImportRunning
+	if imp.Status == ImportPending || imp.Status == ImportReading {
+		claimed = ImportReading
+	}
+
+	// Another server may have claimed it first
+	result, err := db.Exec("UPDATE imports SET status = ?, heartbeat_at = ? WHERE id = ? AND status = ?", claimed, now, imp.ID, imp.Status)
+	if err != nil {
+		return imp, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return imp, err
+	}
+
+	imp.Status = claimed
+	return imp, nil
+}
+
+// FailImport records why an import stopped
+func FailImport(db *sql.DB, id int, cause error) error {
+	query := "UPDATE imports SET status = ?, error = ?, completed_at = ? WHERE id = ?"
+	_, err := db.Exec(query, ImportFailed, cause.Error(), time.Now(), id)
+	return err
+}
+
+// importData loads the uploaded file of an import
+func importData(db *sql.DB, id int) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow("SELECT data FROM imports WHERE id = ?", id).Scan(&data)
+	if err == nil && data == nil {
+		err = errors.New("the import file is no longer available")
+	}
+	return data, err
+}
+
+// ReadImport reads a claimed import's file, counting its rows and matching
+// its exercise names to the catalog. The import is queued straight away when
+// every name matched with confidence, otherwise it waits for review.
+func ReadImport(db *sql.DB, imp Import) error {
+	data, err := importData(db, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	// Names are told apart ignoring case, keeping the first spelling seen
+	var names []string
+	counts := make(map[string]int)
+	trackingTypes := make(map[string]string)
+	total := 0
+	err = ParseImportFile(data, imp.Format, imp.Options, func(row ImportRow, rowErr error) error {
+		total++
+		if rowErr != nil || !row.HasSetData() {
+			return nil
+		}
+		key := strings.ToLower(row.Exercise)
+		if _, ok := counts[key]; !ok {
+			names = append(names, row.Exercise)
+			trackingTypes[key] = inferTrackingType(row)
+		}
+		counts[key]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	catalog, err := GetExercises(db)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM import_exercises WHERE import_id = ?", imp.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	review := false
+	for _, name := range names {
+		action, exerciseID, suggestedID, score := "", 0, 0, 0.0
+		if exact, err := FindExerciseByName(db, name); err == nil {
+			action, exerciseID, score = MappingMatch, exact.ID, 1
+		} else if match, ok := MatchExercise(name, catalog); ok && match.Score >= MatchAutoAccept {
+			action, exerciseID, score = MappingMatch, match.Exercise.ID, match.Score
+		} else if ok && match.Score >= MatchSuggestion {
+			suggestedID, score = match.Exercise.ID, match.Score
+		}
+		if action == "" {
+			review = true
+		}
+
+		query := `
+		INSERT INTO import_exercises (import_id, name, row_count, action, exercise_id, suggested_exercise_id, score, tracking_type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		key := strings.ToLower(name)
+		if _, err := tx.Exec(query, imp.ID, name, counts[key], action, nullableID(exerciseID), nullableID(suggestedID),
+			math.Round(score*1000)/1000, trackingTypes[key]); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	status := ImportQueued
+	if review {
+		status = ImportReview
+	}
+	if _, err := tx.Exec("UPDATE imports SET status = ?, total_rows = ? WHERE id = ?", status, total, imp.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// inferTrackingType guesses how an exercise is tracked from a logged row,
+// for exercises the import creates
+func inferTrackingType(row ImportRow) string {
+	switch {
+	case row.Distance > 0 && row.Weight > 0:
+		return TrackingDistanceLoad
+	case row.Distance > 0:
+		return TrackingDistanceDuration
+	case row.Reps > 0 && row.Weight > 0:
+		return TrackingRepsLoad
+	case row.Reps > 0:
+		return TrackingReps
+	case row.Duration > 0:
+		return TrackingDuration
+	}
+	return TrackingRepsLoad
+}
+
+// importTarget is the exercise an imported name is logged against
+type importTarget struct {
+	exerciseID   int
+	trackingType string
+}
+
+// RunImport imports a claimed import's rows into the user's progress,
+// reporting the outcome of each row. Each row is recorded together with its
+// report, so an interrupted import resumes after the last reported row.
+// Rows matching an existing entry for the same exercise, day and
+// measurements are reported as duplicates; identical sets within the file
+// are only duplicates if the user already has as many of them.
+func RunImport(db *sql.DB, imp Import) error {
+	data, err := importData(db, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	targets, err := resolveImportTargets(db, imp.ID)
+	if err != nil {
+		return err
+	}
+
+	var done int
+	if err := db.QueryRow("SELECT COALESCE(MAX(line), 0) FROM import_rows WHERE import_id = ?", imp.ID).Scan(&done); err != nil {
+		return err
+	}
+
+	workouts := make(map[string]int)
+	occurrences := make(map[string]int)
+	touched := make(map[int]bool)
+	err = ParseImportFile(data, imp.Format, imp.Options, func(row ImportRow, rowErr error) error {
+		report := ImportRowReport{Row: row.Row, Exercise: row.Exercise}
+		progress, status, message := prepareImportRow(row, rowErr, targets)
+
+		var key string
+		if status == "" {
+			key = importDedupeKey(progress)
+			occurrences[key]++
+		}
+		if row.Row <= done {
+			return nil
+		}
+
+		if status == "" {
+			duplicates, err := countImportDuplicates(db, imp, progress)
+			if err != nil {
+				return err
+			}
+			if duplicates >= occurrences[key] {
+				status, message = RowDuplicate, "Already logged"
+			}
+		}
+
+		if status == "" {
+			progress.UserID = imp.UserID
+			if progress.WorkoutID, err = importWorkout(db, imp, row.Workout, workouts); err != nil {
+				return err
+			}
+			if progress.SessionID, err = GetOrCreateSession(db, imp.UserID, progress.WorkoutID, progress.Date); err != nil {
+				return err
+			}
+			status = RowImported
+			touched[progress.ExerciseID] = true
+		}
+
+		report.Status, report.Message = status, message
+		if err := saveImportRow(db, imp.ID, report, progress); err != nil {
+			return err
+		}
+
+		if row.Row%importHeartbeatRows == 0 {
+			_, err := db.Exec("UPDATE imports SET heartbeat_at = ? WHERE id = ?", time.Now(), imp.ID)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Records and analytics are rebuilt once rather than per row
+	prefs, err := GetPreferences(db, imp.UserID)
+	if err != nil {
+		return err
+	}
+	for exerciseID := range touched {
+		if err := RebuildRecords(db, imp.UserID, exerciseID, prefs.E1RMFormula); err != nil {
+			return err
+		}
+	}
+	if len(touched) > 0 {
+		if err := RebuildRollups(db, imp.UserID, prefs.E1RMFormula); err != nil {
+			return err
+		}
+		if _, err := AwardAchievements(db, imp.UserID, prefs); err != nil {
+			return err
+		}
+	}
+
+	query := "UPDATE imports SET status = ?, data = NULL, completed_at = ? WHERE id = ?"
+	_, err = db.Exec(query, ImportCompleted, time.Now(), imp.ID)
+	return err
+}
+
+// resolveImportTargets maps each lowercased name of an import to the
+// exercise it is logged against, creating the exercises the user asked for.
+// Skipped names map to no exercise.
+func resolveImportTargets(db *sql.DB, importID int) (map[string]importTarget, error) {
+	exercises, err := GetImportExercises(db, importID)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[string]importTarget, len(exercises))
+	for _, exercise := range exercises {
+		switch exercise.Action {
+		case MappingMatch:
+			if exercise.ExerciseID == nil {
+				return nil, errors.New("the exercise matched to " + exercise.Name + " no longer exists")
+			}
+			matched, err := GetExercise(db, *exercise.ExerciseID)
+			if err != nil {
+				return nil, errors.New("the exercise matched to " + exercise.Name + " no longer exists")
+			}
+			targets[strings.ToLower(exercise.Name)] = importTarget{matched.ID, matched.TrackingType}
+		case MappingCreate:
+			id := 0
+			if exercise.ExerciseID != nil {
+				id = *exercise.ExerciseID
+			} else {
+				name, equipment := splitEquipmentHint(exercise.Name)
+				created := Exercise{Name: truncate(name, 100), Category: "imported", TrackingType: exercise.TrackingType, Equipment: strings.ToLower(equipment)}
+				if id, err = CreateExercise(db, created); err != nil {
+					return nil, err
+				}
+
+				// Remember the exercise so a resumed import doesn't create it twice
+				query := "UPDATE import_exercises SET exercise_id = ? WHERE import_id = ? AND name = ?"
+				if _, err := db.Exec(query, id, importID, exercise.Name); err != nil {
+					return nil, err
+				}
+			}
+			targets[strings.ToLower(exercise.Name)] = importTarget{id, exercise.TrackingType}
+		case MappingSkip:
+			targets[strings.ToLower(exercise.Name)] = importTarget{}
+		default:
+			return nil, errors.New("the exercise " + exercise.Name + " hasn't been resolved")
+		}
+	}
+
+	return targets, nil
+}
+
+// prepareImportRow turns a parsed row into a progress entry, or returns the
+// outcome of a row that won't be imported
+func prepareImportRow(row ImportRow, rowErr error, targets map[string]importTarget) (Progress, string, string) {
+	if rowErr != nil {
+		return Progress{}, RowError, rowErr.Error()
+	}
+	if !row.HasSetData() {
+		return Progress{}, RowSkipped, "No set data"
+	}
+
+	target := targets[strings.ToLower(row.Exercise)]
+	if target.exerciseID == 0 {
+		return Progress{}, RowSkipped, "Exercise skipped"
+	}
+
+	progress := Progress{ExerciseID: target.exerciseID, RPE: row.RPE, Notes: row.Notes, Date: row.Date}
+	measurements, err := NormalizeMeasurements(target.trackingType, row.Measurements())
+	if err != nil {
+		return Progress{}, RowError, err.Error()
+	}
+	progress.SetMeasurements(measurements)
+	return progress, "", ""
+}
+
+// importDedupeKey identifies identical entries
+func importDedupeKey(p Progress) string {
+	encoded, _ := json.Marshal([]interface{}{p.ExerciseID, p.Date.Format("2006-01-02"), p.Sets, p.Reps,
+		math.Round(p.Weight * 100), p.Duration, math.Round(p.Distance * 100)})
+	return string(encoded)
+}
+
+// countImportDuplicates counts the user's entries identical to p that this
+// import didn't create
+func countImportDuplicates(db *sql.DB, imp Import, p Progress) (int, error) {
+	query := `
+	SELECT COUNT(*)
+	FROM progress
+	WHERE user_id = ? AND exercise_id = ? AND date = ? AND sets = ? AND reps = ? AND ABS(weight - ?) < 0.005
+		AND duration_seconds = ? AND ABS(distance_meters - ?) < 0.005 AND deleted_at IS NULL
+		AND id NOT IN (SELECT progress_id FROM import_rows WHERE import_id = ? AND progress_id IS NOT NULL)`
+	var count int
+	err := db.QueryRow(query, imp.UserID, p.ExerciseID, p.Date, p.Sets, p.Reps, p.Weight, p.Duration, p.Distance, imp.ID).Scan(&count)
+	return count, err
+}
+
+// importWorkout finds the user's workout with the given name, creating it if
+// needed
+func importWorkout(db *sql.DB, imp Import, name string, cache map[string]int) (int, error) {
+	key := strings.ToLower(name)
+	if id, ok := cache[key]; ok {
+		return id, nil
+	}
+
+	var id int
+	query := "SELECT id FROM workouts WHERE user_id = ? AND LOWER(name) = ? AND deleted_at IS NULL ORDER BY id LIMIT 1"
+	err := db.QueryRow(query, imp.UserID, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		id, err = CreateWorkout(db, Workout{Name: name, Description: "Imported from " + imp.Filename, UserID: imp.UserID})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	cache[key] = id
+	return id, nil
+}
+
+// saveImportRow records a row's outcome, together with its progress entry
+// when it was imported
+func saveImportRow(db *sql.DB, importID int, report ImportRowReport, progress Progress) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	var progressID interface{}
+	if report.Status == RowImported {
+		id, err := recordProgress(tx, progress)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		progressID = id
+	}
+
+	query := "INSERT INTO import_rows (import_id, line, status, exercise_name, message, progress_id) VALUES (?, ?, ?, ?, ?, ?)"
+	if _, err := tx.Exec(query, importID, report.Row, report.Status, truncate(report.Exercise, 255), truncate(report.Message, 255), progressID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
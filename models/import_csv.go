@@ -0,0 +1,397 @@
+package models
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Import formats
+const (
+	ImportStrong  = "strong"
+	ImportHevy    = "hevy"
+	ImportGeneric = "generic"
+)
+
+// Date formats of generic imports, deciding how dates with slashes are read
+const (
+	DateFormatISO = "iso"
+	DateFormatUS  = "us"
+	DateFormatEU  = "eu"
+)
+
+// defaultImportWorkout names the workout rows without a workout are logged
+// against
+const defaultImportWorkout = "Imported workouts"
+
+// ImportOptions describes how an import file is read. Units default to the
+// user's preferences and apply wherever the file doesn't name them. Columns
+// maps the fields of a generic import (date, exercise, workout, sets, reps,
+// weight, duration, distance, rpe and notes) to the file's headers.
+type ImportOptions struct {
+	WeightUnit   string            `json:"weight_unit"`
+	DistanceUnit string            `json:"distance_unit"`
+	DateFormat   string            `json:"date_format,omitempty"`
+	Columns      map[string]string `json:"columns,omitempty"`
+	Workout      string            `json:"workout,omitempty"`
+}
+
+// ImportRow is one logged set or entry read from an import file, in
+// canonical units. Row is its 1-based line in the file after the header.
+type ImportRow struct {
+	Row      int
+	Date     time.Time
+	Workout  string
+	Exercise string
+	Sets     int
+	Reps     int
+	Weight   float64
+	Duration int
+	Distance float64
+	RPE      float64
+	Notes    string
+}
+
+// Measurements returns the logged measurements of the row
+func (r ImportRow) Measurements() Measurements {
+	return Measurements{Sets: r.Sets, Reps: r.Reps, Weight: r.Weight, Duration: r.Duration, Distance: r.Distance}
+}
+
+// HasSetData reports whether the row logs anything. Strong and Hevy exports
+// include empty rows for rest timers and notes.
+func (r ImportRow) HasSetData() bool {
+	return r.Reps > 0 || r.Weight > 0 || r.Duration > 0 || r.Distance > 0
+}
+
+// importColumn is where a field is read from and how its value converts to
+// canonical units
+type importColumn struct {
+	index   int
+	convert func(float64) float64
+}
+
+// importLayout is the resolved columns of a file
+type importLayout map[string]importColumn
+
+// Headers of the Strong and Hevy exports. Hevy names its units in the
+// header, so each of its alternatives carries its own conversion.
+var (
+	strongHeaders = map[string][]string{
+		"date":     {"Date"},
+		"workout":  {"Workout Name"},
+		"exercise": {"Exercise Name"},
+		"weight":   {"Weight"},
+		"reps":     {"Reps"},
+		"distance": {"Distance"},
+		"duration": {"Seconds"},
+		"rpe":      {"RPE"},
+		"notes":    {"Notes"},
+	}
+	hevyHeaders = map[string][]string{
+		"date":     {"start_time"},
+		"workout":  {"title"},
+		"exercise": {"exercise_title"},
+		"weight":   {"weight_kg", "weight_lbs"},
+		"reps":     {"reps"},
+		"distance": {"distance_km", "distance_miles", "distance_meters"},
+		"duration": {"duration_seconds"},
+		"rpe":      {"rpe"},
+		"notes":    {"exercise_notes"},
+	}
+	hevyUnits = map[string]Units{
+		"weight_kg":      {Weight: UnitKg},
+		"weight_lbs":     {Weight: UnitLb},
+		"distance_km":    {Distance: UnitKm},
+		"distance_miles": {Distance: UnitMi},
+	}
+)
+
+// importFields lists the fields a generic import can map
+var importFields = []string{"date", "exercise", "workout", "sets", "reps", "weight", "duration", "distance", "rpe", "notes"}
+
+// ValidateImportOptions checks the options for a format before a file is
+// accepted
+func ValidateImportOptions(format string, options ImportOptions) error {
+	switch format {
+	case ImportStrong, ImportHevy:
+	case ImportGeneric:
+		if options.Columns["date"] == "" || options.Columns["exercise"] == "" {
+			return errors.New("generic imports need date and exercise columns")
+		}
+		for field := range options.Columns {
+			if !containsString(importFields, field) {
+				return errors.New("unknown import field: " + field)
+			}
+		}
+	default:
+		return errors.New("unknown import format: " + format)
+	}
+
+	if !IsValidWeightUnit(options.WeightUnit) || !IsValidDistanceUnit(options.DistanceUnit) {
+		return errors.New("invalid weight or distance unit")
+	}
+	switch options.DateFormat {
+	case "", DateFormatISO, DateFormatUS, DateFormatEU:
+	default:
+		return errors.New("date_format must be iso, us or eu")
+	}
+	return nil
+}
+
+// ParseImportFile reads an import file row by row, calling each with every
+// row that parsed and failed with the error of every row that didn't. It
+// fails outright only if the file itself can't be read.
+func ParseImportFile(data []byte, format string, options ImportOptions, each func(ImportRow, error) error) error {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.Comma = detectDelimiter(data)
+
+	header, err := reader.Read()
+	if err != nil {
+		return errors.New("the file has no header row")
+	}
+	layout, err := resolveImportLayout(header, format, options)
+	if err != nil {
+		return err
+	}
+	decimalComma := reader.Comma == ';'
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return err
+			}
+			if err := each(ImportRow{Row: row}, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		parsed, rowErr := layout.parse(record, options, decimalComma)
+		parsed.Row = row
+		if err := each(parsed, rowErr); err != nil {
+			return err
+		}
+	}
+}
+
+// detectDelimiter picks semicolons over commas when the header uses them,
+// as Strong does in locales with decimal commas
+func detectDelimiter(data []byte) rune {
+	header := data
+	if end := bytes.IndexByte(data, '\n'); end >= 0 {
+		header = data[:end]
+	}
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+// resolveImportLayout finds each field's column in the header
+func resolveImportLayout(header []string, format string, options ImportOptions) (importLayout, error) {
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	units := Units{Weight: options.WeightUnit, Distance: options.DistanceUnit}
+	layout := importLayout{}
+	add := func(field, name string, u Units) bool {
+		index, ok := positions[strings.ToLower(name)]
+		if !ok {
+			return false
+		}
+		column := importColumn{index: index}
+		switch field {
+		case "weight":
+			column.convert = func(w float64) float64 { return StoredWeightKg(u, w) }
+		case "distance":
+			if name == "distance_meters" {
+				column.convert = func(m float64) float64 { return m }
+			} else {
+				column.convert = func(d float64) float64 { return StoredDistanceMeters(u, d) }
+			}
+		}
+		layout[field] = column
+		return true
+	}
+
+	switch format {
+	case ImportStrong, ImportHevy:
+		headers := strongHeaders
+		if format == ImportHevy {
+			headers = hevyHeaders
+		}
+		for field, names := range headers {
+			for _, name := range names {
+				u := units
+				if named, ok := hevyUnits[name]; ok {
+					u = named
+				}
+				if add(field, name, u) {
+					break
+				}
+			}
+		}
+	case ImportGeneric:
+		for field, name := range options.Columns {
+			if !add(field, name, units) {
+				return nil, fmt.Errorf("column %q not found in the file", name)
+			}
+		}
+	}
+
+	if _, ok := layout["date"]; !ok {
+		return nil, errors.New("the file has no date column; check the format")
+	}
+	if _, ok := layout["exercise"]; !ok {
+		return nil, errors.New("the file has no exercise column; check the format")
+	}
+	return layout, nil
+}
+
+// parse reads one record into a row
+func (l importLayout) parse(record []string, options ImportOptions, decimalComma bool) (ImportRow, error) {
+	row := ImportRow{Sets: 1, Workout: options.Workout}
+	value := func(field string) string {
+		column, ok := l[field]
+		if !ok || column.index >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[column.index])
+	}
+	number := func(field string) (float64, error) {
+		text := value(field)
+		if text == "" {
+			return 0, nil
+		}
+		if decimalComma || !strings.Contains(text, ".") {
+			text = strings.Replace(text, ",", ".", 1)
+		}
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", field, value(field))
+		}
+		if convert := l[field].convert; convert != nil {
+			n = convert(n)
+		}
+		return n, nil
+	}
+
+	var err error
+	if row.Date, err = parseImportDate(value("date"), options.DateFormat); err != nil {
+		return row, err
+	}
+	if row.Exercise = value("exercise"); row.Exercise == "" {
+		return row, errors.New("missing exercise name")
+	}
+	if workout := value("workout"); workout != "" {
+		row.Workout = workout
+	}
+	if row.Workout == "" {
+		row.Workout = defaultImportWorkout
+	}
+	row.Notes = value("notes")
+
+	if _, ok := l["sets"]; ok {
+		sets, err := number("sets")
+		if err != nil {
+			return row, err
+		}
+		row.Sets = int(sets)
+	}
+	reps, err := number("reps")
+	if err != nil {
+		return row, err
+	}
+	row.Reps = int(reps)
+	if row.Weight, err = number("weight"); err != nil {
+		return row, err
+	}
+	if row.Weight < 0 {
+		return row, errors.New("weight cannot be negative")
+	}
+	if row.Distance, err = number("distance"); err != nil {
+		return row, err
+	}
+	if row.Duration, err = parseImportDuration(value("duration")); err != nil {
+		return row, err
+	}
+	if row.RPE, err = number("rpe"); err != nil {
+		return row, err
+	}
+	if row.RPE < 0 || row.RPE > 10 {
+		return row, errors.New("RPE must be between 0 and 10")
+	}
+
+	return row, nil
+}
+
+// importDateLayouts are tried in order for each date format. Times are read
+// but only the day is kept.
+var importDateLayouts = map[string][]string{
+	DateFormatISO: {"2006-01-02 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02",
+		"2 Jan 2006, 15:04", "2 Jan 2006 15:04", "Jan 2, 2006 15:04", "2 Jan 2006"},
+	DateFormatUS: {"1/2/2006 15:04:05", "1/2/2006 15:04", "1/2/2006", "1/2/06"},
+	DateFormatEU: {"2/1/2006 15:04:05", "2/1/2006 15:04", "2/1/2006", "2.1.2006 15:04", "2.1.2006", "2/1/06"},
+}
+
+// parseImportDate reads a date in ISO form, as Hevy writes it, or with
+// slashes in the configured order
+func parseImportDate(value, format string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("missing date")
+	}
+
+	layouts := importDateLayouts[DateFormatISO]
+	if format == DateFormatUS || format == DateFormatEU {
+		layouts = append(append([]string{}, importDateLayouts[format]...), layouts...)
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+// parseImportDuration reads seconds given either as a number or as
+// [hh:]mm:ss
+func parseImportDuration(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	seconds := 0.0
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.ParseFloat(strings.Replace(part, ",", ".", 1), 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return int(seconds + 0.5), nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
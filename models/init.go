@@ -23,9 +23,101 @@ func InitTables(db *sql.DB) error {
 		return err
 	}
 
+	if err := CreateWorkoutShareTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateWorkoutVersionTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateSessionTable(db); err != nil {
+		return err
+	}
+
 	if err := CreateProgressTable(db); err != nil {
 		return err
 	}
 
+	if err := CreateProgressRevisionTable(db); err != nil {
+		return err
+	}
+
+	if err := CreatePreferencesTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateRecordsTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateRollupTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateProgramTables(db); err != nil {
+		return err
+	}
+
+	if err := CreateEnrollmentTables(db); err != nil {
+		return err
+	}
+
+	if err := CreateTemplateTables(db); err != nil {
+		return err
+	}
+
+	if err := CreateScheduleTables(db); err != nil {
+		return err
+	}
+
+	if err := CreateCalendarFeedTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateMeasurementTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateGoalTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateAchievementTables(db); err != nil {
+		return err
+	}
+
+	if err := CreateReportDeliveryTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateExerciseMediaTable(db); err != nil {
+		return err
+	}
+
+	if err := CreatePhotoTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateActivityTable(db); err != nil {
+		return err
+	}
+
+	if err := MergeDuplicateSessions(db); err != nil {
+		return err
+	}
+
+	if err := CreateImportTables(db); err != nil {
+		return err
+	}
+
+	if err := CreateDataExportTable(db); err != nil {
+		return err
+	}
+
+	if err := CreateAccountDeletionTable(db); err != nil {
+		return err
+	}
+
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,380 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Body metrics that can be measured
+const (
+	MetricBodyweight = "bodyweight"
+	MetricBodyFat    = "body_fat"
+	MetricWaist      = "waist"
+	MetricHips       = "hips"
+	MetricChest      = "chest"
+	MetricNeck       = "neck"
+	MetricArms       = "arms"
+	MetricThighs     = "thighs"
+	MetricCalves     = "calves"
+)
+
+// Kinds of body metric, deciding the unit a metric is stored and shown in.
+// Masses are stored in kilograms and lengths in centimeters.
+const (
+	kindMass    = "mass"
+	kindPercent = "percent"
+	kindLength  = "length"
+)
+
+// UnitPercent is the unit of percentage metrics
+const UnitPercent = "%"
+
+// measurementKinds lists every supported metric with its kind
+var measurementKinds = map[string]string{
+	MetricBodyweight: kindMass,
+	MetricBodyFat:    kindPercent,
+	MetricWaist:      kindLength,
+	MetricHips:       kindLength,
+	MetricChest:      kindLength,
+	MetricNeck:       kindLength,
+	MetricArms:       kindLength,
+	MetricThighs:     kindLength,
+	MetricCalves:     kindLength,
+}
+
+// IsValidMetric reports whether m is a supported body metric
+func IsValidMetric(m string) bool {
+	_, ok := measurementKinds[m]
+	return ok
+}
+
+// MetricUnit returns the unit a metric is expressed in for u
+func MetricUnit(metric string, u Units) string {
+	switch measurementKinds[metric] {
+	case kindMass:
+		return u.Weight
+	case kindLength:
+		return u.LengthUnit()
+	}
+	return UnitPercent
+}
+
+// MeasurementToCanonical converts a value given in unit into the metric's
+// storage unit, checking the unit suits the metric
+func MeasurementToCanonical(metric string, value float64, unit string) (float64, error) {
+	switch measurementKinds[metric] {
+	case kindMass:
+		if !IsValidWeightUnit(unit) {
+			return 0, errors.New(metric + " is measured in kg or lb")
+		}
+		return Units{Weight: unit}.WeightToKg(value), nil
+	case kindLength:
+		if unit != UnitCm && unit != UnitIn {
+			return 0, errors.New(metric + " is measured in cm or in")
+		}
+		return lengthToCm(value, unit), nil
+	case kindPercent:
+		if unit != UnitPercent {
+			return 0, errors.New(metric + " is measured in %")
+		}
+		if value > 100 {
+			return 0, errors.New(metric + " cannot be over 100%")
+		}
+		return value, nil
+	}
+	return 0, errors.New("unknown metric: " + metric)
+}
+
+// measurementFromCanonical converts a stored value into u
+func measurementFromCanonical(metric string, value float64, u Units) float64 {
+	switch measurementKinds[metric] {
+	case kindMass:
+		return RoundWeight(u.WeightFromKg(value))
+	case kindLength:
+		return math.Round(lengthFromCm(value, u.LengthUnit())*10) / 10
+	}
+	return math.Round(value*10) / 10
+}
+
+// Measurement is one body measurement taken on a day. Value is stored in
+// kilograms, centimeters or percent depending on the metric.
+type Measurement struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Metric    string    `json:"metric"`
+	Value     float64   `json:"value"`
+	Unit      string    `json:"unit"`
+	Date      time.Time `json:"date"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// InUnits returns a copy of the measurement expressed in u
+func (m Measurement) InUnits(u Units) Measurement {
+	m.Value = measurementFromCanonical(m.Metric, m.Value, u)
+	m.Unit = MetricUnit(m.Metric, u)
+	return m
+}
+
+// CreateMeasurementTable creates the body_measurements table if it doesn't
+// exist
+func CreateMeasurementTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS body_measurements (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		metric VARCHAR(20) NOT NULL,
+		value DECIMAL(7,2) NOT NULL,
+		date DATE NOT NULL,
+		notes TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_body_measurements_metric (user_id, metric, date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// measurementSelect selects the columns scanned by scanMeasurement
+const measurementSelect = "SELECT id, user_id, metric, value, date, COALESCE(notes, ''), created_at, updated_at FROM body_measurements"
+
+// scanMeasurement scans a measurement selected with measurementSelect
+func scanMeasurement(row interface{ Scan(...interface{}) error }) (Measurement, error) {
+	var m Measurement
+	err := row.Scan(&m.ID, &m.UserID, &m.Metric, &m.Value, &m.Date, &m.Notes, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+// CreateMeasurement records a measurement in canonical units
+func CreateMeasurement(db *sql.DB, m Measurement) (int, error) {
+	query := "INSERT INTO body_measurements (user_id, metric, value, date, notes) VALUES (?, ?, ?, ?, ?)"
+	result, err := db.Exec(query, m.UserID, m.Metric, m.Value, m.Date, m.Notes)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetMeasurement retrieves a user's measurement by ID
+func GetMeasurement(db *sql.DB, id, userID int) (Measurement, error) {
+	query := measurementSelect + " WHERE id = ? AND user_id = ?"
+	return scanMeasurement(db.QueryRow(query, id, userID))
+}
+
+// GetUserMeasurements retrieves a user's measurements of a metric, or of
+// every metric when it is empty, between from and to, newest first. Zero
+// dates mean no bound.
+func GetUserMeasurements(db *sql.DB, userID int, metric string, from, to time.Time) ([]Measurement, error) {
+	query := measurementSelect + " WHERE user_id = ?"
+	args := []interface{}{userID}
+	if metric != "" {
+		query += " AND metric = ?"
+		args = append(args, metric)
+	}
+	if !from.IsZero() {
+		query += " AND date >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND date <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY date DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := []Measurement{}
+	for rows.Next() {
+		m, err := scanMeasurement(rows)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, m)
+	}
+
+	return measurements, rows.Err()
+}
+
+// UpdateMeasurement updates a user's measurement
+func UpdateMeasurement(db *sql.DB, m Measurement) error {
+	query := "UPDATE body_measurements SET value = ?, date = ?, notes = ? WHERE id = ? AND user_id = ?"
+	_, err := db.Exec(query, m.Value, m.Date, m.Notes, m.ID, m.UserID)
+	return err
+}
+
+// DeleteMeasurement removes a user's measurement
+func DeleteMeasurement(db *sql.DB, id, userID int) error {
+	_, err := db.Exec("DELETE FROM body_measurements WHERE id = ? AND user_id = ?", id, userID)
+	return err
+}
+
+// Bodyweights is a user's bodyweight history in kilograms, oldest first
+type Bodyweights []Measurement
+
+// GetBodyweights retrieves a user's bodyweight history
+func GetBodyweights(db *sql.DB, userID int) (Bodyweights, error) {
+	measurements, err := GetUserMeasurements(db, userID, MetricBodyweight, time.Time{}, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Oldest first, with the latest entry of a day last, as bodyweightOnSQL
+	// picks it
+	sort.Slice(measurements, func(i, j int) bool {
+		if !measurements[i].Date.Equal(measurements[j].Date) {
+			return measurements[i].Date.Before(measurements[j].Date)
+		}
+		return measurements[i].ID < measurements[j].ID
+	})
+	return Bodyweights(measurements), nil
+}
+
+// On returns the bodyweight that applied on date: the last one measured on
+// or before it, or the first one measured when date is earlier than that.
+// It returns 0 when no bodyweight has been measured.
+func (b Bodyweights) On(date time.Time) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+
+	// Index of the first measurement after date
+	i := sort.Search(len(b), func(i int) bool { return b[i].Date.After(date) })
+	if i == 0 {
+		return b[0].Value
+	}
+	return b[i-1].Value
+}
+
+// bodyweightOnSQL is the SQL counterpart of Bodyweights.On for the progress
+// row p
+const bodyweightOnSQL = `COALESCE(
+	(SELECT m.value FROM body_measurements m
+	WHERE m.user_id = p.user_id AND m.metric = 'bodyweight' AND m.date <= p.date
+	ORDER BY m.date DESC, m.id DESC LIMIT 1),
+	(SELECT m.value FROM body_measurements m
+	WHERE m.user_id = p.user_id AND m.metric = 'bodyweight'
+	ORDER BY m.date, m.id LIMIT 1),
+	0)`
+
+// TrendPoint is the measured value of a metric on a day, averaged when it
+// was measured more than once, with its moving average over the trend window
+type TrendPoint struct {
+	Date    time.Time `json:"date"`
+	Value   float64   `json:"value"`
+	Average float64   `json:"average"`
+}
+
+// MeasurementTrend is a metric's history with a moving average. Change is
+// the difference between the first and last averages, and WeeklyRate the
+// least-squares slope of the values per week.
+type MeasurementTrend struct {
+	Metric     string       `json:"metric"`
+	Unit       string       `json:"unit"`
+	Window     int          `json:"window_days"`
+	Points     []TrendPoint `json:"points"`
+	Latest     *float64     `json:"latest,omitempty"`
+	Change     float64      `json:"change"`
+	WeeklyRate float64      `json:"weekly_rate"`
+}
+
+// GetMeasurementTrend computes a metric's trend between from and to in u,
+// with a moving average over the trailing window days. Measurements from
+// before from are read so the first averages cover a full window.
+func GetMeasurementTrend(db *sql.DB, userID int, metric string, from, to time.Time, window int, u Units) (MeasurementTrend, error) {
+	trend := MeasurementTrend{Metric: metric, Unit: MetricUnit(metric, u), Window: window, Points: []TrendPoint{}}
+
+	readFrom := from
+	if !from.IsZero() {
+		readFrom = from.AddDate(0, 0, -(window - 1))
+	}
+	measurements, err := GetUserMeasurements(db, userID, metric, readFrom, to)
+	if err != nil {
+		return trend, err
+	}
+
+	// Average each day's measurements, oldest day first
+	var days []TrendPoint
+	counts := []int{}
+	for i := len(measurements) - 1; i >= 0; i-- {
+		m := measurements[i]
+		if n := len(days); n > 0 && days[n-1].Date.Equal(m.Date) {
+			days[n-1].Value += m.Value
+			counts[n-1]++
+			continue
+		}
+		days = append(days, TrendPoint{Date: m.Date, Value: m.Value})
+		counts = append(counts, 1)
+	}
+	for i := range days {
+		days[i].Value /= float64(counts[i])
+	}
+
+	// Trailing moving average over the days measured within the window
+	start := 0
+	sum := 0.0
+	for i := range days {
+		sum += days[i].Value
+		for days[start].Date.Before(days[i].Date.AddDate(0, 0, -(window - 1))) {
+			sum -= days[start].Value
+			start++
+		}
+		days[i].Average = sum / float64(i-start+1)
+	}
+
+	for _, day := range days {
+		if !from.IsZero() && day.Date.Before(from) {
+			continue
+		}
+		trend.Points = append(trend.Points, TrendPoint{
+			Date:    day.Date,
+			Value:   measurementFromCanonical(metric, day.Value, u),
+			Average: measurementFromCanonical(metric, day.Average, u),
+		})
+	}
+	if len(trend.Points) == 0 {
+		return trend, nil
+	}
+
+	first, last := trend.Points[0], trend.Points[len(trend.Points)-1]
+	latest := last.Value
+	trend.Latest = &latest
+	trend.Change = math.Round((last.Average-first.Average)*10) / 10
+	trend.WeeklyRate = math.Round(weeklySlope(trend.Points)*100) / 100
+	return trend, nil
+}
+
+// weeklySlope fits a least-squares line through the points and returns its
+// slope per week
+func weeklySlope(points []TrendPoint) float64 {
+	if len(points) < 2 {
+		return 0
+	}
+
+	origin := points[0].Date
+	var sumX, sumY, sumXY, sumXX float64
+	for _, p := range points {
+		x := p.Date.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += p.Value
+		sumXY += x * p.Value
+		sumXX += x * x
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator * 7
+}
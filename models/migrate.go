@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// addColumnIfMissing adds a column to a table created by an older version of
+// the schema. CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so
+// new columns have to be added explicitly.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) error {
+	var count int
+	query := `
+	SELECT COUNT(*)
+	FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// modifyColumnIfType redefines a column that still has the data type used by
+// an older version of the schema
+func modifyColumnIfType(db *sql.DB, table, column, oldType, definition string) error {
+	var dataType string
+	query := `
+	SELECT data_type
+	FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`
+	if err := db.QueryRow(query, table, column).Scan(&dataType); err != nil {
+		return err
+	}
+	if dataType != oldType {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// createIndexIfMissing adds an index to a table created by an older version
+// of the schema
+func createIndexIfMissing(db *sql.DB, table, index, columns string) error {
+	var count int
+	query := `
+	SELECT COUNT(*)
+	FROM information_schema.statistics
+	WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`
+	if err := db.QueryRow(query, table, index).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index, table, columns))
+	return err
+}
+
+// setForeignKeyOnDelete gives the foreign key on a column the ON DELETE
+// action used by the current schema, replacing a key created by an older
+// version with a different action
+func setForeignKeyOnDelete(db *sql.DB, table, column, refTable, action string) error {
+	var name, rule string
+	query := `
+	SELECT rc.constraint_name, rc.delete_rule
+	FROM information_schema.referential_constraints rc
+	JOIN information_schema.key_column_usage kcu
+		ON kcu.constraint_schema = rc.constraint_schema AND kcu.constraint_name = rc.constraint_name
+		AND kcu.table_name = rc.table_name
+	WHERE rc.constraint_schema = DATABASE() AND rc.table_name = ? AND kcu.column_name = ?`
+	err := db.QueryRow(query, table, column).Scan(&name, &rule)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil || rule == action {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s, ADD FOREIGN KEY (%s) REFERENCES %s(id) ON DELETE %s",
+		table, name, column, refTable, action))
+	return err
+}
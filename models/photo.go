@@ -0,0 +1,333 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cxocodehub/go-backend-workout/storage"
+)
+
+// Poses a progress photo can be taken in, so photos of the same pose can be
+// compared
+const (
+	PoseFront = "front"
+	PoseSide  = "side"
+	PoseBack  = "back"
+	PoseOther = "other"
+)
+
+// IsValidPose reports whether p is a supported photo pose
+func IsValidPose(p string) bool {
+	switch p {
+	case PoseFront, PoseSide, PoseBack, PoseOther:
+		return true
+	}
+	return false
+}
+
+// Variants of uploaded images that can be downloaded
+const (
+	VariantOriginal  = "original"
+	VariantThumbnail = "thumbnail"
+)
+
+// defaultPhotoURLMinutes is how long photo URLs stay valid when
+// PHOTO_URL_LIFETIME_MINUTES is not set
+const defaultPhotoURLMinutes = 15
+
+// Photo is a progress photo. The image and its thumbnail are kept in the
+// file store; they are downloaded through signed URLs that expire after
+// PhotoURLLifetime, or never for public photos.
+type Photo struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Date         time.Time  `json:"date"`
+	Pose         string     `json:"pose"`
+	Notes        string     `json:"notes"`
+	Visibility   string     `json:"visibility"`
+	ContentType  string     `json:"content_type"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	Size         int        `json:"size"`
+	ObjectKey    string     `json:"-"`
+	ThumbnailKey string     `json:"-"`
+	Secret       string     `json:"-"`
+	URL          string     `json:"url,omitempty"`
+	ThumbnailURL string     `json:"thumbnail_url,omitempty"`
+	URLExpiresAt *time.Time `json:"url_expires_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// CreatePhotoTable creates the progress_photos table if it doesn't exist
+func CreatePhotoTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS progress_photos (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		date DATE NOT NULL,
+		pose VARCHAR(10) NOT NULL,
+		notes TEXT,
+		visibility VARCHAR(10) NOT NULL DEFAULT 'private',
+		content_type VARCHAR(20) NOT NULL,
+		width INT NOT NULL,
+		height INT NOT NULL,
+		size INT NOT NULL,
+		object_key VARCHAR(255) NOT NULL,
+		thumbnail_key VARCHAR(255) NOT NULL,
+		secret CHAR(64) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_progress_photos_date (user_id, date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// PhotoURLLifetime returns how long signed URLs of private photos stay
+// valid, read from PHOTO_URL_LIFETIME_MINUTES
+func PhotoURLLifetime() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("PHOTO_URL_LIFETIME_MINUTES"))
+	if err != nil || minutes <= 0 {
+		minutes = defaultPhotoURLMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// photoSelect selects the columns scanned by scanPhoto
+const photoSelect = `
+	SELECT id, user_id, date, pose, COALESCE(notes, ''), visibility, content_type, width, height, size,
+		object_key, thumbnail_key, secret, created_at, updated_at
+	FROM progress_photos`
+
+// scanPhoto scans a photo selected with photoSelect
+func scanPhoto(row interface{ Scan(...interface{}) error }) (Photo, error) {
+	var p Photo
+	err := row.Scan(&p.ID, &p.UserID, &p.Date, &p.Pose, &p.Notes, &p.Visibility, &p.ContentType, &p.Width, &p.Height, &p.Size,
+		&p.ObjectKey, &p.ThumbnailKey, &p.Secret, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// SavePhoto stores a processed image and its thumbnail under random keys and
+// records the photo, returning its ID. The files are removed again if the
+// photo can't be recorded.
+func SavePhoto(db *sql.DB, store storage.Store, p Photo, image ProcessedImage) (int, error) {
+	name, err := newToken()
+	if err != nil {
+		return 0, err
+	}
+	if p.Secret, err = newToken(); err != nil {
+		return 0, err
+	}
+
+	extension := ".jpg"
+	if image.ContentType == "image/png" {
+		extension = ".png"
+	}
+	p.ObjectKey = fmt.Sprintf("photos/%d/%s%s", p.UserID, name, extension)
+	p.ThumbnailKey = fmt.Sprintf("photos/%d/%s_thumb%s", p.UserID, name, extension)
+
+	if err := store.Put(p.ObjectKey, image.Image, image.ContentType); err != nil {
+		return 0, err
+	}
+	if err := store.Put(p.ThumbnailKey, image.Thumbnail, image.ThumbnailType); err != nil {
+		store.Delete(p.ObjectKey)
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO progress_photos (user_id, date, pose, notes, visibility, content_type, width, height, size, object_key, thumbnail_key, secret)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, p.UserID, p.Date, p.Pose, p.Notes, p.Visibility, image.ContentType, image.Width, image.Height,
+		len(image.Image), p.ObjectKey, p.ThumbnailKey, p.Secret)
+	if err != nil {
+		store.Delete(p.ObjectKey)
+		store.Delete(p.ThumbnailKey)
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetPhoto retrieves a user's photo by ID
+func GetPhoto(db *sql.DB, id, userID int) (Photo, error) {
+	query := photoSelect + " WHERE id = ? AND user_id = ?"
+	return scanPhoto(db.QueryRow(query, id, userID))
+}
+
+// GetPhotoByID retrieves a photo by ID whoever it belongs to, for serving
+// signed downloads
+func GetPhotoByID(db *sql.DB, id int) (Photo, error) {
+	query := photoSelect + " WHERE id = ?"
+	return scanPhoto(db.QueryRow(query, id))
+}
+
+// GetUserPhotos retrieves a user's photos of a pose, or of every pose when it
+// is empty, between from and to, newest first. Zero dates mean no bound.
+func GetUserPhotos(db *sql.DB, userID int, pose string, from, to time.Time) ([]Photo, error) {
+	query := photoSelect + " WHERE user_id = ?"
+	args := []interface{}{userID}
+	if pose != "" {
+		query += " AND pose = ?"
+		args = append(args, pose)
+	}
+	if !from.IsZero() {
+		query += " AND date >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND date <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY date DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []Photo{}
+	for rows.Next() {
+		p, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, p)
+	}
+
+	return photos, rows.Err()
+}
+
+// UpdatePhoto updates the date, pose, notes and visibility of a user's photo
+func UpdatePhoto(db *sql.DB, p Photo) error {
+	query := "UPDATE progress_photos SET date = ?, pose = ?, notes = ?, visibility = ? WHERE id = ? AND user_id = ?"
+	_, err := db.Exec(query, p.Date, p.Pose, p.Notes, p.Visibility, p.ID, p.UserID)
+	return err
+}
+
+// DeletePhoto deletes a user's photo and its files
+func DeletePhoto(db *sql.DB, store storage.Store, p Photo) error {
+	if _, err := db.Exec("DELETE FROM progress_photos WHERE id = ? AND user_id = ?", p.ID, p.UserID); err != nil {
+		return err
+	}
+	if err := store.Delete(p.ObjectKey); err != nil {
+		return err
+	}
+	return store.Delete(p.ThumbnailKey)
+}
+
+// DeleteUserPhotoFiles removes the files of all of a user's photos from the
+// store. The rows are left for the account erasure to delete, so a failed
+// attempt can be retried.
+func DeleteUserPhotoFiles(db *sql.DB, store storage.Store, userID int) error {
+	photos, err := GetUserPhotos(db, userID, "", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, p := range photos {
+		if err := store.Delete(p.ObjectKey); err != nil {
+			return err
+		}
+		if err := store.Delete(p.ThumbnailKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithURLs returns the photo with signed URLs of its image and thumbnail.
+// Private photos get URLs that expire at expires; public photos get URLs
+// that stay valid for as long as the photo is public.
+func (p Photo) WithURLs(expires time.Time) Photo {
+	var until int64
+	if p.Visibility != VisibilityPublic {
+		until = expires.Unix()
+		p.URLExpiresAt = &expires
+	}
+	p.URL = p.signedURL(VariantOriginal, until)
+	p.ThumbnailURL = p.signedURL(VariantThumbnail, until)
+	return p
+}
+
+// signedURL returns the download path of a variant, valid until the Unix
+// time expires, or indefinitely when it is 0
+func (p Photo) signedURL(variant string, expires int64) string {
+	return fmt.Sprintf("/photos/%d/%s?expires=%d&signature=%s", p.ID, variant, expires, p.signature(variant, expires))
+}
+
+// signature signs a download of a variant with the photo's secret
+func (p Photo) signature(variant string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(p.Secret))
+	fmt.Fprintf(mac, "%d:%s:%d", p.ID, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDownload reports whether a signed download of a variant is valid at
+// now. Links without an expiry only work while the photo is public.
+func (p Photo) VerifyDownload(variant string, expires int64, signature string, now time.Time) bool {
+	if !hmac.Equal([]byte(signature), []byte(p.signature(variant, expires))) {
+		return false
+	}
+	if expires == 0 {
+		return p.Visibility == VisibilityPublic
+	}
+	return now.Unix() < expires
+}
+
+// Key returns the store key of a variant
+func (p Photo) Key(variant string) string {
+	if variant == VariantThumbnail {
+		return p.ThumbnailKey
+	}
+	return p.ObjectKey
+}
+
+// PhotoComparison pairs the first and last photo of a pose over a period,
+// with the bodyweight on each day
+type PhotoComparison struct {
+	Pose             string  `json:"pose"`
+	Before           *Photo  `json:"before"`
+	After            *Photo  `json:"after"`
+	Days             int     `json:"days"`
+	BodyweightBefore float64 `json:"bodyweight_before,omitempty"`
+	BodyweightAfter  float64 `json:"bodyweight_after,omitempty"`
+	BodyweightChange float64 `json:"bodyweight_change,omitempty"`
+	WeightUnit       string  `json:"weight_unit"`
+}
+
+// ComparePhotos finds the first photo of a pose on or after from and the
+// last one on or before to, for showing side by side. Zero dates mean no
+// bound. Before and After are nil when there are no photos, and the same
+// photo when there is only one.
+func ComparePhotos(db *sql.DB, userID int, pose string, from, to time.Time, u Units) (PhotoComparison, error) {
+	comparison := PhotoComparison{Pose: pose, WeightUnit: u.Weight}
+
+	photos, err := GetUserPhotos(db, userID, pose, from, to)
+	if err != nil || len(photos) == 0 {
+		return comparison, err
+	}
+	before, after := photos[len(photos)-1], photos[0]
+	comparison.Before, comparison.After = &before, &after
+	comparison.Days = int(after.Date.Sub(before.Date).Hours() / 24)
+
+	bodyweights, err := GetBodyweights(db, userID)
+	if err != nil {
+		return comparison, err
+	}
+	if len(bodyweights) > 0 {
+		comparison.BodyweightBefore = RoundWeight(u.WeightFromKg(bodyweights.On(before.Date)))
+		comparison.BodyweightAfter = RoundWeight(u.WeightFromKg(bodyweights.On(after.Date)))
+		comparison.BodyweightChange = RoundWeight(comparison.BodyweightAfter - comparison.BodyweightBefore)
+	}
+	return comparison, nil
+}
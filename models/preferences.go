@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Weekdays accepted as the first day of the week
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Preferences represents a user's display preferences
+type Preferences struct {
+	UserID         int       `json:"user_id"`
+	WeightUnit     string    `json:"weight_unit"`
+	DistanceUnit   string    `json:"distance_unit"`
+	FirstDayOfWeek string    `json:"first_day_of_week"`
+	TimeZone       string    `json:"time_zone"`
+	PlateIncrement float64   `json:"plate_increment"` // in WeightUnit
+	E1RMFormula    string    `json:"e1rm_formula"`
+	WeeklyReport   bool      `json:"weekly_report"`
+	MonthlyReport  bool      `json:"monthly_report"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DefaultPreferences returns the preferences used until a user saves their own
+func DefaultPreferences(userID int) Preferences {
+	return Preferences{
+		UserID:         userID,
+		WeightUnit:     UnitKg,
+		DistanceUnit:   UnitKm,
+		FirstDayOfWeek: "monday",
+		TimeZone:       "UTC",
+		PlateIncrement: DefaultPlateIncrement(UnitKg),
+		E1RMFormula:    FormulaEpley,
+		WeeklyReport:   true,
+	}
+}
+
+// Units returns the units the user prefers
+func (p Preferences) Units() Units {
+	return Units{Weight: p.WeightUnit, Distance: p.DistanceUnit}
+}
+
+// Location returns the user's time zone, falling back to UTC
+func (p Preferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Today returns the current calendar day in the user's time zone, as a
+// midnight UTC value suitable for DATE columns
+func (p Preferences) Today() time.Time {
+	now := time.Now().In(p.Location())
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// WeekStart returns the user's first day of the week
+func (p Preferences) WeekStart() time.Weekday {
+	if day, ok := weekdays[p.FirstDayOfWeek]; ok {
+		return day
+	}
+	return time.Monday
+}
+
+// IncrementFor returns the plate increment to use when rounding loads in u.
+// The saved increment only applies to the user's own weight unit.
+func (p Preferences) IncrementFor(u Units) float64 {
+	if u.Weight == p.WeightUnit && p.PlateIncrement > 0 {
+		return p.PlateIncrement
+	}
+	return DefaultPlateIncrement(u.Weight)
+}
+
+// IsValidWeekday reports whether day names a day of the week
+func IsValidWeekday(day string) bool {
+	_, ok := weekdays[strings.ToLower(day)]
+	return ok
+}
+
+// CreatePreferencesTable creates the user_preferences table if it doesn't exist
+func CreatePreferencesTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS user_preferences (
+		user_id INT PRIMARY KEY,
+		weight_unit VARCHAR(2) NOT NULL DEFAULT 'kg',
+		distance_unit VARCHAR(2) NOT NULL DEFAULT 'km',
+		first_day_of_week VARCHAR(9) NOT NULL DEFAULT 'monday',
+		time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+		plate_increment DECIMAL(5,2) NOT NULL DEFAULT 2.5,
+		e1rm_formula VARCHAR(10) NOT NULL DEFAULT 'epley',
+		weekly_report BOOLEAN NOT NULL DEFAULT TRUE,
+		monthly_report BOOLEAN NOT NULL DEFAULT FALSE,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	if err := addColumnIfMissing(db, "user_preferences", "e1rm_formula", "VARCHAR(10) NOT NULL DEFAULT 'epley'"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "user_preferences", "weekly_report", "BOOLEAN NOT NULL DEFAULT TRUE"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(db, "user_preferences", "monthly_report", "BOOLEAN NOT NULL DEFAULT FALSE")
+}
+
+// GetPreferences retrieves a user's preferences, or the defaults if none are saved
+func GetPreferences(db *sql.DB, userID int) (Preferences, error) {
+	query := `
+	SELECT user_id, weight_unit, distance_unit, first_day_of_week, time_zone, plate_increment, e1rm_formula,
+		weekly_report, monthly_report, updated_at
+	FROM user_preferences
+	WHERE user_id = ?`
+
+	var prefs Preferences
+	err := db.QueryRow(query, userID).Scan(&prefs.UserID, &prefs.WeightUnit, &prefs.DistanceUnit,
+		&prefs.FirstDayOfWeek, &prefs.TimeZone, &prefs.PlateIncrement, &prefs.E1RMFormula,
+		&prefs.WeeklyReport, &prefs.MonthlyReport, &prefs.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return DefaultPreferences(userID), nil
+	}
+	return prefs, err
+}
+
+// SavePreferences creates or replaces a user's preferences
+func SavePreferences(db *sql.DB, prefs Preferences) error {
+	query := `
+	INSERT INTO user_preferences (user_id, weight_unit, distance_unit, first_day_of_week, time_zone, plate_increment, e1rm_formula,
+		weekly_report, monthly_report)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		weight_unit = VALUES(weight_unit),
+		distance_unit = VALUES(distance_unit),
+		first_day_of_week = VALUES(first_day_of_week),
+		time_zone = VALUES(time_zone),
+		plate_increment = VALUES(plate_increment),
+		e1rm_formula = VALUES(e1rm_formula),
+		weekly_report = VALUES(weekly_report),
+		monthly_report = VALUES(monthly_report)`
+
+	_, err := db.Exec(query, prefs.UserID, prefs.WeightUnit, prefs.DistanceUnit,
+		prefs.FirstDayOfWeek, prefs.TimeZone, prefs.PlateIncrement, prefs.E1RMFormula,
+		prefs.WeeklyReport, prefs.MonthlyReport)
+	return err
+}
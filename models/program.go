@@ -0,0 +1,405 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Program phases
+const (
+	PhaseHypertrophy = "hypertrophy"
+	PhaseStrength    = "strength"
+	PhasePeaking     = "peaking"
+	PhaseDeload      = "deload"
+)
+
+// Program progression types
+const (
+	ProgressionNone          = "none"
+	ProgressionLoadIncrement = "load_increment"
+	ProgressionRPE           = "rpe"
+	ProgressionPercentTM     = "percent_tm"
+)
+
+// Deload weeks keep the week's prescription but halve the sets and take this
+// fraction of the load
+const deloadLoadFactor = 0.9
+
+// Program represents a multi-week training program built from workouts.
+// LoadIncrement is in kilograms per week.
+type Program struct {
+	ID              int           `json:"id"`
+	UserID          int           `json:"user_id"`
+	Name            string        `json:"name"`
+	Description     string        `json:"description"`
+	ProgressionType string        `json:"progression_type"`
+	LoadIncrement   float64       `json:"load_increment"`
+	RPEStart        float64       `json:"rpe_start"`
+	RPEStep         float64       `json:"rpe_step"`
+	Weeks           []ProgramWeek `json:"weeks"`
+	Days            []ProgramDay  `json:"days"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+
+	// Units is set once the program has been converted for a response
+	Units *Units `json:"units,omitempty"`
+}
+
+// ProgramWeek describes one week of a program. PercentTM is the percentage
+// of the training max used by percent_tm progression, and RPETarget
+// overrides the RPE computed by rpe progression.
+type ProgramWeek struct {
+	Week      int     `json:"week"`
+	Phase     string  `json:"phase"`
+	PercentTM float64 `json:"percent_tm,omitempty"`
+	RPETarget float64 `json:"rpe_target,omitempty"`
+}
+
+// ProgramDay places a workout on a day of a program week. Day 1 is the
+// first day of the week; week 0 repeats the workout every week.
+type ProgramDay struct {
+	Week      int `json:"week"`
+	Day       int `json:"day"`
+	WorkoutID int `json:"workout_id"`
+}
+
+// IsValidPhase reports whether p is a supported phase
+func IsValidPhase(p string) bool {
+	return p == PhaseHypertrophy || p == PhaseStrength || p == PhasePeaking || p == PhaseDeload
+}
+
+// IsValidProgressionType reports whether t is a supported progression type
+func IsValidProgressionType(t string) bool {
+	return t == ProgressionNone || t == ProgressionLoadIncrement || t == ProgressionRPE || t == ProgressionPercentTM
+}
+
+// Validate checks that the program's weeks and days are consistent
+func (p Program) Validate() error {
+	if p.Name == "" || p.UserID == 0 {
+		return errors.New("program name and user ID are required")
+	}
+	if !IsValidProgressionType(p.ProgressionType) {
+		return errors.New("progression type must be none, load_increment, rpe or percent_tm")
+	}
+	if len(p.Weeks) == 0 {
+		return errors.New("a program needs at least one week")
+	}
+	if p.RPEStart < 0 || p.RPEStart > 10 {
+		return errors.New("rpe_start must be between 0 and 10")
+	}
+
+	for i, week := range p.Weeks {
+		if week.Week != i+1 {
+			return errors.New("weeks must be numbered 1, 2, 3, ... in order")
+		}
+		if !IsValidPhase(week.Phase) {
+			return fmt.Errorf("week %d: phase must be hypertrophy, strength, peaking or deload", week.Week)
+		}
+		if p.ProgressionType == ProgressionPercentTM && week.PercentTM <= 0 {
+			return fmt.Errorf("week %d: percent_tm is required for percent_tm progression", week.Week)
+		}
+		if week.RPETarget < 0 || week.RPETarget > 10 {
+			return fmt.Errorf("week %d: rpe_target must be between 0 and 10", week.Week)
+		}
+	}
+
+	if len(p.Days) == 0 {
+		return errors.New("a program needs at least one day")
+	}
+	for _, day := range p.Days {
+		if day.Week < 0 || day.Week > len(p.Weeks) {
+			return fmt.Errorf("day %d: week %d is not part of the program", day.Day, day.Week)
+		}
+		if day.Day < 1 || day.Day > 7 {
+			return errors.New("days must be numbered 1 to 7")
+		}
+		if day.WorkoutID == 0 {
+			return errors.New("every day needs a workout ID")
+		}
+	}
+
+	return nil
+}
+
+// DaysOfWeek returns the days scheduled in a week, including every-week days
+func (p Program) DaysOfWeek(week int) []ProgramDay {
+	var days []ProgramDay
+	for _, day := range p.Days {
+		if day.Week == 0 || day.Week == week {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+// ProgramPrescription is a workout entry as prescribed for one program week
+type ProgramPrescription struct {
+	WorkoutExercise
+	RPETarget float64 `json:"rpe_target,omitempty"`
+}
+
+// Prescribe applies the program's progression for a week to a workout entry.
+// trainingMax is the lifter's training max for the exercise in kilograms, or
+// 0 if none was given.
+func (p Program) Prescribe(week ProgramWeek, base WorkoutExercise, trainingMax float64) ProgramPrescription {
+	prescription := ProgramPrescription{WorkoutExercise: base}
+	weeksIn := float64(week.Week - 1)
+
+	switch p.ProgressionType {
+	case ProgressionLoadIncrement:
+		if base.Weight > 0 {
+			prescription.Weight = base.Weight + p.LoadIncrement*weeksIn
+		}
+	case ProgressionRPE:
+		prescription.RPETarget = math.Min(10, p.RPEStart+p.RPEStep*weeksIn)
+	case ProgressionPercentTM:
+		if trainingMax > 0 {
+			prescription.Weight = trainingMax * week.PercentTM / 100
+		}
+	}
+	if week.RPETarget > 0 {
+		prescription.RPETarget = week.RPETarget
+	}
+
+	if week.Phase == PhaseDeload {
+		prescription.Sets = (prescription.Sets + 1) / 2
+		prescription.Weight *= deloadLoadFactor
+	}
+
+	return prescription
+}
+
+// InUnits returns a copy of the program expressed in u
+func (p Program) InUnits(u Units) Program {
+	p.LoadIncrement = RoundWeight(u.WeightFromKg(p.LoadIncrement))
+	p.Units = &u
+	return p
+}
+
+// FromUnits converts a program submitted in u into canonical units
+func (p Program) FromUnits(u Units) Program {
+	p.LoadIncrement = u.WeightToKg(p.LoadIncrement)
+	return p
+}
+
+// CreateProgramTables creates the programs, program_weeks and program_days
+// tables if they don't exist
+func CreateProgramTables(db *sql.DB) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS programs (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		description TEXT,
+		progression_type VARCHAR(20) NOT NULL DEFAULT 'none',
+		load_increment DECIMAL(6,2) NOT NULL DEFAULT 0,
+		rpe_start DECIMAL(3,1) NOT NULL DEFAULT 0,
+		rpe_step DECIMAL(3,1) NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`, `
+	CREATE TABLE IF NOT EXISTS program_weeks (
+		program_id INT NOT NULL,
+		week_number INT NOT NULL,
+		phase VARCHAR(20) NOT NULL,
+		percent_tm DECIMAL(5,2) NOT NULL DEFAULT 0,
+		rpe_target DECIMAL(3,1) NOT NULL DEFAULT 0,
+		PRIMARY KEY (program_id, week_number),
+		FOREIGN KEY (program_id) REFERENCES programs(id) ON DELETE CASCADE
+	);`, `
+	CREATE TABLE IF NOT EXISTS program_days (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		program_id INT NOT NULL,
+		week_number INT NOT NULL,
+		day_number INT NOT NULL,
+		workout_id INT NOT NULL,
+		FOREIGN KEY (program_id) REFERENCES programs(id) ON DELETE CASCADE,
+		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE
+	);`}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPrograms retrieves all programs, or only a user's programs if userID is
+// not 0. Weeks and days are not loaded.
+func GetPrograms(db *sql.DB, userID int) ([]Program, error) {
+	query := `
+	SELECT id, user_id, name, COALESCE(description, ''), progression_type, load_increment, rpe_start, rpe_step, created_at, updated_at
+	FROM programs`
+	var args []interface{}
+	if userID != 0 {
+		query += " WHERE user_id = ?"
+		args = append(args, userID)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var programs []Program
+	for rows.Next() {
+		var program Program
+		if err := rows.Scan(&program.ID, &program.UserID, &program.Name, &program.Description, &program.ProgressionType,
+			&program.LoadIncrement, &program.RPEStart, &program.RPEStep, &program.CreatedAt, &program.UpdatedAt); err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+
+	return programs, rows.Err()
+}
+
+// GetProgram retrieves a program with its weeks and days
+func GetProgram(db *sql.DB, id int) (Program, error) {
+	query := `
+	SELECT id, user_id, name, COALESCE(description, ''), progression_type, load_increment, rpe_start, rpe_step, created_at, updated_at
+	FROM programs
+	WHERE id = ?`
+
+	var program Program
+	err := db.QueryRow(query, id).Scan(&program.ID, &program.UserID, &program.Name, &program.Description, &program.ProgressionType,
+		&program.LoadIncrement, &program.RPEStart, &program.RPEStep, &program.CreatedAt, &program.UpdatedAt)
+	if err != nil {
+		return program, err
+	}
+
+	weekRows, err := db.Query("SELECT week_number, phase, percent_tm, rpe_target FROM program_weeks WHERE program_id = ? ORDER BY week_number", id)
+	if err != nil {
+		return program, err
+	}
+	defer weekRows.Close()
+
+	program.Weeks = []ProgramWeek{}
+	for weekRows.Next() {
+		var week ProgramWeek
+		if err := weekRows.Scan(&week.Week, &week.Phase, &week.PercentTM, &week.RPETarget); err != nil {
+			return program, err
+		}
+		program.Weeks = append(program.Weeks, week)
+	}
+	if err := weekRows.Err(); err != nil {
+		return program, err
+	}
+
+	dayRows, err := db.Query("SELECT week_number, day_number, workout_id FROM program_days WHERE program_id = ? ORDER BY week_number, day_number, id", id)
+	if err != nil {
+		return program, err
+	}
+	defer dayRows.Close()
+
+	program.Days = []ProgramDay{}
+	for dayRows.Next() {
+		var day ProgramDay
+		if err := dayRows.Scan(&day.Week, &day.Day, &day.WorkoutID); err != nil {
+			return program, err
+		}
+		program.Days = append(program.Days, day)
+	}
+
+	return program, dayRows.Err()
+}
+
+// CreateProgram creates a program with its weeks and days
+func CreateProgram(db *sql.DB, program Program) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+	INSERT INTO programs (user_id, name, description, progression_type, load_increment, rpe_start, rpe_step)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, program.UserID, program.Name, program.Description, program.ProgressionType,
+		program.LoadIncrement, program.RPEStart, program.RPEStep)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := saveProgramStructure(tx, int(id), program); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+// UpdateProgram replaces a program's settings, weeks and days. Schedules
+// already materialized for enrolled users are not touched.
+func UpdateProgram(db *sql.DB, program Program) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE programs
+	SET name = ?, description = ?, progression_type = ?, load_increment = ?, rpe_start = ?, rpe_step = ?
+	WHERE id = ? AND user_id = ?`
+	if _, err := tx.Exec(query, program.Name, program.Description, program.ProgressionType, program.LoadIncrement,
+		program.RPEStart, program.RPEStep, program.ID, program.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM program_weeks WHERE program_id = ?", program.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM program_days WHERE program_id = ?", program.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := saveProgramStructure(tx, program.ID, program); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// saveProgramStructure inserts a program's weeks and days
+func saveProgramStructure(tx *sql.Tx, programID int, program Program) error {
+	for _, week := range program.Weeks {
+		_, err := tx.Exec("INSERT INTO program_weeks (program_id, week_number, phase, percent_tm, rpe_target) VALUES (?, ?, ?, ?, ?)",
+			programID, week.Week, week.Phase, week.PercentTM, week.RPETarget)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, day := range program.Days {
+		_, err := tx.Exec("INSERT INTO program_days (program_id, week_number, day_number, workout_id) VALUES (?, ?, ?, ?)",
+			programID, day.Week, day.Day, day.WorkoutID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteProgram deletes a program by ID
+func DeleteProgram(db *sql.DB, id, userID int) error {
+	query := "DELETE FROM programs WHERE id = ? AND user_id = ?"
+	_, err := db.Exec(query, id, userID)
+	return err
+}
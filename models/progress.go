@@ -2,6 +2,8 @@ package models
 
 import (
 	"database/sql"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -11,12 +13,92 @@ type Progress struct {
 	UserID     int       `json:"user_id"`
 	WorkoutID  int       `json:"workout_id"`
 	ExerciseID int       `json:"exercise_id"`
+	SessionID  int       `json:"session_id"`
 	Sets       int       `json:"sets"`
 	Reps       int       `json:"reps"`
-	Weight     int       `json:"weight"`
+	Weight     float64   `json:"weight"`
+	Duration   int       `json:"duration"` // seconds
+	Distance   float64   `json:"distance"`
+	RPE        float64   `json:"rpe,omitempty"`
 	Notes      string    `json:"notes"`
 	Date       time.Time `json:"date"`
 	CreatedAt  time.Time `json:"created_at"`
+
+	// TrackingType and Metrics come from the logged exercise and are read-only
+	TrackingType string           `json:"tracking_type,omitempty"`
+	Metrics      *ProgressMetrics `json:"metrics,omitempty"`
+
+	// Units is set once the record has been converted for a response
+	Units *Units `json:"units,omitempty"`
+}
+
+// Measurements returns the logged measurements of the entry
+func (p Progress) Measurements() Measurements {
+	return Measurements{Sets: p.Sets, Reps: p.Reps, Weight: p.Weight, Duration: p.Duration, Distance: p.Distance}
+}
+
+// SetMeasurements overwrites the logged measurements of the entry
+func (p *Progress) SetMeasurements(m Measurements) {
+	p.Sets, p.Reps, p.Weight, p.Duration, p.Distance = m.Sets, m.Reps, m.Weight, m.Duration, m.Distance
+}
+
+// WithFormula returns a copy of the record with its e1RM estimated by formula
+func (p Progress) WithFormula(formula string) Progress {
+	if p.Metrics == nil || p.Metrics.E1RM == 0 {
+		return p
+	}
+
+	metrics := *p.Metrics
+	metrics.E1RM = E1RM(formula, p.Weight, p.Reps)
+	p.Metrics = &metrics
+	return p
+}
+
+// WithBodyweight returns a copy of the record with the metrics that depend on
+// the user's bodyweight in kilograms: the volume of bodyweight exercises,
+// which move the bodyweight itself, and the e1RM relative to bodyweight. It
+// must be applied before converting units.
+func (p Progress) WithBodyweight(bodyweight float64) Progress {
+	if p.Metrics == nil || bodyweight <= 0 {
+		return p
+	}
+
+	metrics := *p.Metrics
+	switch p.TrackingType {
+	case TrackingReps:
+		metrics.Volume = float64(p.Sets*p.Reps) * bodyweight
+	case TrackingRepsLoad, "":
+		if metrics.E1RM > 0 {
+			metrics.RelativeStrength = math.Round(metrics.E1RM/bodyweight*100) / 100
+		}
+	}
+	p.Metrics = &metrics
+	return p
+}
+
+// progressSelect selects progress records together with the tracking type of
+// their exercise, in the order expected by scanProgress
+const progressSelect = `
+	SELECT p.id, p.user_id, p.workout_id, p.exercise_id, COALESCE(p.session_id, 0), p.sets, p.reps, p.weight, p.duration_seconds, p.distance_meters,
+		p.rpe, p.notes, p.date, p.created_at, e.tracking_type
+	FROM progress p
+	JOIN exercises e ON e.id = p.exercise_id`
+
+// scanProgress scans rows produced by progressSelect
+func scanProgress(rows *sql.Rows) ([]Progress, error) {
+	var progressRecords []Progress
+	for rows.Next() {
+		var progress Progress
+		if err := rows.Scan(&progress.ID, &progress.UserID, &progress.WorkoutID, &progress.ExerciseID, &progress.SessionID,
+			&progress.Sets, &progress.Reps, &progress.Weight, &progress.Duration, &progress.Distance,
+			&progress.RPE, &progress.Notes, &progress.Date, &progress.CreatedAt, &progress.TrackingType); err != nil {
+			return nil, err
+		}
+		progress.Metrics = ComputeMetrics(progress.TrackingType, progress.Measurements())
+		progressRecords = append(progressRecords, progress)
+	}
+
+	return progressRecords, rows.Err()
 }
 
 // CreateProgressTable creates the progress table if it doesn't exist
@@ -27,83 +109,185 @@ func CreateProgressTable(db *sql.DB) error {
 		user_id INT NOT NULL,
 		workout_id INT NOT NULL,
 		exercise_id INT NOT NULL,
+		session_id INT NULL,
 		sets INT NOT NULL,
 		reps INT NOT NULL,
-		weight INT NOT NULL,
+		weight DECIMAL(8,2) NOT NULL,
+		duration_seconds INT NOT NULL DEFAULT 0,
+		distance_meters DECIMAL(10,2) NOT NULL DEFAULT 0,
+		rpe DECIMAL(3,1) NOT NULL DEFAULT 0,
 		notes TEXT,
 		date DATE NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		deleted_at TIMESTAMP NULL,
+		INDEX idx_progress_user_exercise_date (user_id, exercise_id, date),
+		INDEX idx_progress_user_date (user_id, date),
+		INDEX idx_progress_user_workout_date (user_id, workout_id, date),
 		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
 		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE,
-		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE
+		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL
 	);`
 
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// Loads used to be stored as bare integers; they are now kilograms
+	if err := modifyColumnIfType(db, "progress", "weight", "int", "DECIMAL(8,2) NOT NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "progress", "duration_seconds", "INT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "progress", "distance_meters", "DECIMAL(10,2) NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "progress", "session_id", "INT NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "progress", "rpe", "DECIMAL(3,1) NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "progress", "deleted_at", "TIMESTAMP NULL"); err != nil {
+		return err
+	}
+
+	// Composite indexes for filtered history queries
+	if err := createIndexIfMissing(db, "progress", "idx_progress_user_exercise_date", "user_id, exercise_id, date"); err != nil {
+		return err
+	}
+	if err := createIndexIfMissing(db, "progress", "idx_progress_user_date", "user_id, date"); err != nil {
+		return err
+	}
+	if err := createIndexIfMissing(db, "progress", "idx_progress_user_workout_date", "user_id, workout_id, date"); err != nil {
+		return err
+	}
+
+	return backfillSessions(db)
 }
 
-// GetUserProgress retrieves progress records for a specific user
-func GetUserProgress(db *sql.DB, userID int) ([]Progress, error) {
-	query := `
-	SELECT id, user_id, workout_id, exercise_id, sets, reps, weight, notes, date, created_at
-	FROM progress
-	WHERE user_id = ?
-	ORDER BY date DESC, created_at DESC`
+// ProgressFilter limits the progress records returned for a user. Zero
+// values mean no limit; all set fields must match.
+type ProgressFilter struct {
+	ExerciseID int
+	WorkoutID  int
+	SessionID  int
+	From       time.Time
+	To         time.Time
+	Notes      string // matched anywhere in the notes, case-insensitively
+}
+
+// QueryProgress retrieves a user's progress records matching the filter,
+// newest first
+func QueryProgress(db *sql.DB, userID int, filter ProgressFilter) ([]Progress, error) {
+	query, args := filter.where(userID)
+	query = progressSelect + query + `
+	ORDER BY p.date DESC, p.created_at DESC`
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var progressRecords []Progress
-	for rows.Next() {
-		var progress Progress
-		if err := rows.Scan(&progress.ID, &progress.UserID, &progress.WorkoutID, &progress.ExerciseID, 
-			&progress.Sets, &progress.Reps, &progress.Weight, &progress.Notes, &progress.Date, &progress.CreatedAt); err != nil {
-			return nil, err
-		}
-		progressRecords = append(progressRecords, progress)
+	return scanProgress(rows)
+}
+
+// where builds the WHERE clause for the filter. Conditions lead with user_id,
+// exercise_id and date so they can use the composite indexes.
+func (f ProgressFilter) where(userID int) (string, []interface{}) {
+	query := `
+	WHERE p.user_id = ? AND p.deleted_at IS NULL`
+	args := []interface{}{userID}
+
+	if f.ExerciseID != 0 {
+		query += " AND p.exercise_id = ?"
+		args = append(args, f.ExerciseID)
+	}
+	if f.WorkoutID != 0 {
+		query += " AND p.workout_id = ?"
+		args = append(args, f.WorkoutID)
+	}
+	if !f.From.IsZero() {
+		query += " AND p.date >= ?"
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		query += " AND p.date <= ?"
+		args = append(args, f.To)
+	}
+	if f.SessionID != 0 {
+		query += " AND p.session_id = ?"
+		args = append(args, f.SessionID)
 	}
+	if f.Notes != "" {
+		query += " AND p.notes LIKE ?"
+		args = append(args, "%"+escapeLike(f.Notes)+"%")
+	}
+
+	return query, args
+}
+
+// escapeLike escapes the wildcard characters of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
 
-	return progressRecords, nil
+// GetUserProgress retrieves progress records for a specific user
+func GetUserProgress(db *sql.DB, userID int) ([]Progress, error) {
+	return QueryProgress(db, userID, ProgressFilter{})
 }
 
 // GetExerciseProgress retrieves progress records for a specific exercise by a user
 func GetExerciseProgress(db *sql.DB, userID, exerciseID int) ([]Progress, error) {
-	query := `
-	SELECT id, user_id, workout_id, exercise_id, sets, reps, weight, notes, date, created_at
-	FROM progress
-	WHERE user_id = ? AND exercise_id = ?
-	ORDER BY date DESC, created_at DESC`
+	return QueryProgress(db, userID, ProgressFilter{ExerciseID: exerciseID})
+}
 
-	rows, err := db.Query(query, userID, exerciseID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// ProgressDay groups the progress records logged on one day
+type ProgressDay struct {
+	Date    time.Time  `json:"date"`
+	Entries []Progress `json:"entries"`
+}
 
-	var progressRecords []Progress
-	for rows.Next() {
-		var progress Progress
-		if err := rows.Scan(&progress.ID, &progress.UserID, &progress.WorkoutID, &progress.ExerciseID, 
-			&progress.Sets, &progress.Reps, &progress.Weight, &progress.Notes, &progress.Date, &progress.CreatedAt); err != nil {
-			return nil, err
+// GroupProgressByDate groups records by date, keeping their order. Records
+// must already be sorted by date.
+func GroupProgressByDate(progress []Progress) []ProgressDay {
+	days := []ProgressDay{}
+	for _, p := range progress {
+		if len(days) == 0 || !days[len(days)-1].Date.Equal(p.Date) {
+			days = append(days, ProgressDay{Date: p.Date})
 		}
-		progressRecords = append(progressRecords, progress)
+		days[len(days)-1].Entries = append(days[len(days)-1].Entries, p)
 	}
+	return days
+}
+
+// execer runs statements on a database or inside a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
 
-	return progressRecords, nil
+// queryer runs statements and single-row queries on a database or inside a
+// transaction
+type queryer interface {
+	execer
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // RecordProgress adds a new progress record
 func RecordProgress(db *sql.DB, progress Progress) (int, error) {
+	return recordProgress(db, progress)
+}
+
+// recordProgress adds a new progress record through db or a transaction
+func recordProgress(db execer, progress Progress) (int, error) {
 	query := `
-	INSERT INTO progress (user_id, workout_id, exercise_id, sets, reps, weight, notes, date)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	INSERT INTO progress (user_id, workout_id, exercise_id, session_id, sets, reps, weight, duration_seconds, distance_meters, rpe, notes, date)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	result, err := db.Exec(query, progress.UserID, progress.WorkoutID, progress.ExerciseID, 
-		progress.Sets, progress.Reps, progress.Weight, progress.Notes, progress.Date)
+	result, err := db.Exec(query, progress.UserID, progress.WorkoutID, progress.ExerciseID, nullableID(progress.SessionID),
+		progress.Sets, progress.Reps, progress.Weight, progress.Duration, progress.Distance, progress.RPE, progress.Notes, progress.Date)
 	if err != nil {
 		return 0, err
 	}
@@ -112,9 +296,86 @@ func RecordProgress(db *sql.DB, progress Progress) (int, error) {
 	return int(id), err
 }
 
-// DeleteProgress deletes a progress record
+// GetProgress retrieves a user's progress record by ID
+func GetProgress(db *sql.DB, id, userID int) (Progress, error) {
+	query := progressSelect + `
+	WHERE p.id = ? AND p.user_id = ? AND p.deleted_at IS NULL`
+
+	rows, err := db.Query(query, id, userID)
+	if err != nil {
+		return Progress{}, err
+	}
+	defer rows.Close()
+
+	progress, err := scanProgress(rows)
+	if err != nil {
+		return Progress{}, err
+	}
+	if len(progress) == 0 {
+		return Progress{}, sql.ErrNoRows
+	}
+	return progress[0], nil
+}
+
+// UpdateProgress updates a progress record, keeping the replaced version as
+// a revision
+func UpdateProgress(db *sql.DB, previous, progress Progress) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := saveRevision(tx, previous, RevisionUpdated); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	query := `
+	UPDATE progress
+	SET workout_id = ?, exercise_id = ?, session_id = ?, sets = ?, reps = ?, weight = ?,
+		duration_seconds = ?, distance_meters = ?, rpe = ?, notes = ?, date = ?
+	WHERE id = ? AND user_id = ? AND deleted_at IS NULL`
+	_, err = tx.Exec(query, progress.WorkoutID, progress.ExerciseID, nullableID(progress.SessionID),
+		progress.Sets, progress.Reps, progress.Weight, progress.Duration, progress.Distance,
+		progress.RPE, progress.Notes, progress.Date, progress.ID, progress.UserID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteProgress moves a progress record to the trash, keeping it as a
+// revision
 func DeleteProgress(db *sql.DB, id, userID int) error {
-	query := "DELETE FROM progress WHERE id = ? AND user_id = ?"
-	_, err := db.Exec(query, id, userID)
-	return err
-}
\ No newline at end of file
+	previous, err := GetProgress(db, id, userID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := saveRevision(tx, previous, RevisionDeleted); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err := tx.Exec("UPDATE progress SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?", id, userID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RestoreProgress takes a progress record out of the trash and returns it
+func RestoreProgress(db *sql.DB, id, userID int) (Progress, error) {
+	if err := restoreRow(db, "UPDATE progress SET deleted_at = NULL WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID); err != nil {
+		return Progress{}, err
+	}
+	return GetProgress(db, id, userID)
+}
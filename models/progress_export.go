@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// ProgressExport is a progress record with the names of its workout and
+// exercise, so exported rows read on their own
+type ProgressExport struct {
+	Progress
+	WorkoutName  string `json:"workout_name"`
+	ExerciseName string `json:"exercise_name"`
+}
+
+// progressExportSelect selects progress records with their names, in the
+// order expected by ProgressCursor.Row
+const progressExportSelect = `
+	SELECT p.id, p.user_id, p.workout_id, p.exercise_id, COALESCE(p.session_id, 0), p.sets, p.reps, p.weight, p.duration_seconds, p.distance_meters,
+		p.rpe, p.notes, p.date, p.created_at, e.tracking_type, w.name, e.name
+	FROM progress p
+	JOIN exercises e ON e.id = p.exercise_id
+	JOIN workouts w ON w.id = p.workout_id`
+
+// ProgressCursor reads exported progress records one at a time, so exports
+// of long histories are never held in memory. It must be closed.
+type ProgressCursor struct {
+	rows *sql.Rows
+}
+
+// QueryProgressExport opens a cursor over a user's progress records matching
+// the filter, oldest first
+func QueryProgressExport(db *sql.DB, userID int, filter ProgressFilter) (*ProgressCursor, error) {
+	query, args := filter.where(userID)
+	query = progressExportSelect + query + `
+	ORDER BY p.date, p.created_at, p.id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &ProgressCursor{rows: rows}, nil
+}
+
+// Next advances to the next record, reporting false at the end or on error
+func (c *ProgressCursor) Next() bool {
+	return c.rows.Next()
+}
+
+// Row scans the current record, with its metrics computed
+func (c *ProgressCursor) Row() (ProgressExport, error) {
+	var row ProgressExport
+	p := &row.Progress
+	err := c.rows.Scan(&p.ID, &p.UserID, &p.WorkoutID, &p.ExerciseID, &p.SessionID, &p.Sets, &p.Reps, &p.Weight, &p.Duration, &p.Distance,
+		&p.RPE, &p.Notes, &p.Date, &p.CreatedAt, &p.TrackingType, &row.WorkoutName, &row.ExerciseName)
+	if err != nil {
+		return row, err
+	}
+	p.Metrics = ComputeMetrics(p.TrackingType, p.Measurements())
+	return row, nil
+}
+
+// Err returns the error that stopped Next, if any
+func (c *ProgressCursor) Err() error {
+	return c.rows.Err()
+}
+
+// Close releases the cursor's connection
+func (c *ProgressCursor) Close() error {
+	return c.rows.Close()
+}
+
+// ProgressCSVHeader returns the CSV columns of exported progress, naming the
+// units loads, distances and paces are given in
+func ProgressCSVHeader(u Units) []string {
+	return []string{
+		"id", "date", "session_id", "workout_id", "workout_name", "exercise_id", "exercise_name", "tracking_type",
+		"sets", "reps", "weight_" + u.Weight, "duration_seconds", "distance_" + u.Distance, "rpe", "notes",
+		"volume_" + u.Weight, "e1rm_" + u.Weight, "relative_strength", "pace_seconds_per_" + u.Distance, "created_at",
+	}
+}
+
+// CSVRecord returns the row's values in the order of ProgressCSVHeader. The
+// row must already be converted into the export's units.
+func (r ProgressExport) CSVRecord() []string {
+	var metrics ProgressMetrics
+	if r.Metrics != nil {
+		metrics = *r.Metrics
+	}
+	number := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return []string{
+		strconv.Itoa(r.ID), r.Date.Format("2006-01-02"), strconv.Itoa(r.SessionID),
+		strconv.Itoa(r.WorkoutID), r.WorkoutName, strconv.Itoa(r.ExerciseID), r.ExerciseName, r.TrackingType,
+		strconv.Itoa(r.Sets), strconv.Itoa(r.Reps), number(r.Weight), strconv.Itoa(r.Duration), number(r.Distance), number(r.RPE), r.Notes,
+		number(metrics.Volume), number(metrics.E1RM), number(metrics.RelativeStrength), number(metrics.Pace), r.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
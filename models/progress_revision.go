@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Progress revision actions
+const (
+	RevisionUpdated = "updated"
+	RevisionDeleted = "deleted"
+)
+
+// ProgressRevision keeps the version of a progress record that an edit or
+// deletion replaced
+type ProgressRevision struct {
+	ID         int       `json:"id"`
+	ProgressID int       `json:"progress_id"`
+	UserID     int       `json:"user_id"`
+	Revision   int       `json:"revision"`
+	Action     string    `json:"action"`
+	Previous   Progress  `json:"previous"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// CreateProgressRevisionTable creates the progress_revisions table if it
+// doesn't exist. Revisions have no foreign key on progress so the history of
+// a deleted record survives it.
+func CreateProgressRevisionTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS progress_revisions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		progress_id INT NOT NULL,
+		user_id INT NOT NULL,
+		revision INT NOT NULL,
+		action VARCHAR(10) NOT NULL,
+		snapshot JSON NOT NULL,
+		changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_progress_revision (progress_id, revision),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// saveRevision stores the previous version of a progress record
+func saveRevision(tx *sql.Tx, previous Progress, action string) error {
+	// Derived fields aren't part of the stored version
+	previous.Metrics = nil
+	previous.Units = nil
+
+	snapshot, err := json.Marshal(previous)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO progress_revisions (progress_id, user_id, revision, action, snapshot)
+	SELECT ?, ?, COALESCE(MAX(revision), 0) + 1, ?, ?
+	FROM progress_revisions
+	WHERE progress_id = ?`
+	_, err = tx.Exec(query, previous.ID, previous.UserID, action, snapshot, previous.ID)
+	return err
+}
+
+// GetProgressRevisions retrieves the revision history of a progress record,
+// oldest first
+func GetProgressRevisions(db *sql.DB, progressID, userID int) ([]ProgressRevision, error) {
+	query := `
+	SELECT id, progress_id, user_id, revision, action, snapshot, changed_at
+	FROM progress_revisions
+	WHERE progress_id = ? AND user_id = ?
+	ORDER BY revision ASC`
+
+	rows, err := db.Query(query, progressID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []ProgressRevision
+	for rows.Next() {
+		var revision ProgressRevision
+		var snapshot []byte
+		if err := rows.Scan(&revision.ID, &revision.ProgressID, &revision.UserID, &revision.Revision,
+			&revision.Action, &snapshot, &revision.ChangedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(snapshot, &revision.Previous); err != nil {
+			return nil, err
+		}
+		revision.Previous.Metrics = ComputeMetrics(revision.Previous.TrackingType, revision.Previous.Measurements())
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
@@ -0,0 +1,353 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// Formulas for estimating a one-rep max
+const (
+	FormulaEpley   = "epley"
+	FormulaBrzycki = "brzycki"
+	FormulaWathan  = "wathan"
+)
+
+// Personal record types
+const (
+	RecordHeaviestLoad = "heaviest_load"
+	RecordMostReps     = "most_reps"
+	RecordBestE1RM     = "best_e1rm"
+	RecordBestVolume   = "best_volume"
+)
+
+// IsValidFormula reports whether f is a supported e1RM formula
+func IsValidFormula(f string) bool {
+	return f == FormulaEpley || f == FormulaBrzycki || f == FormulaWathan
+}
+
+// E1RM estimates the one-rep max for a set of reps at weight. A single rep
+// is its own max; Brzycki is undefined from 37 reps on and returns 0.
+func E1RM(formula string, weight float64, reps int) float64 {
+	if weight <= 0 || reps <= 0 {
+		return 0
+	}
+	if reps == 1 {
+		return weight
+	}
+
+	r := float64(reps)
+	switch formula {
+	case FormulaBrzycki:
+		if reps >= 37 {
+			return 0
+		}
+		return weight * 36 / (37 - r)
+	case FormulaWathan:
+		return 100 * weight / (48.8 + 53.8*math.Exp(-0.075*r))
+	default:
+		return weight * (1 + r/30)
+	}
+}
+
+// PersonalRecord represents a personal record set by a progress entry. For
+// most_reps records Weight is the load the reps were done at.
+type PersonalRecord struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	ExerciseID int       `json:"exercise_id"`
+	RecordType string    `json:"record_type"`
+	Value      float64   `json:"value"`
+	Weight     float64   `json:"weight"`
+	Reps       int       `json:"reps"`
+	Formula    string    `json:"formula,omitempty"`
+	ProgressID *int      `json:"progress_id"`
+	AchievedOn time.Time `json:"achieved_on"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Previous is the value this record beat, if any
+	Previous *float64 `json:"previous,omitempty"`
+
+	// Units is set once the record has been converted for a response
+	Units *Units `json:"units,omitempty"`
+}
+
+// IsLoad reports whether the record's value is a load
+func (r PersonalRecord) IsLoad() bool {
+	return r.RecordType != RecordMostReps
+}
+
+// InUnits returns a copy of the record expressed in u
+func (r PersonalRecord) InUnits(u Units) PersonalRecord {
+	r.Weight = RoundWeight(u.WeightFromKg(r.Weight))
+	if r.IsLoad() {
+		r.Value = RoundWeight(u.WeightFromKg(r.Value))
+		if r.Previous != nil {
+			previous := RoundWeight(u.WeightFromKg(*r.Previous))
+			r.Previous = &previous
+		}
+	}
+	r.Units = &u
+	return r
+}
+
+// CreateRecordsTable creates the personal_records table if it doesn't exist
+func CreateRecordsTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS personal_records (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		exercise_id INT NOT NULL,
+		record_type VARCHAR(20) NOT NULL,
+		value DECIMAL(12,2) NOT NULL,
+		weight DECIMAL(8,2) NOT NULL DEFAULT 0,
+		reps INT NOT NULL DEFAULT 0,
+		formula VARCHAR(10) NOT NULL DEFAULT '',
+		progress_id INT NULL,
+		achieved_on DATE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_records_user_exercise (user_id, exercise_id, record_type),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE,
+		FOREIGN KEY (progress_id) REFERENCES progress(id) ON DELETE SET NULL
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// recordCandidates returns the records a progress entry could set
+func recordCandidates(progress Progress, formula string) []PersonalRecord {
+	base := PersonalRecord{
+		UserID:     progress.UserID,
+		ExerciseID: progress.ExerciseID,
+		Weight:     progress.Weight,
+		Reps:       progress.Reps,
+		ProgressID: &progress.ID,
+		AchievedOn: progress.Date,
+	}
+
+	var candidates []PersonalRecord
+	add := func(recordType string, value float64, formula string) {
+		record := base
+		record.RecordType = recordType
+		record.Value = math.Round(value*100) / 100
+		record.Formula = formula
+		candidates = append(candidates, record)
+	}
+
+	switch progress.TrackingType {
+	case TrackingRepsLoad, "":
+		if progress.Weight > 0 {
+			add(RecordHeaviestLoad, progress.Weight, "")
+			add(RecordMostReps, float64(progress.Reps), "")
+			add(RecordBestE1RM, E1RM(formula, progress.Weight, progress.Reps), formula)
+			add(RecordBestVolume, float64(progress.Sets*progress.Reps)*progress.Weight, "")
+		}
+	case TrackingReps:
+		add(RecordMostReps, float64(progress.Reps), "")
+	}
+
+	return candidates
+}
+
+// earlierRecordSQL matches the records o of the same kind as the record r
+// that were set before it. A record with an earlier one beat it.
+const earlierRecordSQL = `o.user_id = r.user_id AND o.exercise_id = r.exercise_id
+	AND o.record_type = r.record_type AND o.formula = r.formula
+	AND (r.record_type <> 'most_reps' OR o.weight = r.weight)
+	AND (o.achieved_on < r.achieved_on OR o.achieved_on = r.achieved_on AND o.id < r.id)`
+
+// sameKindSQL matches the records of the same kind as a candidate, given its
+// user, exercise, record type and formula. Most-reps records are compared at
+// the same load and e1RM records with the same formula.
+func sameKindSQL(candidate PersonalRecord) (string, []interface{}) {
+	query := "user_id = ? AND exercise_id = ? AND record_type = ? AND formula = ?"
+	args := []interface{}{candidate.UserID, candidate.ExerciseID, candidate.RecordType, candidate.Formula}
+	if candidate.RecordType == RecordMostReps {
+		query += " AND weight = ?"
+		args = append(args, candidate.Weight)
+	}
+	return query, args
+}
+
+// bestBefore returns the best value recorded for the same kind of record as
+// candidate up to its date, or nil if there is none. Records from later
+// dates don't count, so a backdated entry is compared with what stood then.
+func bestBefore(db queryer, candidate PersonalRecord) (*float64, error) {
+	kind, args := sameKindSQL(candidate)
+	query := "SELECT MAX(value) FROM personal_records WHERE " + kind + " AND achieved_on <= ?"
+	args = append(args, candidate.AchievedOn)
+
+	var best sql.NullFloat64
+	if err := db.QueryRow(query, args...).Scan(&best); err != nil {
+		return nil, err
+	}
+	if !best.Valid {
+		return nil, nil
+	}
+	return &best.Float64, nil
+}
+
+// DetectRecords compares a newly recorded progress entry against the user's
+// records for the exercise as they stood on its date and stores every record
+// it beats. The progress entry must have its ID and TrackingType set. The
+// new records are returned.
+func DetectRecords(db *sql.DB, progress Progress, formula string) ([]PersonalRecord, error) {
+	return detectRecords(db, progress, formula)
+}
+
+// detectRecords detects records through db or a transaction. Later records
+// that a backdated entry matches or beats were never records, and are
+// removed.
+func detectRecords(db queryer, progress Progress, formula string) ([]PersonalRecord, error) {
+	var newRecords []PersonalRecord
+	for _, candidate := range recordCandidates(progress, formula) {
+		if candidate.Value <= 0 {
+			continue
+		}
+
+		best, err := bestBefore(db, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if best != nil && candidate.Value <= *best {
+			continue
+		}
+
+		kind, args := sameKindSQL(candidate)
+		args = append(args, candidate.AchievedOn, candidate.Value)
+		if _, err := db.Exec("DELETE FROM personal_records WHERE "+kind+" AND achieved_on > ? AND value <= ?", args...); err != nil {
+			return nil, err
+		}
+
+		candidate.Previous = best
+		id, err := createRecord(db, candidate)
+		if err != nil {
+			return nil, err
+		}
+		candidate.ID = id
+		newRecords = append(newRecords, candidate)
+	}
+
+	return newRecords, nil
+}
+
+// createRecord stores a personal record
+func createRecord(db execer, record PersonalRecord) (int, error) {
+	query := `
+	INSERT INTO personal_records (user_id, exercise_id, record_type, value, weight, reps, formula, progress_id, achieved_on)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := db.Exec(query, record.UserID, record.ExerciseID, record.RecordType, record.Value,
+		record.Weight, record.Reps, record.Formula, record.ProgressID, record.AchievedOn)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetUserRecords retrieves the record history of a user, optionally limited
+// to one exercise, oldest first
+func GetUserRecords(db *sql.DB, userID, exerciseID int) ([]PersonalRecord, error) {
+	query := `
+	SELECT id, user_id, exercise_id, record_type, value, weight, reps, formula, progress_id, achieved_on, created_at
+	FROM personal_records
+	WHERE user_id = ?`
+	args := []interface{}{userID}
+	if exerciseID != 0 {
+		query += " AND exercise_id = ?"
+		args = append(args, exerciseID)
+	}
+	query += " ORDER BY achieved_on ASC, id ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []PersonalRecord
+	for rows.Next() {
+		var record PersonalRecord
+		var progressID sql.NullInt64
+		if err := rows.Scan(&record.ID, &record.UserID, &record.ExerciseID, &record.RecordType, &record.Value,
+			&record.Weight, &record.Reps, &record.Formula, &progressID, &record.AchievedOn, &record.CreatedAt); err != nil {
+			return nil, err
+		}
+		if progressID.Valid {
+			id := int(progressID.Int64)
+			record.ProgressID = &id
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// CurrentRecords reduces a record history to the current best of every
+// record kind, in the order the kinds were first set
+func CurrentRecords(history []PersonalRecord) []PersonalRecord {
+	type key struct {
+		exerciseID int
+		recordType string
+		formula    string
+		weight     float64
+	}
+
+	index := make(map[key]int)
+	var current []PersonalRecord
+	for _, record := range history {
+		k := key{record.ExerciseID, record.RecordType, record.Formula, 0}
+		if record.RecordType == RecordMostReps {
+			k.weight = record.Weight
+		}
+
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(current)
+			current = append(current, record)
+			continue
+		}
+		if record.Value > current[i].Value {
+			current[i] = record
+		}
+	}
+
+	return current
+}
+
+// RebuildRecords recomputes a user's records for an exercise by replaying
+// their progress in the order it was performed. It is used after progress
+// has been edited or deleted. Only the e1RM records of formula are rebuilt;
+// those of other formulas are kept. The rebuild happens in one transaction,
+// so a failure leaves the old records in place.
+func RebuildRecords(db *sql.DB, userID, exerciseID int, formula string) error {
+	progress, err := QueryProgress(db, userID, ProgressFilter{ExerciseID: exerciseID})
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := "DELETE FROM personal_records WHERE user_id = ? AND exercise_id = ? AND formula IN ('', ?)"
+	if _, err := tx.Exec(query, userID, exerciseID, formula); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// QueryProgress returns the newest entries first
+	for i := len(progress) - 1; i >= 0; i-- {
+		if _, err := detectRecords(tx, progress[i], formula); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Recurrence is the supported subset of an iCalendar RRULE: FREQ (DAILY,
+// WEEKLY or MONTHLY), INTERVAL, BYDAY for weekly rules, COUNT and UNTIL
+type Recurrence struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    time.Time
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE,FR" or
+// "FREQ=DAILY;INTERVAL=3". A leading "RRULE:" is ignored.
+func ParseRRule(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, errors.New("invalid rule part: " + part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != FreqDaily && r.Freq != FreqWeekly && r.Freq != FreqMonthly {
+				return r, errors.New("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return r, errors.New("INTERVAL must be a positive number")
+			}
+			r.Interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return r, errors.New("invalid BYDAY value: " + day)
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return r, errors.New("COUNT must be a positive number")
+			}
+			r.Count = count
+		case "UNTIL":
+			until, err := time.Parse("20060102", value[:min(len(value), 8)])
+			if err != nil {
+				return r, errors.New("UNTIL must be a date such as 20250131")
+			}
+			r.Until = until
+		default:
+			return r, errors.New("unsupported rule part: " + key)
+		}
+	}
+
+	if r.Freq == "" {
+		return r, errors.New("FREQ is required")
+	}
+	if len(r.ByDay) > 0 && r.Freq != FreqWeekly {
+		return r, errors.New("BYDAY is only supported for weekly rules")
+	}
+	return r, nil
+}
+
+// matches reports whether date is an occurrence of a rule starting on start.
+// Weeks are counted from the week containing start.
+func (r Recurrence) matches(start, date time.Time, weekStart time.Weekday) bool {
+	switch r.Freq {
+	case FreqDaily:
+		days := int(date.Sub(start).Hours() / 24)
+		return days%r.Interval == 0
+	case FreqWeekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		onDay := false
+		for _, day := range days {
+			if date.Weekday() == day {
+				onDay = true
+			}
+		}
+		weeks := int(BucketStart(BucketWeek, date, weekStart).Sub(BucketStart(BucketWeek, start, weekStart)).Hours() / (24 * 7))
+		return onDay && weeks%r.Interval == 0
+	case FreqMonthly:
+		months := (date.Year()-start.Year())*12 + int(date.Month()-start.Month())
+		return date.Day() == start.Day() && months%r.Interval == 0
+	}
+	return false
+}
+
+// Occurrences returns the dates of a rule starting on start that fall
+// between from and to, inclusive. Dates are calendar days.
+func (r Recurrence) Occurrences(start, from, to time.Time, weekStart time.Weekday) []time.Time {
+	start = BucketStart(BucketDay, start, weekStart)
+	end := to
+	if !r.Until.IsZero() && r.Until.Before(end) {
+		end = r.Until
+	}
+
+	// COUNT limits occurrences from the start, so iterate from there
+	var occurrences []time.Time
+	count := 0
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		if !r.matches(start, date, weekStart) {
+			continue
+		}
+		count++
+		if r.Count > 0 && count > r.Count {
+			break
+		}
+		if !date.Before(from) {
+			occurrences = append(occurrences, date)
+		}
+	}
+	return occurrences
+}
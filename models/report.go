@@ -0,0 +1,427 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultReportHour is the local hour reports are sent at when REPORT_HOUR
+// isn't set
+const defaultReportHour = 7
+
+// maxReportAttempts is how many times delivering a report is tried
+const maxReportAttempts = 3
+
+// reportSendTimeout is how long a delivery can stay claimed before it is
+// taken to have been cut off, such as by a crash, and tried again
+const reportSendTimeout = 30 * time.Minute
+
+// Report delivery statuses
+const (
+	DeliverySending = "sending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliverySkipped = "skipped"
+)
+
+// ReportHour returns the hour of the day, in each user's time zone, from
+// which reports for the period just ended are sent, read from REPORT_HOUR
+func ReportHour() int {
+	hour, err := strconv.Atoi(os.Getenv("REPORT_HOUR"))
+	if err != nil || hour < 0 || hour > 23 {
+		hour = defaultReportHour
+	}
+	return hour
+}
+
+// IsValidReportPeriod reports whether p is a supported report period: week
+// or month
+func IsValidReportPeriod(p string) bool {
+	return p == BucketWeek || p == BucketMonth
+}
+
+// ReportTotals sums up a period of training. Volume is in kilograms until
+// converted. Planned counts the workouts scheduled or programmed in the
+// period, and PlannedCompleted those that were done.
+type ReportTotals struct {
+	Sessions         int     `json:"sessions"`
+	Planned          int     `json:"planned"`
+	PlannedCompleted int     `json:"planned_completed"`
+	TrainingDays     int     `json:"training_days"`
+	Sets             int     `json:"sets"`
+	Reps             int     `json:"reps"`
+	Volume           float64 `json:"volume"`
+	Records          int     `json:"records"`
+}
+
+// ReportChange compares a period with the one before it. VolumePercent is
+// missing when the previous period had no volume.
+type ReportChange struct {
+	Sessions      int      `json:"sessions"`
+	Volume        float64  `json:"volume"`
+	VolumePercent *float64 `json:"volume_percent,omitempty"`
+	Records       int      `json:"records"`
+}
+
+// MuscleGroupShare is a muscle group's share of the sets of a period
+type MuscleGroupShare struct {
+	MuscleGroup string  `json:"muscle_group"`
+	Sets        int     `json:"sets"`
+	Percent     float64 `json:"percent"`
+}
+
+// ReportRecord is a personal record beaten in a period, with the value it
+// beat as Previous
+type ReportRecord struct {
+	PersonalRecord
+	ExerciseName string `json:"exercise_name"`
+}
+
+// Report is a summary of a user's training over a week or a month, compared
+// with the period before it. The streak is as of the end of the period.
+type Report struct {
+	UserID       int                `json:"user_id"`
+	Period       string             `json:"period"`
+	Start        time.Time          `json:"start"`
+	End          time.Time          `json:"end"`
+	Totals       ReportTotals       `json:"totals"`
+	Previous     ReportTotals       `json:"previous"`
+	Change       ReportChange       `json:"change"`
+	Records      []ReportRecord     `json:"records"`
+	MuscleGroups []MuscleGroupShare `json:"muscle_groups"`
+	Streak       Streak             `json:"streak"`
+	Unit         string             `json:"unit"`
+}
+
+// IsEmpty reports whether there is nothing to tell in the report: no
+// training or plans in the period and no training in the one before it
+func (r Report) IsEmpty() bool {
+	return r.Totals.Sessions == 0 && r.Totals.Planned == 0 && r.Previous.Sessions == 0
+}
+
+// InUnits returns a copy of the report expressed in u
+func (r Report) InUnits(u Units) Report {
+	r.Unit = u.Weight
+	r.Totals.Volume = RoundWeight(u.WeightFromKg(r.Totals.Volume))
+	r.Previous.Volume = RoundWeight(u.WeightFromKg(r.Previous.Volume))
+	r.Change.Volume = RoundWeight(u.WeightFromKg(r.Change.Volume))
+
+	records := make([]ReportRecord, len(r.Records))
+	for i, record := range r.Records {
+		record.PersonalRecord = record.PersonalRecord.InUnits(u)
+		records[i] = record
+	}
+	r.Records = records
+	return r
+}
+
+// LastReportPeriod returns the first day of the last period to have ended
+// by today
+func LastReportPeriod(period string, today time.Time, weekStart time.Weekday) time.Time {
+	current := BucketStart(period, today, weekStart)
+	if period == BucketMonth {
+		return current.AddDate(0, -1, 0)
+	}
+	return current.AddDate(0, 0, -7)
+}
+
+// BuildReport summarizes a user's training over the week or month starting
+// at start
+func BuildReport(db *sql.DB, userID int, period string, start time.Time, prefs Preferences) (Report, error) {
+	end := nextBucket(period, start).AddDate(0, 0, -1)
+	report := Report{UserID: userID, Period: period, Start: start, End: end,
+		Records: []ReportRecord{}, MuscleGroups: []MuscleGroupShare{}}
+
+	totals, sets, err := reportTotals(db, userID, period, start, end, prefs)
+	if err != nil {
+		return report, err
+	}
+	report.Totals = totals
+
+	previousStart := start.AddDate(0, 0, -7)
+	if period == BucketMonth {
+		previousStart = start.AddDate(0, -1, 0)
+	}
+	report.Previous, _, err = reportTotals(db, userID, period, previousStart, start.AddDate(0, 0, -1), prefs)
+	if err != nil {
+		return report, err
+	}
+
+	report.Change = ReportChange{
+		Sessions: report.Totals.Sessions - report.Previous.Sessions,
+		Volume:   report.Totals.Volume - report.Previous.Volume,
+		Records:  report.Totals.Records - report.Previous.Records,
+	}
+	if report.Previous.Volume > 0 {
+		percent := math.Round(report.Change.Volume/report.Previous.Volume*1000) / 10
+		report.Change.VolumePercent = &percent
+	}
+
+	if report.Records, err = reportRecords(db, userID, start, end, prefs.E1RMFormula); err != nil {
+		return report, err
+	}
+
+	for group, n := range sets {
+		percent := 0.0
+		if report.Totals.Sets > 0 {
+			percent = math.Round(float64(n)/float64(report.Totals.Sets)*1000) / 10
+		}
+		report.MuscleGroups = append(report.MuscleGroups, MuscleGroupShare{MuscleGroup: group, Sets: n, Percent: percent})
+	}
+	sort.Slice(report.MuscleGroups, func(i, j int) bool {
+		a, b := report.MuscleGroups[i], report.MuscleGroups[j]
+		return a.Sets > b.Sets || a.Sets == b.Sets && a.MuscleGroup < b.MuscleGroup
+	})
+
+	// The streak as of the end of the period, which breaks it if the last
+	// week went without training
+	dates, err := sessionDates(db, userID, time.Time{}, end)
+	if err != nil {
+		return report, err
+	}
+	_, report.Streak = streakTimeline(dates, prefs.WeekStart(), end.AddDate(0, 0, 1))
+
+	return report, nil
+}
+
+// reportTotals sums up from..to, returning the sets per muscle group too
+func reportTotals(db *sql.DB, userID int, period string, from, to time.Time, prefs Preferences) (ReportTotals, map[string]int, error) {
+	var totals ReportTotals
+
+	rollups, err := GetDailyRollups(db, userID, AnalyticsFilter{From: from, To: to})
+	if err != nil {
+		return totals, nil, err
+	}
+	series, err := BuildSeries(rollups, period, from, to, prefs.WeekStart())
+	if err != nil {
+		return totals, nil, err
+	}
+	bucket := series[0]
+	totals.TrainingDays = bucket.TrainingDays
+	totals.Sets = bucket.Sets
+	totals.Reps = bucket.Reps
+	totals.Volume = bucket.Volume
+
+	dates, err := sessionDates(db, userID, from, to)
+	if err != nil {
+		return totals, nil, err
+	}
+	totals.Sessions = len(dates)
+
+	calendar, err := GetCalendar(db, userID, from, to, prefs)
+	if err != nil {
+		return totals, nil, err
+	}
+	for _, entry := range calendar {
+		if entry.Source == CalendarSourceSession {
+			continue
+		}
+		totals.Planned++
+		if entry.Status == CalendarCompleted {
+			totals.PlannedCompleted++
+		}
+	}
+
+	query := `
+	SELECT COUNT(*)
+	FROM personal_records r
+	WHERE r.user_id = ? AND r.formula IN ('', ?) AND r.achieved_on BETWEEN ? AND ?
+		AND EXISTS (SELECT 1 FROM personal_records o WHERE ` + earlierRecordSQL + `)`
+	if err := db.QueryRow(query, userID, prefs.E1RMFormula, from, to).Scan(&totals.Records); err != nil {
+		return totals, nil, err
+	}
+
+	return totals, bucket.SetsPerMuscleGroup, nil
+}
+
+// reportRecords returns the records beaten in from..to, keeping only the
+// best of each kind per exercise, by exercise name
+func reportRecords(db *sql.DB, userID int, from, to time.Time, formula string) ([]ReportRecord, error) {
+	query := `
+	SELECT r.id, r.user_id, r.exercise_id, e.name, r.record_type, r.value, r.weight, r.reps, r.formula, r.achieved_on,
+		r.created_at, (SELECT MAX(o.value) FROM personal_records o WHERE ` + earlierRecordSQL + `) AS previous
+	FROM personal_records r
+	JOIN exercises e ON e.id = r.exercise_id
+	WHERE r.user_id = ? AND r.formula IN ('', ?) AND r.achieved_on BETWEEN ? AND ?
+	ORDER BY e.name, r.record_type, r.weight, r.achieved_on, r.id`
+	rows, err := db.Query(query, userID, formula, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type kind struct {
+		exerciseID int
+		recordType string
+		weight     float64
+	}
+	index := make(map[kind]int)
+	records := []ReportRecord{}
+	for rows.Next() {
+		var record ReportRecord
+		var previous sql.NullFloat64
+		if err := rows.Scan(&record.ID, &record.UserID, &record.ExerciseID, &record.ExerciseName, &record.RecordType,
+			&record.Value, &record.Weight, &record.Reps, &record.Formula, &record.AchievedOn, &record.CreatedAt, &previous); err != nil {
+			return nil, err
+		}
+
+		// First entries of an exercise set records without beating any
+		if !previous.Valid {
+			continue
+		}
+
+		k := kind{record.ExerciseID, record.RecordType, 0}
+		if record.RecordType == RecordMostReps {
+			k.weight = record.Weight
+		}
+		if i, ok := index[k]; ok {
+			// Keep the value beaten at the start of the period
+			record.Previous = records[i].Previous
+			records[i] = record
+			continue
+		}
+		record.Previous = &previous.Float64
+		index[k] = len(records)
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// CreateReportDeliveryTable creates the report_deliveries table if it
+// doesn't exist. A row is claimed before a report is sent, so each report is
+// sent once, barring a crash mid-send.
+func CreateReportDeliveryTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS report_deliveries (
+		user_id INT NOT NULL,
+		period VARCHAR(10) NOT NULL,
+		period_start DATE NOT NULL,
+		status VARCHAR(10) NOT NULL,
+		attempts INT NOT NULL DEFAULT 1,
+		error TEXT,
+		sent_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, period, period_start),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// ClaimReportDelivery claims sending a user's report for a period. It
+// reports false if the report was already sent, skipped or is being sent,
+// or has failed too often to try again. A delivery left sending for longer
+// than reportSendTimeout is claimed again, so a crash mid-send can deliver a
+// report twice rather than never.
+func ClaimReportDelivery(db *sql.DB, userID int, period string, start time.Time) (bool, error) {
+	query := "INSERT IGNORE INTO report_deliveries (user_id, period, period_start, status) VALUES (?, ?, ?, ?)"
+	result, err := db.Exec(query, userID, period, start, DeliverySending)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return n > 0, err
+	}
+
+	query = `
+	UPDATE report_deliveries SET status = ?, attempts = attempts + 1
+	WHERE user_id = ? AND period = ? AND period_start = ? AND attempts < ?
+		AND (status = ? OR status = ? AND updated_at < ?)`
+	result, err = db.Exec(query, DeliverySending, userID, period, start, maxReportAttempts,
+		DeliveryFailed, DeliverySending, time.Now().Add(-reportSendTimeout))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// FinishReportDelivery records how a claimed delivery went
+func FinishReportDelivery(db *sql.DB, userID int, period string, start time.Time, status string, deliveryErr error) error {
+	var message interface{}
+	if deliveryErr != nil {
+		message = deliveryErr.Error()
+	}
+	var sentAt interface{}
+	if status == DeliverySent {
+		sentAt = time.Now()
+	}
+
+	query := "UPDATE report_deliveries SET status = ?, error = ?, sent_at = ? WHERE user_id = ? AND period = ? AND period_start = ?"
+	_, err := db.Exec(query, status, message, sentAt, userID, period, start)
+	return err
+}
+
+// ReportRecipient is a user who may be due a report
+type ReportRecipient struct {
+	User  User
+	Prefs Preferences
+}
+
+// GetReportRecipients retrieves the active users who want weekly or monthly
+// reports, with their preferences
+func GetReportRecipients(db *sql.DB) ([]ReportRecipient, error) {
+	query := `
+	SELECT u.id, u.username, u.email
+	FROM users u
+	LEFT JOIN user_preferences p ON p.user_id = u.id
+	WHERE u.deleted_at IS NULL AND (p.user_id IS NULL OR p.weekly_report OR p.monthly_report)
+	ORDER BY u.id`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	recipients := make([]ReportRecipient, 0, len(users))
+	for _, user := range users {
+		prefs, err := GetPreferences(db, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, ReportRecipient{User: user, Prefs: prefs})
+	}
+	return recipients, nil
+}
+
+// DueReportPeriods returns the periods whose report a user is due at now:
+// those they want whose last period has ended, from ReportHour on the
+// first day after it in their time zone
+func DueReportPeriods(prefs Preferences, now time.Time) map[string]time.Time {
+	local := now.In(prefs.Location())
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	due := make(map[string]time.Time)
+	for period, wanted := range map[string]bool{BucketWeek: prefs.WeeklyReport, BucketMonth: prefs.MonthlyReport} {
+		if !wanted {
+			continue
+		}
+		start := LastReportPeriod(period, today, prefs.WeekStart())
+		firstDayAfter := nextBucket(period, start)
+		if today.Equal(firstDayAfter) && local.Hour() < ReportHour() {
+			continue
+		}
+		due[period] = start
+	}
+	return due
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"math"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// ReportEmail is a report rendered as an email
+type ReportEmail struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// reportView is what the email templates see: the report in the user's
+// units with its labels worked out
+type reportView struct {
+	Report
+	Name       string
+	Title      string
+	Noun       string
+	Dates      string
+	VolumeText string
+	Change     string
+	Records    []string
+	Groups     []string
+	StreakText string
+}
+
+var reportText = texttemplate.Must(texttemplate.New("report").Parse(`Hi {{.Name}},
+
+Here is your {{.Noun}} in training, {{.Dates}}.
+
+Sessions: {{.Totals.Sessions}}{{if .Totals.Planned}} ({{.Totals.PlannedCompleted}} of {{.Totals.Planned}} planned done){{end}}
+Training days: {{.Totals.TrainingDays}}
+Volume: {{.VolumeText}}
+Sets: {{.Totals.Sets}}, reps: {{.Totals.Reps}}
+
+Compared with the {{.Noun}} before: {{.Change}}
+{{if .Records}}
+New personal records:
+{{range .Records}}- {{.}}
+{{end}}{{end}}{{if .Groups}}
+Muscle-group balance, by sets:
+{{range .Groups}}- {{.}}
+{{end}}{{end}}
+Streak: {{.StreakText}}
+`))
+
+var reportHTML = htmltemplate.Must(htmltemplate.New("report").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222; max-width: 600px;">
+<h1 style="font-size: 20px;">{{.Title}}</h1>
+<p>Hi {{.Name}}, here is your {{.Noun}} in training, {{.Dates}}.</p>
+<table cellpadding="6" style="border-collapse: collapse;">
+<tr><td>Sessions</td><td><strong>{{.Totals.Sessions}}</strong>{{if .Totals.Planned}} ({{.Totals.PlannedCompleted}} of {{.Totals.Planned}} planned done){{end}}</td></tr>
+<tr><td>Training days</td><td><strong>{{.Totals.TrainingDays}}</strong></td></tr>
+<tr><td>Volume</td><td><strong>{{.VolumeText}}</strong></td></tr>
+<tr><td>Sets and reps</td><td><strong>{{.Totals.Sets}}</strong> sets, <strong>{{.Totals.Reps}}</strong> reps</td></tr>
+</table>
+<p>Compared with the {{.Noun}} before: {{.Change}}</p>
+{{if .Records}}<h2 style="font-size: 16px;">New personal records</h2>
+<ul>{{range .Records}}<li>{{.}}</li>{{end}}</ul>
+{{end}}{{if .Groups}}<h2 style="font-size: 16px;">Muscle-group balance</h2>
+<ul>{{range .Groups}}<li>{{.}}</li>{{end}}</ul>
+{{end}}<h2 style="font-size: 16px;">Streak</h2>
+<p>{{.StreakText}}</p>
+</body>
+</html>
+`))
+
+// RenderReport renders a report, already in the user's units, as an email
+// addressed to name
+func RenderReport(r Report, name string) (ReportEmail, error) {
+	view := reportView{Report: r, Name: name, Noun: "week", Title: "Your week in training"}
+	view.Dates = r.Start.Format("Jan 2") + " to " + r.End.Format("Jan 2, 2006")
+	if r.Period == BucketMonth {
+		view.Noun, view.Title = "month", "Your month in training"
+		view.Dates = r.Start.Format("January 2006")
+	}
+
+	view.VolumeText = formatNumber(r.Totals.Volume) + " " + r.Unit
+
+	changes := []string{signedCount(r.Change.Sessions, "session")}
+	volume := signedNumber(r.Change.Volume) + " " + r.Unit + " volume"
+	if r.Change.VolumePercent != nil {
+		volume += " (" + signedNumber(*r.Change.VolumePercent) + "%)"
+	}
+	changes = append(changes, volume, signedCount(r.Change.Records, "record"))
+	view.Change = strings.Join(changes, ", ")
+
+	for _, record := range r.Records {
+		view.Records = append(view.Records, describeRecord(record, r.Unit))
+	}
+	for _, group := range r.MuscleGroups {
+		view.Groups = append(view.Groups, group.MuscleGroup+": "+plural(group.Sets, "set")+" ("+formatNumber(group.Percent)+"%)")
+	}
+
+	switch streak := r.Streak; {
+	case streak.CurrentWeeks > 0:
+		view.StreakText = plural(streak.CurrentWeeks, "week") + " in a row"
+		if streak.CurrentWeeks == streak.LongestWeeks && streak.CurrentWeeks > 1 {
+			view.StreakText += ", your longest yet"
+		} else if streak.LongestWeeks > streak.CurrentWeeks {
+			view.StreakText += " (longest: " + plural(streak.LongestWeeks, "week") + ")"
+		}
+	case streak.LongestWeeks > 0:
+		view.StreakText = "No streak right now. Train this week to start a new one (longest: " + plural(streak.LongestWeeks, "week") + ")."
+	default:
+		view.StreakText = "Train this week to start a streak."
+	}
+
+	email := ReportEmail{Subject: view.Title + ": " + view.Dates}
+	var text, html bytes.Buffer
+	if err := reportText.Execute(&text, view); err != nil {
+		return email, err
+	}
+	if err := reportHTML.Execute(&html, view); err != nil {
+		return email, err
+	}
+	email.Text, email.HTML = text.String(), html.String()
+	return email, nil
+}
+
+// describeRecord describes a beaten record, such as "Bench press: best e1RM
+// 105 kg (was 100 kg)"
+func describeRecord(r ReportRecord, unit string) string {
+	value := func(v float64) string {
+		if r.RecordType == RecordMostReps {
+			return formatNumber(v) + " reps at " + formatNumber(r.Weight) + " " + unit
+		}
+		return formatNumber(v) + " " + unit
+	}
+
+	label := map[string]string{
+		RecordHeaviestLoad: "heaviest load",
+		RecordMostReps:     "most reps",
+		RecordBestE1RM:     "best e1RM",
+		RecordBestVolume:   "best volume",
+	}[r.RecordType]
+
+	description := r.ExerciseName + ": " + label + " " + value(r.Value)
+	if r.Previous != nil {
+		previous := formatNumber(*r.Previous) + " " + unit
+		if r.RecordType == RecordMostReps {
+			previous = plural(int(*r.Previous), "rep")
+		}
+		description += " (was " + previous + ")"
+	}
+	return description
+}
+
+// formatNumber formats a number with thousands separators and at most one
+// decimal
+func formatNumber(v float64) string {
+	v = math.Round(v*10) / 10
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+
+	whole := strconv.FormatInt(int64(v), 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	if fraction := math.Round((v - math.Trunc(v)) * 10); fraction > 0 {
+		whole += "." + strconv.Itoa(int(fraction))
+	}
+	return sign + whole
+}
+
+// signedCount formats a change in a count of a noun, such as "+2 sessions"
+func signedCount(n int, noun string) string {
+	count := plural(n, noun)
+	if n > 0 {
+		return "+" + count
+	}
+	return count
+}
+
+// signedNumber formats v like formatNumber, with its sign
+func signedNumber(v float64) string {
+	if v > 0 {
+		return "+" + formatNumber(v)
+	}
+	return formatNumber(v)
+}
+
+// plural formats a count of a noun, adding an s unless there is one
+func plural(n int, noun string) string {
+	if n == 1 || n == -1 {
+		return strconv.Itoa(n) + " " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
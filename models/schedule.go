@@ -0,0 +1,270 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Schedule exception actions
+const (
+	ExceptionSkip = "skip"
+	ExceptionMove = "move"
+)
+
+// Schedule plans a workout for a user, either once on StartDate or
+// repeatedly following RRule. StartTime is an optional "HH:MM" local time.
+type Schedule struct {
+	ID              int                 `json:"id"`
+	UserID          int                 `json:"user_id"`
+	WorkoutID       int                 `json:"workout_id"`
+	StartDate       time.Time           `json:"start_date"`
+	RRule           string              `json:"rrule"`
+	StartTime       string              `json:"start_time"`
+	DurationMinutes int                 `json:"duration_minutes"`
+	Exceptions      []ScheduleException `json:"exceptions"`
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+}
+
+// ScheduleException skips or moves a single occurrence of a schedule
+type ScheduleException struct {
+	OccurrenceDate time.Time  `json:"occurrence_date"`
+	Action         string     `json:"action"`
+	NewDate        *time.Time `json:"new_date,omitempty"`
+}
+
+// Occurrence is one planned date of a schedule after exceptions are applied
+type Occurrence struct {
+	ScheduleID   int       `json:"schedule_id"`
+	WorkoutID    int       `json:"workout_id"`
+	Date         time.Time `json:"date"`
+	OriginalDate time.Time `json:"original_date"`
+	StartTime    string    `json:"start_time,omitempty"`
+	Duration     int       `json:"duration_minutes"`
+}
+
+// Recurrence parses the schedule's rule. Schedules without a rule happen
+// once, which is expressed as a daily rule with a count of one.
+func (s Schedule) Recurrence() (Recurrence, error) {
+	if s.RRule == "" {
+		return Recurrence{Freq: FreqDaily, Interval: 1, Count: 1}, nil
+	}
+	return ParseRRule(s.RRule)
+}
+
+// IsOccurrence reports whether date is an occurrence of the schedule before
+// exceptions are applied
+func (s Schedule) IsOccurrence(date time.Time, weekStart time.Weekday) bool {
+	rule, err := s.Recurrence()
+	if err != nil {
+		return false
+	}
+	return len(rule.Occurrences(s.StartDate, date, date, weekStart)) == 1
+}
+
+// Occurrences expands the schedule between from and to, skipping and moving
+// occurrences as its exceptions say
+func (s Schedule) Occurrences(from, to time.Time, weekStart time.Weekday) ([]Occurrence, error) {
+	rule, err := s.Recurrence()
+	if err != nil {
+		return nil, err
+	}
+
+	// Key by calendar day since scanned dates may carry different locations
+	exceptions := make(map[string]ScheduleException)
+	for _, exception := range s.Exceptions {
+		exceptions[exception.OccurrenceDate.Format("2006-01-02")] = exception
+	}
+
+	var occurrences []Occurrence
+	add := func(date, original time.Time) {
+		if date.Before(from) || date.After(to) {
+			return
+		}
+		occurrences = append(occurrences, Occurrence{
+			ScheduleID:   s.ID,
+			WorkoutID:    s.WorkoutID,
+			Date:         date,
+			OriginalDate: original,
+			StartTime:    s.StartTime,
+			Duration:     s.DurationMinutes,
+		})
+	}
+
+	for _, date := range rule.Occurrences(s.StartDate, from, to, weekStart) {
+		if _, ok := exceptions[date.Format("2006-01-02")]; !ok {
+			add(date, date)
+		}
+	}
+
+	// Moved occurrences may land in the range even if their original date
+	// doesn't
+	for _, exception := range s.Exceptions {
+		if exception.Action == ExceptionMove && exception.NewDate != nil {
+			add(*exception.NewDate, exception.OccurrenceDate)
+		}
+	}
+
+	return occurrences, nil
+}
+
+// CreateScheduleTables creates the workout_schedules and schedule_exceptions
+// tables if they don't exist
+func CreateScheduleTables(db *sql.DB) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS workout_schedules (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		workout_id INT NOT NULL,
+		start_date DATE NOT NULL,
+		rrule VARCHAR(255) NOT NULL DEFAULT '',
+		start_time VARCHAR(5) NOT NULL DEFAULT '',
+		duration_minutes INT NOT NULL DEFAULT 60,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_schedules_user (user_id),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE
+	);`, `
+	CREATE TABLE IF NOT EXISTS schedule_exceptions (
+		schedule_id INT NOT NULL,
+		occurrence_date DATE NOT NULL,
+		action VARCHAR(10) NOT NULL,
+		new_date DATE NULL,
+		PRIMARY KEY (schedule_id, occurrence_date),
+		FOREIGN KEY (schedule_id) REFERENCES workout_schedules(id) ON DELETE CASCADE
+	);`}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUserSchedules retrieves a user's schedules with their exceptions
+func GetUserSchedules(db *sql.DB, userID int) ([]Schedule, error) {
+	query := `
+	SELECT id, user_id, workout_id, start_date, rrule, start_time, duration_minutes, created_at, updated_at
+	FROM workout_schedules
+	WHERE user_id = ? AND workout_id IN (SELECT id FROM workouts WHERE deleted_at IS NULL)
+	ORDER BY start_date, id`
+
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var s Schedule
+		if err := rows.Scan(&s.ID, &s.UserID, &s.WorkoutID, &s.StartDate, &s.RRule, &s.StartTime,
+			&s.DurationMinutes, &s.CreatedAt, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range schedules {
+		if schedules[i].Exceptions, err = getScheduleExceptions(db, schedules[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return schedules, nil
+}
+
+// GetSchedule retrieves a schedule with its exceptions
+func GetSchedule(db *sql.DB, id int) (Schedule, error) {
+	query := `
+	SELECT id, user_id, workout_id, start_date, rrule, start_time, duration_minutes, created_at, updated_at
+	FROM workout_schedules
+	WHERE id = ?`
+
+	var s Schedule
+	err := db.QueryRow(query, id).Scan(&s.ID, &s.UserID, &s.WorkoutID, &s.StartDate, &s.RRule, &s.StartTime,
+		&s.DurationMinutes, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return s, err
+	}
+
+	s.Exceptions, err = getScheduleExceptions(db, id)
+	return s, err
+}
+
+// getScheduleExceptions retrieves the exceptions of a schedule
+func getScheduleExceptions(db *sql.DB, scheduleID int) ([]ScheduleException, error) {
+	rows, err := db.Query("SELECT occurrence_date, action, new_date FROM schedule_exceptions WHERE schedule_id = ? ORDER BY occurrence_date", scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []ScheduleException{}
+	for rows.Next() {
+		var exception ScheduleException
+		var newDate sql.NullTime
+		if err := rows.Scan(&exception.OccurrenceDate, &exception.Action, &newDate); err != nil {
+			return nil, err
+		}
+		if newDate.Valid {
+			exception.NewDate = &newDate.Time
+		}
+		exceptions = append(exceptions, exception)
+	}
+
+	return exceptions, rows.Err()
+}
+
+// CreateSchedule creates a new schedule
+func CreateSchedule(db *sql.DB, s Schedule) (int, error) {
+	query := `
+	INSERT INTO workout_schedules (user_id, workout_id, start_date, rrule, start_time, duration_minutes)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, s.UserID, s.WorkoutID, s.StartDate, s.RRule, s.StartTime, s.DurationMinutes)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// UpdateSchedule updates an existing schedule. Exceptions are kept.
+func UpdateSchedule(db *sql.DB, s Schedule) error {
+	query := `
+	UPDATE workout_schedules
+	SET workout_id = ?, start_date = ?, rrule = ?, start_time = ?, duration_minutes = ?
+	WHERE id = ? AND user_id = ?`
+	_, err := db.Exec(query, s.WorkoutID, s.StartDate, s.RRule, s.StartTime, s.DurationMinutes, s.ID, s.UserID)
+	return err
+}
+
+// DeleteSchedule deletes a schedule by ID
+func DeleteSchedule(db *sql.DB, id, userID int) error {
+	query := "DELETE FROM workout_schedules WHERE id = ? AND user_id = ?"
+	_, err := db.Exec(query, id, userID)
+	return err
+}
+
+// SaveScheduleException skips or moves one occurrence, replacing any earlier
+// exception for it
+func SaveScheduleException(db *sql.DB, scheduleID int, exception ScheduleException) error {
+	query := `
+	INSERT INTO schedule_exceptions (schedule_id, occurrence_date, action, new_date)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE action = VALUES(action), new_date = VALUES(new_date)`
+	_, err := db.Exec(query, scheduleID, exception.OccurrenceDate, exception.Action, exception.NewDate)
+	return err
+}
+
+// DeleteScheduleException restores an occurrence to its original date
+func DeleteScheduleException(db *sql.DB, scheduleID int, occurrenceDate time.Time) error {
+	query := "DELETE FROM schedule_exceptions WHERE schedule_id = ? AND occurrence_date = ?"
+	_, err := db.Exec(query, scheduleID, occurrenceDate)
+	return err
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session represents one performance of a workout by a user on a day. Progress
+// entries logged for the same workout on the same day share a session.
+type Session struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	WorkoutID int       `json:"workout_id"`
+	Date      time.Time `json:"date"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// WorkoutVersion is the version of the workout performed, or 0 for
+	// sessions logged before workouts were versioned
+	WorkoutVersion int `json:"workout_version,omitempty"`
+}
+
+// CreateSessionTable creates the sessions table if it doesn't exist
+func CreateSessionTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		workout_id INT NOT NULL,
+		date DATE NOT NULL,
+		notes TEXT,
+		workout_version INT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_sessions_user_date (user_id, date),
+		UNIQUE KEY uq_sessions_day (user_id, workout_id, date),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	return addColumnIfMissing(db, "sessions", "workout_version", "INT NULL")
+}
+
+// backfillSessions groups progress logged before sessions existed into
+// sessions, one per user, workout and day
+func backfillSessions(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	insert := `
+	INSERT INTO sessions (user_id, workout_id, date, notes)
+	SELECT DISTINCT p.user_id, p.workout_id, p.date, ''
+	FROM progress p
+	WHERE p.session_id IS NULL AND NOT EXISTS (
+		SELECT 1 FROM sessions s
+		WHERE s.user_id = p.user_id AND s.workout_id = p.workout_id AND s.date = p.date
+	)`
+	if _, err := tx.Exec(insert); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	update := `
+	UPDATE progress p
+	JOIN sessions s ON s.user_id = p.user_id AND s.workout_id = p.workout_id AND s.date = p.date
+	SET p.session_id = s.id
+	WHERE p.session_id IS NULL`
+	if _, err := tx.Exec(update); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSession retrieves a session by ID
+func GetSession(db *sql.DB, id int) (Session, error) {
+	query := "SELECT id, user_id, workout_id, date, COALESCE(notes, ''), COALESCE(workout_version, 0), created_at FROM sessions WHERE id = ?"
+	var session Session
+	err := db.QueryRow(query, id).Scan(&session.ID, &session.UserID, &session.WorkoutID, &session.Date, &session.Notes, &session.WorkoutVersion, &session.CreatedAt)
+	return session, err
+}
+
+// GetUserSessions retrieves a user's sessions between from and to, newest
+// first. Zero dates mean no bound.
+func GetUserSessions(db *sql.DB, userID int, from, to time.Time) ([]Session, error) {
+	return querySessions(db, userID, from, to, false)
+}
+
+// GetPerformedSessions is GetUserSessions limited to sessions that still
+// have at least one progress record, so a session whose entries were all
+// deleted no longer counts as trained
+func GetPerformedSessions(db *sql.DB, userID int, from, to time.Time) ([]Session, error) {
+	return querySessions(db, userID, from, to, true)
+}
+
+func querySessions(db *sql.DB, userID int, from, to time.Time, performedOnly bool) ([]Session, error) {
+	query := `
+	SELECT id, user_id, workout_id, date, COALESCE(notes, ''), COALESCE(workout_version, 0), created_at
+	FROM sessions s
+	WHERE user_id = ?`
+	args := []interface{}{userID}
+	if performedOnly {
+		query += " AND EXISTS (SELECT 1 FROM progress p WHERE p.session_id = s.id AND p.deleted_at IS NULL)"
+	}
+	if !from.IsZero() {
+		query += " AND date >= ?"
+		args = append(args, from)
+	}
+	if !to.IsZero() {
+		query += " AND date <= ?"
+		args = append(args, to)
+	}
+	query += " ORDER BY date DESC, id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.WorkoutID, &session.Date, &session.Notes, &session.WorkoutVersion, &session.CreatedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// GetOrCreateSession returns the user's session for the workout on date,
+// creating it if this is the first entry logged for it. New sessions record
+// the workout's current version. Concurrent calls get the same session.
+func GetOrCreateSession(db *sql.DB, userID, workoutID int, date time.Time) (int, error) {
+	version, err := CurrentWorkoutVersion(db, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	return upsertSession(db, userID, workoutID, date, "", version)
+}
+
+// upsertSession inserts a session, or returns the ID of the one that already
+// exists for the user, workout and day. Notes and version only apply to a
+// new session.
+func upsertSession(db execer, userID, workoutID int, date time.Time, notes string, version int) (int, error) {
+	query := `
+	INSERT INTO sessions (user_id, workout_id, date, notes, workout_version)
+	VALUES (?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)`
+	result, err := db.Exec(query, userID, workoutID, date, notes, nullableID(version))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// MergeDuplicateSessions folds sessions created twice for the same user,
+// workout and day into the oldest one, then adds the unique key that keeps
+// it that way. Tables created before the key existed may have duplicates.
+// It runs once every table that refers to sessions exists.
+func MergeDuplicateSessions(db *sql.DB) error {
+	var count int
+	query := `
+	SELECT COUNT(*)
+	FROM information_schema.statistics
+	WHERE table_schema = DATABASE() AND table_name = 'sessions' AND index_name = 'uq_sessions_day'`
+	if err := db.QueryRow(query).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	keep := `
+	JOIN sessions d ON d.id = t.session_id
+	JOIN (SELECT user_id, workout_id, date, MIN(id) AS id FROM sessions GROUP BY user_id, workout_id, date) k
+		ON k.user_id = d.user_id AND k.workout_id = d.workout_id AND k.date = d.date AND k.id <> d.id
+	SET t.session_id = k.id`
+	statements := []string{
+		"UPDATE progress t" + keep,
+		"UPDATE activities t" + keep,
+		"UPDATE program_sessions t" + keep,
+		`DELETE d FROM sessions d
+		JOIN sessions k ON k.user_id = d.user_id AND k.workout_id = d.workout_id AND k.date = d.date AND k.id < d.id`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec("CREATE UNIQUE INDEX uq_sessions_day ON sessions (user_id, workout_id, date)")
+	return err
+}
+
+// nullableID stores a zero ID as NULL in optional foreign key columns
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,545 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Template kinds
+const (
+	TemplateKindWorkout = "workout"
+	TemplateKindProgram = "program"
+)
+
+// Template goals
+const (
+	GoalStrength    = "strength"
+	GoalHypertrophy = "hypertrophy"
+	GoalEndurance   = "endurance"
+	GoalWeightLoss  = "weight_loss"
+	GoalGeneral     = "general"
+)
+
+// Template levels
+const (
+	LevelBeginner     = "beginner"
+	LevelIntermediate = "intermediate"
+	LevelAdvanced     = "advanced"
+)
+
+// Template is a published workout or program in the template library. The
+// snapshot is taken when it is published and never changes, so later edits
+// by the author don't affect what others imported.
+type Template struct {
+	ID              int               `json:"id"`
+	AuthorID        *int              `json:"author_id"`
+	Kind            string            `json:"kind"`
+	SourceID        int               `json:"source_id"`
+	Title           string            `json:"title"`
+	Description     string            `json:"description"`
+	Goal            string            `json:"goal"`
+	Level           string            `json:"level"`
+	Equipment       []string          `json:"equipment"`
+	DurationMinutes int               `json:"duration_minutes"`
+	DaysPerWeek     int               `json:"days_per_week"`
+	Downloads       int               `json:"downloads"`
+	RatingAverage   float64           `json:"rating_average"`
+	RatingCount     int               `json:"rating_count"`
+	PublishedAt     time.Time         `json:"published_at"`
+	Snapshot        *TemplateSnapshot `json:"snapshot,omitempty"`
+}
+
+// TemplateSnapshot is the published content of a template. A program's days
+// refer to workouts by their 1-based position in Workouts.
+type TemplateSnapshot struct {
+	Workouts []TemplateWorkout `json:"workouts"`
+	Program  *Program          `json:"program,omitempty"`
+}
+
+// TemplateWorkout is a workout in a template snapshot
+type TemplateWorkout struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Exercises   []TemplateExercise `json:"exercises"`
+}
+
+// TemplateExercise is an exercise with its prescription. The exercise is
+// copied in full so it can be recreated if it leaves the library.
+type TemplateExercise struct {
+	Exercise     Exercise        `json:"exercise"`
+	Prescription WorkoutExercise `json:"prescription"`
+}
+
+// TemplateReview is a user's rating and review of a template
+type TemplateReview struct {
+	TemplateID int       `json:"template_id"`
+	UserID     int       `json:"user_id"`
+	Rating     int       `json:"rating"`
+	Review     string    `json:"review"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TemplateFilter selects templates when browsing. Equipment lists what the
+// user has; templates needing anything else are left out.
+type TemplateFilter struct {
+	Kind        string
+	Goal        string
+	Level       string
+	Equipment   []string
+	MaxDuration int
+	DaysPerWeek int
+	Sort        string
+}
+
+// TemplateImport lists what importing a template created
+type TemplateImport struct {
+	WorkoutIDs []int `json:"workout_ids"`
+	ProgramID  int   `json:"program_id,omitempty"`
+}
+
+// IsValidGoal reports whether g is a supported template goal
+func IsValidGoal(g string) bool {
+	return g == GoalStrength || g == GoalHypertrophy || g == GoalEndurance || g == GoalWeightLoss || g == GoalGeneral
+}
+
+// IsValidLevel reports whether l is a supported template level
+func IsValidLevel(l string) bool {
+	return l == LevelBeginner || l == LevelIntermediate || l == LevelAdvanced
+}
+
+// CreateTemplateTables creates the templates, template_equipment and
+// template_reviews tables if they don't exist
+func CreateTemplateTables(db *sql.DB) error {
+	queries := []string{`
+	CREATE TABLE IF NOT EXISTS templates (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		author_id INT NULL,
+		kind VARCHAR(10) NOT NULL,
+		source_id INT NOT NULL,
+		title VARCHAR(100) NOT NULL,
+		description TEXT,
+		goal VARCHAR(20) NOT NULL,
+		level VARCHAR(20) NOT NULL,
+		duration_minutes INT NOT NULL DEFAULT 0,
+		days_per_week INT NOT NULL DEFAULT 1,
+		downloads INT NOT NULL DEFAULT 0,
+		snapshot JSON NOT NULL,
+		published_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_templates_browse (goal, level, days_per_week),
+		FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL
+	);`, `
+	CREATE TABLE IF NOT EXISTS template_equipment (
+		template_id INT NOT NULL,
+		equipment VARCHAR(50) NOT NULL,
+		PRIMARY KEY (template_id, equipment),
+		FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE
+	);`, `
+	CREATE TABLE IF NOT EXISTS template_reviews (
+		template_id INT NOT NULL,
+		user_id INT NOT NULL,
+		rating TINYINT NOT NULL,
+		review TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		PRIMARY KEY (template_id, user_id),
+		FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`}
+
+	for _, query := range queries {
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateSelect selects the columns scanned by scanTemplate. Ratings are
+// aggregated from the reviews.
+const templateSelect = `
+	SELECT t.id, t.author_id, t.kind, t.source_id, t.title, COALESCE(t.description, ''), t.goal, t.level,
+		t.duration_minutes, t.days_per_week, t.downloads,
+		COALESCE((SELECT AVG(r.rating) FROM template_reviews r WHERE r.template_id = t.id), 0) AS rating_average,
+		(SELECT COUNT(*) FROM template_reviews r WHERE r.template_id = t.id) AS rating_count,
+		COALESCE((SELECT GROUP_CONCAT(e.equipment ORDER BY e.equipment) FROM template_equipment e WHERE e.template_id = t.id), ''),
+		t.published_at
+	FROM templates t`
+
+// scanTemplate scans a template selected with templateSelect
+func scanTemplate(row interface{ Scan(...interface{}) error }) (Template, error) {
+	var t Template
+	var authorID sql.NullInt64
+	var equipment string
+	err := row.Scan(&t.ID, &authorID, &t.Kind, &t.SourceID, &t.Title, &t.Description, &t.Goal, &t.Level,
+		&t.DurationMinutes, &t.DaysPerWeek, &t.Downloads, &t.RatingAverage, &t.RatingCount, &equipment, &t.PublishedAt)
+	if authorID.Valid {
+		id := int(authorID.Int64)
+		t.AuthorID = &id
+	}
+	t.Equipment = []string{}
+	if equipment != "" {
+		t.Equipment = strings.Split(equipment, ",")
+	}
+	return t, err
+}
+
+// BrowseTemplates retrieves templates matching a filter. They are sorted by
+// downloads unless Sort is "rating" or "newest".
+func BrowseTemplates(db *sql.DB, filter TemplateFilter) ([]Template, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Kind != "" {
+		conditions = append(conditions, "t.kind = ?")
+		args = append(args, filter.Kind)
+	}
+	if filter.Goal != "" {
+		conditions = append(conditions, "t.goal = ?")
+		args = append(args, filter.Goal)
+	}
+	if filter.Level != "" {
+		conditions = append(conditions, "t.level = ?")
+		args = append(args, filter.Level)
+	}
+	if filter.MaxDuration > 0 {
+		conditions = append(conditions, "t.duration_minutes <= ?")
+		args = append(args, filter.MaxDuration)
+	}
+	if filter.DaysPerWeek > 0 {
+		conditions = append(conditions, "t.days_per_week = ?")
+		args = append(args, filter.DaysPerWeek)
+	}
+	if filter.Equipment != nil {
+		condition := "NOT EXISTS (SELECT 1 FROM template_equipment e WHERE e.template_id = t.id"
+		if len(filter.Equipment) > 0 {
+			condition += " AND e.equipment NOT IN (?" + strings.Repeat(", ?", len(filter.Equipment)-1) + ")"
+			for _, equipment := range filter.Equipment {
+				args = append(args, equipment)
+			}
+		}
+		conditions = append(conditions, condition+")")
+	}
+
+	query := templateSelect
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	switch filter.Sort {
+	case "rating":
+		query += " ORDER BY rating_average DESC, rating_count DESC, t.id DESC"
+	case "newest":
+		query += " ORDER BY t.published_at DESC, t.id DESC"
+	default:
+		query += " ORDER BY t.downloads DESC, t.id DESC"
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// GetTemplate retrieves a template with its snapshot
+func GetTemplate(db *sql.DB, id int) (Template, error) {
+	t, err := scanTemplate(db.QueryRow(templateSelect+" WHERE t.id = ?", id))
+	if err != nil {
+		return t, err
+	}
+
+	var snapshot []byte
+	if err := db.QueryRow("SELECT snapshot FROM templates WHERE id = ?", id).Scan(&snapshot); err != nil {
+		return t, err
+	}
+	t.Snapshot = &TemplateSnapshot{}
+	return t, json.Unmarshal(snapshot, t.Snapshot)
+}
+
+// BuildWorkoutSnapshot captures a workout and its exercises for publishing
+func BuildWorkoutSnapshot(db *sql.DB, workoutID int) (TemplateWorkout, error) {
+	workout, err := GetWorkout(db, workoutID)
+	if err != nil {
+		return TemplateWorkout{}, err
+	}
+
+	workoutExercises, err := GetWorkoutExercises(db, workoutID)
+	if err != nil {
+		return TemplateWorkout{}, err
+	}
+
+	snapshot := TemplateWorkout{Name: workout.Name, Description: workout.Description, Exercises: []TemplateExercise{}}
+	for _, we := range workoutExercises {
+		exercise, err := GetExercise(db, we.ExerciseID)
+		if err != nil {
+			return snapshot, err
+		}
+
+		// Training maxes and cycles belong to the author, not the template
+		we.WorkoutID = 0
+		we.TrainingMax = 0
+		we.CycleStart = nil
+		snapshot.Exercises = append(snapshot.Exercises, TemplateExercise{Exercise: exercise, Prescription: we})
+	}
+	return snapshot, nil
+}
+
+// BuildProgramSnapshot captures a program with all the workouts it uses
+func BuildProgramSnapshot(db *sql.DB, program Program) (TemplateSnapshot, error) {
+	snapshot := TemplateSnapshot{Workouts: []TemplateWorkout{}}
+	positions := make(map[int]int)
+	days := make([]ProgramDay, 0, len(program.Days))
+	for _, day := range program.Days {
+		if _, ok := positions[day.WorkoutID]; !ok {
+			workout, err := BuildWorkoutSnapshot(db, day.WorkoutID)
+			if err != nil {
+				return snapshot, err
+			}
+			snapshot.Workouts = append(snapshot.Workouts, workout)
+			positions[day.WorkoutID] = len(snapshot.Workouts)
+		}
+		day.WorkoutID = positions[day.WorkoutID]
+		days = append(days, day)
+	}
+
+	program.ID = 0
+	program.UserID = 0
+	program.Days = days
+	snapshot.Program = &program
+	return snapshot, nil
+}
+
+// Equipment lists the distinct equipment the snapshot's exercises need
+func (s TemplateSnapshot) Equipment() []string {
+	seen := make(map[string]bool)
+	equipment := []string{}
+	for _, workout := range s.Workouts {
+		for _, te := range workout.Exercises {
+			name := strings.ToLower(strings.TrimSpace(te.Exercise.Equipment))
+			if name != "" && !seen[name] {
+				seen[name] = true
+				equipment = append(equipment, name)
+			}
+		}
+	}
+	return equipment
+}
+
+// PublishTemplate stores a template with its snapshot
+func PublishTemplate(db *sql.DB, t Template) (int, error) {
+	if t.Snapshot == nil {
+		return 0, errors.New("template has no snapshot")
+	}
+	snapshot, err := json.Marshal(t.Snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO templates (author_id, kind, source_id, title, description, goal, level, duration_minutes, days_per_week, snapshot)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(query, t.AuthorID, t.Kind, t.SourceID, t.Title, t.Description, t.Goal, t.Level,
+		t.DurationMinutes, t.DaysPerWeek, snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, equipment := range t.Snapshot.Equipment() {
+		if _, err := tx.Exec("INSERT INTO template_equipment (template_id, equipment) VALUES (?, ?)", id, equipment); err != nil {
+			return 0, err
+		}
+	}
+
+	return int(id), tx.Commit()
+}
+
+// DeleteTemplate removes a template from the library. Workouts and programs
+// already imported from it are kept.
+func DeleteTemplate(db *sql.DB, id, authorID int) error {
+	query := "DELETE FROM templates WHERE id = ? AND author_id = ?"
+	_, err := db.Exec(query, id, authorID)
+	return err
+}
+
+// ImportTemplate copies a template's snapshot into a user's account and
+// counts the download. Exercises that are no longer in the library are
+// matched by name or recreated.
+func ImportTemplate(db *sql.DB, t Template, userID int) (TemplateImport, error) {
+	imported := TemplateImport{WorkoutIDs: []int{}}
+	if t.Snapshot == nil {
+		return imported, errors.New("template has no snapshot")
+	}
+
+	exerciseIDs := make(map[int]int)
+	for _, workout := range t.Snapshot.Workouts {
+		for _, te := range workout.Exercises {
+			if _, ok := exerciseIDs[te.Exercise.ID]; ok {
+				continue
+			}
+			id, err := resolveTemplateExercise(db, te.Exercise)
+			if err != nil {
+				return imported, err
+			}
+			exerciseIDs[te.Exercise.ID] = id
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return imported, err
+	}
+	defer tx.Rollback()
+
+	for _, workout := range t.Snapshot.Workouts {
+		result, err := tx.Exec("INSERT INTO workouts (name, description, user_id) VALUES (?, ?, ?)",
+			workout.Name, workout.Description, userID)
+		if err != nil {
+			return imported, err
+		}
+		workoutID, err := result.LastInsertId()
+		if err != nil {
+			return imported, err
+		}
+		imported.WorkoutIDs = append(imported.WorkoutIDs, int(workoutID))
+
+		for _, te := range workout.Exercises {
+			we := te.Prescription
+			_, err := tx.Exec(`
+			INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, weight, duration_seconds, distance_meters,
+				exercise_order, progression, reps_min, reps_max, target_rpe, training_max, cycle_start)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, CURRENT_DATE)`, workoutID, exerciseIDs[te.Exercise.ID], we.Sets, we.Reps,
+				we.Weight, we.Duration, we.Distance, we.Order, we.Progression, we.RepsMin, we.RepsMax, we.TargetRPE)
+			if err != nil {
+				return imported, err
+			}
+		}
+	}
+
+	if program := t.Snapshot.Program; program != nil {
+		result, err := tx.Exec(`
+		INSERT INTO programs (user_id, name, description, progression_type, load_increment, rpe_start, rpe_step)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, userID, program.Name, program.Description, program.ProgressionType,
+			program.LoadIncrement, program.RPEStart, program.RPEStep)
+		if err != nil {
+			return imported, err
+		}
+		programID, err := result.LastInsertId()
+		if err != nil {
+			return imported, err
+		}
+		imported.ProgramID = int(programID)
+
+		// Map workout positions back to the imported workouts
+		structure := *program
+		structure.Days = make([]ProgramDay, 0, len(program.Days))
+		for _, day := range program.Days {
+			if day.WorkoutID < 1 || day.WorkoutID > len(imported.WorkoutIDs) {
+				return imported, errors.New("template program refers to a missing workout")
+			}
+			day.WorkoutID = imported.WorkoutIDs[day.WorkoutID-1]
+			structure.Days = append(structure.Days, day)
+		}
+		if err := saveProgramStructure(tx, imported.ProgramID, structure); err != nil {
+			return imported, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE templates SET downloads = downloads + 1 WHERE id = ?", t.ID); err != nil {
+		return imported, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return imported, err
+	}
+
+	for _, workoutID := range imported.WorkoutIDs {
+		if _, err := RecordWorkoutVersion(db, workoutID); err != nil {
+			return imported, err
+		}
+	}
+	return imported, nil
+}
+
+// resolveTemplateExercise finds the library exercise for a snapshot exercise:
+// the same exercise if it still exists, one with the same name, or a new copy
+func resolveTemplateExercise(db *sql.DB, exercise Exercise) (int, error) {
+	if existing, err := GetExercise(db, exercise.ID); err == nil {
+		return existing.ID, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if existing, err := FindExerciseByName(db, exercise.Name); err == nil {
+		return existing.ID, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	return CreateExercise(db, exercise)
+}
+
+// GetTemplateReviews retrieves a template's reviews, newest first
+func GetTemplateReviews(db *sql.DB, templateID int) ([]TemplateReview, error) {
+	query := `
+	SELECT template_id, user_id, rating, COALESCE(review, ''), created_at, updated_at
+	FROM template_reviews
+	WHERE template_id = ?
+	ORDER BY updated_at DESC`
+	rows, err := db.Query(query, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []TemplateReview{}
+	for rows.Next() {
+		var review TemplateReview
+		if err := rows.Scan(&review.TemplateID, &review.UserID, &review.Rating, &review.Review, &review.CreatedAt, &review.UpdatedAt); err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+// SaveTemplateReview creates or replaces a user's review of a template
+func SaveTemplateReview(db *sql.DB, review TemplateReview) error {
+	query := `
+	INSERT INTO template_reviews (template_id, user_id, rating, review)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE rating = VALUES(rating), review = VALUES(review)`
+	_, err := db.Exec(query, review.TemplateID, review.UserID, review.Rating, review.Review)
+	return err
+}
+
+// DeleteTemplateReview deletes a user's review of a template
+func DeleteTemplateReview(db *sql.DB, templateID, userID int) error {
+	query := "DELETE FROM template_reviews WHERE template_id = ? AND user_id = ?"
+	_, err := db.Exec(query, templateID, userID)
+	return err
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// newToken returns a random URL-safe secret of 32 bytes, hex encoded
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
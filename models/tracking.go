@@ -0,0 +1,148 @@
+package models
+
+import (
+	"errors"
+)
+
+// Tracking types describe which measurements an exercise is logged with
+const (
+	TrackingRepsLoad         = "reps_load"
+	TrackingReps             = "reps"
+	TrackingDuration         = "duration"
+	TrackingDistanceDuration = "distance_duration"
+	TrackingDistanceLoad     = "distance_load"
+)
+
+// TrackingTypes lists every supported tracking type
+var TrackingTypes = []string{
+	TrackingRepsLoad,
+	TrackingReps,
+	TrackingDuration,
+	TrackingDistanceDuration,
+	TrackingDistanceLoad,
+}
+
+// IsValidTrackingType reports whether t is a supported tracking type
+func IsValidTrackingType(t string) bool {
+	for _, trackingType := range TrackingTypes {
+		if t == trackingType {
+			return true
+		}
+	}
+	return false
+}
+
+// Measurements holds the fields shared by prescriptions and logged sets.
+// Weight is in kilograms, duration in seconds and distance in meters.
+type Measurements struct {
+	Sets     int
+	Reps     int
+	Weight   float64
+	Duration int
+	Distance float64
+}
+
+// SupportsProgression reports whether entries of exercises tracked as t can
+// follow a progression strategy. Strategies work on sets, reps and load.
+func SupportsProgression(t string) bool {
+	return t == TrackingRepsLoad || t == TrackingReps || t == ""
+}
+
+// DefaultPrescription returns the prescription used when an exercise is added
+// to a workout without one, in canonical units
+func DefaultPrescription(trackingType string) Measurements {
+	switch trackingType {
+	case TrackingDuration:
+		return Measurements{Sets: 3, Duration: 60}
+	case TrackingDistanceDuration:
+		return Measurements{Sets: 1, Distance: 5000, Duration: 1800}
+	case TrackingDistanceLoad:
+		return Measurements{Sets: 3, Distance: 20, Weight: 20}
+	default:
+		return Measurements{Sets: 3, Reps: 10}
+	}
+}
+
+// NormalizeMeasurements validates m against the tracking type and clears the
+// fields the tracking type doesn't use, so only the matching fields are stored
+func NormalizeMeasurements(trackingType string, m Measurements) (Measurements, error) {
+	if m.Sets < 0 || m.Reps < 0 || m.Weight < 0 || m.Duration < 0 || m.Distance < 0 {
+		return m, errors.New("sets, reps, weight, duration and distance cannot be negative")
+	}
+
+	switch trackingType {
+	case TrackingRepsLoad, "":
+		if m.Sets == 0 || m.Reps == 0 {
+			return m, errors.New("sets and reps are required for reps and load exercises")
+		}
+		m.Duration, m.Distance = 0, 0
+	case TrackingReps:
+		if m.Sets == 0 || m.Reps == 0 {
+			return m, errors.New("sets and reps are required for reps-only exercises")
+		}
+		m.Weight, m.Duration, m.Distance = 0, 0, 0
+	case TrackingDuration:
+		if m.Sets == 0 || m.Duration == 0 {
+			return m, errors.New("sets and duration are required for duration exercises")
+		}
+		m.Reps, m.Weight, m.Distance = 0, 0, 0
+	case TrackingDistanceDuration:
+		if m.Distance == 0 || m.Duration == 0 {
+			return m, errors.New("distance and duration are required for distance exercises")
+		}
+		if m.Sets == 0 {
+			m.Sets = 1
+		}
+		m.Reps, m.Weight = 0, 0
+	case TrackingDistanceLoad:
+		if m.Distance == 0 || m.Weight == 0 {
+			return m, errors.New("distance and weight are required for loaded carries")
+		}
+		if m.Sets == 0 {
+			m.Sets = 1
+		}
+		m.Reps = 0
+	default:
+		return m, errors.New("unknown tracking type: " + trackingType)
+	}
+
+	return m, nil
+}
+
+// ProgressMetrics holds values derived from a logged entry. Pace is in
+// seconds per kilometer, speed in kilometers per hour and time under tension
+// in seconds.
+type ProgressMetrics struct {
+	Volume           float64 `json:"volume,omitempty"`
+	E1RM             float64 `json:"e1rm,omitempty"`
+	Pace             float64 `json:"pace,omitempty"`
+	Speed            float64 `json:"speed,omitempty"`
+	TimeUnderTension int     `json:"time_under_tension,omitempty"`
+
+	// RelativeStrength is the e1RM as a multiple of the user's bodyweight
+	RelativeStrength float64 `json:"relative_strength,omitempty"`
+}
+
+// ComputeMetrics derives the metrics that make sense for the tracking type.
+// The e1RM is estimated with the Epley formula.
+func ComputeMetrics(trackingType string, m Measurements) *ProgressMetrics {
+	metrics := &ProgressMetrics{}
+
+	switch trackingType {
+	case TrackingRepsLoad, "":
+		metrics.Volume = float64(m.Sets*m.Reps) * m.Weight
+		metrics.E1RM = E1RM(FormulaEpley, m.Weight, m.Reps)
+	case TrackingDuration:
+		metrics.TimeUnderTension = m.Sets * m.Duration
+	case TrackingDistanceDuration, TrackingDistanceLoad:
+		if m.Distance > 0 && m.Duration > 0 {
+			metrics.Pace = float64(m.Duration) / (m.Distance / 1000)
+			metrics.Speed = (m.Distance / 1000) / (float64(m.Duration) / 3600)
+		}
+		if trackingType == TrackingDistanceLoad {
+			metrics.TimeUnderTension = m.Sets * m.Duration
+		}
+	}
+
+	return metrics
+}
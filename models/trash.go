@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultTrashRetentionDays is how long deleted rows stay restorable when
+// TRASH_RETENTION_DAYS isn't set
+const defaultTrashRetentionDays = 30
+
+// Trash item types
+const (
+	TrashWorkout  = "workout"
+	TrashExercise = "exercise"
+	TrashProgress = "progress"
+)
+
+// TrashItem is a deleted row that can still be restored until PurgeAt
+type TrashItem struct {
+	Type      string    `json:"type"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// TrashRetention returns how long deleted rows are kept before they are
+// purged, read from TRASH_RETENTION_DAYS
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// restoreRow runs an UPDATE clearing deleted_at, returning sql.ErrNoRows when
+// nothing in the trash matched
+func restoreRow(db *sql.DB, query string, args ...interface{}) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserTrash retrieves a user's deleted workouts and progress records,
+// most recently deleted first
+func GetUserTrash(db *sql.DB, userID int, retention time.Duration) ([]TrashItem, error) {
+	query := `
+	SELECT 'workout', id, name, deleted_at
+	FROM workouts
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	UNION ALL
+	SELECT 'progress', p.id, CONCAT(e.name, ' on ', DATE_FORMAT(p.date, '%Y-%m-%d')), p.deleted_at
+	FROM progress p
+	JOIN exercises e ON e.id = p.exercise_id
+	WHERE p.user_id = ? AND p.deleted_at IS NOT NULL
+	ORDER BY 4 DESC`
+
+	return queryTrash(db, retention, query, userID, userID)
+}
+
+// GetExerciseTrash retrieves deleted exercises, most recently deleted first
+func GetExerciseTrash(db *sql.DB, retention time.Duration) ([]TrashItem, error) {
+	query := `
+	SELECT 'exercise', id, name, deleted_at
+	FROM exercises
+	WHERE deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC`
+
+	return queryTrash(db, retention, query)
+}
+
+// queryTrash scans trash items selected as type, id, name and deleted_at
+func queryTrash(db *sql.DB, retention time.Duration, query string, args ...interface{}) ([]TrashItem, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []TrashItem{}
+	for rows.Next() {
+		var item TrashItem
+		if err := rows.Scan(&item.Type, &item.ID, &item.Name, &item.DeletedAt); err != nil {
+			return nil, err
+		}
+		item.PurgeAt = item.DeletedAt.Add(retention)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// PurgeTrash permanently deletes rows trashed before the cutoff. Progress goes
+// first, and trashed workouts and exercises that other progress still refers
+// to are kept, so the foreign key cascades never remove live progress.
+// Workouts used by a program, an enrollment or a schedule are kept too, so
+// programs and calendars don't silently lose days.
+func PurgeTrash(db *sql.DB, before time.Time) (int64, error) {
+	queries := []string{
+		"DELETE FROM progress WHERE deleted_at < ?",
+		`DELETE FROM workouts
+		WHERE deleted_at < ? AND NOT EXISTS (SELECT 1 FROM progress p WHERE p.workout_id = workouts.id)
+			AND NOT EXISTS (SELECT 1 FROM program_days d WHERE d.workout_id = workouts.id)
+			AND NOT EXISTS (SELECT 1 FROM program_sessions ps WHERE ps.workout_id = workouts.id)
+			AND NOT EXISTS (SELECT 1 FROM workout_schedules ws WHERE ws.workout_id = workouts.id)`,
+		`DELETE FROM exercises
+		WHERE deleted_at < ? AND NOT EXISTS (SELECT 1 FROM progress p WHERE p.exercise_id = exercises.id)`,
+	}
+
+	var purged int64
+	for _, query := range queries {
+		result, err := db.Exec(query, before)
+		if err != nil {
+			return purged, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+		purged += affected
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// Supported units. Loads are stored in kilograms and distances in meters;
+// everything else is converted at the API boundary.
+const (
+	UnitKg = "kg"
+	UnitLb = "lb"
+	UnitKm = "km"
+	UnitMi = "mi"
+	UnitCm = "cm"
+	UnitIn = "in"
+)
+
+const (
+	kgPerLb       = 0.45359237
+	metersPerKm   = 1000.0
+	metersPerMile = 1609.344
+	cmPerInch     = 2.54
+)
+
+// Units is the pair of weight and distance units a response is expressed in
+type Units struct {
+	Weight   string `json:"weight"`
+	Distance string `json:"distance"`
+}
+
+// MetricUnits are the canonical storage units
+var MetricUnits = Units{Weight: UnitKg, Distance: UnitKm}
+
+// ImperialUnits are pounds and miles
+var ImperialUnits = Units{Weight: UnitLb, Distance: UnitMi}
+
+// ParseUnits parses a units override such as "metric", "imperial" or "lb,km"
+func ParseUnits(s string) (Units, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "metric":
+		return MetricUnits, nil
+	case "imperial":
+		return ImperialUnits, nil
+	}
+
+	units := MetricUnits
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		switch strings.TrimSpace(part) {
+		case UnitKg, UnitLb:
+			units.Weight = strings.TrimSpace(part)
+		case UnitKm, UnitMi:
+			units.Distance = strings.TrimSpace(part)
+		default:
+			return Units{}, errors.New("unknown unit: " + part)
+		}
+	}
+	return units, nil
+}
+
+// IsValidWeightUnit reports whether u is a supported weight unit
+func IsValidWeightUnit(u string) bool {
+	return u == UnitKg || u == UnitLb
+}
+
+// IsValidDistanceUnit reports whether u is a supported distance unit
+func IsValidDistanceUnit(u string) bool {
+	return u == UnitKm || u == UnitMi
+}
+
+// WeightFromKg converts a canonical load into u's weight unit
+func (u Units) WeightFromKg(kg float64) float64 {
+	if u.Weight == UnitLb {
+		return kg / kgPerLb
+	}
+	return kg
+}
+
+// WeightToKg converts a load in u's weight unit into kilograms
+func (u Units) WeightToKg(w float64) float64 {
+	if u.Weight == UnitLb {
+		return w * kgPerLb
+	}
+	return w
+}
+
+// DistanceFromMeters converts a canonical distance into u's distance unit
+func (u Units) DistanceFromMeters(m float64) float64 {
+	if u.Distance == UnitMi {
+		return m / metersPerMile
+	}
+	return m / metersPerKm
+}
+
+// DistanceToMeters converts a distance in u's distance unit into meters
+func (u Units) DistanceToMeters(d float64) float64 {
+	if u.Distance == UnitMi {
+		return d * metersPerMile
+	}
+	return d * metersPerKm
+}
+
+// LengthUnit returns the unit body measurements are shown in: centimeters
+// alongside kilometers and inches alongside miles
+func (u Units) LengthUnit() string {
+	if u.Distance == UnitMi {
+		return UnitIn
+	}
+	return UnitCm
+}
+
+// lengthToCm converts a length in unit into centimeters
+func lengthToCm(l float64, unit string) float64 {
+	if unit == UnitIn {
+		return l * cmPerInch
+	}
+	return l
+}
+
+// lengthFromCm converts a length in centimeters into unit
+func lengthFromCm(cm float64, unit string) float64 {
+	if unit == UnitIn {
+		return cm / cmPerInch
+	}
+	return cm
+}
+
+// DefaultPlateIncrement is the smallest load jump for a weight unit
+func DefaultPlateIncrement(weightUnit string) float64 {
+	if weightUnit == UnitLb {
+		return 5
+	}
+	return 2.5
+}
+
+// RoundWeight rounds a logged load to one decimal place. Loads are stored
+// with two decimals in kilograms, so a load entered in either unit survives
+// the round trip unchanged at this precision.
+func RoundWeight(w float64) float64 {
+	return math.Round(w*10) / 10
+}
+
+// RoundToIncrement rounds a prescribed load to the nearest loadable increment
+func RoundToIncrement(w, increment float64) float64 {
+	if increment <= 0 {
+		return RoundWeight(w)
+	}
+	return RoundWeight(math.Round(w/increment) * increment)
+}
+
+// RoundDistance rounds a distance to two decimal places
+func RoundDistance(d float64) float64 {
+	return math.Round(d*100) / 100
+}
+
+// InUnits converts metrics computed from canonical values into u
+func (m *ProgressMetrics) InUnits(u Units) *ProgressMetrics {
+	if m == nil {
+		return nil
+	}
+
+	converted := *m
+	converted.Volume = math.Round(u.WeightFromKg(m.Volume))
+	converted.E1RM = RoundWeight(u.WeightFromKg(m.E1RM))
+	if m.Pace > 0 {
+		// Pace is time per distance unit, so it scales with the unit's length
+		converted.Pace = math.Round(m.Pace * u.DistanceToMeters(1) / metersPerKm)
+	}
+	if m.Speed > 0 {
+		converted.Speed = math.Round(m.Speed*metersPerKm/u.DistanceToMeters(1)*10) / 10
+	}
+	return &converted
+}
+
+// InUnits returns a copy of the progress record expressed in u
+func (p Progress) InUnits(u Units) Progress {
+	p.Weight = RoundWeight(u.WeightFromKg(p.Weight))
+	p.Distance = RoundDistance(u.DistanceFromMeters(p.Distance))
+	p.Metrics = p.Metrics.InUnits(u)
+	p.Units = &u
+	return p
+}
+
+// FromUnits converts a progress record submitted in u into canonical units,
+// rounded to the precision they are stored with
+func (p Progress) FromUnits(u Units) Progress {
+	p.Weight = StoredWeightKg(u, p.Weight)
+	p.Distance = StoredDistanceMeters(u, p.Distance)
+	return p
+}
+
+// StoredWeightKg converts a load in u into kilograms at the 2 decimal places
+// progress is stored with, so it compares equal to the stored value
+func StoredWeightKg(u Units, w float64) float64 {
+	return math.Round(u.WeightToKg(w)*100) / 100
+}
+
+// StoredDistanceMeters converts a distance in u into meters at the 2 decimal
+// places progress is stored with
+func StoredDistanceMeters(u Units, d float64) float64 {
+	return RoundDistance(u.DistanceToMeters(d))
+}
+
+// InUnits returns a copy of the prescription expressed in u, with loads
+// rounded to the given plate increment
+func (we WorkoutExercise) InUnits(u Units, increment float64) WorkoutExercise {
+	we.Weight = RoundToIncrement(u.WeightFromKg(we.Weight), increment)
+	we.Distance = RoundDistance(u.DistanceFromMeters(we.Distance))
+	we.TrainingMax = RoundWeight(u.WeightFromKg(we.TrainingMax))
+	we.Units = &u
+	return we
+}
+
+// FromUnits converts a prescription submitted in u into canonical units
+func (we WorkoutExercise) FromUnits(u Units) WorkoutExercise {
+	we.Weight = u.WeightToKg(we.Weight)
+	we.Distance = u.DistanceToMeters(we.Distance)
+	we.TrainingMax = u.WeightToKg(we.TrainingMax)
+	return we
+}
+
+// RoundLoadKg rounds a canonical load to the nearest plate increment in u
+// and returns it in kilograms again
+func RoundLoadKg(kg float64, u Units, increment float64) float64 {
+	return u.WeightToKg(RoundToIncrement(u.WeightFromKg(kg), increment))
+}
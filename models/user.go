@@ -24,16 +24,20 @@ func CreateUserTable(db *sql.DB) error {
 		email VARCHAR(100) NOT NULL UNIQUE,
 		password VARCHAR(255) NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		deleted_at TIMESTAMP NULL
 	);`
 
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	return addColumnIfMissing(db, "users", "deleted_at", "TIMESTAMP NULL")
 }
 
 // GetUsers retrieves all users from the database
 func GetUsers(db *sql.DB) ([]User, error) {
-	query := "SELECT id, username, email, created_at, updated_at FROM users"
+	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE deleted_at IS NULL"
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
@@ -54,7 +58,7 @@ func GetUsers(db *sql.DB) ([]User, error) {
 
 // GetUser retrieves a user by ID
 func GetUser(db *sql.DB, id int) (User, error) {
-	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE id = ?"
+	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE id = ? AND deleted_at IS NULL"
 	var user User
 	err := db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
 	return user, err
@@ -74,14 +78,16 @@ func CreateUser(db *sql.DB, user User) (int, error) {
 
 // UpdateUser updates an existing user
 func UpdateUser(db *sql.DB, user User) error {
-	query := "UPDATE users SET username = ?, email = ?, password = ? WHERE id = ?"
+	query := "UPDATE users SET username = ?, email = ?, password = ? WHERE id = ? AND deleted_at IS NULL"
 	_, err := db.Exec(query, user.Username, user.Email, user.Password, user.ID)
 	return err
 }
 
-// DeleteUser deletes a user by ID
-func DeleteUser(db *sql.DB, id int) error {
-	query := "DELETE FROM users WHERE id = ?"
-	_, err := db.Exec(query, id)
-	return err
+// GetUserPassword retrieves the password hash of a user, including a
+// deactivated one, so requests to delete or reactivate an account can be
+// confirmed
+func GetUserPassword(db *sql.DB, id int) (string, error) {
+	var password string
+	err := db.QueryRow("SELECT password FROM users WHERE id = ?", id).Scan(&password)
+	return password, err
 }
\ No newline at end of file
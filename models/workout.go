@@ -5,16 +5,41 @@ import (
 	"time"
 )
 
+// Workout visibilities. Public workouts can be read by anyone with their
+// share link.
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+)
+
 // Workout represents a workout plan
 type Workout struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	UserID      int       `json:"user_id"`
+	ForkedFrom  *int      `json:"forked_from,omitempty"`
+	Visibility  string    `json:"visibility"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// workoutSelect selects the columns scanned by scanWorkout, leaving out
+// workouts in the trash. Further conditions are added with AND.
+const workoutSelect = "SELECT id, name, description, user_id, forked_from, visibility, created_at, updated_at FROM workouts WHERE deleted_at IS NULL"
+
+// scanWorkout scans a workout selected with workoutSelect
+func scanWorkout(row interface{ Scan(...interface{}) error }) (Workout, error) {
+	var workout Workout
+	var forkedFrom sql.NullInt64
+	err := row.Scan(&workout.ID, &workout.Name, &workout.Description, &workout.UserID, &forkedFrom, &workout.Visibility, &workout.CreatedAt, &workout.UpdatedAt)
+	if forkedFrom.Valid {
+		id := int(forkedFrom.Int64)
+		workout.ForkedFrom = &id
+	}
+	return workout, err
+}
+
 // CreateWorkoutTable creates the workouts table if it doesn't exist
 func CreateWorkoutTable(db *sql.DB) error {
 	query := `
@@ -23,19 +48,39 @@ func CreateWorkoutTable(db *sql.DB) error {
 		name VARCHAR(100) NOT NULL,
 		description TEXT,
 		user_id INT NOT NULL,
+		forked_from INT NULL,
+		visibility VARCHAR(10) NOT NULL DEFAULT 'private',
+		share_token CHAR(64) NULL UNIQUE,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		deleted_at TIMESTAMP NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (forked_from) REFERENCES workouts(id) ON DELETE SET NULL
 	);`
 
-	_, err := db.Exec(query)
-	return err
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// Sharing columns added after the original schema
+	if err := addColumnIfMissing(db, "workouts", "forked_from", "INT NULL, ADD FOREIGN KEY (forked_from) REFERENCES workouts(id) ON DELETE SET NULL"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "workouts", "visibility", "VARCHAR(10) NOT NULL DEFAULT 'private'"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "workouts", "share_token", "CHAR(64) NULL UNIQUE"); err != nil {
+		return err
+	}
+	return addColumnIfMissing(db, "workouts", "deleted_at", "TIMESTAMP NULL")
 }
 
-// GetWorkouts retrieves all workouts from the database
-func GetWorkouts(db *sql.DB) ([]Workout, error) {
-	query := "SELECT id, name, description, user_id, created_at, updated_at FROM workouts"
-	rows, err := db.Query(query)
+// GetWorkouts retrieves the workouts a user may read: their own, those shared
+// with them and public ones
+func GetWorkouts(db *sql.DB, userID int) ([]Workout, error) {
+	query := workoutSelect + ` AND (user_id = ? OR visibility = ?
+		OR id IN (SELECT workout_id FROM workout_shares WHERE user_id = ?))`
+	rows, err := db.Query(query, userID, VisibilityPublic, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -43,8 +88,8 @@ func GetWorkouts(db *sql.DB) ([]Workout, error) {
 
 	var workouts []Workout
 	for rows.Next() {
-		var workout Workout
-		if err := rows.Scan(&workout.ID, &workout.Name, &workout.Description, &workout.UserID, &workout.CreatedAt, &workout.UpdatedAt); err != nil {
+		workout, err := scanWorkout(rows)
+		if err != nil {
 			return nil, err
 		}
 		workouts = append(workouts, workout)
@@ -55,15 +100,13 @@ func GetWorkouts(db *sql.DB) ([]Workout, error) {
 
 // GetWorkout retrieves a workout by ID
 func GetWorkout(db *sql.DB, id int) (Workout, error) {
-	query := "SELECT id, name, description, user_id, created_at, updated_at FROM workouts WHERE id = ?"
-	var workout Workout
-	err := db.QueryRow(query, id).Scan(&workout.ID, &workout.Name, &workout.Description, &workout.UserID, &workout.CreatedAt, &workout.UpdatedAt)
-	return workout, err
+	query := workoutSelect + " AND id = ?"
+	return scanWorkout(db.QueryRow(query, id))
 }
 
 // GetUserWorkouts retrieves all workouts for a specific user
 func GetUserWorkouts(db *sql.DB, userID int) ([]Workout, error) {
-	query := "SELECT id, name, description, user_id, created_at, updated_at FROM workouts WHERE user_id = ?"
+	query := workoutSelect + " AND user_id = ?"
 	rows, err := db.Query(query, userID)
 	if err != nil {
 		return nil, err
@@ -72,8 +115,8 @@ func GetUserWorkouts(db *sql.DB, userID int) ([]Workout, error) {
 
 	var workouts []Workout
 	for rows.Next() {
-		var workout Workout
-		if err := rows.Scan(&workout.ID, &workout.Name, &workout.Description, &workout.UserID, &workout.CreatedAt, &workout.UpdatedAt); err != nil {
+		workout, err := scanWorkout(rows)
+		if err != nil {
 			return nil, err
 		}
 		workouts = append(workouts, workout)
@@ -91,19 +134,34 @@ func CreateWorkout(db *sql.DB, workout Workout) (int, error) {
 	}
 
 	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = RecordWorkoutVersion(db, int(id))
 	return int(id), err
 }
 
 // UpdateWorkout updates an existing workout
 func UpdateWorkout(db *sql.DB, workout Workout) error {
-	query := "UPDATE workouts SET name = ?, description = ? WHERE id = ? AND user_id = ?"
-	_, err := db.Exec(query, workout.Name, workout.Description, workout.ID, workout.UserID)
+	query := "UPDATE workouts SET name = ?, description = ? WHERE id = ? AND user_id = ? AND deleted_at IS NULL"
+	if _, err := db.Exec(query, workout.Name, workout.Description, workout.ID, workout.UserID); err != nil {
+		return err
+	}
+
+	_, err := RecordWorkoutVersion(db, workout.ID)
 	return err
 }
 
-// DeleteWorkout deletes a workout by ID
+// DeleteWorkout moves a workout to the trash. Progress logged against it is
+// kept.
 func DeleteWorkout(db *sql.DB, id int, userID int) error {
-	query := "DELETE FROM workouts WHERE id = ? AND user_id = ?"
+	query := "UPDATE workouts SET deleted_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND deleted_at IS NULL"
 	_, err := db.Exec(query, id, userID)
 	return err
+}
+
+// RestoreWorkout takes a user's workout out of the trash
+func RestoreWorkout(db *sql.DB, id, userID int) error {
+	return restoreRow(db, "UPDATE workouts SET deleted_at = NULL WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL", id, userID)
 }
\ No newline at end of file
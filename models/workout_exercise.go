@@ -2,16 +2,43 @@ package models
 
 import (
 	"database/sql"
+	"time"
 )
 
 // WorkoutExercise represents the association between workouts and exercises
 type WorkoutExercise struct {
-	WorkoutID  int `json:"workout_id"`
-	ExerciseID int `json:"exercise_id"`
-	Sets       int `json:"sets"`
-	Reps       int `json:"reps"`
-	Weight     int `json:"weight"`
-	Order      int `json:"order"`
+	WorkoutID  int     `json:"workout_id"`
+	ExerciseID int     `json:"exercise_id"`
+	Sets       int     `json:"sets"`
+	Reps       int     `json:"reps"`
+	Weight     float64 `json:"weight"`
+	Duration   int     `json:"duration"` // seconds
+	Distance   float64 `json:"distance"`
+	Order      int     `json:"order"`
+
+	// Progression selects the strategy that computes the next session's
+	// target, with its settings. TrainingMax is in kilograms. CycleStart is
+	// the day the current wave cycle began: sessions before it don't count
+	// towards the cycle.
+	Progression string     `json:"progression"`
+	RepsMin     int        `json:"reps_min"`
+	RepsMax     int        `json:"reps_max"`
+	TargetRPE   float64    `json:"target_rpe"`
+	TrainingMax float64    `json:"training_max"`
+	CycleStart  *time.Time `json:"cycle_start,omitempty"`
+
+	// Units is set once the entry has been converted for a response
+	Units *Units `json:"units,omitempty"`
+}
+
+// Measurements returns the prescribed measurements of the entry
+func (we WorkoutExercise) Measurements() Measurements {
+	return Measurements{Sets: we.Sets, Reps: we.Reps, Weight: we.Weight, Duration: we.Duration, Distance: we.Distance}
+}
+
+// SetMeasurements overwrites the prescribed measurements of the entry
+func (we *WorkoutExercise) SetMeasurements(m Measurements) {
+	we.Sets, we.Reps, we.Weight, we.Duration, we.Distance = m.Sets, m.Reps, m.Weight, m.Duration, m.Distance
 }
 
 // CreateWorkoutExerciseTable creates the workout_exercises table if it doesn't exist
@@ -22,22 +49,63 @@ func CreateWorkoutExerciseTable(db *sql.DB) error {
 		exercise_id INT NOT NULL,
 		sets INT NOT NULL DEFAULT 3,
 		reps INT NOT NULL DEFAULT 10,
-		weight INT NOT NULL DEFAULT 0,
+		weight DECIMAL(8,2) NOT NULL DEFAULT 0,
+		duration_seconds INT NOT NULL DEFAULT 0,
+		distance_meters DECIMAL(10,2) NOT NULL DEFAULT 0,
 		exercise_order INT NOT NULL,
+		progression VARCHAR(20) NOT NULL DEFAULT 'linear',
+		reps_min INT NOT NULL DEFAULT 0,
+		reps_max INT NOT NULL DEFAULT 0,
+		target_rpe DECIMAL(3,1) NOT NULL DEFAULT 0,
+		training_max DECIMAL(8,2) NOT NULL DEFAULT 0,
+		cycle_start DATE NULL,
 		PRIMARY KEY (workout_id, exercise_id),
 		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE,
 		FOREIGN KEY (exercise_id) REFERENCES exercises(id) ON DELETE CASCADE
 	);`
 
-	_, err := db.Exec(query)
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	// Loads used to be stored as bare integers; they are now kilograms
+	if err := modifyColumnIfType(db, "workout_exercises", "weight", "int", "DECIMAL(8,2) NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "workout_exercises", "duration_seconds", "INT NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "workout_exercises", "distance_meters", "DECIMAL(10,2) NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	progressionColumns := []struct{ name, definition string }{
+		{"progression", "VARCHAR(20) NOT NULL DEFAULT 'linear'"},
+		{"reps_min", "INT NOT NULL DEFAULT 0"},
+		{"reps_max", "INT NOT NULL DEFAULT 0"},
+		{"target_rpe", "DECIMAL(3,1) NOT NULL DEFAULT 0"},
+		{"training_max", "DECIMAL(8,2) NOT NULL DEFAULT 0"},
+		{"cycle_start", "DATE NULL"},
+	}
+	for _, column := range progressionColumns {
+		if err := addColumnIfMissing(db, "workout_exercises", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Entries from before cycles were tracked start a new cycle now, rather
+	// than one placed by their whole history
+	_, err := db.Exec("UPDATE workout_exercises SET cycle_start = CURRENT_DATE WHERE cycle_start IS NULL")
 	return err
 }
 
 // GetWorkoutExercises retrieves all exercises for a specific workout
 func GetWorkoutExercises(db *sql.DB, workoutID int) ([]WorkoutExercise, error) {
 	query := `
-	SELECT we.workout_id, we.exercise_id, we.sets, we.reps, we.weight, we.exercise_order
+	SELECT we.workout_id, we.exercise_id, we.sets, we.reps, we.weight, we.duration_seconds, we.distance_meters, we.exercise_order,
+		we.progression, we.reps_min, we.reps_max, we.target_rpe, we.training_max, we.cycle_start
 	FROM workout_exercises we
+	JOIN exercises e ON e.id = we.exercise_id AND e.deleted_at IS NULL
 	WHERE we.workout_id = ?
 	ORDER BY we.exercise_order ASC`
 
@@ -50,9 +118,14 @@ func GetWorkoutExercises(db *sql.DB, workoutID int) ([]WorkoutExercise, error) {
 	var workoutExercises []WorkoutExercise
 	for rows.Next() {
 		var we WorkoutExercise
-		if err := rows.Scan(&we.WorkoutID, &we.ExerciseID, &we.Sets, &we.Reps, &we.Weight, &we.Order); err != nil {
+		var cycleStart sql.NullTime
+		if err := rows.Scan(&we.WorkoutID, &we.ExerciseID, &we.Sets, &we.Reps, &we.Weight, &we.Duration, &we.Distance, &we.Order,
+			&we.Progression, &we.RepsMin, &we.RepsMax, &we.TargetRPE, &we.TrainingMax, &cycleStart); err != nil {
 			return nil, err
 		}
+		if cycleStart.Valid {
+			we.CycleStart = &cycleStart.Time
+		}
 		workoutExercises = append(workoutExercises, we)
 	}
 
@@ -71,22 +144,60 @@ func AddExerciseToWorkout(db *sql.DB, we WorkoutExercise) error {
 	// Set the order to be one more than the highest current order
 	we.Order = maxOrder + 1
 
-	query := "INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, weight, exercise_order) VALUES (?, ?, ?, ?, ?, ?)"
-	_, err = db.Exec(query, we.WorkoutID, we.ExerciseID, we.Sets, we.Reps, we.Weight, we.Order)
+	query := `
+	INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, weight, duration_seconds, distance_meters, exercise_order,
+		progression, reps_min, reps_max, target_rpe, training_max, cycle_start)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_DATE))`
+	_, err = db.Exec(query, we.WorkoutID, we.ExerciseID, we.Sets, we.Reps, we.Weight, we.Duration, we.Distance, we.Order,
+		we.Progression, we.RepsMin, we.RepsMax, we.TargetRPE, we.TrainingMax, we.CycleStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = RecordWorkoutVersion(db, we.WorkoutID)
 	return err
 }
 
 // UpdateWorkoutExercise updates the details of an exercise in a workout
 func UpdateWorkoutExercise(db *sql.DB, we WorkoutExercise) error {
-	query := "UPDATE workout_exercises SET sets = ?, reps = ?, weight = ? WHERE workout_id = ? AND exercise_id = ?"
-	_, err := db.Exec(query, we.Sets, we.Reps, we.Weight, we.WorkoutID, we.ExerciseID)
+	query := `
+	UPDATE workout_exercises
+	SET sets = ?, reps = ?, weight = ?, duration_seconds = ?, distance_meters = ?,
+		progression = ?, reps_min = ?, reps_max = ?, target_rpe = ?, training_max = ?, cycle_start = COALESCE(?, cycle_start)
+	WHERE workout_id = ? AND exercise_id = ?`
+	_, err := db.Exec(query, we.Sets, we.Reps, we.Weight, we.Duration, we.Distance,
+		we.Progression, we.RepsMin, we.RepsMax, we.TargetRPE, we.TrainingMax, we.CycleStart, we.WorkoutID, we.ExerciseID)
+	if err != nil {
+		return err
+	}
+
+	_, err = RecordWorkoutVersion(db, we.WorkoutID)
 	return err
 }
 
+// GetWorkoutExercise retrieves a single entry of a workout
+func GetWorkoutExercise(db *sql.DB, workoutID, exerciseID int) (WorkoutExercise, error) {
+	workoutExercises, err := GetWorkoutExercises(db, workoutID)
+	if err != nil {
+		return WorkoutExercise{}, err
+	}
+
+	for _, we := range workoutExercises {
+		if we.ExerciseID == exerciseID {
+			return we, nil
+		}
+	}
+	return WorkoutExercise{}, sql.ErrNoRows
+}
+
 // RemoveExerciseFromWorkout removes an exercise from a workout
 func RemoveExerciseFromWorkout(db *sql.DB, workoutID, exerciseID int) error {
 	query := "DELETE FROM workout_exercises WHERE workout_id = ? AND exercise_id = ?"
-	_, err := db.Exec(query, workoutID, exerciseID)
+	if _, err := db.Exec(query, workoutID, exerciseID); err != nil {
+		return err
+	}
+
+	_, err := RecordWorkoutVersion(db, workoutID)
 	return err
 }
 
@@ -105,5 +216,10 @@ func ReorderWorkoutExercises(db *sql.DB, workoutID int, exerciseIDs []int) error
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	_, err = RecordWorkoutVersion(db, workoutID)
+	return err
 }
\ No newline at end of file
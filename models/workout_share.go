@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// WorkoutShare grants a user read-only access to another user's workout
+type WorkoutShare struct {
+	WorkoutID int       `json:"workout_id"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWorkoutShareTable creates the workout_shares table if it doesn't exist
+func CreateWorkoutShareTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS workout_shares (
+		workout_id INT NOT NULL,
+		user_id INT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (workout_id, user_id),
+		INDEX idx_workout_shares_user (user_id),
+		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	_, err := db.Exec(query)
+	return err
+}
+
+// CanViewWorkout reports whether a user may read a workout: its owner, anyone
+// for a public workout, or a user it was shared with
+func CanViewWorkout(db *sql.DB, workout Workout, userID int) (bool, error) {
+	if workout.UserID == userID || workout.Visibility == VisibilityPublic {
+		return true, nil
+	}
+
+	var count int
+	query := "SELECT COUNT(*) FROM workout_shares WHERE workout_id = ? AND user_id = ?"
+	if err := db.QueryRow(query, workout.ID, userID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// PublishWorkout makes a workout public and returns its share token, keeping
+// the existing token if it was already published
+func PublishWorkout(db *sql.DB, workoutID int) (string, error) {
+	var token sql.NullString
+	if err := db.QueryRow("SELECT share_token FROM workouts WHERE id = ?", workoutID).Scan(&token); err != nil {
+		return "", err
+	}
+	if token.Valid {
+		return token.String, nil
+	}
+
+	newShareToken, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	query := "UPDATE workouts SET visibility = ?, share_token = ? WHERE id = ?"
+	if _, err := db.Exec(query, VisibilityPublic, newShareToken, workoutID); err != nil {
+		return "", err
+	}
+	return newShareToken, nil
+}
+
+// UnpublishWorkout makes a workout private again and revokes its share link
+func UnpublishWorkout(db *sql.DB, workoutID int) error {
+	query := "UPDATE workouts SET visibility = ?, share_token = NULL WHERE id = ?"
+	_, err := db.Exec(query, VisibilityPrivate, workoutID)
+	return err
+}
+
+// GetWorkoutByShareToken retrieves a public workout by its share token
+func GetWorkoutByShareToken(db *sql.DB, token string) (Workout, error) {
+	query := workoutSelect + " AND share_token = ? AND visibility = ?"
+	return scanWorkout(db.QueryRow(query, token, VisibilityPublic))
+}
+
+// GetWorkoutShares retrieves the users a workout is shared with
+func GetWorkoutShares(db *sql.DB, workoutID int) ([]WorkoutShare, error) {
+	query := "SELECT workout_id, user_id, created_at FROM workout_shares WHERE workout_id = ? ORDER BY created_at"
+	rows, err := db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []WorkoutShare{}
+	for rows.Next() {
+		var share WorkoutShare
+		if err := rows.Scan(&share.WorkoutID, &share.UserID, &share.CreatedAt); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// ShareWorkout shares a workout with a user. Sharing twice is a no-op.
+func ShareWorkout(db *sql.DB, workoutID, userID int) error {
+	query := "INSERT IGNORE INTO workout_shares (workout_id, user_id) VALUES (?, ?)"
+	_, err := db.Exec(query, workoutID, userID)
+	return err
+}
+
+// UnshareWorkout revokes a user's access to a workout
+func UnshareWorkout(db *sql.DB, workoutID, userID int) error {
+	query := "DELETE FROM workout_shares WHERE workout_id = ? AND user_id = ?"
+	_, err := db.Exec(query, workoutID, userID)
+	return err
+}
+
+// GetWorkoutsSharedWith retrieves the workouts shared with a user
+func GetWorkoutsSharedWith(db *sql.DB, userID int) ([]Workout, error) {
+	query := workoutSelect + " AND id IN (SELECT workout_id FROM workout_shares WHERE user_id = ?) ORDER BY name"
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []Workout{}
+	for rows.Next() {
+		workout, err := scanWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, workout)
+	}
+
+	return workouts, rows.Err()
+}
+
+// CloneWorkout deep-copies a workout and all its exercise entries into a
+// user's account. The copy is private and records the source in forked_from.
+func CloneWorkout(db *sql.DB, sourceID, userID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+	INSERT INTO workouts (name, description, user_id, forked_from)
+	SELECT name, description, ?, id FROM workouts WHERE id = ? AND deleted_at IS NULL`, userID, sourceID)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, weight, duration_seconds, distance_meters,
+		exercise_order, progression, reps_min, reps_max, target_rpe, training_max, cycle_start)
+	SELECT ?, exercise_id, sets, reps, weight, duration_seconds, distance_meters,
+		exercise_order, progression, reps_min, reps_max, target_rpe, training_max, CURRENT_DATE
+	FROM workout_exercises
+	WHERE workout_id = ? AND exercise_id IN (SELECT id FROM exercises WHERE deleted_at IS NULL)`, id, sourceID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	_, err = RecordWorkoutVersion(db, int(id))
+	return int(id), err
+}
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// WorkoutVersion is a snapshot of a workout's structure. A new version is
+// recorded whenever the name, description, entries, order or prescriptions
+// change.
+type WorkoutVersion struct {
+	WorkoutID   int               `json:"workout_id"`
+	Version     int               `json:"version"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Entries     []WorkoutExercise `json:"entries"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// FieldChange is a value before and after a change
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// EntryChange lists the changed prescription fields of an entry
+type EntryChange struct {
+	ExerciseID int                    `json:"exercise_id"`
+	Fields     map[string]FieldChange `json:"fields"`
+}
+
+// WorkoutDiff is the structured difference between two workout versions.
+// Order lists exercise IDs before and after when entries were reordered.
+type WorkoutDiff struct {
+	From        int               `json:"from"`
+	To          int               `json:"to"`
+	Name        *FieldChange      `json:"name,omitempty"`
+	Description *FieldChange      `json:"description,omitempty"`
+	Added       []WorkoutExercise `json:"added"`
+	Removed     []WorkoutExercise `json:"removed"`
+	Changed     []EntryChange     `json:"changed"`
+	Order       *FieldChange      `json:"order,omitempty"`
+}
+
+// CreateWorkoutVersionTable creates the workout_versions table if it doesn't
+// exist and records a first version of workouts created before versioning
+func CreateWorkoutVersionTable(db *sql.DB) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS workout_versions (
+		workout_id INT NOT NULL,
+		version INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		description TEXT,
+		entries JSON NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (workout_id, version),
+		FOREIGN KEY (workout_id) REFERENCES workouts(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(query); err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT id FROM workouts WHERE deleted_at IS NULL AND id NOT IN (SELECT workout_id FROM workout_versions)")
+	if err != nil {
+		return err
+	}
+	var unversioned []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		unversioned = append(unversioned, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range unversioned {
+		if _, err := RecordWorkoutVersion(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordWorkoutVersion snapshots a workout's current structure as a new
+// version, unless it is unchanged since the latest version. It returns the
+// current version number.
+func RecordWorkoutVersion(db *sql.DB, workoutID int) (int, error) {
+	workout, err := GetWorkout(db, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := GetWorkoutExercises(db, workoutID)
+	if err != nil {
+		return 0, err
+	}
+	if entries == nil {
+		entries = []WorkoutExercise{}
+	}
+	encoded, err := json.Marshal(entries)
+	if err != nil {
+		return 0, err
+	}
+
+	latest, err := GetLatestWorkoutVersion(db, workoutID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	if err == nil && latest.Name == workout.Name && latest.Description == workout.Description {
+		previous, err := json.Marshal(latest.Entries)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(previous, encoded) {
+			return latest.Version, nil
+		}
+	}
+
+	query := `
+	INSERT INTO workout_versions (workout_id, version, name, description, entries)
+	VALUES (?, ?, ?, ?, ?)`
+	if _, err := db.Exec(query, workoutID, latest.Version+1, workout.Name, workout.Description, encoded); err != nil {
+		return 0, err
+	}
+	return latest.Version + 1, nil
+}
+
+// CurrentWorkoutVersion returns the latest version number of a workout, or 0
+// if it has none
+func CurrentWorkoutVersion(db *sql.DB, workoutID int) (int, error) {
+	var version int
+	err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM workout_versions WHERE workout_id = ?", workoutID).Scan(&version)
+	return version, err
+}
+
+// workoutVersionSelect selects the columns scanned by scanWorkoutVersion
+const workoutVersionSelect = "SELECT workout_id, version, name, COALESCE(description, ''), entries, created_at FROM workout_versions"
+
+// scanWorkoutVersion scans a version selected with workoutVersionSelect
+func scanWorkoutVersion(row interface{ Scan(...interface{}) error }) (WorkoutVersion, error) {
+	var v WorkoutVersion
+	var entries []byte
+	if err := row.Scan(&v.WorkoutID, &v.Version, &v.Name, &v.Description, &entries, &v.CreatedAt); err != nil {
+		return v, err
+	}
+	return v, json.Unmarshal(entries, &v.Entries)
+}
+
+// GetWorkoutVersions retrieves all versions of a workout, newest first
+func GetWorkoutVersions(db *sql.DB, workoutID int) ([]WorkoutVersion, error) {
+	rows, err := db.Query(workoutVersionSelect+" WHERE workout_id = ? ORDER BY version DESC", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []WorkoutVersion{}
+	for rows.Next() {
+		v, err := scanWorkoutVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetWorkoutVersion retrieves one version of a workout
+func GetWorkoutVersion(db *sql.DB, workoutID, version int) (WorkoutVersion, error) {
+	return scanWorkoutVersion(db.QueryRow(workoutVersionSelect+" WHERE workout_id = ? AND version = ?", workoutID, version))
+}
+
+// GetLatestWorkoutVersion retrieves the newest version of a workout
+func GetLatestWorkoutVersion(db *sql.DB, workoutID int) (WorkoutVersion, error) {
+	return scanWorkoutVersion(db.QueryRow(workoutVersionSelect+" WHERE workout_id = ? ORDER BY version DESC LIMIT 1", workoutID))
+}
+
+// RestoreWorkoutVersion puts a workout back to an earlier version. The
+// restore is itself recorded as a new version, which is returned.
+func RestoreWorkoutVersion(db *sql.DB, v WorkoutVersion) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE workouts SET name = ?, description = ? WHERE id = ?", v.Name, v.Description, v.WorkoutID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM workout_exercises WHERE workout_id = ?", v.WorkoutID); err != nil {
+		return 0, err
+	}
+	for _, we := range v.Entries {
+		_, err := tx.Exec(`
+		INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, weight, duration_seconds, distance_meters,
+			exercise_order, progression, reps_min, reps_max, target_rpe, training_max, cycle_start)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_DATE))`, v.WorkoutID, we.ExerciseID, we.Sets, we.Reps, we.Weight,
+			we.Duration, we.Distance, we.Order, we.Progression, we.RepsMin, we.RepsMax, we.TargetRPE, we.TrainingMax, we.CycleStart)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return RecordWorkoutVersion(db, v.WorkoutID)
+}
+
+// DiffWorkoutVersions compares two versions of a workout
+func DiffWorkoutVersions(from, to WorkoutVersion) WorkoutDiff {
+	diff := WorkoutDiff{
+		From:    from.Version,
+		To:      to.Version,
+		Added:   []WorkoutExercise{},
+		Removed: []WorkoutExercise{},
+		Changed: []EntryChange{},
+	}
+
+	if from.Name != to.Name {
+		diff.Name = &FieldChange{From: from.Name, To: to.Name}
+	}
+	if from.Description != to.Description {
+		diff.Description = &FieldChange{From: from.Description, To: to.Description}
+	}
+
+	before := make(map[int]WorkoutExercise)
+	for _, we := range from.Entries {
+		before[we.ExerciseID] = we
+	}
+	after := make(map[int]bool)
+	for _, we := range to.Entries {
+		after[we.ExerciseID] = true
+		old, ok := before[we.ExerciseID]
+		if !ok {
+			diff.Added = append(diff.Added, we)
+			continue
+		}
+		if fields := prescriptionChanges(old, we); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, EntryChange{ExerciseID: we.ExerciseID, Fields: fields})
+		}
+	}
+	for _, we := range from.Entries {
+		if !after[we.ExerciseID] {
+			diff.Removed = append(diff.Removed, we)
+		}
+	}
+
+	// Compare the order of the entries present in both versions
+	var fromOrder, toOrder []int
+	for _, we := range from.Entries {
+		if after[we.ExerciseID] {
+			fromOrder = append(fromOrder, we.ExerciseID)
+		}
+	}
+	for _, we := range to.Entries {
+		if _, ok := before[we.ExerciseID]; ok {
+			toOrder = append(toOrder, we.ExerciseID)
+		}
+	}
+	for i := range fromOrder {
+		if fromOrder[i] != toOrder[i] {
+			diff.Order = &FieldChange{From: fromOrder, To: toOrder}
+			break
+		}
+	}
+
+	return diff
+}
+
+// prescriptionChanges lists the prescription fields that differ between two
+// versions of an entry
+func prescriptionChanges(a, b WorkoutExercise) map[string]FieldChange {
+	fields := make(map[string]FieldChange)
+	compare := func(name string, from, to interface{}) {
+		if from != to {
+			fields[name] = FieldChange{From: from, To: to}
+		}
+	}
+	compare("sets", a.Sets, b.Sets)
+	compare("reps", a.Reps, b.Reps)
+	compare("weight", a.Weight, b.Weight)
+	compare("duration", a.Duration, b.Duration)
+	compare("distance", a.Distance, b.Distance)
+	compare("progression", a.Progression, b.Progression)
+	compare("reps_min", a.RepsMin, b.RepsMin)
+	compare("reps_max", a.RepsMax, b.RepsMax)
+	compare("target_rpe", a.TargetRPE, b.TargetRPE)
+	compare("training_max", a.TrainingMax, b.TrainingMax)
+	return fields
+}
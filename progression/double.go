@@ -0,0 +1,62 @@
+package progression
+
+import "fmt"
+
+// Double progresses reps within a range at a fixed load, then adds load and
+// returns to the bottom of the range once every set reaches the top. With no
+// increment, as for unloaded exercises, it holds at the top of the range.
+type Double struct{}
+
+// Name returns the strategy's name
+func (Double) Name() string { return "double" }
+
+// Next computes the next prescription
+func (Double) Next(current Prescription, history []Entry, params Params) Result {
+	result := Result{Strategy: "double", Prescription: current}
+
+	repsMin, repsMax := params.RepsMin, params.RepsMax
+	if repsMin == 0 {
+		repsMin = current.Reps
+	}
+	if repsMax < repsMin {
+		repsMax = repsMin
+	}
+
+	session := lastSession(history)
+	if len(session) == 0 {
+		result.Explanation = fmt.Sprintf("No sessions logged yet; work up from %d reps towards %d.", repsMin, repsMax)
+		return result
+	}
+
+	// The lowest rep count over the working sets decides progress
+	lowest, sets := 0, 0
+	for _, entry := range session {
+		if entry.Weight+1e-9 < current.Weight {
+			continue
+		}
+		if sets == 0 || entry.Reps < lowest {
+			lowest = entry.Reps
+		}
+		sets += entry.Sets
+	}
+
+	switch {
+	case sets >= current.Sets && lowest >= repsMax && params.Increment <= 0:
+		result.Prescription.Reps = repsMax
+		result.Explanation = fmt.Sprintf("Every set reached the top of the %d-%d range with no load to add, so hold %d reps or move to a harder variation.",
+			repsMin, repsMax, repsMax)
+	case sets >= current.Sets && lowest >= repsMax:
+		result.Prescription.Weight = roundTo(current.Weight+params.Increment, params.Increment)
+		result.Prescription.Reps = repsMin
+		result.Explanation = fmt.Sprintf("Every set reached the top of the %d-%d range at %g, so add %g and start again at %d reps.",
+			repsMin, repsMax, current.Weight, params.Increment, repsMin)
+	case sets >= current.Sets && lowest >= current.Reps:
+		result.Prescription.Reps = min(lowest+1, repsMax)
+		result.Explanation = fmt.Sprintf("All sets reached %d reps at %g, so aim for %d reps next.",
+			lowest, current.Weight, result.Prescription.Reps)
+	default:
+		result.Explanation = fmt.Sprintf("Not every set reached %d reps at %g, so repeat the target.", current.Reps, current.Weight)
+	}
+
+	return result
+}
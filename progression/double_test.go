@@ -0,0 +1,97 @@
+package progression
+
+import "testing"
+
+func TestDoubleNext(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    Prescription
+		params     Params
+		history    []Entry
+		wantReps   int
+		wantWeight float64
+	}{
+		{
+			name:       "first session",
+			current:    Prescription{Sets: 3, Reps: 8, Weight: 50},
+			params:     Params{Increment: 2.5, RepsMin: 8, RepsMax: 12},
+			wantReps:   8,
+			wantWeight: 50,
+		},
+		{
+			name:       "adds a rep",
+			current:    Prescription{Sets: 3, Reps: 10, Weight: 50},
+			params:     Params{Increment: 2.5, RepsMin: 8, RepsMax: 12},
+			history:    []Entry{{Date: day(0), Sets: 3, Reps: 10, Weight: 50}},
+			wantReps:   11,
+			wantWeight: 50,
+		},
+		{
+			name:    "lowest set decides",
+			current: Prescription{Sets: 3, Reps: 10, Weight: 50},
+			params:  Params{Increment: 2.5, RepsMin: 8, RepsMax: 12},
+			history: []Entry{
+				{Date: day(0), Sets: 2, Reps: 12, Weight: 50},
+				{Date: day(0), Sets: 1, Reps: 11, Weight: 50},
+			},
+			wantReps:   12,
+			wantWeight: 50,
+		},
+		{
+			name:       "adds load at the top of the range",
+			current:    Prescription{Sets: 3, Reps: 12, Weight: 50},
+			params:     Params{Increment: 2.5, RepsMin: 8, RepsMax: 12},
+			history:    []Entry{{Date: day(0), Sets: 3, Reps: 12, Weight: 50}},
+			wantReps:   8,
+			wantWeight: 52.5,
+		},
+		{
+			name:    "missed reps repeat the target",
+			current: Prescription{Sets: 3, Reps: 10, Weight: 50},
+			params:  Params{Increment: 2.5, RepsMin: 8, RepsMax: 12},
+			history: []Entry{
+				{Date: day(0), Sets: 2, Reps: 10, Weight: 50},
+				{Date: day(0), Sets: 1, Reps: 8, Weight: 50},
+			},
+			wantReps:   10,
+			wantWeight: 50,
+		},
+		{
+			name:       "missed sets repeat the target",
+			current:    Prescription{Sets: 3, Reps: 10, Weight: 50},
+			params:     Params{Increment: 2.5, RepsMin: 8, RepsMax: 12},
+			history:    []Entry{{Date: day(0), Sets: 2, Reps: 10, Weight: 50}},
+			wantReps:   10,
+			wantWeight: 50,
+		},
+		{
+			name:       "holds at the top without load",
+			current:    Prescription{Sets: 3, Reps: 15},
+			params:     Params{RepsMin: 10, RepsMax: 15},
+			history:    []Entry{{Date: day(0), Sets: 3, Reps: 15}},
+			wantReps:   15,
+			wantWeight: 0,
+		},
+		{
+			name:       "range defaults to the prescribed reps",
+			current:    Prescription{Sets: 3, Reps: 8, Weight: 50},
+			params:     Params{Increment: 2.5},
+			history:    []Entry{{Date: day(0), Sets: 3, Reps: 8, Weight: 50}},
+			wantReps:   8,
+			wantWeight: 52.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Double{}.Next(tt.current, tt.history, tt.params)
+			if got.Prescription.Reps != tt.wantReps || got.Prescription.Weight != tt.wantWeight {
+				t.Errorf("got %d reps at %g, want %d at %g (%s)",
+					got.Prescription.Reps, got.Prescription.Weight, tt.wantReps, tt.wantWeight, got.Explanation)
+			}
+			if got.Prescription.Sets != tt.current.Sets {
+				t.Errorf("sets = %d, want %d", got.Prescription.Sets, tt.current.Sets)
+			}
+		})
+	}
+}
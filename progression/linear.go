@@ -0,0 +1,53 @@
+package progression
+
+import "fmt"
+
+// failuresBeforeDeload is how many missed sessions in a row trigger a deload
+const failuresBeforeDeload = 3
+
+// linearDeload is the fraction of the load kept after a deload
+const linearDeload = 0.9
+
+// Linear adds the increment after every session where all sets and reps were
+// completed, and deloads by 10% after three missed sessions in a row
+type Linear struct{}
+
+// Name returns the strategy's name
+func (Linear) Name() string { return "linear" }
+
+// Next computes the next prescription
+func (Linear) Next(current Prescription, history []Entry, params Params) Result {
+	result := Result{Strategy: "linear", Prescription: current}
+
+	days := sessions(history)
+	if len(days) == 0 {
+		result.Explanation = "No sessions logged yet, so the current prescription stays."
+		return result
+	}
+
+	if completed(days[0], current) {
+		result.Prescription.Weight = roundTo(current.Weight+params.Increment, params.Increment)
+		result.Explanation = fmt.Sprintf("All %d×%d at %g were completed last session, so the load goes up by %g.",
+			current.Sets, current.Reps, current.Weight, params.Increment)
+		return result
+	}
+
+	misses := 0
+	for _, day := range days {
+		if completed(day, current) || misses == failuresBeforeDeload {
+			break
+		}
+		misses++
+	}
+
+	if misses >= failuresBeforeDeload {
+		result.Prescription.Weight = roundTo(current.Weight*linearDeload, params.Increment)
+		result.Explanation = fmt.Sprintf("%d×%d at %g was missed %d sessions in a row, so the load drops 10%% to rebuild.",
+			current.Sets, current.Reps, current.Weight, misses)
+		return result
+	}
+
+	result.Explanation = fmt.Sprintf("%d×%d at %g wasn't completed last session (%d miss in a row), so repeat it.",
+		current.Sets, current.Reps, current.Weight, misses)
+	return result
+}
@@ -0,0 +1,59 @@
+package progression
+
+import (
+	"testing"
+	"time"
+)
+
+// day returns a session date n days before a fixed reference day
+func day(n int) time.Time {
+	return time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -n)
+}
+
+func TestLinearNext(t *testing.T) {
+	current := Prescription{Sets: 3, Reps: 5, Weight: 100}
+	params := Params{Increment: 2.5}
+
+	tests := []struct {
+		name    string
+		history []Entry
+		want    float64
+	}{
+		{"first session", nil, 100},
+		{"completed", []Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 100}}, 102.5},
+		{"completed over several entries", []Entry{
+			{Date: day(0), Sets: 2, Reps: 5, Weight: 100},
+			{Date: day(0), Sets: 1, Reps: 6, Weight: 100},
+		}, 102.5},
+		{"too light", []Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 95}}, 100},
+		{"one miss", []Entry{
+			{Date: day(0), Sets: 3, Reps: 4, Weight: 100},
+			{Date: day(2), Sets: 3, Reps: 5, Weight: 100},
+		}, 100},
+		{"two misses", []Entry{
+			{Date: day(0), Sets: 3, Reps: 4, Weight: 100},
+			{Date: day(2), Sets: 2, Reps: 5, Weight: 100},
+			{Date: day(4), Sets: 3, Reps: 5, Weight: 100},
+		}, 100},
+		{"deload after three misses", []Entry{
+			{Date: day(0), Sets: 3, Reps: 4, Weight: 100},
+			{Date: day(2), Sets: 3, Reps: 3, Weight: 100},
+			{Date: day(4), Sets: 2, Reps: 5, Weight: 100},
+		}, 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Linear{}.Next(current, tt.history, params)
+			if got.Prescription.Weight != tt.want {
+				t.Errorf("weight = %g, want %g (%s)", got.Prescription.Weight, tt.want, got.Explanation)
+			}
+			if got.Prescription.Sets != 3 || got.Prescription.Reps != 5 {
+				t.Errorf("sets×reps = %d×%d, want 3×5", got.Prescription.Sets, got.Prescription.Reps)
+			}
+			if got.Strategy != "linear" || got.Explanation == "" {
+				t.Errorf("strategy %q with explanation %q", got.Strategy, got.Explanation)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package progression computes next-session targets from recent training.
+// Strategies work on plain values and never touch the database, so they can
+// be exercised in isolation. All loads are in the lifter's own unit, which
+// keeps rounding to their plate increment exact.
+package progression
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Entry is one logged entry of the exercise
+type Entry struct {
+	Date   time.Time
+	Sets   int
+	Reps   int
+	Weight float64
+	RPE    float64 // 0 if not logged
+}
+
+// Prescription is a target for one exercise in a session
+type Prescription struct {
+	Sets   int     `json:"sets"`
+	Reps   int     `json:"reps"`
+	Weight float64 `json:"weight"`
+	RPE    float64 `json:"rpe,omitempty"`
+}
+
+// Params configures a strategy. Increment is the load jump used when
+// progressing and the increment loads are rounded to. CycleStart is the day
+// the current training max took effect; cyclic strategies only count the
+// sessions since then, or all of them when it is zero.
+type Params struct {
+	Increment   float64
+	RepsMin     int
+	RepsMax     int
+	TargetRPE   float64
+	TrainingMax float64
+	CycleStart  time.Time
+}
+
+// Result is a strategy's next prescription with an explanation of why
+type Result struct {
+	Strategy     string         `json:"strategy"`
+	Prescription Prescription   `json:"prescription"`
+	Sets         []Prescription `json:"sets,omitempty"` // per-set targets when they differ
+	Explanation  string         `json:"explanation"`
+
+	// TrainingMax is the training max the prescription was based on, if any
+	TrainingMax float64 `json:"training_max,omitempty"`
+}
+
+// Strategy produces the next prescription from the current one and the
+// exercise's history, newest entries first
+type Strategy interface {
+	Name() string
+	Next(current Prescription, history []Entry, params Params) Result
+}
+
+var strategies = map[string]Strategy{}
+
+// Register makes a strategy available by name
+func Register(s Strategy) {
+	strategies[s.Name()] = s
+}
+
+// Get returns the strategy registered under name
+func Get(name string) (Strategy, bool) {
+	s, ok := strategies[name]
+	return s, ok
+}
+
+// Names returns the names of all registered strategies, sorted
+func Names() []string {
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register(Linear{})
+	Register(Double{})
+	Register(RPE{})
+	Register(Wave{})
+}
+
+// lastSession returns the entries of the most recent day in history
+func lastSession(history []Entry) []Entry {
+	if len(history) == 0 {
+		return nil
+	}
+
+	var session []Entry
+	day := history[0].Date.Format("2006-01-02")
+	for _, entry := range history {
+		if entry.Date.Format("2006-01-02") != day {
+			break
+		}
+		session = append(session, entry)
+	}
+	return session
+}
+
+// sessions splits history into days, newest first
+func sessions(history []Entry) [][]Entry {
+	var days [][]Entry
+	for len(history) > 0 {
+		session := lastSession(history)
+		days = append(days, session)
+		history = history[len(session):]
+	}
+	return days
+}
+
+// since returns the entries of history on or after day, which is newest
+// first, or all of them when day is zero
+func since(history []Entry, day time.Time) []Entry {
+	if day.IsZero() {
+		return history
+	}
+	for i, entry := range history {
+		if entry.Date.Before(day) {
+			return history[:i]
+		}
+	}
+	return history
+}
+
+// completed reports whether a session hit the prescription: enough sets of
+// at least the prescribed reps at no less than the prescribed load
+func completed(session []Entry, target Prescription) bool {
+	sets := 0
+	for _, entry := range session {
+		if entry.Weight+1e-9 >= target.Weight && entry.Reps >= target.Reps {
+			sets += entry.Sets
+		}
+	}
+	return sets >= target.Sets
+}
+
+// roundTo rounds a load to the nearest increment
+func roundTo(weight, increment float64) float64 {
+	if increment <= 0 {
+		return math.Round(weight*10) / 10
+	}
+	return math.Round(math.Round(weight/increment)*increment*10) / 10
+}
+
+// epley estimates a one-rep max
+func epley(weight float64, reps float64) float64 {
+	if reps <= 1 {
+		return weight
+	}
+	return weight * (1 + reps/30)
+}
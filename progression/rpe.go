@@ -0,0 +1,56 @@
+package progression
+
+import (
+	"fmt"
+	"math"
+)
+
+// RPE autoregulates the load: it estimates a one-rep max from the last set
+// logged with an RPE, counting reps in reserve, and picks the load that
+// should land on the target RPE for the prescribed reps
+type RPE struct{}
+
+// Name returns the strategy's name
+func (RPE) Name() string { return "rpe" }
+
+// Next computes the next prescription
+func (RPE) Next(current Prescription, history []Entry, params Params) Result {
+	result := Result{Strategy: "rpe", Prescription: current}
+
+	target := params.TargetRPE
+	if target == 0 {
+		target = current.RPE
+	}
+	if target == 0 {
+		target = 8
+	}
+	result.Prescription.RPE = target
+
+	var last *Entry
+	for i := range history {
+		if history[i].RPE > 0 && history[i].Weight > 0 {
+			last = &history[i]
+			break
+		}
+	}
+	if last == nil {
+		result.Explanation = fmt.Sprintf("No set has been logged with an RPE yet; work up to RPE %g for %d reps.", target, current.Reps)
+		return result
+	}
+
+	// A set at RPE r left 10 - r reps in reserve
+	e1rm := epley(last.Weight, float64(last.Reps)+10-last.RPE)
+	weight := e1rm / (1 + (float64(current.Reps)+10-target)/30)
+	result.Prescription.Weight = roundTo(weight, params.Increment)
+
+	change := "stays the same"
+	switch {
+	case result.Prescription.Weight > current.Weight:
+		change = "goes up"
+	case result.Prescription.Weight < current.Weight:
+		change = "comes down"
+	}
+	result.Explanation = fmt.Sprintf("%d reps at %g felt like RPE %g, an estimated max of %g. Hitting RPE %g for %d reps needs about %g, so the load %s.",
+		last.Reps, last.Weight, last.RPE, math.Round(e1rm*10)/10, target, current.Reps, result.Prescription.Weight, change)
+	return result
+}
@@ -0,0 +1,41 @@
+package progression
+
+import "testing"
+
+func TestRPENext(t *testing.T) {
+	current := Prescription{Sets: 3, Reps: 5, Weight: 100}
+
+	tests := []struct {
+		name       string
+		params     Params
+		history    []Entry
+		wantWeight float64
+		wantRPE    float64
+	}{
+		{"first session", Params{Increment: 2.5, TargetRPE: 8}, nil, 100, 8},
+		{"no set with an RPE", Params{Increment: 2.5, TargetRPE: 8},
+			[]Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 100}}, 100, 8},
+		{"on target", Params{Increment: 2.5, TargetRPE: 8},
+			[]Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 100, RPE: 8}}, 100, 8},
+		{"too hard", Params{Increment: 2.5, TargetRPE: 8},
+			[]Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 100, RPE: 9}}, 97.5, 8},
+		{"too easy", Params{Increment: 2.5, TargetRPE: 8},
+			[]Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 100, RPE: 7}}, 102.5, 8},
+		{"latest set with an RPE decides", Params{Increment: 2.5, TargetRPE: 8}, []Entry{
+			{Date: day(0), Sets: 3, Reps: 5, Weight: 105},
+			{Date: day(2), Sets: 3, Reps: 5, Weight: 100, RPE: 7},
+		}, 102.5, 8},
+		{"target defaults to 8", Params{Increment: 2.5},
+			[]Entry{{Date: day(0), Sets: 3, Reps: 5, Weight: 100, RPE: 8}}, 100, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RPE{}.Next(current, tt.history, tt.params)
+			if got.Prescription.Weight != tt.wantWeight || got.Prescription.RPE != tt.wantRPE {
+				t.Errorf("got %g at RPE %g, want %g at RPE %g (%s)",
+					got.Prescription.Weight, got.Prescription.RPE, tt.wantWeight, tt.wantRPE, got.Explanation)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package progression
+
+import (
+	"fmt"
+	"math"
+)
+
+// waveWeek is one week of a 5/3/1 cycle: the percentage of the training max
+// and the reps of each working set
+type waveWeek struct {
+	name     string
+	percents [3]float64
+	reps     [3]int
+}
+
+var waveCycle = []waveWeek{
+	{"5s week", [3]float64{65, 75, 85}, [3]int{5, 5, 5}},
+	{"3s week", [3]float64{70, 80, 90}, [3]int{3, 3, 3}},
+	{"5/3/1 week", [3]float64{75, 85, 95}, [3]int{5, 3, 1}},
+	{"deload week", [3]float64{40, 50, 60}, [3]int{5, 5, 5}},
+}
+
+// trainingMaxFraction is the share of the estimated max used as training max
+const trainingMaxFraction = 0.9
+
+// Wave runs 5/3/1-style percentage waves: three working sets at rising
+// percentages of a training max over a four-week cycle, with the training
+// max raised by the increment after each cycle
+type Wave struct{}
+
+// Name returns the strategy's name
+func (Wave) Name() string { return "wave531" }
+
+// Next computes the next prescription. Each session logged since the cycle
+// start advances the cycle by one week.
+func (Wave) Next(current Prescription, history []Entry, params Params) Result {
+	result := Result{Strategy: "wave531"}
+
+	trainingMax := params.TrainingMax
+	source := "the configured training max"
+	if trainingMax == 0 {
+		// Estimate one from the best set logged so far
+		for _, entry := range history {
+			trainingMax = math.Max(trainingMax, epley(entry.Weight, float64(entry.Reps))*trainingMaxFraction)
+		}
+		source = "90% of the best estimated max"
+	}
+	if trainingMax == 0 {
+		result.Prescription = current
+		result.Explanation = "No training max is set and no sets have been logged, so the current prescription stays."
+		return result
+	}
+
+	done := len(sessions(since(history, params.CycleStart)))
+	cycles := done / len(waveCycle)
+	week := waveCycle[done%len(waveCycle)]
+
+	// The configured training max is raised once per completed cycle
+	if params.TrainingMax > 0 {
+		trainingMax += float64(cycles) * params.Increment
+	}
+	result.TrainingMax = math.Round(trainingMax*10) / 10
+
+	for i := range week.percents {
+		result.Sets = append(result.Sets, Prescription{
+			Sets:   1,
+			Reps:   week.reps[i],
+			Weight: roundTo(trainingMax*week.percents[i]/100, params.Increment),
+		})
+	}
+	top := result.Sets[len(result.Sets)-1]
+	result.Prescription = Prescription{Sets: len(result.Sets), Reps: top.Reps, Weight: top.Weight}
+
+	result.Explanation = fmt.Sprintf("Session %d of the cycle is the %s: %g%%, %g%% and %g%% of a %g training max (%s).",
+		done%len(waveCycle)+1, week.name, week.percents[0], week.percents[1], week.percents[2], result.TrainingMax, source)
+	if cycles > 0 && params.TrainingMax > 0 {
+		result.Explanation += fmt.Sprintf(" The training max went up by %g for each of the %d completed cycles.", params.Increment, cycles)
+	}
+	return result
+}
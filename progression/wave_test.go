@@ -0,0 +1,109 @@
+package progression
+
+import "testing"
+
+func TestWaveNext(t *testing.T) {
+	// sessionsFrom returns one session every other day, newest first,
+	// starting n days before the reference day
+	sessionsFrom := func(count, n int) []Entry {
+		var history []Entry
+		for i := 0; i < count; i++ {
+			history = append(history, Entry{Date: day(n + 2*i), Sets: 3, Reps: 5, Weight: 80})
+		}
+		return history
+	}
+
+	tests := []struct {
+		name            string
+		params          Params
+		history         []Entry
+		wantSets        []float64
+		wantTopReps     int
+		wantTrainingMax float64
+	}{
+		{
+			name:            "first session",
+			params:          Params{Increment: 2.5, TrainingMax: 100},
+			wantSets:        []float64{65, 75, 85},
+			wantTopReps:     5,
+			wantTrainingMax: 100,
+		},
+		{
+			name:            "third week",
+			params:          Params{Increment: 2.5, TrainingMax: 100},
+			history:         sessionsFrom(2, 0),
+			wantSets:        []float64{75, 85, 95},
+			wantTopReps:     1,
+			wantTrainingMax: 100,
+		},
+		{
+			name:            "deload week",
+			params:          Params{Increment: 2.5, TrainingMax: 100},
+			history:         sessionsFrom(3, 0),
+			wantSets:        []float64{40, 50, 60},
+			wantTopReps:     5,
+			wantTrainingMax: 100,
+		},
+		{
+			name:            "next cycle raises the training max",
+			params:          Params{Increment: 2.5, TrainingMax: 100},
+			history:         sessionsFrom(4, 0),
+			wantSets:        []float64{67.5, 77.5, 87.5},
+			wantTopReps:     5,
+			wantTrainingMax: 102.5,
+		},
+		{
+			name:            "sessions before the cycle start don't count",
+			params:          Params{Increment: 2.5, TrainingMax: 100, CycleStart: day(1)},
+			history:         sessionsFrom(9, 0),
+			wantSets:        []float64{70, 80, 90},
+			wantTopReps:     3,
+			wantTrainingMax: 100,
+		},
+		{
+			name:            "new cycle with only old history",
+			params:          Params{Increment: 2.5, TrainingMax: 100, CycleStart: day(0).AddDate(0, 0, 1)},
+			history:         sessionsFrom(9, 0),
+			wantSets:        []float64{65, 75, 85},
+			wantTopReps:     5,
+			wantTrainingMax: 100,
+		},
+		{
+			name:            "estimated training max",
+			params:          Params{Increment: 2.5},
+			history:         []Entry{{Date: day(0), Sets: 1, Reps: 5, Weight: 100}},
+			wantSets:        []float64{72.5, 85, 95},
+			wantTopReps:     3,
+			wantTrainingMax: 105,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Wave{}.Next(Prescription{Sets: 3, Reps: 5, Weight: 80}, tt.history, tt.params)
+			if got.TrainingMax != tt.wantTrainingMax {
+				t.Errorf("training max = %g, want %g", got.TrainingMax, tt.wantTrainingMax)
+			}
+			if len(got.Sets) != len(tt.wantSets) {
+				t.Fatalf("got %d sets, want %d (%s)", len(got.Sets), len(tt.wantSets), got.Explanation)
+			}
+			for i, want := range tt.wantSets {
+				if got.Sets[i].Weight != want {
+					t.Errorf("set %d weight = %g, want %g (%s)", i+1, got.Sets[i].Weight, want, got.Explanation)
+				}
+			}
+			top := got.Prescription
+			if top.Sets != 3 || top.Reps != tt.wantTopReps || top.Weight != tt.wantSets[2] {
+				t.Errorf("prescription = %d×%d at %g, want 3×%d at %g", top.Sets, top.Reps, top.Weight, tt.wantTopReps, tt.wantSets[2])
+			}
+		})
+	}
+}
+
+func TestWaveNextWithoutTrainingMax(t *testing.T) {
+	current := Prescription{Sets: 3, Reps: 5, Weight: 80}
+	got := Wave{}.Next(current, nil, Params{Increment: 2.5})
+	if got.Prescription != current || len(got.Sets) != 0 {
+		t.Errorf("got %+v with sets %v, want the current prescription unchanged", got.Prescription, got.Sets)
+	}
+}
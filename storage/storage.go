@@ -0,0 +1,50 @@
+// Package storage keeps uploaded files such as progress photos outside the
+// database, on the local filesystem or in an S3-compatible bucket
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound is returned when an object doesn't exist
+var ErrNotFound = errors.New("object not found")
+
+// Store saves, reads and deletes objects by key. Keys are slash-separated
+// paths such as photos/12/abc.jpg.
+type Store interface {
+	// Put saves an object, replacing any object with the same key
+	Put(key string, data []byte, contentType string) error
+
+	// Open reads an object. The caller must close it.
+	Open(key string) (io.ReadCloser, error)
+
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(key string) error
+}
+
+// FromEnv opens the store chosen by STORAGE_BACKEND: local (the default),
+// which keeps files under STORAGE_PATH, or s3, configured by the S3_*
+// variables
+func FromEnv() (Store, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		path := os.Getenv("STORAGE_PATH")
+		if path == "" {
+			path = "data/storage"
+		}
+		return NewLocal(path)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}